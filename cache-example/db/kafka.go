@@ -67,7 +67,8 @@ func (h ConsumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cla
 }
 
 // NewKafkaServer 创建新的 Kafka 服务器实例
-func NewKafkaServer(brokers []string, topics []string, groupID string) *KafkaSever {
+// security 为 SASL 认证和 TLS 加密配置，零值表示使用明文连接
+func NewKafkaServer(brokers []string, topics []string, groupID string, security KafkaSecurity) *KafkaSever {
 	log.Printf("Initializing Kafka server with brokers: %v, topics: %v, groupID: %s",
 		brokers, topics, groupID)
 
@@ -80,6 +81,9 @@ func NewKafkaServer(brokers []string, topics []string, groupID string) *KafkaSev
 	config.Producer.Idempotent = true
 	config.Consumer.Return.Errors = true
 	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	if err := security.Apply(config); err != nil {
+		log.Fatalf("Invalid Kafka security config: %v", err)
+	}
 
 	// 创建消费者组
 	group, err := sarama.NewConsumerGroup(brokers, groupID, config)
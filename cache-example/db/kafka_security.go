@@ -0,0 +1,152 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// KafkaSecurity 连接 Kafka 的 SASL 认证和 TLS 加密配置
+type KafkaSecurity struct {
+	SASLMechanism         string // 认证机制: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512，为空时不启用 SASL
+	SASLUsername          string // 用户名
+	SASLPassword          string // 密码
+	TLSEnabled            bool   // 是否启用 TLS
+	TLSCAFile             string // CA 证书文件，为空时使用系统根证书
+	TLSCertFile           string // 客户端证书文件，双向认证时与私钥一起设置
+	TLSKeyFile            string // 客户端私钥文件
+	TLSInsecureSkipVerify bool   // 跳过服务端证书校验，仅用于开发环境
+}
+
+// KafkaSecurityFromEnv 从环境变量读取 Kafka 认证和加密配置
+// 环境变量与 kafka-example 一致: KAFKA_SASL_MECHANISM、KAFKA_SASL_USERNAME、KAFKA_SASL_PASSWORD、
+// KAFKA_TLS_ENABLED、KAFKA_TLS_CA_FILE、KAFKA_TLS_CERT_FILE、KAFKA_TLS_KEY_FILE、KAFKA_TLS_INSECURE_SKIP_VERIFY
+func KafkaSecurityFromEnv() KafkaSecurity {
+	return KafkaSecurity{
+		SASLMechanism:         os.Getenv("KAFKA_SASL_MECHANISM"),
+		SASLUsername:          os.Getenv("KAFKA_SASL_USERNAME"),
+		SASLPassword:          os.Getenv("KAFKA_SASL_PASSWORD"),
+		TLSEnabled:            envBool("KAFKA_TLS_ENABLED"),
+		TLSCAFile:             os.Getenv("KAFKA_TLS_CA_FILE"),
+		TLSCertFile:           os.Getenv("KAFKA_TLS_CERT_FILE"),
+		TLSKeyFile:            os.Getenv("KAFKA_TLS_KEY_FILE"),
+		TLSInsecureSkipVerify: envBool("KAFKA_TLS_INSECURE_SKIP_VERIFY"),
+	}
+}
+
+// envBool 读取布尔类型的环境变量，未设置或无法解析时返回 false
+func envBool(key string) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("[Kafka] 环境变量 %s 的值不合法: %s，按 false 处理", key, v)
+	}
+	return b
+}
+
+// Apply 将认证和加密配置应用到 sarama 配置
+func (s KafkaSecurity) Apply(config *sarama.Config) error {
+	if s.TLSEnabled {
+		tlsConfig, err := s.tlsConfig()
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	if s.SASLMechanism == "" {
+		return nil
+	}
+	if s.SASLUsername == "" {
+		return errors.New("启用 SASL 认证时用户名不能为空")
+	}
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.User = s.SASLUsername
+	config.Net.SASL.Password = s.SASLPassword
+
+	switch strings.ToUpper(s.SASLMechanism) {
+	case "PLAIN":
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case "SCRAM-SHA-256":
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA256}
+		}
+	case "SCRAM-SHA-512":
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA512}
+		}
+	default:
+		return fmt.Errorf("未知的 SASL 认证机制: %s", s.SASLMechanism)
+	}
+	return nil
+}
+
+// tlsConfig 根据证书文件创建 TLS 配置
+func (s KafkaSecurity) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s.TLSInsecureSkipVerify,
+	}
+	if s.TLSCAFile != "" {
+		pem, err := os.ReadFile(s.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA 证书文件中没有有效的证书: %s", s.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		return nil, errors.New("客户端证书和私钥必须同时设置")
+	}
+	if s.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// scramClient 基于 xdg-go/scram 实现 sarama.SCRAMClient
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+// Begin 使用用户名和密码开始 SCRAM 认证会话
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+// Step 处理服务端的挑战并返回下一条客户端消息
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+// Done 返回认证会话是否结束
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// writeTestCert 在临时目录中生成自签名证书和私钥，返回证书和私钥文件路径
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成私钥失败: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cache-example-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("编码私钥失败: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("写入证书失败: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("写入私钥失败: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// TestKafkaSecurity_Apply 测试按认证机制和证书文件设置 sarama 配置
+func TestKafkaSecurity_Apply(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	tests := []struct {
+		name          string
+		security      KafkaSecurity
+		wantMechanism sarama.SASLMechanism // 为空时期望不启用SASL
+		wantSCRAM     bool
+		wantTLSCerts  int // 大于等于0时期望启用TLS
+		wantErr       string
+	}{
+		{name: "未配置时使用明文连接", wantTLSCerts: -1},
+		{name: "PLAIN", security: KafkaSecurity{SASLMechanism: "plain", SASLUsername: "user"}, wantMechanism: sarama.SASLTypePlaintext, wantTLSCerts: -1},
+		{name: "SCRAM-SHA-256", security: KafkaSecurity{SASLMechanism: "SCRAM-SHA-256", SASLUsername: "user"}, wantMechanism: sarama.SASLTypeSCRAMSHA256, wantSCRAM: true, wantTLSCerts: -1},
+		{
+			name:          "SCRAM-SHA-512和双向TLS",
+			security:      KafkaSecurity{SASLMechanism: "scram-sha-512", SASLUsername: "user", TLSEnabled: true, TLSCAFile: certFile, TLSCertFile: certFile, TLSKeyFile: keyFile},
+			wantMechanism: sarama.SASLTypeSCRAMSHA512,
+			wantSCRAM:     true,
+			wantTLSCerts:  1,
+		},
+		{name: "未知的认证机制", security: KafkaSecurity{SASLMechanism: "GSSAPI", SASLUsername: "user"}, wantErr: "未知的 SASL 认证机制"},
+		{name: "缺少用户名", security: KafkaSecurity{SASLMechanism: "PLAIN"}, wantErr: "用户名不能为空"},
+		{name: "只设置了客户端证书", security: KafkaSecurity{TLSEnabled: true, TLSCertFile: certFile}, wantErr: "必须同时设置"},
+		{name: "只设置了私钥", security: KafkaSecurity{TLSEnabled: true, TLSKeyFile: keyFile}, wantErr: "必须同时设置"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := sarama.NewConfig()
+			err := tt.security.Apply(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Apply() error = %v, 期望包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if cfg.Net.SASL.Enable != (tt.wantMechanism != "") || (tt.wantMechanism != "" && cfg.Net.SASL.Mechanism != tt.wantMechanism) {
+				t.Errorf("SASL.Enable = %v, SASL.Mechanism = %s, 期望 %s", cfg.Net.SASL.Enable, cfg.Net.SASL.Mechanism, tt.wantMechanism)
+			}
+			if (cfg.Net.SASL.SCRAMClientGeneratorFunc != nil) != tt.wantSCRAM {
+				t.Errorf("SCRAMClientGeneratorFunc 是否设置 = %v, 期望 %v", cfg.Net.SASL.SCRAMClientGeneratorFunc != nil, tt.wantSCRAM)
+			}
+			if tt.wantSCRAM {
+				client := cfg.Net.SASL.SCRAMClientGeneratorFunc()
+				if err := client.Begin("user", "secret", ""); err != nil {
+					t.Fatalf("Begin() error = %v", err)
+				}
+				if first, err := client.Step(""); err != nil || !strings.HasPrefix(first, "n,,n=user,r=") {
+					t.Errorf("SCRAM第一条消息 = %s, error = %v", first, err)
+				}
+			}
+			if cfg.Net.TLS.Enable != (tt.wantTLSCerts >= 0) {
+				t.Fatalf("TLS.Enable = %v, 期望 %v", cfg.Net.TLS.Enable, tt.wantTLSCerts >= 0)
+			}
+			if tt.wantTLSCerts >= 0 && len(cfg.Net.TLS.Config.Certificates) != tt.wantTLSCerts {
+				t.Errorf("客户端证书数 = %d, 期望 %d", len(cfg.Net.TLS.Config.Certificates), tt.wantTLSCerts)
+			}
+		})
+	}
+}
+
+// TestKafkaSecurityFromEnv 测试从与 kafka-example 一致的环境变量读取配置
+func TestKafkaSecurityFromEnv(t *testing.T) {
+	t.Setenv("KAFKA_SASL_MECHANISM", "SCRAM-SHA-256")
+	t.Setenv("KAFKA_SASL_USERNAME", "user")
+	t.Setenv("KAFKA_SASL_PASSWORD", "secret")
+	t.Setenv("KAFKA_TLS_ENABLED", "true")
+	t.Setenv("KAFKA_TLS_CA_FILE", "/etc/kafka/ca.pem")
+	t.Setenv("KAFKA_TLS_INSECURE_SKIP_VERIFY", "yes") // 不合法的值按 false 处理
+
+	want := KafkaSecurity{
+		SASLMechanism: "SCRAM-SHA-256",
+		SASLUsername:  "user",
+		SASLPassword:  "secret",
+		TLSEnabled:    true,
+		TLSCAFile:     "/etc/kafka/ca.pem",
+	}
+	if got := KafkaSecurityFromEnv(); got != want {
+		t.Errorf("KafkaSecurityFromEnv() = %+v, 期望 %+v", got, want)
+	}
+}
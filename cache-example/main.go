@@ -11,7 +11,7 @@ func main() {
 	db.NewMysqlDB()
 	db.NewRedisDB()
 
-	db.KafkaServer = db.NewKafkaServer([]string{"127.0.0.1:9092"}, []string{"cache_example"}, "cache_example_group")
+	db.KafkaServer = db.NewKafkaServer([]string{"127.0.0.1:9092"}, []string{"cache_example"}, "cache_example_group", db.KafkaSecurityFromEnv())
 
 	r := gin.Default()
 	// 缓存回溯
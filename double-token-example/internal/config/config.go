@@ -50,6 +50,8 @@ type Config struct {
 			OrderTopic string
 			GoodsTopic string
 		}
+		SASL SASLConfig // SASL 认证配置，Mechanism 为空时不启用
+		TLS  TLSConfig  // TLS 加密配置
 	}
 }
 
@@ -69,6 +71,9 @@ func init() {
 
 	// 读取环境变量
 	viper.AutomaticEnv()
+	for key, env := range kafkaSecurityEnv {
+		_ = viper.BindEnv(key, env)
+	}
 
 	// 绑定配置到结构体
 	if err := viper.Unmarshal(&Cfg); err != nil {
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// SASLConfig Kafka 的 SASL 认证配置，Mechanism 为空时不启用
+type SASLConfig struct {
+	Mechanism string // PLAIN, SCRAM-SHA-256, SCRAM-SHA-512
+	Username  string
+	Password  string
+}
+
+// TLSConfig Kafka 的 TLS 加密配置
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string // 为空时使用系统根证书
+	CertFile           string // 双向认证时与 KeyFile 一起设置
+	KeyFile            string
+	InsecureSkipVerify bool // 仅用于开发环境
+}
+
+// kafkaSecurityEnv Kafka 认证和加密配置对应的环境变量，与 kafka-example 一致
+var kafkaSecurityEnv = map[string]string{
+	"kafka.sasl.mechanism":         "KAFKA_SASL_MECHANISM",
+	"kafka.sasl.username":          "KAFKA_SASL_USERNAME",
+	"kafka.sasl.password":          "KAFKA_SASL_PASSWORD",
+	"kafka.tls.enabled":            "KAFKA_TLS_ENABLED",
+	"kafka.tls.cafile":             "KAFKA_TLS_CA_FILE",
+	"kafka.tls.certfile":           "KAFKA_TLS_CERT_FILE",
+	"kafka.tls.keyfile":            "KAFKA_TLS_KEY_FILE",
+	"kafka.tls.insecureskipverify": "KAFKA_TLS_INSECURE_SKIP_VERIFY",
+}
+
+// Apply 将 SASL 认证配置应用到 sarama 配置，Mechanism 为空时不做修改
+func (c SASLConfig) Apply(cfg *sarama.Config) error {
+	if c.Mechanism == "" {
+		return nil
+	}
+	if c.Username == "" {
+		return errors.New("启用 SASL 认证时用户名不能为空")
+	}
+	cfg.Net.SASL.Enable = true
+	cfg.Net.SASL.Handshake = true
+	cfg.Net.SASL.User = c.Username
+	cfg.Net.SASL.Password = c.Password
+
+	switch strings.ToUpper(c.Mechanism) {
+	case "PLAIN":
+		cfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case "SCRAM-SHA-256":
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA256}
+		}
+	case "SCRAM-SHA-512":
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA512}
+		}
+	default:
+		return fmt.Errorf("未知的 SASL 认证机制: %s", c.Mechanism)
+	}
+	return nil
+}
+
+// Apply 将 TLS 加密配置应用到 sarama 配置，未启用时不做修改
+func (c TLSConfig) Apply(cfg *sarama.Config) error {
+	if !c.Enabled {
+		return nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA 证书文件中没有有效的证书: %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("客户端证书和私钥必须同时设置")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	cfg.Net.TLS.Enable = true
+	cfg.Net.TLS.Config = tlsConfig
+	return nil
+}
+
+// scramClient 基于 xdg-go/scram 实现 sarama.SCRAMClient
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+// Begin 使用用户名和密码开始 SCRAM 认证会话
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+// Step 处理服务端的挑战并返回下一条客户端消息
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+// Done 返回认证会话是否结束
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
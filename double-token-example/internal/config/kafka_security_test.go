@@ -0,0 +1,170 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/spf13/viper"
+)
+
+// writeTestCert 在临时目录中生成自签名证书和私钥，返回证书和私钥文件路径
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成私钥失败: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "double-token-example-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("编码私钥失败: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("写入证书失败: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("写入私钥失败: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// TestSASLConfig_Apply 测试按认证机制设置 sarama 的 SASL 参数
+func TestSASLConfig_Apply(t *testing.T) {
+	tests := []struct {
+		name          string
+		sasl          SASLConfig
+		wantEnable    bool
+		wantMechanism sarama.SASLMechanism
+		wantSCRAM     bool
+		wantErr       string
+	}{
+		{name: "未配置时不启用", wantEnable: false},
+		{name: "PLAIN", sasl: SASLConfig{Mechanism: "plain", Username: "user"}, wantEnable: true, wantMechanism: sarama.SASLTypePlaintext},
+		{name: "SCRAM-SHA-256", sasl: SASLConfig{Mechanism: "SCRAM-SHA-256", Username: "user"}, wantEnable: true, wantMechanism: sarama.SASLTypeSCRAMSHA256, wantSCRAM: true},
+		{name: "SCRAM-SHA-512", sasl: SASLConfig{Mechanism: "scram-sha-512", Username: "user"}, wantEnable: true, wantMechanism: sarama.SASLTypeSCRAMSHA512, wantSCRAM: true},
+		{name: "未知的认证机制", sasl: SASLConfig{Mechanism: "GSSAPI", Username: "user"}, wantErr: "未知的 SASL 认证机制"},
+		{name: "缺少用户名", sasl: SASLConfig{Mechanism: "PLAIN"}, wantErr: "用户名不能为空"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := sarama.NewConfig()
+			err := tt.sasl.Apply(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Apply() error = %v, 期望包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if cfg.Net.SASL.Enable != tt.wantEnable {
+				t.Fatalf("SASL.Enable = %v, 期望 %v", cfg.Net.SASL.Enable, tt.wantEnable)
+			}
+			if !tt.wantEnable {
+				return
+			}
+			if cfg.Net.SASL.Mechanism != tt.wantMechanism {
+				t.Errorf("SASL.Mechanism = %s, 期望 %s", cfg.Net.SASL.Mechanism, tt.wantMechanism)
+			}
+			if (cfg.Net.SASL.SCRAMClientGeneratorFunc != nil) != tt.wantSCRAM {
+				t.Errorf("SCRAMClientGeneratorFunc 是否设置 = %v, 期望 %v", cfg.Net.SASL.SCRAMClientGeneratorFunc != nil, tt.wantSCRAM)
+			}
+			if tt.wantSCRAM {
+				client := cfg.Net.SASL.SCRAMClientGeneratorFunc()
+				if err := client.Begin("user", "secret", ""); err != nil {
+					t.Fatalf("Begin() error = %v", err)
+				}
+				if first, err := client.Step(""); err != nil || !strings.HasPrefix(first, "n,,n=user,r=") {
+					t.Errorf("SCRAM第一条消息 = %s, error = %v", first, err)
+				}
+			}
+		})
+	}
+}
+
+// TestTLSConfig_Apply 测试根据证书文件设置 sarama 的 TLS 参数
+func TestTLSConfig_Apply(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	tests := []struct {
+		name      string
+		tls       TLSConfig
+		wantCerts int
+		wantErr   string
+	}{
+		{name: "CA证书", tls: TLSConfig{Enabled: true, CAFile: certFile}},
+		{name: "双向TLS", tls: TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile}, wantCerts: 1},
+		{name: "只设置了客户端证书", tls: TLSConfig{Enabled: true, CertFile: certFile}, wantErr: "必须同时设置"},
+		{name: "只设置了私钥", tls: TLSConfig{Enabled: true, KeyFile: keyFile}, wantErr: "必须同时设置"},
+		{name: "CA证书无效", tls: TLSConfig{Enabled: true, CAFile: keyFile}, wantErr: "没有有效的证书"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := sarama.NewConfig()
+			err := tt.tls.Apply(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Apply() error = %v, 期望包含 %q", err, tt.wantErr)
+				}
+				if cfg.Net.TLS.Enable {
+					t.Error("配置不合法时不应启用TLS")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !cfg.Net.TLS.Enable || len(cfg.Net.TLS.Config.Certificates) != tt.wantCerts {
+				t.Errorf("TLS.Enable = %v, 客户端证书数 = %d, 期望 %d", cfg.Net.TLS.Enable, len(cfg.Net.TLS.Config.Certificates), tt.wantCerts)
+			}
+		})
+	}
+}
+
+// TestKafkaSecurityEnv 测试 Kafka 认证和加密配置的环境变量与 kafka-example 一致，其他配置不受影响
+func TestKafkaSecurityEnv(t *testing.T) {
+	t.Setenv("KAFKA_TLS_CA_FILE", "/etc/kafka/ca.pem")
+	t.Setenv("KAFKA_TLS_INSECURE_SKIP_VERIFY", "true")
+	t.Setenv("KAFKA_SASL_PASSWORD", "secret")
+	t.Setenv("KAFKA_TLS_CAFILE", "/wrong/ca.pem")
+	t.Setenv("SERVER_PORT", "9999")
+
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if cfg.Kafka.TLS.CAFile != "/etc/kafka/ca.pem" || !cfg.Kafka.TLS.InsecureSkipVerify || cfg.Kafka.SASL.Password != "secret" {
+		t.Errorf("Kafka 安全配置 = %+v, %+v", cfg.Kafka.SASL, cfg.Kafka.TLS)
+	}
+	if cfg.Server.Port == "9999" {
+		t.Error("未绑定的配置不应被下划线形式的环境变量覆盖")
+	}
+}
@@ -21,6 +21,9 @@ func init() {
 	cfg := sarama.NewConfig()
 	cfg.Consumer.Return.Errors = true
 	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	if err := applySecurity(cfg); err != nil {
+		log.Fatalf("Invalid Kafka security config: %v", err)
+	}
 
 	orderGroup, err := sarama.NewConsumerGroup(config.Cfg.Kafka.Brokers, config.Cfg.Kafka.Groups.OrderGroup, cfg)
 	if err != nil {
@@ -20,6 +20,9 @@ func init() {
 	cfg.Producer.Retry.Max = 5
 	cfg.Net.MaxOpenRequests = 1
 	cfg.Producer.Idempotent = true
+	if err := applySecurity(cfg); err != nil {
+		log.Fatalf("Invalid Kafka security config: %v", err)
+	}
 	// 创建生产者
 	p, err := sarama.NewSyncProducer(config.Cfg.Kafka.Brokers, cfg)
 	if err != nil {
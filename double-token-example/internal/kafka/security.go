@@ -0,0 +1,16 @@
+package kafka
+
+import (
+	"double-token-example/internal/config"
+
+	"github.com/IBM/sarama"
+)
+
+// applySecurity 将配置中的 SASL 认证和 TLS 加密应用到 sarama 配置
+// 生产者和消费者共用该函数，保证两者使用相同的认证方式
+func applySecurity(cfg *sarama.Config) error {
+	if err := config.Cfg.Kafka.TLS.Apply(cfg); err != nil {
+		return err
+	}
+	return config.Cfg.Kafka.SASL.Apply(cfg)
+}
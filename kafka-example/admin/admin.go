@@ -0,0 +1,389 @@
+package admin
+
+import (
+	"fmt"
+	"kafka-example/config"
+	"log"
+	"sort"
+
+	"github.com/IBM/sarama"
+)
+
+const logPrefix = "[Admin] "
+
+// TopicInfo 主题概要
+type TopicInfo struct {
+	Name              string `json:"name"`               // 主题名称
+	Partitions        int32  `json:"partitions"`         // 分区数
+	ReplicationFactor int16  `json:"replication_factor"` // 副本数
+}
+
+// PartitionInfo 分区的副本分布
+type PartitionInfo struct {
+	ID       int32   `json:"id"`       // 分区ID
+	Leader   int32   `json:"leader"`   // leader所在的broker
+	Replicas []int32 `json:"replicas"` // 所有副本所在的broker
+	ISR      []int32 `json:"isr"`      // 同步副本所在的broker
+}
+
+// TopicDetail 主题详情
+type TopicDetail struct {
+	Name       string            `json:"name"`       // 主题名称
+	Internal   bool              `json:"internal"`   // 是否为内部主题
+	Partitions []PartitionInfo   `json:"partitions"` // 分区列表，按分区ID排序
+	Configs    map[string]string `json:"configs"`    // 主题配置，敏感配置不返回值
+}
+
+// MemberInfo 消费者组成员
+type MemberInfo struct {
+	MemberID    string             `json:"member_id"`   // 成员ID
+	ClientID    string             `json:"client_id"`   // 客户端ID
+	ClientHost  string             `json:"client_host"` // 客户端地址
+	Assignments map[string][]int32 `json:"assignments"` // 分配到的主题和分区
+}
+
+// GroupInfo 消费者组详情
+type GroupInfo struct {
+	GroupID      string       `json:"group_id"`      // 消费者组ID
+	ProtocolType string       `json:"protocol_type"` // 协议类型，消费者组为 consumer
+	State        string       `json:"state"`         // 消费者组状态，例如 Stable、Empty
+	Members      []MemberInfo `json:"members"`       // 组成员，按成员ID排序
+}
+
+// PartitionLag 消费者组在一个分区上的消费延迟
+type PartitionLag struct {
+	Topic         string `json:"topic"`          // 主题
+	Partition     int32  `json:"partition"`      // 分区
+	Committed     int64  `json:"committed"`      // 已提交的偏移量，没有提交过时为-1
+	HighWatermark int64  `json:"high_watermark"` // 分区的高水位，即下一条消息的偏移量
+	Lag           int64  `json:"lag"`            // 尚未消费的消息数
+}
+
+// offsetClient 查询分区和偏移量的客户端，sarama.Client 实现了该接口
+type offsetClient interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partitionID int32, time int64) (int64, error)
+}
+
+// Service 集群管理服务
+// 基于 sarama.ClusterAdmin 管理主题、查询消费者组及其消费延迟
+type Service struct {
+	admin  sarama.ClusterAdmin // 集群管理客户端
+	client offsetClient        // 查询分区和偏移量
+	writer offsetWriter        // 提交重置后的消费者组偏移量
+}
+
+// NewService 创建集群管理服务
+// 参数:
+//   - cfg: Kafka配置
+//
+// 返回:
+//   - *Service: 集群管理服务实例
+//   - error: 创建失败时返回错误
+func NewService(cfg *config.Config) (*Service, error) {
+	log.Printf("%s正在创建集群管理服务: brokers=%v", logPrefix, cfg.Brokers)
+
+	saramaConfig, err := cfg.AdminSaramaConfig()
+	if err != nil {
+		return nil, fmt.Errorf("集群管理配置不合法: %w", err)
+	}
+	saramaConfig.Consumer.Return.Errors = true // 收集重置偏移量时的提交错误
+
+	client, err := sarama.NewClient(cfg.Brokers, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建客户端失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建客户端失败: %w", err)
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		log.Printf("%s创建集群管理客户端失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建集群管理客户端失败: %w", err)
+	}
+
+	log.Printf("%s集群管理服务创建成功", logPrefix)
+	return newService(admin, client, clientOffsetWriter{client: client}), nil
+}
+
+// newService 使用已创建的集群管理客户端组装服务
+func newService(admin sarama.ClusterAdmin, client offsetClient, writer offsetWriter) *Service {
+	return &Service{admin: admin, client: client, writer: writer}
+}
+
+// CreateTopic 创建主题
+// 参数:
+//   - name: 主题名称
+//   - partitions: 分区数
+//   - replicationFactor: 副本数
+//   - configs: 主题配置，可为空
+//
+// 返回:
+//   - error: 创建失败时返回错误，主题已存在时可用 errors.Is(err, sarama.ErrTopicAlreadyExists) 判断
+func (s *Service) CreateTopic(name string, partitions int32, replicationFactor int16, configs map[string]string) error {
+	detail := &sarama.TopicDetail{
+		NumPartitions:     partitions,
+		ReplicationFactor: replicationFactor,
+	}
+	if len(configs) > 0 {
+		detail.ConfigEntries = make(map[string]*string, len(configs))
+		for k, v := range configs {
+			detail.ConfigEntries[k] = &v
+		}
+	}
+
+	if err := s.admin.CreateTopic(name, detail, false); err != nil {
+		log.Printf("%s创建主题失败: topic=%s, error=%v", logPrefix, name, err)
+		return fmt.Errorf("创建主题 %s 失败: %w", name, err)
+	}
+	log.Printf("%s主题创建成功: topic=%s, partitions=%d, replication_factor=%d",
+		logPrefix, name, partitions, replicationFactor)
+	return nil
+}
+
+// DeleteTopic 删除主题
+// 返回:
+//   - error: 删除失败时返回错误，主题不存在时可用 errors.Is(err, sarama.ErrUnknownTopicOrPartition) 判断
+func (s *Service) DeleteTopic(name string) error {
+	if err := s.admin.DeleteTopic(name); err != nil {
+		log.Printf("%s删除主题失败: topic=%s, error=%v", logPrefix, name, err)
+		return fmt.Errorf("删除主题 %s 失败: %w", name, err)
+	}
+	log.Printf("%s主题删除成功: topic=%s", logPrefix, name)
+	return nil
+}
+
+// ListTopics 列出集群中的所有主题
+// 返回:
+//   - []TopicInfo: 按名称排序的主题列表
+//   - error: 查询失败时返回错误
+func (s *Service) ListTopics() ([]TopicInfo, error) {
+	topics, err := s.admin.ListTopics()
+	if err != nil {
+		return nil, fmt.Errorf("查询主题列表失败: %w", err)
+	}
+
+	infos := make([]TopicInfo, 0, len(topics))
+	for name, detail := range topics {
+		infos = append(infos, TopicInfo{
+			Name:              name,
+			Partitions:        detail.NumPartitions,
+			ReplicationFactor: detail.ReplicationFactor,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// DescribeTopic 查询主题的分区分布和配置
+// 返回:
+//   - *TopicDetail: 主题详情
+//   - error: 查询失败时返回错误，主题不存在时可用 errors.Is(err, sarama.ErrUnknownTopicOrPartition) 判断
+func (s *Service) DescribeTopic(name string) (*TopicDetail, error) {
+	metadata, err := s.admin.DescribeTopics([]string{name})
+	if err != nil {
+		return nil, fmt.Errorf("查询主题 %s 失败: %w", name, err)
+	}
+	if len(metadata) == 0 {
+		return nil, fmt.Errorf("查询主题 %s 失败: %w", name, sarama.ErrUnknownTopicOrPartition)
+	}
+	topic := metadata[0]
+	if topic.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("查询主题 %s 失败: %w", name, topic.Err)
+	}
+
+	detail := &TopicDetail{
+		Name:       topic.Name,
+		Internal:   topic.IsInternal,
+		Partitions: make([]PartitionInfo, 0, len(topic.Partitions)),
+		Configs:    make(map[string]string),
+	}
+	for _, p := range topic.Partitions {
+		detail.Partitions = append(detail.Partitions, PartitionInfo{
+			ID:       p.ID,
+			Leader:   p.Leader,
+			Replicas: p.Replicas,
+			ISR:      p.Isr,
+		})
+	}
+	sort.Slice(detail.Partitions, func(i, j int) bool { return detail.Partitions[i].ID < detail.Partitions[j].ID })
+
+	entries, err := s.admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("查询主题 %s 的配置失败: %w", name, err)
+	}
+	for _, entry := range entries {
+		if entry.Sensitive {
+			continue
+		}
+		detail.Configs[entry.Name] = entry.Value
+	}
+	return detail, nil
+}
+
+// ListConsumerGroups 列出所有消费者组及其成员
+// 返回:
+//   - []GroupInfo: 按消费者组ID排序的消费者组列表
+//   - error: 查询失败时返回错误
+func (s *Service) ListConsumerGroups() ([]GroupInfo, error) {
+	groups, err := s.admin.ListConsumerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("查询消费者组列表失败: %w", err)
+	}
+	if len(groups) == 0 {
+		return []GroupInfo{}, nil
+	}
+
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	return s.describeGroups(ids)
+}
+
+// DescribeConsumerGroup 查询消费者组的状态和成员
+// 返回:
+//   - *GroupInfo: 消费者组详情，消费者组不存在时状态为 Dead
+//   - error: 查询失败时返回错误
+func (s *Service) DescribeConsumerGroup(group string) (*GroupInfo, error) {
+	infos, err := s.describeGroups([]string{group})
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("查询消费者组 %s 失败: 没有返回结果", group)
+	}
+	return &infos[0], nil
+}
+
+// describeGroups 查询多个消费者组的详情
+func (s *Service) describeGroups(ids []string) ([]GroupInfo, error) {
+	descriptions, err := s.admin.DescribeConsumerGroups(ids)
+	if err != nil {
+		return nil, fmt.Errorf("查询消费者组详情失败: %w", err)
+	}
+
+	infos := make([]GroupInfo, 0, len(descriptions))
+	for _, d := range descriptions {
+		if d.Err != sarama.ErrNoError {
+			return nil, fmt.Errorf("查询消费者组 %s 失败: %w", d.GroupId, d.Err)
+		}
+		info := GroupInfo{
+			GroupID:      d.GroupId,
+			ProtocolType: d.ProtocolType,
+			State:        d.State,
+			Members:      make([]MemberInfo, 0, len(d.Members)),
+		}
+		for id, m := range d.Members {
+			member := MemberInfo{
+				MemberID:    id,
+				ClientID:    m.ClientId,
+				ClientHost:  m.ClientHost,
+				Assignments: map[string][]int32{},
+			}
+			// 非 consumer 协议的成员分配无法按消费者格式解析，忽略分配信息
+			if assignment, err := m.GetMemberAssignment(); err == nil && assignment != nil {
+				member.Assignments = assignment.Topics
+			}
+			info.Members = append(info.Members, member)
+		}
+		sort.Slice(info.Members, func(i, j int) bool { return info.Members[i].MemberID < info.Members[j].MemberID })
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].GroupID < infos[j].GroupID })
+	return infos, nil
+}
+
+// ConsumerGroupLag 查询消费者组在各分区上的消费延迟
+// 延迟 = 高水位 - 已提交的偏移量；分区没有提交过偏移量时，延迟按分区中最早的可用消息计算
+// 参数:
+//   - group: 消费者组ID
+//   - topics: 要查询的主题，为空时查询消费者组提交过偏移量的所有主题
+//
+// 返回:
+//   - []PartitionLag: 按主题和分区排序的消费延迟
+//   - error: 查询失败时返回错误
+func (s *Service) ConsumerGroupLag(group string, topics []string) ([]PartitionLag, error) {
+	var topicPartitions map[string][]int32
+	if len(topics) > 0 {
+		topicPartitions = make(map[string][]int32, len(topics))
+		for _, topic := range topics {
+			partitions, err := s.client.Partitions(topic)
+			if err != nil {
+				return nil, fmt.Errorf("查询主题 %s 的分区失败: %w", topic, err)
+			}
+			topicPartitions[topic] = partitions
+		}
+	}
+
+	offsets, err := s.admin.ListConsumerGroupOffsets(group, topicPartitions)
+	if err != nil {
+		return nil, fmt.Errorf("查询消费者组 %s 的偏移量失败: %w", group, err)
+	}
+	if offsets.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("查询消费者组 %s 的偏移量失败: %w", group, offsets.Err)
+	}
+	if topicPartitions == nil {
+		topicPartitions = make(map[string][]int32, len(offsets.Blocks))
+		for topic, blocks := range offsets.Blocks {
+			for partition := range blocks {
+				topicPartitions[topic] = append(topicPartitions[topic], partition)
+			}
+		}
+	}
+
+	lags := make([]PartitionLag, 0)
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			lag, err := s.partitionLag(offsets, topic, partition)
+			if err != nil {
+				return nil, err
+			}
+			lags = append(lags, lag)
+		}
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags, nil
+}
+
+// partitionLag 计算一个分区的消费延迟
+func (s *Service) partitionLag(offsets *sarama.OffsetFetchResponse, topic string, partition int32) (PartitionLag, error) {
+	lag := PartitionLag{Topic: topic, Partition: partition, Committed: -1}
+	if block := offsets.GetBlock(topic, partition); block != nil {
+		if block.Err != sarama.ErrNoError {
+			return lag, fmt.Errorf("查询分区 %s/%d 的已提交偏移量失败: %w", topic, partition, block.Err)
+		}
+		lag.Committed = block.Offset
+	}
+
+	hwm, err := s.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return lag, fmt.Errorf("查询分区 %s/%d 的高水位失败: %w", topic, partition, err)
+	}
+	lag.HighWatermark = hwm
+
+	from := lag.Committed
+	if from < 0 {
+		if from, err = s.client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+			return lag, fmt.Errorf("查询分区 %s/%d 的最早偏移量失败: %w", topic, partition, err)
+		}
+	}
+	lag.Lag = max(hwm-from, 0)
+	return lag, nil
+}
+
+// Close 关闭集群管理服务及其客户端
+// 返回:
+//   - error: 关闭失败时返回错误
+func (s *Service) Close() error {
+	log.Printf("%s正在关闭集群管理服务", logPrefix)
+	if err := s.admin.Close(); err != nil {
+		return fmt.Errorf("关闭集群管理客户端失败: %w", err)
+	}
+	return nil
+}
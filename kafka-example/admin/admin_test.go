@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeAdmin 内存中的集群管理客户端，只实现测试用到的方法
+type fakeAdmin struct {
+	sarama.ClusterAdmin
+	topics   map[string]sarama.TopicDetail
+	metadata []*sarama.TopicMetadata
+	configs  []sarama.ConfigEntry
+	groups   []*sarama.GroupDescription
+	offsets  *sarama.OffsetFetchResponse
+	created  map[string]*sarama.TopicDetail
+}
+
+func (a *fakeAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, _ bool) error {
+	if _, ok := a.topics[topic]; ok {
+		return &sarama.TopicError{Err: sarama.ErrTopicAlreadyExists}
+	}
+	a.created[topic] = detail
+	return nil
+}
+
+func (a *fakeAdmin) ListTopics() (map[string]sarama.TopicDetail, error) { return a.topics, nil }
+
+func (a *fakeAdmin) DescribeTopics([]string) ([]*sarama.TopicMetadata, error) {
+	return a.metadata, nil
+}
+
+func (a *fakeAdmin) DescribeConfig(sarama.ConfigResource) ([]sarama.ConfigEntry, error) {
+	return a.configs, nil
+}
+
+func (a *fakeAdmin) ListConsumerGroups() (map[string]string, error) {
+	groups := make(map[string]string, len(a.groups))
+	for _, g := range a.groups {
+		groups[g.GroupId] = g.ProtocolType
+	}
+	return groups, nil
+}
+
+func (a *fakeAdmin) DescribeConsumerGroups([]string) ([]*sarama.GroupDescription, error) {
+	return a.groups, nil
+}
+
+func (a *fakeAdmin) ListConsumerGroupOffsets(string, map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	return a.offsets, nil
+}
+
+// fakeClient 固定分区和偏移量的客户端
+type fakeClient struct {
+	partitions map[string][]int32
+	oldest     map[int32]int64
+	newest     map[int32]int64
+	byTime     map[int32]int64 // 按时间戳查询时返回的偏移量
+}
+
+func (c *fakeClient) Partitions(topic string) ([]int32, error) {
+	partitions, ok := c.partitions[topic]
+	if !ok {
+		return nil, sarama.ErrUnknownTopicOrPartition
+	}
+	return partitions, nil
+}
+
+func (c *fakeClient) GetOffset(_ string, partition int32, time int64) (int64, error) {
+	switch time {
+	case sarama.OffsetOldest:
+		return c.oldest[partition], nil
+	case sarama.OffsetNewest:
+		return c.newest[partition], nil
+	default:
+		return c.byTime[partition], nil
+	}
+}
+
+// TestService_ConsumerGroupLag 测试按高水位和已提交偏移量计算消费延迟
+func TestService_ConsumerGroupLag(t *testing.T) {
+	offsets := &sarama.OffsetFetchResponse{}
+	offsets.AddBlock("orders", 0, &sarama.OffsetFetchResponseBlock{Offset: 7})
+	offsets.AddBlock("orders", 1, &sarama.OffsetFetchResponseBlock{Offset: 20})
+
+	client := &fakeClient{
+		partitions: map[string][]int32{"orders": {0, 1, 2}},
+		oldest:     map[int32]int64{0: 0, 1: 0, 2: 3},
+		newest:     map[int32]int64{0: 10, 1: 20, 2: 8},
+	}
+
+	tests := []struct {
+		name    string
+		topics  []string
+		want    []PartitionLag
+		wantErr error
+	}{
+		{
+			name:   "未指定主题时只查询提交过偏移量的分区",
+			topics: nil,
+			want: []PartitionLag{
+				{Topic: "orders", Partition: 0, Committed: 7, HighWatermark: 10, Lag: 3},
+				{Topic: "orders", Partition: 1, Committed: 20, HighWatermark: 20, Lag: 0},
+			},
+		},
+		{
+			name:   "指定主题时包含未提交过偏移量的分区",
+			topics: []string{"orders"},
+			want: []PartitionLag{
+				{Topic: "orders", Partition: 0, Committed: 7, HighWatermark: 10, Lag: 3},
+				{Topic: "orders", Partition: 1, Committed: 20, HighWatermark: 20, Lag: 0},
+				{Topic: "orders", Partition: 2, Committed: -1, HighWatermark: 8, Lag: 5},
+			},
+		},
+		{
+			name:    "主题不存在",
+			topics:  []string{"missing"},
+			wantErr: sarama.ErrUnknownTopicOrPartition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newService(&fakeAdmin{offsets: offsets}, client, nil)
+			got, err := s.ConsumerGroupLag("group", tt.topics)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ConsumerGroupLag() error = %v, 期望 %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConsumerGroupLag() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConsumerGroupLag() = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestService_DescribeTopic 测试主题详情按分区排序并隐藏敏感配置
+func TestService_DescribeTopic(t *testing.T) {
+	t.Run("返回分区和配置", func(t *testing.T) {
+		s := newService(&fakeAdmin{
+			metadata: []*sarama.TopicMetadata{{
+				Name: "orders",
+				Partitions: []*sarama.PartitionMetadata{
+					{ID: 1, Leader: 2, Replicas: []int32{2, 1}, Isr: []int32{2}},
+					{ID: 0, Leader: 1, Replicas: []int32{1, 2}, Isr: []int32{1, 2}},
+				},
+			}},
+			configs: []sarama.ConfigEntry{
+				{Name: "retention.ms", Value: "604800000"},
+				{Name: "secret", Value: "xxx", Sensitive: true},
+			},
+		}, nil, nil)
+
+		detail, err := s.DescribeTopic("orders")
+		if err != nil {
+			t.Fatalf("DescribeTopic() error = %v", err)
+		}
+		if len(detail.Partitions) != 2 || detail.Partitions[0].ID != 0 || detail.Partitions[1].Leader != 2 {
+			t.Errorf("分区 = %+v, 期望按分区ID排序", detail.Partitions)
+		}
+		if want := map[string]string{"retention.ms": "604800000"}; !reflect.DeepEqual(detail.Configs, want) {
+			t.Errorf("配置 = %v, 期望 %v", detail.Configs, want)
+		}
+	})
+
+	t.Run("主题不存在", func(t *testing.T) {
+		s := newService(&fakeAdmin{
+			metadata: []*sarama.TopicMetadata{{Name: "missing", Err: sarama.ErrUnknownTopicOrPartition}},
+		}, nil, nil)
+		if _, err := s.DescribeTopic("missing"); !errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			t.Errorf("DescribeTopic() error = %v, 期望 ErrUnknownTopicOrPartition", err)
+		}
+	})
+}
+
+// TestService_CreateTopic 测试创建主题时传递配置，主题已存在时返回可判断的错误
+func TestService_CreateTopic(t *testing.T) {
+	admin := &fakeAdmin{
+		topics:  map[string]sarama.TopicDetail{"exists": {}},
+		created: make(map[string]*sarama.TopicDetail),
+	}
+	s := newService(admin, nil, nil)
+
+	if err := s.CreateTopic("orders", 3, 2, map[string]string{"cleanup.policy": "compact"}); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	detail := admin.created["orders"]
+	if detail == nil || detail.NumPartitions != 3 || detail.ReplicationFactor != 2 {
+		t.Fatalf("创建的主题 = %+v, 期望 3个分区 2个副本", detail)
+	}
+	if v := detail.ConfigEntries["cleanup.policy"]; v == nil || *v != "compact" {
+		t.Errorf("主题配置 cleanup.policy = %v, 期望 compact", v)
+	}
+
+	if err := s.CreateTopic("exists", 1, 1, nil); !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		t.Errorf("CreateTopic() error = %v, 期望 ErrTopicAlreadyExists", err)
+	}
+}
+
+// TestService_ListConsumerGroups 测试列出消费者组及其成员
+func TestService_ListConsumerGroups(t *testing.T) {
+	s := newService(&fakeAdmin{
+		groups: []*sarama.GroupDescription{
+			{
+				GroupId:      "b-group",
+				ProtocolType: "consumer",
+				State:        "Stable",
+				Members: map[string]*sarama.GroupMemberDescription{
+					"member-2": {ClientId: "client-2", ClientHost: "/10.0.0.2"},
+					"member-1": {ClientId: "client-1", ClientHost: "/10.0.0.1"},
+				},
+			},
+			{GroupId: "a-group", ProtocolType: "consumer", State: "Empty"},
+		},
+	}, nil, nil)
+
+	groups, err := s.ListConsumerGroups()
+	if err != nil {
+		t.Fatalf("ListConsumerGroups() error = %v", err)
+	}
+	if len(groups) != 2 || groups[0].GroupID != "a-group" || groups[1].GroupID != "b-group" {
+		t.Fatalf("消费者组 = %+v, 期望按ID排序", groups)
+	}
+	members := groups[1].Members
+	if len(members) != 2 || members[0].MemberID != "member-1" || members[0].ClientID != "client-1" {
+		t.Errorf("成员 = %+v, 期望按成员ID排序", members)
+	}
+}
@@ -0,0 +1,257 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 偏移量重置策略
+const (
+	ResetEarliest  = "earliest"  // 重置到分区中最早的可用消息
+	ResetLatest    = "latest"    // 重置到分区末尾，跳过所有未消费的消息
+	ResetOffset    = "offset"    // 重置到每个分区指定的偏移量
+	ResetTimestamp = "timestamp" // 重置到时间戳之后的第一条消息
+)
+
+var (
+	// ErrGroupNotEmpty 消费者组仍有活跃成员，重置偏移量前需要先停止所有消费者
+	ErrGroupNotEmpty = errors.New("消费者组仍有活跃成员")
+	// ErrInvalidReset 重置请求不合法
+	ErrInvalidReset = errors.New("偏移量重置请求不合法")
+)
+
+// ResetRequest 消费者组偏移量重置请求
+type ResetRequest struct {
+	Group     string                     // 消费者组ID
+	Topics    []string                   // 要重置的主题，offset策略下为空时使用 Offsets 中的主题
+	Strategy  string                     // 重置策略，见 ResetEarliest 等常量
+	Offsets   map[string]map[int32]int64 // offset策略下每个分区的目标偏移量，未列出的分区保持不变
+	Timestamp time.Time                  // timestamp策略下的时间戳
+	DryRun    bool                       // 只计算目标偏移量，不提交
+}
+
+// OffsetPlan 一个分区的偏移量重置计划
+type OffsetPlan struct {
+	Topic     string `json:"topic"`     // 主题
+	Partition int32  `json:"partition"` // 分区
+	Current   int64  `json:"current"`   // 当前已提交的偏移量，没有提交过时为-1
+	Target    int64  `json:"target"`    // 重置后的偏移量
+}
+
+// offsetWriter 提交消费者组偏移量
+type offsetWriter interface {
+	WriteOffsets(group string, offsets map[string]map[int32]int64) error
+}
+
+// clientOffsetWriter 通过 OffsetCommit 请求提交偏移量
+// 当前版本的 sarama.ClusterAdmin 没有修改消费者组偏移量的接口，与 kafka-consumer-groups.sh 一样以空成员身份提交，
+// 只有消费者组没有活跃成员时协调者才会接受
+type clientOffsetWriter struct {
+	client sarama.Client
+}
+
+// WriteOffsets 提交偏移量，目标偏移量可以小于当前已提交的偏移量
+func (w clientOffsetWriter) WriteOffsets(group string, offsets map[string]map[int32]int64) error {
+	om, err := sarama.NewOffsetManagerFromClient(group, w.client)
+	if err != nil {
+		return fmt.Errorf("创建偏移量管理器失败: %w", err)
+	}
+
+	var poms []sarama.PartitionOffsetManager
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			pom, err := om.ManagePartition(topic, partition)
+			if err != nil {
+				_ = om.Close()
+				return fmt.Errorf("管理分区 %s/%d 的偏移量失败: %w", topic, partition, err)
+			}
+			// ResetOffset 只能回退偏移量，MarkOffset 只能前进，两者之一生效
+			pom.ResetOffset(offset, "")
+			pom.MarkOffset(offset, "")
+			poms = append(poms, pom)
+		}
+	}
+
+	om.Commit()
+	for _, pom := range poms {
+		pom.AsyncClose()
+	}
+	if err := om.Close(); err != nil {
+		return fmt.Errorf("关闭偏移量管理器失败: %w", err)
+	}
+
+	// 偏移量管理器关闭后，分区的错误通道已关闭，收集提交过程中的错误
+	var errs []error
+	for _, pom := range poms {
+		for err := range pom.Errors() {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ResetOffsets 重置消费者组的偏移量
+// 先按策略计算每个分区的目标偏移量，非 DryRun 时确认消费者组没有活跃成员后再提交
+// 参数:
+//   - req: 重置请求
+//
+// 返回:
+//   - []OffsetPlan: 按主题和分区排序的重置计划
+//   - error: 请求不合法时返回 ErrInvalidReset，消费者组仍有活跃成员时返回 ErrGroupNotEmpty
+func (s *Service) ResetOffsets(req ResetRequest) ([]OffsetPlan, error) {
+	topicPartitions, err := s.resetPartitions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.admin.ListConsumerGroupOffsets(req.Group, topicPartitions)
+	if err != nil {
+		return nil, fmt.Errorf("查询消费者组 %s 的偏移量失败: %w", req.Group, err)
+	}
+	if current.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("查询消费者组 %s 的偏移量失败: %w", req.Group, current.Err)
+	}
+
+	plans := make([]OffsetPlan, 0)
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			plan := OffsetPlan{Topic: topic, Partition: partition, Current: -1}
+			if block := current.GetBlock(topic, partition); block != nil && block.Err == sarama.ErrNoError {
+				plan.Current = block.Offset
+			}
+			if plan.Target, err = s.targetOffset(req, topic, partition); err != nil {
+				return nil, err
+			}
+			plans = append(plans, plan)
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Topic != plans[j].Topic {
+			return plans[i].Topic < plans[j].Topic
+		}
+		return plans[i].Partition < plans[j].Partition
+	})
+
+	if req.DryRun {
+		log.Printf("%s偏移量重置预览: group=%s, strategy=%s, 分区数=%d", logPrefix, req.Group, req.Strategy, len(plans))
+		return plans, nil
+	}
+
+	group, err := s.DescribeConsumerGroup(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if len(group.Members) > 0 {
+		return plans, fmt.Errorf("%w: group=%s, state=%s, 成员数=%d", ErrGroupNotEmpty, req.Group, group.State, len(group.Members))
+	}
+
+	offsets := make(map[string]map[int32]int64)
+	for _, plan := range plans {
+		if offsets[plan.Topic] == nil {
+			offsets[plan.Topic] = make(map[int32]int64)
+		}
+		offsets[plan.Topic][plan.Partition] = plan.Target
+	}
+	if err := s.writer.WriteOffsets(req.Group, offsets); err != nil {
+		log.Printf("%s提交重置后的偏移量失败: group=%s, error=%v", logPrefix, req.Group, err)
+		return plans, fmt.Errorf("提交消费者组 %s 的偏移量失败: %w", req.Group, err)
+	}
+	log.Printf("%s偏移量重置成功: group=%s, strategy=%s, 分区数=%d", logPrefix, req.Group, req.Strategy, len(plans))
+	return plans, nil
+}
+
+// resetPartitions 校验重置请求并返回要重置的主题和分区
+func (s *Service) resetPartitions(req ResetRequest) (map[string][]int32, error) {
+	if req.Group == "" {
+		return nil, fmt.Errorf("%w: 消费者组不能为空", ErrInvalidReset)
+	}
+	switch req.Strategy {
+	case ResetEarliest, ResetLatest:
+	case ResetTimestamp:
+		if req.Timestamp.IsZero() {
+			return nil, fmt.Errorf("%w: timestamp策略需要指定时间戳", ErrInvalidReset)
+		}
+	case ResetOffset:
+		if len(req.Offsets) == 0 {
+			return nil, fmt.Errorf("%w: offset策略需要指定分区的偏移量", ErrInvalidReset)
+		}
+	default:
+		return nil, fmt.Errorf("%w: 未知的重置策略 %q", ErrInvalidReset, req.Strategy)
+	}
+
+	topics := req.Topics
+	if len(topics) == 0 && req.Strategy == ResetOffset {
+		for topic := range req.Offsets {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("%w: 主题不能为空", ErrInvalidReset)
+	}
+
+	topicPartitions := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		partitions, err := s.client.Partitions(topic)
+		if err != nil {
+			return nil, fmt.Errorf("查询主题 %s 的分区失败: %w", topic, err)
+		}
+		if req.Strategy != ResetOffset {
+			topicPartitions[topic] = partitions
+			continue
+		}
+		for partition := range req.Offsets[topic] {
+			if !containsPartition(partitions, partition) {
+				return nil, fmt.Errorf("%w: 分区 %s/%d 不存在", ErrInvalidReset, topic, partition)
+			}
+			topicPartitions[topic] = append(topicPartitions[topic], partition)
+		}
+	}
+	return topicPartitions, nil
+}
+
+// targetOffset 按策略计算分区的目标偏移量
+// 指定的偏移量超出分区的有效范围时，调整到最早或最末尾的偏移量
+func (s *Service) targetOffset(req ResetRequest, topic string, partition int32) (int64, error) {
+	oldest, err := s.client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, fmt.Errorf("查询分区 %s/%d 的最早偏移量失败: %w", topic, partition, err)
+	}
+	newest, err := s.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, fmt.Errorf("查询分区 %s/%d 的高水位失败: %w", topic, partition, err)
+	}
+
+	var target int64
+	switch req.Strategy {
+	case ResetEarliest:
+		target = oldest
+	case ResetLatest:
+		target = newest
+	case ResetOffset:
+		target = req.Offsets[topic][partition]
+	case ResetTimestamp:
+		if target, err = s.client.GetOffset(topic, partition, req.Timestamp.UnixMilli()); err != nil {
+			return 0, fmt.Errorf("按时间戳查询分区 %s/%d 的偏移量失败: %w", topic, partition, err)
+		}
+		// 时间戳之后没有消息时返回-1，重置到分区末尾
+		if target < 0 {
+			target = newest
+		}
+	}
+	return min(max(target, oldest), newest), nil
+}
+
+// containsPartition 判断分区是否在列表中
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package admin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeWriter 记录提交的偏移量
+type fakeWriter struct {
+	written map[string]map[int32]int64
+}
+
+func (w *fakeWriter) WriteOffsets(_ string, offsets map[string]map[int32]int64) error {
+	w.written = offsets
+	return nil
+}
+
+// TestService_ResetOffsets 测试按不同策略计算目标偏移量，DryRun 不提交，消费者组有活跃成员时拒绝提交
+func TestService_ResetOffsets(t *testing.T) {
+	offsets := &sarama.OffsetFetchResponse{}
+	offsets.AddBlock("orders", 0, &sarama.OffsetFetchResponseBlock{Offset: 7})
+
+	client := &fakeClient{
+		partitions: map[string][]int32{"orders": {0, 1}},
+		oldest:     map[int32]int64{0: 2, 1: 0},
+		newest:     map[int32]int64{0: 10, 1: 5},
+		byTime:     map[int32]int64{0: 6, 1: -1},
+	}
+	empty := []*sarama.GroupDescription{{GroupId: "group", State: "Empty"}}
+	active := []*sarama.GroupDescription{{
+		GroupId: "group",
+		State:   "Stable",
+		Members: map[string]*sarama.GroupMemberDescription{"member-1": {ClientId: "client-1"}},
+	}}
+
+	tests := []struct {
+		name      string
+		req       ResetRequest
+		groups    []*sarama.GroupDescription
+		want      []OffsetPlan
+		wantErr   error
+		wantWrite bool
+	}{
+		{
+			name:   "重置到最早",
+			req:    ResetRequest{Group: "group", Topics: []string{"orders"}, Strategy: ResetEarliest},
+			groups: empty,
+			want: []OffsetPlan{
+				{Topic: "orders", Partition: 0, Current: 7, Target: 2},
+				{Topic: "orders", Partition: 1, Current: -1, Target: 0},
+			},
+			wantWrite: true,
+		},
+		{
+			name:   "重置到最新",
+			req:    ResetRequest{Group: "group", Topics: []string{"orders"}, Strategy: ResetLatest},
+			groups: empty,
+			want: []OffsetPlan{
+				{Topic: "orders", Partition: 0, Current: 7, Target: 10},
+				{Topic: "orders", Partition: 1, Current: -1, Target: 5},
+			},
+			wantWrite: true,
+		},
+		{
+			name: "按分区指定偏移量并限制在有效范围内",
+			req: ResetRequest{Group: "group", Strategy: ResetOffset,
+				Offsets: map[string]map[int32]int64{"orders": {0: 1}}},
+			groups:    empty,
+			want:      []OffsetPlan{{Topic: "orders", Partition: 0, Current: 7, Target: 2}},
+			wantWrite: true,
+		},
+		{
+			name: "按时间戳重置，时间戳之后没有消息时重置到末尾",
+			req: ResetRequest{Group: "group", Topics: []string{"orders"}, Strategy: ResetTimestamp,
+				Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			groups: empty,
+			want: []OffsetPlan{
+				{Topic: "orders", Partition: 0, Current: 7, Target: 6},
+				{Topic: "orders", Partition: 1, Current: -1, Target: 5},
+			},
+			wantWrite: true,
+		},
+		{
+			name:   "DryRun不检查成员也不提交",
+			req:    ResetRequest{Group: "group", Topics: []string{"orders"}, Strategy: ResetEarliest, DryRun: true},
+			groups: active,
+			want: []OffsetPlan{
+				{Topic: "orders", Partition: 0, Current: 7, Target: 2},
+				{Topic: "orders", Partition: 1, Current: -1, Target: 0},
+			},
+		},
+		{
+			name:    "消费者组有活跃成员",
+			req:     ResetRequest{Group: "group", Topics: []string{"orders"}, Strategy: ResetEarliest},
+			groups:  active,
+			wantErr: ErrGroupNotEmpty,
+		},
+		{
+			name:    "未知的重置策略",
+			req:     ResetRequest{Group: "group", Topics: []string{"orders"}, Strategy: "unknown"},
+			wantErr: ErrInvalidReset,
+		},
+		{
+			name: "指定的分区不存在",
+			req: ResetRequest{Group: "group", Strategy: ResetOffset,
+				Offsets: map[string]map[int32]int64{"orders": {9: 1}}},
+			wantErr: ErrInvalidReset,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &fakeWriter{}
+			s := newService(&fakeAdmin{offsets: offsets, groups: tt.groups}, client, writer)
+
+			got, err := s.ResetOffsets(tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResetOffsets() error = %v, 期望 %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("ResetOffsets() error = %v", err)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResetOffsets() = %+v, 期望 %+v", got, tt.want)
+			}
+
+			if !tt.wantWrite {
+				if writer.written != nil {
+					t.Errorf("不应提交偏移量, 实际提交 %v", writer.written)
+				}
+				return
+			}
+			for _, plan := range tt.want {
+				if writer.written[plan.Topic][plan.Partition] != plan.Target {
+					t.Errorf("提交的偏移量 = %v, 期望 %s/%d=%d", writer.written, plan.Topic, plan.Partition, plan.Target)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Header 归档的消息头
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"` // JSON中为base64编码
+}
+
+// Record 归档文件中的一行，对应一条Kafka消息
+// 消息键、消息头的值和消息体可能是二进制数据，JSON中使用base64编码
+type Record struct {
+	Topic     string    `json:"topic"`             // 来源主题
+	Partition int32     `json:"partition"`         // 来源分区
+	Offset    int64     `json:"offset"`            // 来源偏移量
+	Timestamp time.Time `json:"timestamp"`         // 消息时间戳
+	Key       []byte    `json:"key,omitempty"`     // 消息键，没有键时省略
+	Headers   []Header  `json:"headers,omitempty"` // 消息头，保持原有顺序
+	Value     []byte    `json:"value"`             // 消息体
+}
+
+// NewRecord 将消费到的消息转换为归档记录
+func NewRecord(msg *sarama.ConsumerMessage) Record {
+	r := Record{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+		Key:       msg.Key,
+		Value:     msg.Value,
+	}
+	for _, h := range msg.Headers {
+		if h != nil {
+			r.Headers = append(r.Headers, Header{Key: string(h.Key), Value: h.Value})
+		}
+	}
+	return r
+}
+
+// ProducerMessage 将归档记录转换为待发送的消息，保留消息键、消息头和原始时间戳
+// 参数:
+//   - topic: 目标主题，为空时发送回来源主题
+func (r Record) ProducerMessage(topic string) *sarama.ProducerMessage {
+	if topic == "" {
+		topic = r.Topic
+	}
+	msg := &sarama.ProducerMessage{
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(r.Value),
+		Timestamp: r.Timestamp,
+	}
+	if r.Key != nil {
+		msg.Key = sarama.ByteEncoder(r.Key)
+	}
+	for _, h := range r.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(h.Key), Value: h.Value})
+	}
+	return msg
+}
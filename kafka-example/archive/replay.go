@@ -0,0 +1,223 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// maxLineBytes 分段文件中单行的最大字节数
+const maxLineBytes = 64 * 1024 * 1024
+
+// Segments 返回主题已完成的分段文件，按文件名即创建时间排序
+// 参数:
+//   - dir: 归档目录
+//   - topic: 归档的主题
+//
+// 返回:
+//   - []string: 分段文件路径，正在写入的 .part 文件不包含在内
+//   - error: 读取目录失败时返回错误
+func Segments(dir, topic string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, topic))
+	if err != nil {
+		return nil, fmt.Errorf("读取主题归档目录失败: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, segmentExt) || strings.HasSuffix(name, segmentExt+gzipExt)) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, topic, name))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ReadSegment 按顺序读取分段文件中的记录
+// 压缩分段的末尾被截断时（写入中途进程退出）读到截断处为止
+// 参数:
+//   - path: 分段文件路径，以 .gz 结尾时按gzip解压
+//   - fn: 每条记录的回调，返回错误时停止读取并返回该错误
+func ReadSegment(path string, fn func(Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开分段失败: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, gzipExt) {
+		gz, err := gzip.NewReader(file)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取压缩分段失败: %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// 最后一行不完整，同样是写入中途进程退出
+			if !scanner.Scan() && (scanner.Err() == nil || errors.Is(scanner.Err(), io.ErrUnexpectedEOF)) {
+				log.Printf("%s分段末尾被截断，已读取到截断处: %s", logPrefix, path)
+				return nil
+			}
+			return fmt.Errorf("解析归档记录失败: %s:%d: %w", path, line, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Printf("%s分段末尾被截断，已读取到截断处: %s", logPrefix, path)
+			return nil
+		}
+		return fmt.Errorf("读取分段失败: %s: %w", path, err)
+	}
+	return nil
+}
+
+// Filter 重放时的记录过滤条件，零值表示不过滤
+type Filter struct {
+	From time.Time // 只重放时间戳不早于该时间的消息，为零时不限制
+	To   time.Time // 只重放时间戳早于该时间的消息，为零时不限制
+	Key  []byte    // 只重放消息键等于该值的消息，为nil时不限制
+}
+
+// Match 判断记录是否满足过滤条件
+func (f Filter) Match(rec Record) bool {
+	if !f.From.IsZero() && rec.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !rec.Timestamp.Before(f.To) {
+		return false
+	}
+	if f.Key != nil && !bytes.Equal(rec.Key, f.Key) {
+		return false
+	}
+	return true
+}
+
+// ReplayConfig 重放参数
+type ReplayConfig struct {
+	Topic  string  // 目标主题，为空时发送回记录的来源主题
+	Filter Filter  // 过滤条件
+	Rate   float64 // 每秒最多发送的消息数，不大于0时不限制
+	DryRun bool    // 只统计满足条件的记录，不发送
+}
+
+// ReplayStats 重放统计
+type ReplayStats struct {
+	Read    int `json:"read"`    // 读取的记录数
+	Matched int `json:"matched"` // 满足过滤条件的记录数
+	Sent    int `json:"sent"`    // 发送成功的记录数
+}
+
+// Replayer 将归档的分段重放到Kafka
+type Replayer struct {
+	producer sarama.SyncProducer
+	cfg      ReplayConfig
+	now      func() time.Time
+	next     time.Time // 按速率限制下一条消息最早的发送时间
+}
+
+// NewReplayer 创建重放器
+// 参数:
+//   - producer: 发送消息的同步生产者，DryRun 时可以为空
+//   - cfg: 重放参数
+func NewReplayer(producer sarama.SyncProducer, cfg ReplayConfig) *Replayer {
+	return &Replayer{producer: producer, cfg: cfg, now: time.Now}
+}
+
+// Replay 按顺序重放分段文件中满足条件的记录
+// 遇到第一个发送失败的记录即停止，返回的统计可用于确认已发送到哪里
+// 参数:
+//   - ctx: 上下文，取消后停止重放
+//   - paths: 分段文件路径，按给定顺序重放
+//
+// 返回:
+//   - ReplayStats: 重放统计
+//   - error: 读取或发送失败、上下文取消时返回错误
+func (r *Replayer) Replay(ctx context.Context, paths []string) (ReplayStats, error) {
+	var stats ReplayStats
+	for _, path := range paths {
+		log.Printf("%s正在重放分段: %s", logPrefix, path)
+		err := ReadSegment(path, func(rec Record) error {
+			stats.Read++
+			if !r.cfg.Filter.Match(rec) {
+				return nil
+			}
+			stats.Matched++
+			if r.cfg.DryRun {
+				return nil
+			}
+			if err := r.wait(ctx); err != nil {
+				return err
+			}
+			msg := rec.ProducerMessage(r.cfg.Topic)
+			if _, _, err := r.producer.SendMessage(msg); err != nil {
+				return fmt.Errorf("重放消息失败: %s/%d/%d -> %s: %w", rec.Topic, rec.Partition, rec.Offset, msg.Topic, err)
+			}
+			stats.Sent++
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	log.Printf("%s重放完成: read=%d, matched=%d, sent=%d", logPrefix, stats.Read, stats.Matched, stats.Sent)
+	return stats, nil
+}
+
+// wait 按速率限制等待到下一条消息的发送时间
+func (r *Replayer) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.cfg.Rate <= 0 {
+		return nil
+	}
+	now := r.now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(time.Duration(float64(time.Second) / r.cfg.Rate))
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,170 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// TestFilter_Match 测试按时间范围和消息键过滤记录
+func TestFilter_Match(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := Record{Timestamp: base, Key: []byte("k1")}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "不过滤", want: true},
+		{name: "起始时间包含在内", filter: Filter{From: base}, want: true},
+		{name: "早于起始时间", filter: Filter{From: base.Add(time.Second)}, want: false},
+		{name: "结束时间不包含在内", filter: Filter{To: base}, want: false},
+		{name: "早于结束时间", filter: Filter{To: base.Add(time.Second)}, want: true},
+		{name: "消息键相同", filter: Filter{Key: []byte("k1")}, want: true},
+		{name: "消息键不同", filter: Filter{Key: []byte("k2")}, want: false},
+		{name: "过滤空键", filter: Filter{Key: []byte{}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(rec); got != tt.want {
+				t.Errorf("Match() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestReplayer_Replay 测试将归档的分段重放到Kafka
+func TestReplayer_Replay(t *testing.T) {
+	w, dir := newTestWriter(t, true, 1000)
+	records := testRecords("orders", 9) // 时间戳间隔1分钟，消息键依次为 key-0、key-1、key-2
+	if err := w.Write(records...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := Segments(dir, "orders")
+	if err != nil || len(paths) < 2 {
+		t.Fatalf("Segments() = %d 个分段, error = %v, 期望多个分段", len(paths), err)
+	}
+	errSend := errors.New("broker不可用")
+
+	tests := []struct {
+		name      string
+		cfg       ReplayConfig
+		sendErr   error // 第一条消息发送失败
+		wantTopic string
+		wantKey   string // 不为空时期望所有消息都是该键
+		want      ReplayStats
+		wantErr   bool
+	}{
+		{
+			name:      "全部重放回来源主题",
+			wantTopic: "orders",
+			want:      ReplayStats{Read: 9, Matched: 9, Sent: 9},
+		},
+		{
+			name: "按时间范围和消息键过滤并发送到目标主题",
+			cfg: ReplayConfig{Topic: "orders-replay", Filter: Filter{
+				From: records[1].Timestamp,
+				To:   records[8].Timestamp,
+				Key:  []byte("key-1"),
+			}},
+			wantTopic: "orders-replay",
+			wantKey:   "key-1",
+			want:      ReplayStats{Read: 9, Matched: 3, Sent: 3},
+		},
+		{
+			name: "只统计不发送",
+			cfg:  ReplayConfig{DryRun: true, Filter: Filter{Key: []byte("key-0")}},
+			want: ReplayStats{Read: 9, Matched: 3},
+		},
+		{
+			name:    "发送失败时停止",
+			sendErr: errSend,
+			want:    ReplayStats{Read: 1, Matched: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mocks.NewTestConfig()
+			cfg.Producer.Return.Successes = true
+			producer := mocks.NewSyncProducer(t, cfg)
+			defer producer.Close()
+			switch {
+			case tt.sendErr != nil:
+				producer.ExpectSendMessageAndFail(tt.sendErr)
+			case !tt.cfg.DryRun:
+				for i := 0; i < tt.want.Sent; i++ {
+					producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+						if msg.Topic != tt.wantTopic {
+							t.Errorf("目标主题 = %s, 期望 %s", msg.Topic, tt.wantTopic)
+						}
+						key, _ := msg.Key.Encode()
+						if tt.wantKey != "" && string(key) != tt.wantKey {
+							t.Errorf("消息键 = %s, 期望 %s", key, tt.wantKey)
+						}
+						if len(msg.Headers) != 1 || msg.Timestamp.IsZero() {
+							t.Errorf("消息头或时间戳未保留: %+v", msg)
+						}
+						return nil
+					})
+				}
+			}
+
+			stats, err := NewReplayer(producer, tt.cfg).Replay(context.Background(), paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Replay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.sendErr != nil && !errors.Is(err, tt.sendErr) {
+				t.Errorf("Replay() error = %v, 期望 %v", err, tt.sendErr)
+			}
+			if stats != tt.want {
+				t.Errorf("Replay() stats = %+v, 期望 %+v", stats, tt.want)
+			}
+		})
+	}
+}
+
+// TestReplayer_Rate 测试按速率限制发送，上下文取消后停止
+func TestReplayer_Rate(t *testing.T) {
+	w, dir := newTestWriter(t, false, 1<<20)
+	if err := w.Write(testRecords("orders", 6)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := Segments(dir, "orders")
+
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	producer := mocks.NewSyncProducer(t, cfg)
+	defer producer.Close()
+	for i := 0; i < 6; i++ {
+		producer.ExpectSendMessageAndSucceed()
+	}
+
+	start := time.Now()
+	stats, err := NewReplayer(producer, ReplayConfig{Rate: 100}).Replay(context.Background(), paths)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	// 第一条立即发送，其余每条间隔10ms
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("发送 %d 条消息用时 %v, 期望不少于 50ms", stats.Sent, elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewReplayer(producer, ReplayConfig{}).Replay(ctx, paths); !errors.Is(err, context.Canceled) {
+		t.Errorf("上下文取消后 Replay() error = %v, 期望 context.Canceled", err)
+	}
+}
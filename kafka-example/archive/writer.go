@@ -0,0 +1,341 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"kafka-example/config"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 分段文件命名
+const (
+	segmentExt = ".jsonl" // 分段文件扩展名，每行一条 Record
+	gzipExt    = ".gz"    // 压缩分段文件在 .jsonl 之后追加的扩展名
+	partSuffix = ".part"  // 正在写入的分段文件后缀，滚动时去掉，重放只读取已完成的分段
+
+	segmentTimeLayout = "20060102T150405Z" // 分段文件名中的创建时间，按文件名排序即按创建时间排序
+
+	logPrefix = "[Archive] "
+
+	minWriteBackoff = 1 * time.Second  // 归档写入失败后的初始等待时间
+	maxWriteBackoff = 30 * time.Second // 归档写入失败后的最大等待时间
+)
+
+// ErrClosed 归档写入器已关闭
+var ErrClosed = errors.New("归档写入器已关闭")
+
+// Writer 按主题写入滚动的JSONL分段文件
+// 每个主题在归档目录下有一个子目录，同一时间只有一个正在写入的分段；分段超过大小上限或写入时间上限后滚动。
+// 正在写入的分段带有 .part 后缀，滚动时去掉；进程异常退出遗留的 .part 文件在下次启动时完成滚动
+type Writer struct {
+	dir      string        // 归档目录
+	compress bool          // 是否用gzip压缩
+	maxBytes int64         // 分段的最大字节数（压缩前）
+	maxAge   time.Duration // 分段的最长写入时间
+	now      func() time.Time
+
+	mu       sync.Mutex          // 保护以下字段
+	segments map[string]*segment // 正在写入的分段，键为主题
+	seq      int                 // 分段序号，避免同一秒内创建的分段重名
+	closed   bool
+}
+
+// segment 正在写入的分段文件
+type segment struct {
+	path     string        // 滚动后的文件路径
+	file     *os.File      // 带 .part 后缀的文件
+	gz       *gzip.Writer  // 压缩写入器，不压缩时为空
+	buf      *bufio.Writer // 写入缓冲
+	size     int64         // 已写入的字节数（压缩前）
+	openedAt time.Time     // 创建时间
+}
+
+// NewWriter 创建归档写入器，归档目录不存在时自动创建
+// 参数:
+//   - cfg: 归档配置
+//
+// 返回:
+//   - *Writer: 归档写入器
+//   - error: 创建目录或完成遗留分段失败时返回错误
+func NewWriter(cfg config.ArchiveConfig) (*Writer, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建归档目录失败: %w", err)
+	}
+	w := &Writer{
+		dir:      cfg.Dir,
+		compress: cfg.Compress,
+		maxBytes: cfg.MaxSegmentBytes,
+		maxAge:   cfg.MaxSegmentAge,
+		now:      time.Now,
+		segments: make(map[string]*segment),
+	}
+	if err := w.recoverParts(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// recoverParts 完成上次运行遗留的分段
+// 这些分段中已同步到磁盘的记录都已提交偏移量，不能丢弃；压缩分段的末尾可能被截断，读取时会跳过截断的部分
+func (w *Writer) recoverParts() error {
+	return filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, partSuffix) {
+			return nil
+		}
+		final := strings.TrimSuffix(path, partSuffix)
+		if err := os.Rename(path, final); err != nil {
+			return fmt.Errorf("完成遗留分段失败: %w", err)
+		}
+		log.Printf("%s已完成遗留的分段: %s", logPrefix, final)
+		return nil
+	})
+}
+
+// Write 将记录追加到各自主题的分段，写入前分段超过大小上限时先滚动
+// 写入的数据可能还在缓冲中，需要调用 Sync 才能保证落盘
+func (w *Writer) Write(records ...Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("编码归档记录失败: %w", err)
+		}
+		line = append(line, '\n')
+
+		seg := w.segments[rec.Topic]
+		if seg != nil && seg.size+int64(len(line)) > w.maxBytes {
+			if err := w.rotate(rec.Topic); err != nil {
+				return err
+			}
+			seg = nil
+		}
+		if seg == nil {
+			if seg, err = w.open(rec.Topic); err != nil {
+				return err
+			}
+		}
+		if _, err := seg.buf.Write(line); err != nil {
+			// 分段末尾可能只写入了半行，结束该分段，读取时按截断处理
+			_ = w.rotate(rec.Topic)
+			return fmt.Errorf("写入分段失败: %s: %w", seg.path, err)
+		}
+		seg.size += int64(len(line))
+	}
+	return nil
+}
+
+// Sync 将所有正在写入的分段刷新并同步到磁盘
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for topic, seg := range w.segments {
+		if err := seg.sync(); err != nil {
+			_ = w.rotate(topic)
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateExpired 滚动写入时间超过上限的分段
+func (w *Writer) RotateExpired() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for topic, seg := range w.segments {
+		if w.now().Sub(seg.openedAt) >= w.maxAge {
+			errs = append(errs, w.rotate(topic))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunRotation 定期滚动写入时间超过上限的分段，直到上下文取消
+// 没有新消息时分段也会按时滚动，使已归档的消息及时出现在可重放的分段中
+func (w *Writer) RunRotation(ctx context.Context) {
+	interval := w.maxAge / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.RotateExpired(); err != nil {
+				log.Printf("%s滚动分段失败: %v", logPrefix, err)
+			}
+		}
+	}
+}
+
+// Close 滚动所有正在写入的分段并关闭写入器
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	var errs []error
+	for topic := range w.segments {
+		errs = append(errs, w.rotate(topic))
+	}
+	return errors.Join(errs...)
+}
+
+// open 为主题创建新的分段，调用方需持有锁
+func (w *Writer) open(topic string) (*segment, error) {
+	dir := filepath.Join(w.dir, topic)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建主题归档目录失败: %w", err)
+	}
+	ext := segmentExt
+	if w.compress {
+		ext += gzipExt
+	}
+
+	now := w.now()
+	for {
+		w.seq++
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s-%04d%s", topic, now.UTC().Format(segmentTimeLayout), w.seq%10000, ext))
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		file, err := os.OpenFile(path+partSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("创建分段失败: %w", err)
+		}
+
+		seg := &segment{path: path, file: file, openedAt: now}
+		var out io.Writer = file
+		if w.compress {
+			seg.gz = gzip.NewWriter(file)
+			out = seg.gz
+		}
+		seg.buf = bufio.NewWriter(out)
+		w.segments[topic] = seg
+		log.Printf("%s创建分段: %s", logPrefix, path)
+		return seg, nil
+	}
+}
+
+// rotate 完成主题正在写入的分段并去掉 .part 后缀，调用方需持有锁
+func (w *Writer) rotate(topic string) error {
+	seg := w.segments[topic]
+	if seg == nil {
+		return nil
+	}
+	delete(w.segments, topic)
+
+	err := seg.buf.Flush()
+	if seg.gz != nil {
+		err = errors.Join(err, seg.gz.Close())
+	}
+	err = errors.Join(err, seg.file.Sync(), seg.file.Close())
+	if err != nil {
+		return fmt.Errorf("关闭分段失败: %s: %w", seg.path, err)
+	}
+	if err := os.Rename(seg.file.Name(), seg.path); err != nil {
+		return fmt.Errorf("完成分段失败: %w", err)
+	}
+	log.Printf("%s分段已完成: %s, size=%d", logPrefix, seg.path, seg.size)
+	return nil
+}
+
+// sync 刷新缓冲和压缩数据并同步到磁盘
+func (s *segment) sync() error {
+	if err := s.buf.Flush(); err != nil {
+		return fmt.Errorf("刷新分段失败: %s: %w", s.path, err)
+	}
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return fmt.Errorf("刷新分段失败: %s: %w", s.path, err)
+		}
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("同步分段失败: %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Sink 归档消费者的消息处理器，实现 consumer.Handler 和 consumer.BatchHandler 接口
+// 整批写入并同步到磁盘后才返回，偏移量随后提交，保证已提交的消息都已归档。
+// 写入失败时按指数退避重试直到成功或会话结束，不会跳过消息；重试时同一批消息可能重复归档，重放时按需去重
+type Sink struct {
+	writer *Writer
+}
+
+// NewSink 创建写入指定归档写入器的消息处理器
+func NewSink(writer *Writer) *Sink {
+	return &Sink{writer: writer}
+}
+
+// HandleBatch 归档一批消息
+// 消息按消费到的原样归档，claim-check 转存的大消息只保存引用
+func (s *Sink) HandleBatch(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+	records := make([]Record, len(msgs))
+	for i, msg := range msgs {
+		records[i] = NewRecord(msg)
+	}
+
+	backoff := minWriteBackoff
+	for {
+		err := s.write(records)
+		if err == nil || errors.Is(err, ErrClosed) {
+			return err
+		}
+		log.Printf("%s归档失败，%v 后重试: count=%d, error=%v", logPrefix, backoff, len(records), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxWriteBackoff {
+			backoff = maxWriteBackoff
+		}
+	}
+}
+
+// write 写入记录并同步到磁盘
+func (s *Sink) write(records []Record) error {
+	if err := s.writer.Write(records...); err != nil {
+		return err
+	}
+	return s.writer.Sync()
+}
+
+// Handle 归档单条消息，未使用 batch 提交模式时调用
+func (s *Sink) Handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	return s.HandleBatch(ctx, []*sarama.ConsumerMessage{msg})
+}
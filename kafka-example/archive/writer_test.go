@@ -0,0 +1,257 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"kafka-example/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// newTestWriter 在临时目录中创建归档写入器
+func newTestWriter(t *testing.T, compress bool, maxBytes int64) (*Writer, string) {
+	dir := t.TempDir()
+	w, err := NewWriter(config.ArchiveConfig{Dir: dir, Compress: compress, MaxSegmentBytes: maxBytes, MaxSegmentAge: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	return w, dir
+}
+
+// testRecords 生成 n 条归档记录，消息体包含二进制数据
+func testRecords(topic string, n int) []Record {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{
+			Topic:     topic,
+			Partition: int32(i % 2),
+			Offset:    int64(i),
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+			Key:       []byte(fmt.Sprintf("key-%d", i%3)),
+			Headers:   []Header{{Key: "trace", Value: []byte{0, 1, 2}}},
+			Value:     append([]byte{0xff, '\n'}, bytes.Repeat([]byte("v"), 50)...),
+		}
+	}
+	return records
+}
+
+// readAll 读取主题的所有已完成分段
+func readAll(t *testing.T, dir, topic string) []Record {
+	paths, err := Segments(dir, topic)
+	if err != nil {
+		t.Fatalf("Segments() error = %v", err)
+	}
+	var records []Record
+	for _, path := range paths {
+		if err := ReadSegment(path, func(rec Record) error {
+			records = append(records, rec)
+			return nil
+		}); err != nil {
+			t.Fatalf("ReadSegment() error = %v", err)
+		}
+	}
+	return records
+}
+
+// assertRecords 比较读回的记录与写入的记录
+func assertRecords(t *testing.T, got, want []Record) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("读回 %d 条记录, 期望 %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Topic != w.Topic || g.Partition != w.Partition || g.Offset != w.Offset || !g.Timestamp.Equal(w.Timestamp) ||
+			!bytes.Equal(g.Key, w.Key) || !bytes.Equal(g.Value, w.Value) || len(g.Headers) != len(w.Headers) {
+			t.Fatalf("第 %d 条记录 = %+v, 期望 %+v", i, g, w)
+		}
+	}
+}
+
+// TestWriter_Rotation 测试分段按大小滚动，读回的记录与写入的一致
+func TestWriter_Rotation(t *testing.T) {
+	tests := []struct {
+		name         string
+		compress     bool
+		maxBytes     int64
+		wantSegments int
+	}{
+		{name: "未超过大小上限时只有一个分段", maxBytes: 1 << 20, wantSegments: 1},
+		{name: "超过大小上限时滚动", maxBytes: 1000, wantSegments: 3},
+		{name: "压缩分段", compress: true, maxBytes: 1000, wantSegments: 3},
+		{name: "单条记录超过上限时独占一个分段", maxBytes: 10, wantSegments: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, dir := newTestWriter(t, tt.compress, tt.maxBytes)
+			records := testRecords("orders", 10)
+			for _, rec := range records {
+				if err := w.Write(rec); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			paths, err := Segments(dir, "orders")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != tt.wantSegments {
+				t.Errorf("分段数 = %d, 期望 %d", len(paths), tt.wantSegments)
+			}
+			for _, path := range paths {
+				if got := strings.HasSuffix(path, ".jsonl.gz"); got != tt.compress {
+					t.Errorf("分段 %s 是否压缩 = %v, 期望 %v", path, got, tt.compress)
+				}
+			}
+			assertRecords(t, readAll(t, dir, "orders"), records)
+
+			if err := w.Write(records[0]); !errors.Is(err, ErrClosed) {
+				t.Errorf("关闭后 Write() error = %v, 期望 ErrClosed", err)
+			}
+		})
+	}
+}
+
+// TestWriter_RotateExpired 测试分段写入时间超过上限后滚动，未完成的分段不参与重放
+func TestWriter_RotateExpired(t *testing.T) {
+	w, dir := newTestWriter(t, false, 1<<20)
+	now := time.Now()
+	w.now = func() time.Time { return now }
+	records := testRecords("orders", 2)
+
+	if err := w.Write(records[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RotateExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, dir, "orders"); len(got) != 0 {
+		t.Fatalf("未到期的分段不应完成, 读到 %d 条记录", len(got))
+	}
+
+	now = now.Add(time.Hour)
+	if err := w.RotateExpired(); err != nil {
+		t.Fatal(err)
+	}
+	assertRecords(t, readAll(t, dir, "orders"), records[:1])
+
+	// 滚动后的写入创建新分段
+	if err := w.Write(records[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertRecords(t, readAll(t, dir, "orders"), records)
+	if paths, _ := Segments(dir, "orders"); len(paths) != 2 {
+		t.Errorf("分段数 = %d, 期望 2", len(paths))
+	}
+}
+
+// TestWriter_RecoverParts 测试进程异常退出后，已同步的记录在下次启动时可以读取
+func TestWriter_RecoverParts(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			w, dir := newTestWriter(t, compress, 1<<20)
+			records := testRecords("orders", 5)
+			if err := w.Write(records[:3]...); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			// 模拟进程退出：未同步的记录只写入了一部分，gzip也没有写入结尾
+			seg := w.segments["orders"]
+			if err := w.Write(records[3:]...); err != nil {
+				t.Fatal(err)
+			}
+			_ = seg.buf.Flush()
+			if seg.gz != nil {
+				_ = seg.gz.Flush()
+			}
+			info, err := seg.file.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := seg.file.Truncate(info.Size() - 10); err != nil {
+				t.Fatal(err)
+			}
+			_ = seg.file.Close()
+
+			if _, err := NewWriter(config.ArchiveConfig{Dir: dir, MaxSegmentBytes: 1 << 20, MaxSegmentAge: time.Hour}); err != nil {
+				t.Fatalf("NewWriter() error = %v", err)
+			}
+			got := readAll(t, dir, "orders")
+			if len(got) < 3 {
+				t.Fatalf("读回 %d 条记录, 已同步的 3 条记录不应丢失", len(got))
+			}
+			assertRecords(t, got[:3], records[:3])
+		})
+	}
+}
+
+// TestReadSegment_Corrupted 测试分段中间的记录损坏时返回错误
+func TestReadSegment_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders-1.jsonl")
+	content := `{"topic":"orders","offset":1,"value":"YQ=="}` + "\nnot json\n" + `{"topic":"orders","offset":2,"value":"Yg=="}` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	err := ReadSegment(path, func(Record) error {
+		n++
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("ReadSegment() error = %v, 期望指出第2行", err)
+	}
+	if n != 1 {
+		t.Errorf("回调次数 = %d, 期望 1", n)
+	}
+}
+
+// TestSink_HandleBatch 测试归档消费到的消息
+func TestSink_HandleBatch(t *testing.T) {
+	w, dir := newTestWriter(t, true, 1<<20)
+	sink := NewSink(w)
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	msgs := []*sarama.ConsumerMessage{
+		{Topic: "orders", Partition: 1, Offset: 10, Timestamp: ts, Key: []byte("k"), Value: []byte("a"),
+			Headers: []*sarama.RecordHeader{{Key: []byte("h"), Value: []byte("v")}}},
+		{Topic: "payments", Partition: 0, Offset: 3, Timestamp: ts, Value: []byte("b")},
+	}
+	if err := sink.HandleBatch(context.Background(), msgs); err != nil {
+		t.Fatalf("HandleBatch() error = %v", err)
+	}
+	if err := sink.Handle(context.Background(), &sarama.ConsumerMessage{Topic: "orders", Offset: 11, Timestamp: ts, Value: []byte("c")}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	orders := readAll(t, dir, "orders")
+	if len(orders) != 2 || string(orders[0].Key) != "k" || orders[0].Headers[0].Key != "h" || string(orders[1].Value) != "c" {
+		t.Errorf("orders 归档记录 = %+v", orders)
+	}
+	if payments := readAll(t, dir, "payments"); len(payments) != 1 || payments[0].Key != nil {
+		t.Errorf("payments 归档记录 = %+v", payments)
+	}
+
+	// 写入器关闭后立即返回，不会无限重试
+	if err := sink.HandleBatch(context.Background(), msgs); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后 HandleBatch() error = %v, 期望 ErrClosed", err)
+	}
+}
@@ -0,0 +1,327 @@
+package claimcheck
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"kafka-example/config"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 大消息使用的消息头
+const (
+	HeaderRef      = "claim-check-ref"      // 消息体在blob存储中的键，消息体本身为空
+	HeaderEncoding = "claim-check-encoding" // 消息体的压缩方式，目前只有 gzip
+	HeaderSize     = "claim-check-size"     // 压缩或转存前消息体的原始字节数
+
+	encodingGzip = "gzip"
+)
+
+// inlineHeadroom 消息键、消息头和记录格式的预留字节数
+// sarama按整条消息的大小检查 Producer.MaxMessageBytes，消息体需要给它们留出空间
+const inlineHeadroom = 1024
+
+// maxResolvedBytes 解压后消息体的字节数上限，防止伪造的压缩数据耗尽内存
+const maxResolvedBytes = 256 << 20
+
+// ErrBlobNotFound blob存储中不存在指定的键，通常是已被保留期清理
+var ErrBlobNotFound = errors.New("blob不存在")
+
+// Stats 大消息处理的统计
+type Stats struct {
+	Compressed int64 `json:"compressed"` // 压缩后发送的消息数
+	Offloaded  int64 `json:"offloaded"`  // 转存到blob存储的消息数
+	Resolved   int64 `json:"resolved"`   // 消费时从blob存储取回的消息数
+	Cleaned    int64 `json:"cleaned"`    // 保留期清理删除的blob数
+}
+
+// ClaimCheck 大消息的claim-check处理
+// 生产者发送前调用 Offload：超过压缩阈值的消息体用gzip压缩，压缩后仍超过内联上限的转存到blob存储，
+// 消息中只保留引用消息头；消费者处理前调用 Resolve 还原消息体。可以在生产者和消费者之间共享
+type ClaimCheck struct {
+	store             BlobStore
+	compressThreshold int           // 消息体达到该字节数时压缩，0表示不压缩
+	maxInline         int           // 消息体超过该字节数时转存到blob存储
+	retention         time.Duration // blob的保留时间
+	cleanupInterval   time.Duration // 保留期清理的间隔
+	now               func() time.Time
+
+	compressed atomic.Int64
+	offloaded  atomic.Int64
+	resolved   atomic.Int64
+	cleaned    atomic.Int64
+}
+
+// New 创建claim-check处理器
+// 参数:
+//   - store: 保存大消息体的blob存储
+//   - cfg: 压缩阈值、内联上限和保留期配置
+//   - maxMessageBytes: 生产者的 Producer.MaxMessageBytes，未配置内联上限时据此计算
+//
+// 返回:
+//   - *ClaimCheck: claim-check处理器
+func New(store BlobStore, cfg config.ClaimCheckConfig, maxMessageBytes int) *ClaimCheck {
+	maxInline := cfg.MaxInlineBytes
+	if maxInline <= 0 {
+		maxInline = maxMessageBytes - inlineHeadroom
+	}
+	return &ClaimCheck{
+		store:             store,
+		compressThreshold: cfg.CompressThreshold,
+		maxInline:         maxInline,
+		retention:         cfg.Retention,
+		cleanupInterval:   cfg.CleanupInterval,
+		now:               time.Now,
+	}
+}
+
+// Offload 在发送前压缩或转存消息体
+// 已经处理过的消息（重试、从死信队列重放）原样返回，避免重复压缩或转存
+// 参数:
+//   - ctx: 写入blob存储使用的上下文
+//   - msg: 要发送的消息，消息体和消息头会被替换
+//
+// 返回:
+//   - error: 读取消息体、压缩或写入blob存储失败时返回错误
+func (c *ClaimCheck) Offload(ctx context.Context, msg *sarama.ProducerMessage) error {
+	if msg.Value == nil || producerHeader(msg, HeaderRef) != "" || producerHeader(msg, HeaderEncoding) != "" {
+		return nil
+	}
+	value, err := msg.Value.Encode()
+	if err != nil {
+		return fmt.Errorf("读取消息体失败: %w", err)
+	}
+	size := len(value)
+	encoding := ""
+
+	if c.compressThreshold > 0 && size >= c.compressThreshold {
+		compressed, err := gzipBytes(value)
+		if err != nil {
+			return fmt.Errorf("压缩消息体失败: %w", err)
+		}
+		// 压缩后更大时（如已压缩的图片）保持原样
+		if len(compressed) < size {
+			value = compressed
+			encoding = encodingGzip
+		}
+	}
+
+	if len(value) <= c.maxInline {
+		if encoding == "" {
+			return nil
+		}
+		msg.Value = sarama.ByteEncoder(value)
+		setProducerHeader(msg, HeaderEncoding, encoding)
+		setProducerHeader(msg, HeaderSize, fmt.Sprint(size))
+		c.compressed.Add(1)
+		return nil
+	}
+
+	key, err := newKey(c.now())
+	if err != nil {
+		return err
+	}
+	if err := c.store.Put(ctx, key, value); err != nil {
+		return fmt.Errorf("转存消息体失败: %w", err)
+	}
+	msg.Value = sarama.ByteEncoder(nil)
+	setProducerHeader(msg, HeaderRef, key)
+	if encoding != "" {
+		setProducerHeader(msg, HeaderEncoding, encoding)
+	}
+	setProducerHeader(msg, HeaderSize, fmt.Sprint(size))
+	c.offloaded.Add(1)
+	log.Printf("[ClaimCheck] 消息体已转存: topic=%s, key=%s, size=%d, stored=%d", msg.Topic, key, size, len(value))
+	return nil
+}
+
+// Resolve 在处理前还原消息体
+// 从blob存储取回转存的消息体并解压，返回去掉claim-check消息头的消息副本，原消息保持不变，
+// 因此写入死信队列的仍是只带引用的小消息，重放时可以再次还原
+// 参数:
+//   - ctx: 读取blob存储使用的上下文
+//   - msg: 消费到的消息
+//
+// 返回:
+//   - *sarama.ConsumerMessage: 还原后的消息，不是大消息时返回原消息
+//   - error: blob不存在、读取失败或解压失败时返回错误
+func (c *ClaimCheck) Resolve(ctx context.Context, msg *sarama.ConsumerMessage) (*sarama.ConsumerMessage, error) {
+	ref := consumerHeader(msg, HeaderRef)
+	encoding := consumerHeader(msg, HeaderEncoding)
+	if ref == "" && encoding == "" {
+		return msg, nil
+	}
+
+	value := msg.Value
+	if ref != "" {
+		data, err := c.store.Get(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("取回消息体失败: key=%s: %w", ref, err)
+		}
+		value = data
+	}
+	switch encoding {
+	case "":
+	case encodingGzip:
+		data, err := gunzipBytes(value, resolvedLimit(consumerHeader(msg, HeaderSize)))
+		if err != nil {
+			return nil, fmt.Errorf("解压消息体失败: %w", err)
+		}
+		value = data
+	default:
+		return nil, fmt.Errorf("未知的消息体压缩方式: %s", encoding)
+	}
+	if ref != "" {
+		c.resolved.Add(1)
+	}
+
+	resolved := *msg
+	resolved.Value = value
+	resolved.Headers = make([]*sarama.RecordHeader, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+		switch string(h.Key) {
+		case HeaderRef, HeaderEncoding, HeaderSize:
+		default:
+			resolved.Headers = append(resolved.Headers, h)
+		}
+	}
+	return &resolved, nil
+}
+
+// Cleanup 删除超过保留期的blob
+// 返回:
+//   - int: 删除的blob数
+//   - error: 清理失败时返回错误
+func (c *ClaimCheck) Cleanup(ctx context.Context) (int, error) {
+	removed, err := c.store.Sweep(ctx, c.now().Add(-c.retention))
+	c.cleaned.Add(int64(removed))
+	return removed, err
+}
+
+// RunRetention 按清理间隔定期删除超过保留期的blob，直到上下文取消
+// 保留期应大于消费者处理积压消息可能需要的时间，否则消费时blob可能已被删除
+func (c *ClaimCheck) RunRetention(ctx context.Context) {
+	interval := c.cleanupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := c.Cleanup(ctx)
+			if err != nil {
+				log.Printf("[ClaimCheck] 清理过期blob失败: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("[ClaimCheck] 已清理过期blob: %d", removed)
+			}
+		}
+	}
+}
+
+// Stats 返回大消息处理的统计
+func (c *ClaimCheck) Stats() Stats {
+	return Stats{
+		Compressed: c.compressed.Load(),
+		Offloaded:  c.offloaded.Load(),
+		Resolved:   c.resolved.Load(),
+		Cleaned:    c.cleaned.Load(),
+	}
+}
+
+// newKey 生成blob的键，以写入日期开头便于按日期排查
+func newKey(now time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成blob键失败: %w", err)
+	}
+	return now.UTC().Format("20060102") + "-" + hex.EncodeToString(b), nil
+}
+
+// gzipBytes 使用gzip压缩数据
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipBytes 解压gzip数据，解压后超过limit字节时返回错误
+func gunzipBytes(data []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("解压后的消息体超过 %d 字节", limit)
+	}
+	return out, nil
+}
+
+// resolvedLimit 根据原始字节数消息头计算解压上限，消息头缺失或不合法时使用 maxResolvedBytes
+func resolvedLimit(size string) int64 {
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 || n > maxResolvedBytes {
+		return maxResolvedBytes
+	}
+	return n
+}
+
+// producerHeader 返回生产者消息中指定消息头的值
+func producerHeader(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// setProducerHeader 设置生产者消息的消息头，已存在时覆盖
+func setProducerHeader(msg *sarama.ProducerMessage, key, value string) {
+	for i, h := range msg.Headers {
+		if string(h.Key) == key {
+			msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// consumerHeader 返回消费者消息中指定消息头的值
+func consumerHeader(msg *sarama.ConsumerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
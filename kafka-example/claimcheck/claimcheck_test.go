@@ -0,0 +1,233 @@
+package claimcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"kafka-example/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// newTestClaimCheck 创建压缩阈值100字节、内联上限1000字节的claim-check处理器
+func newTestClaimCheck(t *testing.T) (*ClaimCheck, *FileStore) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	c := New(store, config.ClaimCheckConfig{CompressThreshold: 100, MaxInlineBytes: 1000, Retention: time.Hour}, 0)
+	return c, store
+}
+
+// randomBytes 生成无法压缩的随机数据
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// consumed 将生产者消息转换为消费者收到的消息
+func consumed(t *testing.T, msg *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	value, err := msg.Value.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &sarama.ConsumerMessage{Topic: msg.Topic, Value: value}
+	for i := range msg.Headers {
+		out.Headers = append(out.Headers, &msg.Headers[i])
+	}
+	return out
+}
+
+// TestClaimCheck_OffloadResolve 测试不同大小的消息体经过压缩或转存后，消费时还原为原始内容
+func TestClaimCheck_OffloadResolve(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        []byte
+		wantEncoding string
+		wantRef      bool
+	}{
+		{name: "小消息不处理", value: []byte("hello")},
+		{name: "超过压缩阈值时压缩", value: bytes.Repeat([]byte("a"), 500), wantEncoding: "gzip"},
+		{name: "压缩后更大时保持原样", value: randomBytes(t, 500)},
+		{name: "无法压缩的大消息转存", value: randomBytes(t, 5000), wantRef: true},
+		{name: "压缩后仍然过大时压缩并转存", value: bytes.Repeat([]byte("abcdefghij"), 100000), wantEncoding: "gzip", wantRef: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClaimCheck(t)
+			msg := &sarama.ProducerMessage{
+				Topic:   "orders",
+				Value:   sarama.ByteEncoder(tt.value),
+				Headers: []sarama.RecordHeader{{Key: []byte("app"), Value: []byte("x")}},
+			}
+			if err := c.Offload(context.Background(), msg); err != nil {
+				t.Fatalf("Offload() error = %v", err)
+			}
+			if got := producerHeader(msg, HeaderEncoding); got != tt.wantEncoding {
+				t.Errorf("claim-check-encoding = %q, 期望 %q", got, tt.wantEncoding)
+			}
+			if got := producerHeader(msg, HeaderRef) != ""; got != tt.wantRef {
+				t.Errorf("是否转存 = %v, 期望 %v", got, tt.wantRef)
+			}
+			if size, _ := msg.Value.Encode(); len(size) > 1000 {
+				t.Errorf("处理后的消息体 %d 字节, 超过内联上限", len(size))
+			}
+
+			// 已经处理过的消息再次调用不会变化
+			before, _ := msg.Value.Encode()
+			if err := c.Offload(context.Background(), msg); err != nil {
+				t.Fatalf("再次 Offload() error = %v", err)
+			}
+			if after, _ := msg.Value.Encode(); !bytes.Equal(before, after) {
+				t.Error("重复调用 Offload() 不应再次处理消息体")
+			}
+
+			in := consumed(t, msg)
+			resolved, err := c.Resolve(context.Background(), in)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !bytes.Equal(resolved.Value, tt.value) {
+				t.Errorf("还原的消息体长度 %d, 期望 %d", len(resolved.Value), len(tt.value))
+			}
+			if consumerHeader(resolved, HeaderRef) != "" || consumerHeader(resolved, HeaderEncoding) != "" {
+				t.Error("还原后的消息不应包含claim-check消息头")
+			}
+			if consumerHeader(resolved, "app") != "x" {
+				t.Error("业务消息头丢失")
+			}
+			if (tt.wantRef || tt.wantEncoding != "") && consumerHeader(in, HeaderSize) == "" {
+				t.Error("原消息不应被修改")
+			}
+		})
+	}
+}
+
+// TestClaimCheck_ResolveErrors 测试blob不存在或压缩方式未知时返回错误
+func TestClaimCheck_ResolveErrors(t *testing.T) {
+	c, _ := newTestClaimCheck(t)
+	bomb, err := gzipBytes(make([]byte, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		value   []byte
+		headers map[string]string
+		wantErr error
+	}{
+		{name: "blob不存在", headers: map[string]string{HeaderRef: "20250101-missing"}, wantErr: ErrBlobNotFound},
+		{name: "blob键不合法", headers: map[string]string{HeaderRef: "../../etc/passwd"}},
+		{name: "未知的压缩方式", headers: map[string]string{HeaderEncoding: "br"}},
+		{name: "解压后超过原始字节数", value: bomb, headers: map[string]string{HeaderEncoding: "gzip", HeaderSize: "1024"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &sarama.ConsumerMessage{Topic: "orders", Value: tt.value}
+			for k, v := range tt.headers {
+				msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+			}
+			_, err := c.Resolve(context.Background(), msg)
+			if err == nil {
+				t.Fatal("Resolve() 应返回错误")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Resolve() error = %v, 期望 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestClaimCheck_Headers 测试内联上限按生产者的MaxMessageBytes计算，且不处理其他用途的 content-encoding 消息头
+func TestClaimCheck_Headers(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(store, config.ClaimCheckConfig{Retention: time.Hour}, inlineHeadroom+100)
+
+	value := randomBytes(t, 200)
+	msg := &sarama.ProducerMessage{
+		Topic:   "orders",
+		Value:   sarama.ByteEncoder(value),
+		Headers: []sarama.RecordHeader{{Key: []byte("content-encoding"), Value: []byte("br")}},
+	}
+	if err := c.Offload(context.Background(), msg); err != nil {
+		t.Fatalf("Offload() error = %v", err)
+	}
+	if producerHeader(msg, HeaderRef) == "" {
+		t.Error("超过按MaxMessageBytes计算的内联上限时应转存")
+	}
+
+	resolved, err := c.Resolve(context.Background(), consumed(t, msg))
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if !bytes.Equal(resolved.Value, value) {
+		t.Error("还原的消息体与原始内容不一致")
+	}
+	if consumerHeader(resolved, "content-encoding") != "br" {
+		t.Error("业务的 content-encoding 消息头应原样保留")
+	}
+}
+
+// TestClaimCheck_Cleanup 测试保留期清理只删除过期的blob和遗留的临时文件
+func TestClaimCheck_Cleanup(t *testing.T) {
+	c, store := newTestClaimCheck(t)
+	ctx := context.Background()
+	for _, key := range []string{"old", "new"} {
+		if err := store.Put(ctx, key, []byte(key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	tmp := filepath.Join(store.dir, ".tmp-123")
+	if err := os.WriteFile(tmp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, path := range []string{filepath.Join(store.dir, "old"), tmp} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := c.Cleanup(ctx)
+	if err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("删除 %d 个文件, 期望 2", removed)
+	}
+	if _, err := store.Get(ctx, "old"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("过期的blob应被删除, Get() error = %v", err)
+	}
+	if data, err := store.Get(ctx, "new"); err != nil || string(data) != "new" {
+		t.Errorf("未过期的blob应保留, Get() = %q, %v", data, err)
+	}
+	if got := c.Stats().Cleaned; got != 2 {
+		t.Errorf("Stats().Cleaned = %d, 期望 2", got)
+	}
+}
+
+// TestFileStore_InvalidKey 测试拒绝可能逃出存储目录的键
+func TestFileStore_InvalidKey(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "../x", "a/b", strings.Repeat("a", 200)} {
+		if err := store.Put(context.Background(), key, []byte("x")); err == nil {
+			t.Errorf("Put(%q) 应返回错误", key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kafka-example/config"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// BlobStore 保存大消息体的存储
+type BlobStore interface {
+	// Put 保存消息体
+	Put(ctx context.Context, key string, data []byte) error
+	// Get 读取消息体，不存在时返回 ErrBlobNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Sweep 删除 before 之前写入的消息体
+	// 返回删除的数量
+	Sweep(ctx context.Context, before time.Time) (int, error)
+}
+
+// NewBlobStore 根据配置创建blob存储
+// 参数:
+//   - cfg: claim-check配置
+//
+// 返回:
+//   - BlobStore: blob存储实例
+//   - error: 创建失败时返回错误
+func NewBlobStore(cfg config.ClaimCheckConfig) (BlobStore, error) {
+	switch cfg.Store {
+	case "", "file":
+		return NewFileStore(cfg.Dir)
+	default:
+		return nil, fmt.Errorf("未知的blob存储类型: %s", cfg.Store)
+	}
+}
+
+// validKey blob键的格式，键来自消息头，校验后才能用作文件名
+var validKey = regexp.MustCompile(`^[0-9A-Za-z_-]{1,128}$`)
+
+// FileStore 基于本地目录的blob存储，每个消息体一个文件
+// 生产者和消费者需要能访问同一个目录，例如同一台机器或共享挂载
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore 创建基于本地目录的blob存储，目录不存在时自动创建
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		dir = "data/claim_check"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建blob目录失败: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Put 先写入临时文件再重命名，避免消费者读到写了一半的消息体
+func (s *FileStore) Put(_ context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("写入blob失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("写入blob失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("保存blob失败: %w", err)
+	}
+	return nil
+}
+
+// Get 读取消息体
+func (s *FileStore) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取blob失败: %w", err)
+	}
+	return data, nil
+}
+
+// Sweep 按文件修改时间删除 before 之前写入的消息体，同时清理遗留的临时文件
+func (s *FileStore) Sweep(ctx context.Context, before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("读取blob目录失败: %w", err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("删除blob失败: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// path 返回键对应的文件路径，拒绝可能逃出目录的键
+func (s *FileStore) path(key string) (string, error) {
+	if !validKey.MatchString(key) {
+		return "", fmt.Errorf("blob键不合法: %q", key)
+	}
+	return filepath.Join(s.dir, key), nil
+}
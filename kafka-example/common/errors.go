@@ -0,0 +1,198 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrorClass 表示错误的重试分类
+type ErrorClass int
+
+const (
+	ErrorClassUnknown      ErrorClass = iota // 未知错误，无法确定是否可以重试
+	ErrorClassRetryable                      // 可重试错误，通常是暂时性的集群或网络故障
+	ErrorClassNonRetryable                   // 不可重试错误，重试也不会成功
+)
+
+// String 返回错误分类的名称
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassRetryable:
+		return "retryable"
+	case ErrorClassNonRetryable:
+		return "non-retryable"
+	default:
+		return "unknown"
+	}
+}
+
+// retryableKErrors 可重试的Kafka服务端错误
+// 这些错误通常在leader切换、副本同步或协调者加载完成后自行恢复
+var retryableKErrors = map[sarama.KError]bool{
+	sarama.ErrInvalidMessage:                  true,
+	sarama.ErrLeaderNotAvailable:              true,
+	sarama.ErrNotLeaderForPartition:           true,
+	sarama.ErrRequestTimedOut:                 true,
+	sarama.ErrBrokerNotAvailable:              true,
+	sarama.ErrReplicaNotAvailable:             true,
+	sarama.ErrNetworkException:                true,
+	sarama.ErrOffsetsLoadInProgress:           true,
+	sarama.ErrConsumerCoordinatorNotAvailable: true,
+	sarama.ErrNotCoordinatorForConsumer:       true,
+	sarama.ErrNotEnoughReplicas:               true,
+	sarama.ErrNotEnoughReplicasAfterAppend:    true,
+	sarama.ErrRebalanceInProgress:             true,
+	sarama.ErrNotController:                   true,
+	sarama.ErrConcurrentTransactions:          true,
+	sarama.ErrKafkaStorageError:               true,
+	sarama.ErrFencedLeaderEpoch:               true,
+	sarama.ErrUnknownLeaderEpoch:              true,
+	sarama.ErrOffsetNotAvailable:              true,
+	sarama.ErrPreferredLeaderNotAvailable:     true,
+	sarama.ErrEligibleLeadersNotAvailable:     true,
+	sarama.ErrUnstableOffsetCommit:            true,
+	sarama.ErrThrottlingQuotaExceeded:         true,
+}
+
+// nonRetryableKErrors 不可重试的Kafka服务端错误
+// 包括认证授权失败、消息过大、主题不存在以及请求本身不合法等情况
+var nonRetryableKErrors = map[sarama.KError]bool{
+	sarama.ErrUnknownTopicOrPartition:            true,
+	sarama.ErrMessageSizeTooLarge:                true,
+	sarama.ErrOffsetMetadataTooLarge:             true,
+	sarama.ErrInvalidTopic:                       true,
+	sarama.ErrMessageSetSizeTooLarge:             true,
+	sarama.ErrInvalidRequiredAcks:                true,
+	sarama.ErrTopicAuthorizationFailed:           true,
+	sarama.ErrGroupAuthorizationFailed:           true,
+	sarama.ErrClusterAuthorizationFailed:         true,
+	sarama.ErrInvalidTimestamp:                   true,
+	sarama.ErrUnsupportedSASLMechanism:           true,
+	sarama.ErrIllegalSASLState:                   true,
+	sarama.ErrUnsupportedVersion:                 true,
+	sarama.ErrInvalidConfig:                      true,
+	sarama.ErrInvalidRequest:                     true,
+	sarama.ErrUnsupportedForMessageFormat:        true,
+	sarama.ErrPolicyViolation:                    true,
+	sarama.ErrOutOfOrderSequenceNumber:           true,
+	sarama.ErrDuplicateSequenceNumber:            true,
+	sarama.ErrInvalidProducerEpoch:               true,
+	sarama.ErrInvalidTxnState:                    true,
+	sarama.ErrInvalidProducerIDMapping:           true,
+	sarama.ErrTransactionalIDAuthorizationFailed: true,
+	sarama.ErrSecurityDisabled:                   true,
+	sarama.ErrSASLAuthenticationFailed:           true,
+	sarama.ErrUnknownProducerID:                  true,
+	sarama.ErrUnsupportedCompressionType:         true,
+	sarama.ErrInvalidRecord:                      true,
+	sarama.ErrProducerFenced:                     true,
+}
+
+// retryableClientErrors 可重试的sarama客户端错误
+var retryableClientErrors = []error{
+	sarama.ErrOutOfBrokers,
+	sarama.ErrNotConnected,
+	sarama.ErrIncompleteResponse,
+	sarama.ErrControllerNotAvailable,
+	sarama.ErrBrokerNotFound,
+	io.EOF,
+	io.ErrUnexpectedEOF,
+	context.DeadlineExceeded,
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.EPIPE,
+}
+
+// nonRetryableClientErrors 不可重试的sarama客户端错误
+var nonRetryableClientErrors = []error{
+	sarama.ErrClosedClient,
+	sarama.ErrShuttingDown,
+	sarama.ErrMessageTooLarge,
+	sarama.ErrInvalidPartition,
+	sarama.ErrNonTransactedProducer,
+	context.Canceled,
+}
+
+// ClassifyError 判断错误属于可重试、不可重试还是未知类别
+// 会依次解开 sarama.ProducerErrors、sarama.ProducerError 等包装，
+// 再根据 sarama.KError、sarama客户端错误和网络错误进行分类
+// 参数:
+//   - err: 待分类的错误，为nil时视为不可重试（无需重试）
+//
+// 返回:
+//   - ErrorClass: 错误分类
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassNonRetryable
+	}
+
+	// 批量错误：任意一条不可重试则整体不可重试，全部可重试才可重试
+	var producerErrors sarama.ProducerErrors
+	if errors.As(err, &producerErrors) {
+		return classifyProducerErrors(producerErrors)
+	}
+
+	// Kafka服务端错误码（errors.As会自动解开ProducerError）
+	var kerr sarama.KError
+	if errors.As(err, &kerr) {
+		switch {
+		case retryableKErrors[kerr]:
+			return ErrorClassRetryable
+		case nonRetryableKErrors[kerr]:
+			return ErrorClassNonRetryable
+		default:
+			return ErrorClassUnknown
+		}
+	}
+
+	// 配置和编码错误无法通过重试恢复
+	var configErr sarama.ConfigurationError
+	var encodingErr sarama.PacketEncodingError
+	if errors.As(err, &configErr) || errors.As(err, &encodingErr) {
+		return ErrorClassNonRetryable
+	}
+
+	for _, target := range nonRetryableClientErrors {
+		if errors.Is(err, target) {
+			return ErrorClassNonRetryable
+		}
+	}
+	for _, target := range retryableClientErrors {
+		if errors.Is(err, target) {
+			return ErrorClassRetryable
+		}
+	}
+
+	// 其余网络错误（超时、连接失败、DNS解析失败等）均视为暂时性故障
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorClassRetryable
+	}
+
+	return ErrorClassUnknown
+}
+
+// classifyProducerErrors 对批量发送错误进行分类
+func classifyProducerErrors(errs sarama.ProducerErrors) ErrorClass {
+	class := ErrorClassRetryable
+	for _, pe := range errs {
+		switch ClassifyError(pe.Err) {
+		case ErrorClassNonRetryable:
+			return ErrorClassNonRetryable
+		case ErrorClassUnknown:
+			class = ErrorClassUnknown
+		}
+	}
+	return class
+}
+
+// IsRetryableError 判断错误是否可重试
+// 只有明确属于可重试类别的错误才返回true，未知错误需要调用方结合 ClassifyError 自行决定
+func IsRetryableError(err error) bool {
+	return ClassifyError(err) == ErrorClassRetryable
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// TestClassifyError 测试错误分类
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{name: "nil错误", err: nil, want: ErrorClassNonRetryable},
+		{name: "leader不可用", err: sarama.ErrLeaderNotAvailable, want: ErrorClassRetryable},
+		{name: "副本不足", err: sarama.ErrNotEnoughReplicas, want: ErrorClassRetryable},
+		{name: "消息过大", err: sarama.ErrMessageSizeTooLarge, want: ErrorClassNonRetryable},
+		{name: "主题不存在", err: sarama.ErrUnknownTopicOrPartition, want: ErrorClassNonRetryable},
+		{name: "认证失败", err: sarama.ErrSASLAuthenticationFailed, want: ErrorClassNonRetryable},
+		{name: "主题授权失败", err: sarama.ErrTopicAuthorizationFailed, want: ErrorClassNonRetryable},
+		{name: "未分类的KError", err: sarama.ErrUnknown, want: ErrorClassUnknown},
+		{
+			name: "ProducerError包装的可重试错误",
+			err:  &sarama.ProducerError{Msg: &sarama.ProducerMessage{}, Err: sarama.ErrRequestTimedOut},
+			want: ErrorClassRetryable,
+		},
+		{
+			name: "fmt包装的ProducerError",
+			err:  fmt.Errorf("发送失败: %w", &sarama.ProducerError{Msg: &sarama.ProducerMessage{}, Err: sarama.ErrInvalidTopic}),
+			want: ErrorClassNonRetryable,
+		},
+		{
+			name: "批量错误中包含不可重试错误",
+			err: sarama.ProducerErrors{
+				{Msg: &sarama.ProducerMessage{}, Err: sarama.ErrLeaderNotAvailable},
+				{Msg: &sarama.ProducerMessage{}, Err: sarama.ErrMessageSizeTooLarge},
+			},
+			want: ErrorClassNonRetryable,
+		},
+		{
+			name: "批量错误全部可重试",
+			err: sarama.ProducerErrors{
+				{Msg: &sarama.ProducerMessage{}, Err: sarama.ErrLeaderNotAvailable},
+				{Msg: &sarama.ProducerMessage{}, Err: sarama.ErrOutOfBrokers},
+			},
+			want: ErrorClassRetryable,
+		},
+		{name: "broker全部不可用", err: sarama.ErrOutOfBrokers, want: ErrorClassRetryable},
+		{name: "生产者正在关闭", err: sarama.ErrShuttingDown, want: ErrorClassNonRetryable},
+		{name: "配置错误", err: sarama.ConfigurationError("bad config"), want: ErrorClassNonRetryable},
+		{
+			name: "连接被拒绝",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+			want: ErrorClassRetryable,
+		},
+		{name: "DNS解析失败", err: &net.DNSError{Err: "no such host", Name: "kafka"}, want: ErrorClassRetryable},
+		{name: "上下文超时", err: context.DeadlineExceeded, want: ErrorClassRetryable},
+		{name: "上下文取消", err: context.Canceled, want: ErrorClassNonRetryable},
+		{name: "普通错误", err: errors.New("boom"), want: ErrorClassUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError() = %v, want %v", got, tt.want)
+			}
+			if got := IsRetryableError(tt.err); got != (tt.want == ErrorClassRetryable) {
+				t.Errorf("IsRetryableError() = %v, want %v", got, tt.want == ErrorClassRetryable)
+			}
+		})
+	}
+}
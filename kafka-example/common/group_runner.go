@@ -0,0 +1,137 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 消费循环的重试参数
+const (
+	MinConsumeBackoff = 1 * time.Second  // Consume出错后的初始等待时间
+	MaxConsumeBackoff = 30 * time.Second // Consume出错后的最大等待时间
+)
+
+// ErrGroupRunnerStarted 重复启动消费循环时返回的错误
+var ErrGroupRunnerStarted = errors.New("消费循环已启动")
+
+// GroupRunner 在后台循环加入消费者组并消费，读取错误通道，停止时关闭消费者组
+// 消费者组服务、事务管道和延迟队列转发器共用同一套启动、退避和停止流程
+type GroupRunner struct {
+	group     sarama.ConsumerGroup
+	topics    []string
+	handler   sarama.ConsumerGroupHandler
+	logPrefix string
+
+	mu       sync.Mutex         // 保护cancel
+	cancel   context.CancelFunc // 取消消费循环，Start之前为空
+	wg       sync.WaitGroup     // 等待消费循环和错误处理协程退出
+	stopOnce sync.Once          // 确保只停止一次
+	stopErr  error              // Stop的结果
+}
+
+// NewGroupRunner 创建消费循环
+// 参数:
+//   - group: 消费者组
+//   - topics: 订阅的主题列表
+//   - handler: 消费者组处理器
+//   - logPrefix: 日志前缀，如 "[Delay] "
+//
+// 返回:
+//   - *GroupRunner: 消费循环，调用 Start 后开始消费
+func NewGroupRunner(group sarama.ConsumerGroup, topics []string, handler sarama.ConsumerGroupHandler, logPrefix string) *GroupRunner {
+	return &GroupRunner{group: group, topics: topics, handler: handler, logPrefix: logPrefix}
+}
+
+// Start 在后台启动消费循环和错误处理协程
+// 参数:
+//   - ctx: 上下文，取消后消费循环退出
+//
+// 返回:
+//   - error: 已经启动过时返回 ErrGroupRunnerStarted
+func (r *GroupRunner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	if r.cancel != nil {
+		r.mu.Unlock()
+		return ErrGroupRunnerStarted
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	r.mu.Unlock()
+
+	r.wg.Add(2)
+	go r.consumeLoop(ctx)
+	go r.errorLoop()
+	return nil
+}
+
+// consumeLoop 循环加入消费者组并消费消息
+// 每次再均衡或会话结束后 Consume 都会返回，需要重新调用；出错时按指数退避等待后重试
+func (r *GroupRunner) consumeLoop(ctx context.Context) {
+	defer r.wg.Done()
+
+	backoff := MinConsumeBackoff
+	for {
+		err := r.group.Consume(ctx, r.topics, r.handler)
+		if ctx.Err() != nil {
+			log.Printf("%s上下文已取消，退出消费循环", r.logPrefix)
+			return
+		}
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			log.Printf("%s消费者组已关闭，退出消费循环", r.logPrefix)
+			return
+		}
+		if err == nil {
+			backoff = MinConsumeBackoff
+			continue
+		}
+
+		log.Printf("%s消费错误: %v，将在 %v 后重试", r.logPrefix, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, MaxConsumeBackoff)
+	}
+}
+
+// errorLoop 读取消费者组的错误通道，直到消费者组关闭
+// Consumer.Return.Errors 开启时必须读取该通道，否则会阻塞消费
+func (r *GroupRunner) errorLoop() {
+	defer r.wg.Done()
+	for err := range r.group.Errors() {
+		log.Printf("%s消费者组错误: %v", r.logPrefix, err)
+	}
+}
+
+// Cancel 取消消费循环，不关闭消费者组
+// 处理器遇到不可恢复的错误时可以调用，之后仍需调用 Stop 释放资源
+func (r *GroupRunner) Cancel() {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Stop 取消消费循环并关闭消费者组，等待消费循环和错误处理协程退出
+// 关闭消费者组会等待当前会话结束（包括 ConsumeClaim 和 Cleanup）；重复调用返回第一次的结果
+// 返回:
+//   - error: 关闭消费者组失败时返回错误
+func (r *GroupRunner) Stop() error {
+	r.stopOnce.Do(func() {
+		r.Cancel()
+		if err := r.group.Close(); err != nil {
+			r.stopErr = fmt.Errorf("关闭消费者组失败: %w", err)
+		}
+		r.wg.Wait()
+	})
+	return r.stopErr
+}
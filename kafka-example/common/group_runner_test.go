@@ -0,0 +1,67 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"kafka-example/kafkatest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// countingHandler 统计消费到的消息并立即标记
+type countingHandler struct {
+	consumed atomic.Int32
+}
+
+func (h *countingHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *countingHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
+	sess.Commit()
+	return nil
+}
+
+func (h *countingHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		h.consumed.Add(1)
+		sess.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// TestGroupRunner 测试消费循环的启动、重复启动、停止后提交偏移量并关闭消费者组
+func TestGroupRunner(t *testing.T) {
+	broker := kafkatest.NewBroker("test-topic", 0)
+	group := broker.NewConsumerGroup()
+	handler := &countingHandler{}
+	r := NewGroupRunner(group, []string{"test-topic"}, handler, "[Test] ")
+
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := r.Start(context.Background()); !errors.Is(err, ErrGroupRunnerStarted) {
+		t.Errorf("重复启动 Start() error = %v, 期望 %v", err, ErrGroupRunnerStarted)
+	}
+
+	broker.Produce(0, "a")
+	broker.Produce(0, "b")
+	deadline := time.Now().Add(time.Second)
+	for handler.consumed.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := r.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := r.Stop(); err != nil {
+		t.Errorf("重复调用 Stop() error = %v", err)
+	}
+	if !group.Closed() {
+		t.Error("消费者组未关闭")
+	}
+	if committed, _ := broker.Committed(); committed[0] != 2 {
+		t.Errorf("提交的偏移量 = %d, 期望 2", committed[0])
+	}
+}
@@ -8,9 +8,6 @@ const (
 	Broker     = "localhost:9092"
 	SyncTopic  = "kafka-example-sync"
 	AsyncTopic = "kafka-example-async"
-)
 
-// IsRetryableError 判断错误是否可重试
-func IsRetryableError(err error) bool {
-	return err != nil
-}
+	UnknownErrorMaxRetries = 1 // 未知类别错误的最大重试次数
+)
@@ -0,0 +1,940 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"kafka-example/common"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 表示Kafka示例服务的配置
+// 可以通过YAML文件加载，并由环境变量覆盖
+type Config struct {
+	Brokers  []string       `yaml:"brokers"`   // Kafka broker地址列表
+	ClientID string         `yaml:"client_id"` // 客户端ID
+	Version  string         `yaml:"version"`   // Kafka版本，为空时使用sarama默认版本
+	Topics   TopicsConfig   `yaml:"topics"`    // 主题配置
+	Producer ProducerConfig `yaml:"producer"`  // 生产者配置
+	Consumer ConsumerConfig `yaml:"consumer"`  // 消费者配置
+	Pipeline PipelineConfig `yaml:"pipeline"`  // 事务消费-转换-生产管道配置
+	Delay    DelayConfig    `yaml:"delay"`     // 延迟队列配置
+	Security SecurityConfig `yaml:"security"`  // SASL认证和TLS加密配置
+
+	ClaimCheck ClaimCheckConfig `yaml:"claim_check"` // 大消息的压缩和转存配置
+	Reply      ReplyConfig      `yaml:"reply"`       // 请求-回复配置
+	Archive    ArchiveConfig    `yaml:"archive"`     // 主题归档配置
+}
+
+// TopicsConfig 主题配置
+type TopicsConfig struct {
+	Sync  string `yaml:"sync"`  // 同步生产者使用的主题
+	Async string `yaml:"async"` // 异步生产者使用的主题
+}
+
+// ProducerConfig 生产者配置
+type ProducerConfig struct {
+	Acks        string           `yaml:"acks"`        // 确认级别: all, leader, none
+	Compression string           `yaml:"compression"` // 压缩算法: none, gzip, snappy, lz4, zstd
+	Idempotent  bool             `yaml:"idempotent"`  // 是否启用幂等性
+	RetryMax    int              `yaml:"retry_max"`   // 最大重试次数，同时用于sarama内部重试和同步生产者服务的重试，不超过 MaxRetryMax
+	Flush       FlushConfig      `yaml:"flush"`       // 批量发送配置
+	AsyncRetry  AsyncRetryConfig `yaml:"async_retry"` // 异步生产者的应用层重试配置
+	Partitioner string           `yaml:"partitioner"` // 分区器: hash, murmur2, round_robin, manual, custom
+}
+
+// MaxRetryMax producer.retry_max 的上限
+// 同步生产者的重试在HTTP请求中同步等待，重试次数过多时请求会长时间阻塞
+const MaxRetryMax = 10
+
+// 生产者的分区器
+const (
+	PartitionerHash       = "hash"        // 按消息键的FNV-1a哈希选择分区，sarama默认
+	PartitionerMurmur2    = "murmur2"     // 按消息键的murmur2哈希选择分区，与Java客户端一致
+	PartitionerRoundRobin = "round_robin" // 轮询分区
+	PartitionerManual     = "manual"      // 使用消息中指定的分区
+	PartitionerCustom     = "custom"      // 使用代码中通过选项注册的分区器
+)
+
+// AsyncRetryConfig 异步生产者的应用层重试配置
+// sarama内部重试耗尽后，异步生产者按指数退避加随机抖动再次发送，仍然失败的消息写入落盘文件或死信主题
+type AsyncRetryConfig struct {
+	MaxRetries int           `yaml:"max_retries"` // 可重试错误的最大重试次数
+	Backoff    time.Duration `yaml:"backoff"`     // 首次重试前的等待时间
+	MaxBackoff time.Duration `yaml:"max_backoff"` // 重试等待时间上限
+	Jitter     float64       `yaml:"jitter"`      // 随机抖动比例，取值0~1
+	Spill      string        `yaml:"spill"`       // 最终失败消息的去向: file, dlq, none
+	SpillPath  string        `yaml:"spill_path"`  // file类型的落盘文件路径
+}
+
+// FlushConfig 批量发送配置
+type FlushConfig struct {
+	Frequency time.Duration `yaml:"frequency"` // 批量发送的时间间隔
+	Messages  int           `yaml:"messages"`  // 触发批量发送的消息数
+}
+
+// ConsumerConfig 消费者配置
+type ConsumerConfig struct {
+	GroupID     string            `yaml:"group_id"`     // 消费者组ID
+	OffsetReset string            `yaml:"offset_reset"` // 无已提交偏移量时的策略: newest, oldest
+	Isolation   string            `yaml:"isolation"`    // 事务隔离级别: read_committed, read_uncommitted
+	OffsetStore OffsetStoreConfig `yaml:"offset_store"` // 传统消费者的偏移量存储
+	Commit      CommitConfig      `yaml:"commit"`       // 消费者组的偏移量提交策略
+	Workers     int               `yaml:"workers"`      // 消费者组每个分区的工作协程数，大于1时按消息键并行处理
+	Dedup       DedupConfig       `yaml:"dedup"`        // 消息去重，跳过重复投递的消息
+	Limits      LimitsConfig      `yaml:"limits"`       // 消费者组的限流和背压参数
+}
+
+// LimitsConfig 消费者组的限流和背压参数
+// 限流使用令牌桶，整个消费者和每个分区各有一个；背压在分区待处理消息过多时暂停拉取该分区。
+// 运行时可以通过消费者组服务的 SetLimits 调整
+type LimitsConfig struct {
+	Rate           float64 `yaml:"rate" json:"rate"`                       // 整个消费者每秒最多处理的消息数，0表示不限制
+	Burst          int     `yaml:"burst" json:"burst"`                     // 整个消费者的令牌桶容量，0表示与每秒消息数相同
+	PartitionRate  float64 `yaml:"partition_rate" json:"partition_rate"`   // 每个分区每秒最多处理的消息数，0表示不限制
+	PartitionBurst int     `yaml:"partition_burst" json:"partition_burst"` // 每个分区的令牌桶容量，0表示与每秒消息数相同
+	HighWaterMark  int     `yaml:"high_water_mark" json:"high_water_mark"` // 分区待处理消息数达到该值时暂停拉取，0表示不启用背压
+	LowWaterMark   int     `yaml:"low_water_mark" json:"low_water_mark"`   // 暂停后待处理消息数降到该值时恢复拉取
+}
+
+// DedupConfig 消费者消息去重配置
+// 消息有信封ID时按ID去重，否则按主题/分区/偏移量去重；处理成功的消息在TTL内再次出现时跳过。
+// 去重键包含消费者组ID，订阅同一主题的不同消费者组互不影响
+type DedupConfig struct {
+	Enabled bool             `yaml:"enabled"` // 是否启用去重
+	Store   string           `yaml:"store"`   // 存储类型: memory, redis
+	TTL     time.Duration    `yaml:"ttl"`     // 已处理消息ID的保留时间
+	Redis   RedisStoreConfig `yaml:"redis"`   // redis类型使用的连接配置
+}
+
+// PipelineConfig 事务消费-转换-生产管道配置
+// 从输入主题消费消息，转换后写入输出主题，输出消息和消费偏移量在同一个Kafka事务中提交
+type PipelineConfig struct {
+	Enabled         bool          `yaml:"enabled"`          // 是否启动管道
+	InputTopic      string        `yaml:"input_topic"`      // 输入主题
+	OutputTopic     string        `yaml:"output_topic"`     // 输出主题
+	GroupID         string        `yaml:"group_id"`         // 管道使用的消费者组ID
+	TransactionalID string        `yaml:"transactional_id"` // 事务ID，同一管道的多个实例应使用不同的事务ID
+	BatchSize       int           `yaml:"batch_size"`       // 每个事务最多包含的输入消息数
+	BatchTimeout    time.Duration `yaml:"batch_timeout"`    // 批次未满时的最长等待时间
+}
+
+// DelayConfig 延迟队列配置
+// 延迟消息先写入固定延迟级别的主题，由转发器在到期后重新发布到目标主题
+type DelayConfig struct {
+	Enabled     bool            `yaml:"enabled"`      // 是否启动延迟消息转发器
+	TopicPrefix string          `yaml:"topic_prefix"` // 级别主题前缀，级别主题名为 <topic_prefix>-<级别>，如 kafka-example-delay-10s
+	Levels      []time.Duration `yaml:"levels"`       // 延迟级别，必须递增
+	GroupID     string          `yaml:"group_id"`     // 转发器使用的消费者组ID
+}
+
+// ClaimCheckConfig 大消息的claim-check配置
+// 生产者压缩超过阈值的消息体，压缩后仍然过大的写入blob存储，消息中只保留引用；消费者处理前自动还原
+type ClaimCheckConfig struct {
+	Enabled           bool          `yaml:"enabled"`            // 是否启用
+	CompressThreshold int           `yaml:"compress_threshold"` // 消息体达到该字节数时用gzip压缩，0表示不压缩
+	MaxInlineBytes    int           `yaml:"max_inline_bytes"`   // 消息体超过该字节数时写入blob存储，0表示按生产者的 Producer.MaxMessageBytes 计算
+	Store             string        `yaml:"store"`              // blob存储类型: file
+	Dir               string        `yaml:"dir"`                // file类型的存储目录，生产者和消费者需要能访问同一个目录
+	Retention         time.Duration `yaml:"retention"`          // blob的保留时间，应大于消费积压可能持续的时间
+	CleanupInterval   time.Duration `yaml:"cleanup_interval"`   // 清理过期blob的间隔
+}
+
+// ReplyConfig 请求-回复配置
+// 请求方将请求写入请求主题，消息头中带有关联ID和回复主题；回复方处理后将结果写入回复主题。
+// 每个请求方实例使用独立的回复主题，只读取发给自己的回复
+type ReplyConfig struct {
+	Enabled           bool          `yaml:"enabled"`            // 是否启用请求方和示例回复方
+	RequestTopic      string        `yaml:"request_topic"`      // 请求主题
+	ReplyTopicPrefix  string        `yaml:"reply_topic_prefix"` // 回复主题前缀，回复主题名为 <reply_topic_prefix>-<instance_id>
+	InstanceID        string        `yaml:"instance_id"`        // 实例ID，为空时使用主机名；同时运行的实例必须不同
+	Timeout           time.Duration `yaml:"timeout"`            // 等待回复的默认超时时间
+	GroupID           string        `yaml:"group_id"`           // 示例回复方使用的消费者组ID
+	ReplicationFactor int16         `yaml:"replication_factor"` // 创建回复主题时的副本数
+}
+
+// ArchiveConfig 主题归档配置
+// 归档消费者将消息写入按大小和时间滚动的JSONL分段文件，整批写入并同步到磁盘后才提交偏移量
+type ArchiveConfig struct {
+	Enabled         bool          `yaml:"enabled"`           // 是否启动归档消费者
+	Topics          []string      `yaml:"topics"`            // 要归档的主题
+	GroupID         string        `yaml:"group_id"`          // 归档消费者组ID，首次启动时从最早的消息开始归档
+	Dir             string        `yaml:"dir"`               // 归档目录，每个主题一个子目录
+	Compress        bool          `yaml:"compress"`          // 是否用gzip压缩分段文件
+	MaxSegmentBytes int64         `yaml:"max_segment_bytes"` // 分段文件的最大字节数（压缩前），超过后滚动
+	MaxSegmentAge   time.Duration `yaml:"max_segment_age"`   // 分段文件的最长写入时间，超过后滚动
+	BatchSize       int           `yaml:"batch_size"`        // 每批写入的最大消息数
+	BatchTimeout    time.Duration `yaml:"batch_timeout"`     // 批次未满时的最长等待时间
+}
+
+// 消费者组的偏移量提交模式
+const (
+	CommitModeMessage  = "message"  // 每条消息处理后提交
+	CommitModeCount    = "count"    // 每处理N条消息提交一次
+	CommitModeInterval = "interval" // 按固定时间间隔提交
+	CommitModeBatch    = "batch"    // 批量处理成功后提交
+)
+
+// CommitConfig 消费者组的偏移量提交配置
+// 无论使用哪种模式，会话结束（再均衡或停止服务）时都会同步提交已标记的偏移量
+type CommitConfig struct {
+	Mode         string        `yaml:"mode"`          // 提交模式: message, count, interval, batch
+	Count        int           `yaml:"count"`         // count模式下每处理多少条消息提交一次
+	Interval     time.Duration `yaml:"interval"`      // interval模式下的提交间隔
+	BatchSize    int           `yaml:"batch_size"`    // batch模式下每批的最大消息数
+	BatchTimeout time.Duration `yaml:"batch_timeout"` // batch模式下批次未满时的最长等待时间
+}
+
+// OffsetStoreConfig 偏移量存储配置
+type OffsetStoreConfig struct {
+	Type           string           `yaml:"type"`            // 存储类型: file, redis, memory
+	CommitInterval time.Duration    `yaml:"commit_interval"` // 定期提交偏移量的间隔
+	Path           string           `yaml:"path"`            // file类型使用的文件路径
+	Redis          RedisStoreConfig `yaml:"redis"`           // redis类型使用的连接配置
+}
+
+// RedisStoreConfig Redis偏移量存储配置
+type RedisStoreConfig struct {
+	Addr      string `yaml:"addr"`       // Redis地址
+	Password  string `yaml:"password"`   // Redis密码
+	DB        int    `yaml:"db"`         // Redis数据库
+	KeyPrefix string `yaml:"key_prefix"` // 键前缀，偏移量存储的键为 <key_prefix>:<topic>
+}
+
+// Default 返回默认配置
+// broker、主题、确认级别、幂等性和重试次数与原先硬编码的参数一致，以下默认值有意改变了原先的行为:
+//   - consumer.isolation 为 read_committed，只读取已提交的事务消息，原先为sarama默认的 read_uncommitted
+//   - consumer.commit.mode 为 interval，消费者组每秒提交一次已标记的偏移量，原先只标记不提交
+//   - consumer.offset_store.type 为 file，传统消费者的偏移量写入 data/offsets.json，原先只打印日志
+//   - producer.async_retry.spill 为 file，异步生产者最终失败的消息写入 data/async_spill.jsonl，原先直接丢弃
+//
+// 文件路径都是相对路径，以进程的工作目录为基准
+func Default() *Config {
+	return &Config{
+		Brokers:  []string{common.Broker},
+		ClientID: "kafka-example",
+		Topics: TopicsConfig{
+			Sync:  common.SyncTopic,
+			Async: common.AsyncTopic,
+		},
+		Producer: ProducerConfig{
+			Acks:        "all",
+			Compression: "none",
+			Idempotent:  true,
+			RetryMax:    5,
+			Partitioner: PartitionerHash,
+			AsyncRetry: AsyncRetryConfig{
+				MaxRetries: 5,
+				Backoff:    100 * time.Millisecond,
+				MaxBackoff: 10 * time.Second,
+				Jitter:     0.2,
+				Spill:      "file",
+				SpillPath:  "data/async_spill.jsonl",
+			},
+		},
+		Consumer: ConsumerConfig{
+			GroupID:     "group_consumer",
+			OffsetReset: "newest",
+			Isolation:   "read_committed",
+			Workers:     1,
+			OffsetStore: OffsetStoreConfig{
+				Type:           "file",
+				CommitInterval: 5 * time.Second,
+				Path:           "data/offsets.json",
+				Redis: RedisStoreConfig{
+					Addr:      "localhost:6379",
+					KeyPrefix: "kafka-example:offsets",
+				},
+			},
+			Commit: CommitConfig{
+				Mode:         CommitModeInterval,
+				Count:        100,
+				Interval:     time.Second,
+				BatchSize:    100,
+				BatchTimeout: time.Second,
+			},
+			Dedup: DedupConfig{
+				Store: "memory",
+				TTL:   24 * time.Hour,
+				Redis: RedisStoreConfig{
+					Addr:      "localhost:6379",
+					KeyPrefix: "kafka-example:dedup",
+				},
+			},
+		},
+		Pipeline: PipelineConfig{
+			InputTopic:      common.AsyncTopic,
+			OutputTopic:     common.AsyncTopic + "-transformed",
+			GroupID:         "pipeline",
+			TransactionalID: "kafka-example-pipeline",
+			BatchSize:       100,
+			BatchTimeout:    time.Second,
+		},
+		Delay: DelayConfig{
+			TopicPrefix: "kafka-example-delay",
+			Levels:      []time.Duration{time.Second, 10 * time.Second, time.Minute, 10 * time.Minute},
+			GroupID:     "delay-forwarder",
+		},
+		ClaimCheck: ClaimCheckConfig{
+			CompressThreshold: 64 * 1024,
+			Store:             "file",
+			Dir:               "data/claim_check",
+			Retention:         7 * 24 * time.Hour,
+			CleanupInterval:   time.Hour,
+		},
+		Reply: ReplyConfig{
+			RequestTopic:      "kafka-example-requests",
+			ReplyTopicPrefix:  "kafka-example-replies",
+			Timeout:           10 * time.Second,
+			GroupID:           "responder",
+			ReplicationFactor: 1,
+		},
+		Archive: ArchiveConfig{
+			Topics:          []string{common.SyncTopic},
+			GroupID:         "archiver",
+			Dir:             "data/archive",
+			Compress:        true,
+			MaxSegmentBytes: 64 * 1024 * 1024,
+			MaxSegmentAge:   time.Hour,
+			BatchSize:       500,
+			BatchTimeout:    time.Second,
+		},
+	}
+}
+
+// Load 从YAML文件加载配置
+// 文件不存在时使用默认配置，随后应用环境变量覆盖
+// 参数:
+//   - path: 配置文件路径
+//
+// 返回:
+//   - *Config: 加载后的配置
+//   - error: 读取或解析失败时返回错误
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Printf("[Config] 配置文件未找到，使用默认配置: %s", path)
+	case err != nil:
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	default:
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv 使用环境变量覆盖配置
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("KAFKA_BROKERS"); v != "" {
+		c.Brokers = strings.Split(v, ",")
+	}
+	if v := os.Getenv("KAFKA_CLIENT_ID"); v != "" {
+		c.ClientID = v
+	}
+	if v := os.Getenv("KAFKA_VERSION"); v != "" {
+		c.Version = v
+	}
+	if v := os.Getenv("KAFKA_SYNC_TOPIC"); v != "" {
+		c.Topics.Sync = v
+	}
+	if v := os.Getenv("KAFKA_ASYNC_TOPIC"); v != "" {
+		c.Topics.Async = v
+	}
+	if v := os.Getenv("KAFKA_ACKS"); v != "" {
+		c.Producer.Acks = v
+	}
+	if v := os.Getenv("KAFKA_COMPRESSION"); v != "" {
+		c.Producer.Compression = v
+	}
+	if v := os.Getenv("KAFKA_IDEMPOTENT"); v != "" {
+		idempotent, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_IDEMPOTENT失败: %w", err)
+		}
+		c.Producer.Idempotent = idempotent
+	}
+	if v := os.Getenv("KAFKA_RETRY_MAX"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_RETRY_MAX失败: %w", err)
+		}
+		c.Producer.RetryMax = n
+	}
+	if v := os.Getenv("KAFKA_FLUSH_FREQUENCY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_FLUSH_FREQUENCY失败: %w", err)
+		}
+		c.Producer.Flush.Frequency = d
+	}
+	if v := os.Getenv("KAFKA_FLUSH_MESSAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_FLUSH_MESSAGES失败: %w", err)
+		}
+		c.Producer.Flush.Messages = n
+	}
+	if v := os.Getenv("KAFKA_PARTITIONER"); v != "" {
+		c.Producer.Partitioner = v
+	}
+	if v := os.Getenv("KAFKA_ASYNC_SPILL"); v != "" {
+		c.Producer.AsyncRetry.Spill = v
+	}
+	if v := os.Getenv("KAFKA_ASYNC_SPILL_PATH"); v != "" {
+		c.Producer.AsyncRetry.SpillPath = v
+	}
+	if v := os.Getenv("KAFKA_GROUP_ID"); v != "" {
+		c.Consumer.GroupID = v
+	}
+	if v := os.Getenv("KAFKA_OFFSET_RESET"); v != "" {
+		c.Consumer.OffsetReset = v
+	}
+	if v := os.Getenv("KAFKA_OFFSET_STORE"); v != "" {
+		c.Consumer.OffsetStore.Type = v
+	}
+	if v := os.Getenv("KAFKA_OFFSET_STORE_PATH"); v != "" {
+		c.Consumer.OffsetStore.Path = v
+	}
+	if v := os.Getenv("KAFKA_COMMIT_MODE"); v != "" {
+		c.Consumer.Commit.Mode = v
+	}
+	if v := os.Getenv("KAFKA_CONSUMER_WORKERS"); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_CONSUMER_WORKERS失败: %w", err)
+		}
+		c.Consumer.Workers = workers
+	}
+	if v := os.Getenv("KAFKA_CONSUMER_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_CONSUMER_RATE失败: %w", err)
+		}
+		c.Consumer.Limits.Rate = rate
+	}
+	if v := os.Getenv("KAFKA_PARTITION_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_PARTITION_RATE失败: %w", err)
+		}
+		c.Consumer.Limits.PartitionRate = rate
+	}
+	if v := os.Getenv("KAFKA_DEDUP_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_DEDUP_ENABLED失败: %w", err)
+		}
+		c.Consumer.Dedup.Enabled = enabled
+	}
+	if v := os.Getenv("KAFKA_DEDUP_STORE"); v != "" {
+		c.Consumer.Dedup.Store = v
+	}
+	if v := os.Getenv("KAFKA_ISOLATION"); v != "" {
+		c.Consumer.Isolation = v
+	}
+	if v := os.Getenv("KAFKA_PIPELINE_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_PIPELINE_ENABLED失败: %w", err)
+		}
+		c.Pipeline.Enabled = enabled
+	}
+	if v := os.Getenv("KAFKA_DELAY_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_DELAY_ENABLED失败: %w", err)
+		}
+		c.Delay.Enabled = enabled
+	}
+	if v := os.Getenv("KAFKA_CLAIM_CHECK_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_CLAIM_CHECK_ENABLED失败: %w", err)
+		}
+		c.ClaimCheck.Enabled = enabled
+	}
+	if v := os.Getenv("KAFKA_CLAIM_CHECK_DIR"); v != "" {
+		c.ClaimCheck.Dir = v
+	}
+	if v := os.Getenv("KAFKA_REPLY_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_REPLY_ENABLED失败: %w", err)
+		}
+		c.Reply.Enabled = enabled
+	}
+	if v := os.Getenv("KAFKA_INSTANCE_ID"); v != "" {
+		c.Reply.InstanceID = v
+	}
+	if v := os.Getenv("KAFKA_ARCHIVE_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_ARCHIVE_ENABLED失败: %w", err)
+		}
+		c.Archive.Enabled = enabled
+	}
+	if v := os.Getenv("KAFKA_ARCHIVE_DIR"); v != "" {
+		c.Archive.Dir = v
+	}
+	if v := os.Getenv("KAFKA_TRANSACTIONAL_ID"); v != "" {
+		c.Pipeline.TransactionalID = v
+	}
+	if v := os.Getenv("KAFKA_SASL_MECHANISM"); v != "" {
+		c.Security.SASL.Mechanism = v
+	}
+	if v := os.Getenv("KAFKA_SASL_USERNAME"); v != "" {
+		c.Security.SASL.Username = v
+	}
+	if v := os.Getenv("KAFKA_SASL_PASSWORD"); v != "" {
+		c.Security.SASL.Password = v
+	}
+	if v := os.Getenv("KAFKA_TLS_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_TLS_ENABLED失败: %w", err)
+		}
+		c.Security.TLS.Enabled = enabled
+	}
+	if v := os.Getenv("KAFKA_TLS_CA_FILE"); v != "" {
+		c.Security.TLS.CAFile = v
+	}
+	if v := os.Getenv("KAFKA_TLS_CERT_FILE"); v != "" {
+		c.Security.TLS.CertFile = v
+	}
+	if v := os.Getenv("KAFKA_TLS_KEY_FILE"); v != "" {
+		c.Security.TLS.KeyFile = v
+	}
+	if v := os.Getenv("KAFKA_TLS_INSECURE_SKIP_VERIFY"); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("解析KAFKA_TLS_INSECURE_SKIP_VERIFY失败: %w", err)
+		}
+		c.Security.TLS.InsecureSkipVerify = skip
+	}
+	if v := os.Getenv("REDIS_ADDR"); v != "" {
+		c.Consumer.OffsetStore.Redis.Addr = v
+		c.Consumer.Dedup.Redis.Addr = v
+	}
+	if v := os.Getenv("REDIS_PASSWORD"); v != "" {
+		c.Consumer.OffsetStore.Redis.Password = v
+		c.Consumer.Dedup.Redis.Password = v
+	}
+	return nil
+}
+
+// Validate 校验配置是否合法
+func (c *Config) Validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("broker地址列表不能为空")
+	}
+	if _, err := c.ProducerSaramaConfig(); err != nil {
+		return err
+	}
+	if _, err := c.ConsumerSaramaConfig(); err != nil {
+		return err
+	}
+	if c.Producer.RetryMax < 0 || c.Producer.RetryMax > MaxRetryMax {
+		return fmt.Errorf("producer.retry_max必须在0到%d之间: %d", MaxRetryMax, c.Producer.RetryMax)
+	}
+	if err := c.Producer.AsyncRetry.Validate(); err != nil {
+		return err
+	}
+	switch c.Producer.Partitioner {
+	case "", PartitionerHash, PartitionerMurmur2, PartitionerRoundRobin, PartitionerManual, PartitionerCustom:
+	default:
+		return fmt.Errorf("未知的分区器: %s", c.Producer.Partitioner)
+	}
+	switch c.Consumer.OffsetStore.Type {
+	case "", "file", "redis", "memory":
+	default:
+		return fmt.Errorf("未知的偏移量存储类型: %s", c.Consumer.OffsetStore.Type)
+	}
+	if err := c.Consumer.Commit.Validate(); err != nil {
+		return err
+	}
+	if c.Consumer.Workers < 0 {
+		return fmt.Errorf("消费者工作协程数不能为负数: %d", c.Consumer.Workers)
+	}
+	if err := c.Consumer.Limits.Validate(); err != nil {
+		return err
+	}
+	if c.Consumer.Dedup.Enabled {
+		switch c.Consumer.Dedup.Store {
+		case "", "memory", "redis":
+		default:
+			return fmt.Errorf("未知的去重存储类型: %s", c.Consumer.Dedup.Store)
+		}
+		if c.Consumer.Dedup.TTL <= 0 {
+			return fmt.Errorf("去重TTL必须大于0: %v", c.Consumer.Dedup.TTL)
+		}
+	}
+	if c.Pipeline.Enabled {
+		if _, err := c.PipelineSaramaConfig(); err != nil {
+			return err
+		}
+	}
+	if c.Delay.Enabled {
+		if _, err := c.DelaySaramaConfig(); err != nil {
+			return err
+		}
+	}
+	if c.ClaimCheck.Enabled {
+		if err := c.ClaimCheck.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Reply.Enabled {
+		if _, err := c.ReplySaramaConfig(); err != nil {
+			return err
+		}
+	}
+	if c.Archive.Enabled {
+		if err := c.Archive.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate 校验归档配置是否合法
+func (c ArchiveConfig) Validate() error {
+	if len(c.Topics) == 0 || c.GroupID == "" || c.Dir == "" {
+		return errors.New("归档的主题、消费者组ID和目录不能为空")
+	}
+	if c.MaxSegmentBytes <= 0 || c.MaxSegmentAge <= 0 {
+		return fmt.Errorf("分段文件的大小和时间上限必须大于0: %d, %v", c.MaxSegmentBytes, c.MaxSegmentAge)
+	}
+	if c.BatchSize < 0 || c.BatchTimeout < 0 {
+		return fmt.Errorf("归档批次大小和等待时间不能为负数: %d, %v", c.BatchSize, c.BatchTimeout)
+	}
+	return nil
+}
+
+// Validate 校验claim-check配置是否合法
+func (c ClaimCheckConfig) Validate() error {
+	switch c.Store {
+	case "", "file":
+	default:
+		return fmt.Errorf("未知的blob存储类型: %s", c.Store)
+	}
+	if c.CompressThreshold < 0 || c.MaxInlineBytes < 0 {
+		return fmt.Errorf("压缩阈值和内联上限不能为负数: %d, %d", c.CompressThreshold, c.MaxInlineBytes)
+	}
+	if c.Retention <= 0 {
+		return fmt.Errorf("blob保留时间必须大于0: %v", c.Retention)
+	}
+	return nil
+}
+
+// Validate 校验异步重试配置是否合法
+func (c AsyncRetryConfig) Validate() error {
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("重试抖动比例必须在0~1之间: %v", c.Jitter)
+	}
+	switch c.Spill {
+	case "", "file", "dlq", "none":
+	default:
+		return fmt.Errorf("未知的失败消息去向: %s", c.Spill)
+	}
+	return nil
+}
+
+// Validate 校验偏移量提交配置是否合法
+func (c CommitConfig) Validate() error {
+	switch c.Mode {
+	case "", CommitModeMessage, CommitModeInterval:
+	case CommitModeCount:
+		if c.Count <= 0 {
+			return fmt.Errorf("count提交模式的消息数必须大于0: %d", c.Count)
+		}
+	case CommitModeBatch:
+		if c.BatchSize <= 0 {
+			return fmt.Errorf("batch提交模式的批次大小必须大于0: %d", c.BatchSize)
+		}
+	default:
+		return fmt.Errorf("未知的偏移量提交模式: %s", c.Mode)
+	}
+	return nil
+}
+
+// baseSaramaConfig 构建生产者和消费者共用的sarama配置
+func (c *Config) baseSaramaConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	if c.ClientID != "" {
+		config.ClientID = c.ClientID
+	}
+	if c.Version != "" {
+		version, err := sarama.ParseKafkaVersion(c.Version)
+		if err != nil {
+			return nil, fmt.Errorf("解析Kafka版本失败: %w", err)
+		}
+		config.Version = version
+	}
+	if err := c.Security.Apply(config); err != nil {
+		return nil, fmt.Errorf("认证和加密配置不合法: %w", err)
+	}
+	return config, nil
+}
+
+// ProducerSaramaConfig 根据配置构建生产者使用的sarama配置
+// 返回:
+//   - *sarama.Config: 生产者配置，调用方可按需调整Return等参数
+//   - error: 配置不合法时返回错误
+func (c *Config) ProducerSaramaConfig() (*sarama.Config, error) {
+	config, err := c.baseSaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	acks, err := parseAcks(c.Producer.Acks)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.RequiredAcks = acks
+
+	if c.Producer.Compression != "" {
+		if err := config.Producer.Compression.UnmarshalText([]byte(c.Producer.Compression)); err != nil {
+			return nil, fmt.Errorf("解析压缩算法失败: %w", err)
+		}
+	}
+
+	config.Producer.Idempotent = c.Producer.Idempotent // 启用幂等性，确保消息不会重复发送
+	if c.Producer.Idempotent {
+		config.Net.MaxOpenRequests = 1 // 幂等生产者要求限制最大并发请求数
+	}
+	config.Producer.Retry.Max = c.Producer.RetryMax
+	config.Producer.Flush.Frequency = c.Producer.Flush.Frequency
+	config.Producer.Flush.Messages = c.Producer.Flush.Messages
+	return config, nil
+}
+
+// AdminSaramaConfig 根据配置构建集群管理客户端使用的sarama配置
+// 返回:
+//   - *sarama.Config: 集群管理配置
+//   - error: 配置不合法时返回错误
+func (c *Config) AdminSaramaConfig() (*sarama.Config, error) {
+	return c.baseSaramaConfig()
+}
+
+// ConsumerSaramaConfig 根据配置构建消费者使用的sarama配置
+// 返回:
+//   - *sarama.Config: 消费者配置
+//   - error: 配置不合法时返回错误
+func (c *Config) ConsumerSaramaConfig() (*sarama.Config, error) {
+	config, err := c.baseSaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	initial, err := parseOffsetReset(c.Consumer.OffsetReset)
+	if err != nil {
+		return nil, err
+	}
+	isolation, err := parseIsolation(c.Consumer.Isolation)
+	if err != nil {
+		return nil, err
+	}
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = initial
+	config.Consumer.Offsets.AutoCommit.Enable = false // 禁用自动提交
+	config.Consumer.IsolationLevel = isolation
+	c.Consumer.Limits.FitChannelBuffer(config)
+	return config, nil
+}
+
+// PipelineSaramaConfig 根据配置构建事务管道使用的sarama配置
+// 同一份配置同时用于消费者组和事务生产者：生产者启用幂等和事务，消费者只读取已提交的事务消息
+// 返回:
+//   - *sarama.Config: 管道配置
+//   - error: 配置不合法时返回错误
+func (c *Config) PipelineSaramaConfig() (*sarama.Config, error) {
+	p := c.Pipeline
+	if p.InputTopic == "" || p.OutputTopic == "" {
+		return nil, errors.New("管道的输入主题和输出主题不能为空")
+	}
+	if p.TransactionalID == "" {
+		return nil, errors.New("管道的事务ID不能为空")
+	}
+
+	config, err := c.ProducerSaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, fmt.Errorf("Kafka事务要求版本不低于0.11.0.0: %s", config.Version)
+	}
+	initial, err := parseOffsetReset(c.Consumer.OffsetReset)
+	if err != nil {
+		return nil, err
+	}
+
+	// 事务生产者要求幂等、确认级别为all且最大并发请求数为1
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Transaction.ID = p.TransactionalID
+	config.Net.MaxOpenRequests = 1
+
+	// 偏移量随事务提交，消费者只读取已提交的事务消息
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = initial
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	return config, nil
+}
+
+// Validate 校验限流和背压参数是否合法
+func (c LimitsConfig) Validate() error {
+	if c.Rate < 0 || c.PartitionRate < 0 || c.Burst < 0 || c.PartitionBurst < 0 {
+		return fmt.Errorf("限流参数不能为负数: %+v", c)
+	}
+	if c.HighWaterMark < 0 || c.LowWaterMark < 0 {
+		return fmt.Errorf("背压水位不能为负数: high=%d, low=%d", c.HighWaterMark, c.LowWaterMark)
+	}
+	if c.HighWaterMark > 0 && c.LowWaterMark >= c.HighWaterMark {
+		return fmt.Errorf("背压低水位必须小于高水位: high=%d, low=%d", c.HighWaterMark, c.LowWaterMark)
+	}
+	return nil
+}
+
+// FitChannelBuffer 在背压高水位不小于消息通道容量时增大 ChannelBufferSize
+// 逐条和批量消费按分区消息通道中的消息数计算待处理消息，通道容量为 ChannelBufferSize（sarama默认256），
+// 高水位不小于它时永远不会暂停拉取
+// 参数:
+//   - cfg: 消费者使用的sarama配置
+func (c LimitsConfig) FitChannelBuffer(cfg *sarama.Config) {
+	if c.HighWaterMark >= cfg.ChannelBufferSize {
+		cfg.ChannelBufferSize = c.HighWaterMark + 1
+	}
+}
+
+// DelaySaramaConfig 根据配置构建延迟队列使用的sarama配置
+// 同一份配置同时用于转发器的消费者组和生产者：转发成功后才标记偏移量并自动提交，
+// 没有提交偏移量时从最早的消息开始，避免转发器首次启动时跳过已写入的延迟消息
+// 返回:
+//   - *sarama.Config: 延迟队列配置
+//   - error: 配置不合法时返回错误
+func (c *Config) DelaySaramaConfig() (*sarama.Config, error) {
+	d := c.Delay
+	if d.TopicPrefix == "" || d.GroupID == "" {
+		return nil, errors.New("延迟队列的主题前缀和消费者组ID不能为空")
+	}
+	if len(d.Levels) == 0 {
+		return nil, errors.New("延迟队列至少需要一个延迟级别")
+	}
+	for i, level := range d.Levels {
+		if level <= 0 || (i > 0 && level <= d.Levels[i-1]) {
+			return nil, fmt.Errorf("延迟级别必须大于0且递增: %v", d.Levels)
+		}
+	}
+
+	config, err := c.ProducerSaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Return.Successes = true
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Offsets.AutoCommit.Enable = true
+	return config, nil
+}
+
+// ReplySaramaConfig 根据配置构建请求方使用的sarama配置
+// 同一份配置用于发送请求的生产者、读取回复的消费者和创建回复主题的集群管理客户端
+// 返回:
+//   - *sarama.Config: 请求方配置
+//   - error: 配置不合法时返回错误
+func (c *Config) ReplySaramaConfig() (*sarama.Config, error) {
+	r := c.Reply
+	if r.RequestTopic == "" || r.ReplyTopicPrefix == "" {
+		return nil, errors.New("请求主题和回复主题前缀不能为空")
+	}
+	if r.Timeout <= 0 {
+		return nil, fmt.Errorf("等待回复的超时时间必须大于0: %v", r.Timeout)
+	}
+	if r.ReplicationFactor <= 0 {
+		return nil, fmt.Errorf("回复主题的副本数必须大于0: %d", r.ReplicationFactor)
+	}
+
+	config, err := c.ProducerSaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Return.Successes = true
+	return config, nil
+}
+
+// ReplyTopic 返回当前实例的回复主题，如 kafka-example-replies-host1
+// 未配置实例ID时使用主机名，主题名中不允许的字符替换为 _
+func (c ReplyConfig) ReplyTopic() string {
+	id := c.InstanceID
+	if id == "" {
+		id, _ = os.Hostname()
+	}
+	if id == "" {
+		id = "default"
+	}
+	return c.ReplyTopicPrefix + "-" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, id)
+}
+
+// parseAcks 解析确认级别
+func parseAcks(s string) (sarama.RequiredAcks, error) {
+	switch strings.ToLower(s) {
+	case "", "all", "-1":
+		return sarama.WaitForAll, nil
+	case "leader", "1":
+		return sarama.WaitForLocal, nil
+	case "none", "0":
+		return sarama.NoResponse, nil
+	default:
+		return 0, fmt.Errorf("未知的确认级别: %s", s)
+	}
+}
+
+// parseIsolation 解析事务隔离级别
+func parseIsolation(s string) (sarama.IsolationLevel, error) {
+	switch strings.ToLower(s) {
+	case "", "read_committed":
+		return sarama.ReadCommitted, nil
+	case "read_uncommitted":
+		return sarama.ReadUncommitted, nil
+	default:
+		return 0, fmt.Errorf("未知的事务隔离级别: %s", s)
+	}
+}
+
+// parseOffsetReset 解析偏移量重置策略
+func parseOffsetReset(s string) (int64, error) {
+	switch strings.ToLower(s) {
+	case "", "newest", "latest":
+		return sarama.OffsetNewest, nil
+	case "oldest", "earliest":
+		return sarama.OffsetOldest, nil
+	default:
+		return 0, fmt.Errorf("未知的偏移量重置策略: %s", s)
+	}
+}
@@ -0,0 +1,375 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// writeConfigFile 在临时目录中写入配置文件
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	return path
+}
+
+// TestLoad 测试配置加载
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		check   func(t *testing.T, cfg *Config)
+		wantErr bool
+	}{
+		{
+			name:    "文件不存在时使用默认配置",
+			content: "",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Consumer.GroupID != "group_consumer" {
+					t.Errorf("GroupID = %s, 期望 group_consumer", cfg.Consumer.GroupID)
+				}
+			},
+		},
+		{
+			name: "从文件加载配置",
+			content: `
+brokers: ["k1:9092", "k2:9092"]
+topics:
+  sync: orders
+producer:
+  acks: leader
+  compression: zstd
+  idempotent: false
+  flush:
+    frequency: 500ms
+    messages: 100
+consumer:
+  offset_reset: earliest
+`,
+			check: func(t *testing.T, cfg *Config) {
+				if len(cfg.Brokers) != 2 || cfg.Topics.Sync != "orders" {
+					t.Errorf("配置未正确加载: %+v", cfg)
+				}
+				if cfg.Topics.Async == "" {
+					t.Error("未设置的字段应保留默认值")
+				}
+				pc, err := cfg.ProducerSaramaConfig()
+				if err != nil {
+					t.Fatalf("ProducerSaramaConfig() error = %v", err)
+				}
+				if pc.Producer.RequiredAcks != sarama.WaitForLocal || pc.Producer.Compression != sarama.CompressionZSTD {
+					t.Errorf("生产者配置不正确: acks=%v, compression=%v", pc.Producer.RequiredAcks, pc.Producer.Compression)
+				}
+				if pc.Producer.Flush.Frequency != 500*time.Millisecond || pc.Producer.Flush.Messages != 100 {
+					t.Errorf("批量配置不正确: %+v", pc.Producer.Flush)
+				}
+				cc, err := cfg.ConsumerSaramaConfig()
+				if err != nil {
+					t.Fatalf("ConsumerSaramaConfig() error = %v", err)
+				}
+				if cc.Consumer.Offsets.Initial != sarama.OffsetOldest {
+					t.Errorf("偏移量策略不正确: %d", cc.Consumer.Offsets.Initial)
+				}
+			},
+		},
+		{
+			name:    "环境变量覆盖文件配置",
+			content: `brokers: ["k1:9092"]`,
+			env: map[string]string{
+				"KAFKA_BROKERS":  "e1:9092,e2:9092",
+				"KAFKA_GROUP_ID": "env_group",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if len(cfg.Brokers) != 2 || cfg.Brokers[0] != "e1:9092" {
+					t.Errorf("Brokers = %v", cfg.Brokers)
+				}
+				if cfg.Consumer.GroupID != "env_group" {
+					t.Errorf("GroupID = %s", cfg.Consumer.GroupID)
+				}
+			},
+		},
+		{
+			name:    "环境变量覆盖幂等性和重试次数",
+			content: "producer:\n  idempotent: true\n  retry_max: 5\n",
+			env:     map[string]string{"KAFKA_IDEMPOTENT": "false", "KAFKA_RETRY_MAX": "2"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Producer.Idempotent || cfg.Producer.RetryMax != 2 {
+					t.Errorf("Idempotent = %v, RetryMax = %d, 期望 false, 2", cfg.Producer.Idempotent, cfg.Producer.RetryMax)
+				}
+			},
+		},
+		{
+			name:    "重试次数环境变量不合法",
+			env:     map[string]string{"KAFKA_RETRY_MAX": "many"},
+			wantErr: true,
+		},
+		{
+			name:    "加载SASL认证配置并由环境变量提供密码",
+			content: "security:\n  sasl:\n    mechanism: SCRAM-SHA-512\n    username: app\n",
+			env:     map[string]string{"KAFKA_SASL_PASSWORD": "secret"},
+			check: func(t *testing.T, cfg *Config) {
+				for name, build := range map[string]func() (*sarama.Config, error){
+					"producer": cfg.ProducerSaramaConfig,
+					"consumer": cfg.ConsumerSaramaConfig,
+					"admin":    cfg.AdminSaramaConfig,
+				} {
+					sc, err := build()
+					if err != nil {
+						t.Fatalf("%s: 构建sarama配置失败: %v", name, err)
+					}
+					if !sc.Net.SASL.Enable || sc.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 || sc.Net.SASL.Password != "secret" {
+						t.Errorf("%s: SASL = %+v", name, sc.Net.SASL)
+					}
+				}
+			},
+		},
+		{
+			name:    "非法的SASL认证机制",
+			content: "security:\n  sasl:\n    mechanism: KERBEROS\n    username: app\n",
+			wantErr: true,
+		},
+		{
+			name:    "启用claim-check",
+			content: "claim_check:\n  enabled: true\n  compress_threshold: 1024\n",
+			env:     map[string]string{"KAFKA_CLAIM_CHECK_DIR": "/tmp/blobs"},
+			check: func(t *testing.T, cfg *Config) {
+				cc := cfg.ClaimCheck
+				if !cc.Enabled || cc.CompressThreshold != 1024 || cc.Dir != "/tmp/blobs" || cc.Retention != 7*24*time.Hour {
+					t.Errorf("ClaimCheck = %+v", cc)
+				}
+			},
+		},
+		{
+			name:    "claim-check保留时间不合法",
+			content: "claim_check:\n  enabled: true\n  retention: 0s\n",
+			wantErr: true,
+		},
+		{
+			name:    "启用请求-回复",
+			content: "reply:\n  enabled: true\n  timeout: 3s\n",
+			env:     map[string]string{"KAFKA_INSTANCE_ID": "web 1"},
+			check: func(t *testing.T, cfg *Config) {
+				r := cfg.Reply
+				if !r.Enabled || r.Timeout != 3*time.Second || r.RequestTopic != "kafka-example-requests" {
+					t.Errorf("Reply = %+v", r)
+				}
+				if got := r.ReplyTopic(); got != "kafka-example-replies-web_1" {
+					t.Errorf("ReplyTopic() = %s, 期望 kafka-example-replies-web_1", got)
+				}
+			},
+		},
+		{
+			name:    "请求-回复超时时间不合法",
+			content: "reply:\n  enabled: true\n  timeout: 0s\n",
+			wantErr: true,
+		},
+		{
+			name:    "启用归档",
+			content: "archive:\n  enabled: true\n  topics: [orders]\n  compress: false\n",
+			env:     map[string]string{"KAFKA_ARCHIVE_DIR": "/tmp/archive"},
+			check: func(t *testing.T, cfg *Config) {
+				a := cfg.Archive
+				if !a.Enabled || len(a.Topics) != 1 || a.Topics[0] != "orders" || a.Compress || a.Dir != "/tmp/archive" {
+					t.Errorf("Archive = %+v", a)
+				}
+				if a.MaxSegmentAge != time.Hour || a.MaxSegmentBytes != 64*1024*1024 {
+					t.Errorf("未设置的滚动参数应保留默认值: %+v", a)
+				}
+			},
+		},
+		{
+			name:    "归档分段大小不合法",
+			content: "archive:\n  enabled: true\n  max_segment_bytes: 0\n",
+			wantErr: true,
+		},
+		{
+			name:    "重试次数超过上限",
+			content: "producer:\n  retry_max: 11\n",
+			wantErr: true,
+		},
+		{
+			name:    "重试次数为负数",
+			env:     map[string]string{"KAFKA_RETRY_MAX": "-1"},
+			wantErr: true,
+		},
+		{
+			name:    "非法的确认级别",
+			content: "producer:\n  acks: some\n",
+			wantErr: true,
+		},
+		{
+			name:    "加载偏移量提交配置",
+			content: "consumer:\n  commit:\n    mode: count\n    count: 10\n",
+			env:     map[string]string{"KAFKA_COMMIT_MODE": "batch"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Consumer.Commit.Mode != CommitModeBatch || cfg.Consumer.Commit.Count != 10 {
+					t.Errorf("Commit = %+v", cfg.Consumer.Commit)
+				}
+			},
+		},
+		{
+			name:    "非法的偏移量提交模式",
+			content: "consumer:\n  commit:\n    mode: never\n",
+			wantErr: true,
+		},
+		{
+			name:    "count模式的消息数不合法",
+			content: "consumer:\n  commit:\n    mode: count\n    count: 0\n",
+			wantErr: true,
+		},
+		{
+			name:    "启用事务管道",
+			content: "pipeline:\n  enabled: true\n  transactional_id: tx-1\n",
+			check: func(t *testing.T, cfg *Config) {
+				sc, err := cfg.PipelineSaramaConfig()
+				if err != nil {
+					t.Fatalf("PipelineSaramaConfig() error = %v", err)
+				}
+				if sc.Producer.Transaction.ID != "tx-1" || !sc.Producer.Idempotent || sc.Net.MaxOpenRequests != 1 {
+					t.Errorf("事务生产者配置不正确: id=%s, idempotent=%v", sc.Producer.Transaction.ID, sc.Producer.Idempotent)
+				}
+				if sc.Consumer.IsolationLevel != sarama.ReadCommitted {
+					t.Errorf("IsolationLevel = %v, 期望 ReadCommitted", sc.Consumer.IsolationLevel)
+				}
+			},
+		},
+		{
+			name:    "启用事务管道但事务ID为空",
+			content: "pipeline:\n  enabled: true\n  transactional_id: \"\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "启用延迟队列",
+			content: "delay:\n  enabled: true\n  levels: [5s, 1m]\n",
+			check: func(t *testing.T, cfg *Config) {
+				if len(cfg.Delay.Levels) != 2 || cfg.Delay.Levels[1] != time.Minute {
+					t.Errorf("Levels = %v, 期望 [5s 1m0s]", cfg.Delay.Levels)
+				}
+				sc, err := cfg.DelaySaramaConfig()
+				if err != nil {
+					t.Fatalf("DelaySaramaConfig() error = %v", err)
+				}
+				if sc.Consumer.Offsets.Initial != sarama.OffsetOldest || !sc.Consumer.Offsets.AutoCommit.Enable {
+					t.Errorf("转发器应从最早的消息开始并自动提交偏移量")
+				}
+			},
+		},
+		{
+			name:    "延迟级别未递增",
+			content: "delay:\n  enabled: true\n  levels: [1m, 10s]\n",
+			wantErr: true,
+		},
+		{
+			name:    "加载限流和背压配置",
+			content: "consumer:\n  limits:\n    rate: 100\n    high_water_mark: 50\n    low_water_mark: 10\n",
+			env:     map[string]string{"KAFKA_PARTITION_RATE": "20"},
+			check: func(t *testing.T, cfg *Config) {
+				l := cfg.Consumer.Limits
+				if l.Rate != 100 || l.PartitionRate != 20 || l.HighWaterMark != 50 || l.LowWaterMark != 10 {
+					t.Errorf("Limits = %+v", l)
+				}
+			},
+		},
+		{
+			name:    "背压低水位不小于高水位",
+			content: "consumer:\n  limits:\n    high_water_mark: 10\n    low_water_mark: 10\n",
+			wantErr: true,
+		},
+		{
+			name:    "非法的事务隔离级别",
+			content: "consumer:\n  isolation: serializable\n",
+			wantErr: true,
+		},
+		{
+			name: "环境变量覆盖工作协程数",
+			env:  map[string]string{"KAFKA_CONSUMER_WORKERS": "8"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Consumer.Workers != 8 {
+					t.Errorf("Workers = %d, 期望 8", cfg.Consumer.Workers)
+				}
+			},
+		},
+		{
+			name: "环境变量启用去重",
+			env:  map[string]string{"KAFKA_DEDUP_ENABLED": "true", "KAFKA_DEDUP_STORE": "redis", "REDIS_ADDR": "redis:6379"},
+			check: func(t *testing.T, cfg *Config) {
+				if !cfg.Consumer.Dedup.Enabled || cfg.Consumer.Dedup.Store != "redis" || cfg.Consumer.Dedup.Redis.Addr != "redis:6379" {
+					t.Errorf("Dedup = %+v, 期望启用redis存储", cfg.Consumer.Dedup)
+				}
+			},
+		},
+		{
+			name:    "未知的去重存储类型",
+			content: "consumer:\n  dedup:\n    enabled: true\n    store: file\n",
+			wantErr: true,
+		},
+		{
+			name:    "工作协程数为负数",
+			content: "consumer:\n  workers: -1\n",
+			wantErr: true,
+		},
+		{
+			name:    "非法的分区器",
+			content: "producer:\n  partitioner: sticky\n",
+			wantErr: true,
+		},
+		{
+			name:    "非法的Kafka版本",
+			content: `version: "abc"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := filepath.Join(t.TempDir(), "missing.yaml")
+			if tt.content != "" {
+				path = writeConfigFile(t, tt.content)
+			}
+
+			cfg, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+// TestLimitsConfig_FitChannelBuffer 测试背压高水位不小于消息通道容量时增大通道容量
+func TestLimitsConfig_FitChannelBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		highWaterMark int
+		want          int
+	}{
+		{name: "未启用背压", highWaterMark: 0, want: 256},
+		{name: "高水位小于默认容量", highWaterMark: 100, want: 256},
+		{name: "高水位等于默认容量", highWaterMark: 256, want: 257},
+		{name: "高水位大于默认容量", highWaterMark: 1000, want: 1001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Consumer.Limits = LimitsConfig{HighWaterMark: tt.highWaterMark}
+			cc, err := cfg.ConsumerSaramaConfig()
+			if err != nil {
+				t.Fatalf("ConsumerSaramaConfig() error = %v", err)
+			}
+			if cc.ChannelBufferSize != tt.want {
+				t.Errorf("ChannelBufferSize = %d, 期望 %d", cc.ChannelBufferSize, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// SASL认证机制
+const (
+	SASLMechanismPlain       = "PLAIN"         // 用户名密码明文认证，应配合TLS使用
+	SASLMechanismSCRAMSHA256 = "SCRAM-SHA-256" // SCRAM认证，使用SHA-256
+	SASLMechanismSCRAMSHA512 = "SCRAM-SHA-512" // SCRAM认证，使用SHA-512
+)
+
+// SecurityConfig 连接Kafka的认证和加密配置
+// 所有sarama配置（生产者、消费者、集群管理、管道、延迟队列）都会应用该配置
+type SecurityConfig struct {
+	SASL SASLConfig `yaml:"sasl"` // SASL认证配置
+	TLS  TLSConfig  `yaml:"tls"`  // TLS加密配置
+}
+
+// SASLConfig SASL认证配置
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism"` // 认证机制: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512，为空时不启用SASL
+	Username  string `yaml:"username"`  // 用户名
+	Password  string `yaml:"password"`  // 密码，建议通过环境变量 KAFKA_SASL_PASSWORD 设置
+}
+
+// TLSConfig TLS加密配置
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`              // 是否启用TLS
+	CAFile             string `yaml:"ca_file"`              // CA证书文件，为空时使用系统根证书
+	CertFile           string `yaml:"cert_file"`            // 客户端证书文件，双向认证时与 key_file 一起设置
+	KeyFile            string `yaml:"key_file"`             // 客户端私钥文件
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 跳过服务端证书校验，仅用于开发环境
+}
+
+// Apply 将认证和加密配置应用到sarama配置
+// 参数:
+//   - config: 要修改的sarama配置
+//
+// 返回:
+//   - error: 认证机制未知、缺少用户名或证书文件无法加载时返回错误
+func (c SecurityConfig) Apply(config *sarama.Config) error {
+	if c.TLS.Enabled {
+		tlsConfig, err := c.TLS.build()
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	if c.SASL.Mechanism != "" {
+		if err := c.SASL.apply(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply 设置sarama的SASL认证参数
+func (c SASLConfig) apply(config *sarama.Config) error {
+	if c.Username == "" {
+		return errors.New("启用SASL认证时用户名不能为空")
+	}
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.User = c.Username
+	config.Net.SASL.Password = c.Password
+
+	switch strings.ToUpper(c.Mechanism) {
+	case SASLMechanismPlain:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case SASLMechanismSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA256}
+		}
+	case SASLMechanismSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hash: scram.SHA512}
+		}
+	default:
+		return fmt.Errorf("未知的SASL认证机制: %s", c.Mechanism)
+	}
+	return nil
+}
+
+// build 根据证书文件创建TLS配置
+func (c TLSConfig) build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA证书文件中没有有效的证书: %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("客户端证书和私钥必须同时设置")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// scramClient 基于 xdg-go/scram 实现 sarama.SCRAMClient
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+// Begin 使用用户名和密码开始SCRAM认证会话
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+// Step 处理服务端的挑战并返回下一条客户端消息
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+// Done 返回认证会话是否结束
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// writeTestCert 在临时目录中生成自签名证书和私钥，返回证书和私钥文件路径
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成私钥失败: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka-example-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("编码私钥失败: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("写入证书失败: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("写入私钥失败: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// TestSecurityConfig_Apply 测试SASL和TLS配置应用到sarama配置
+func TestSecurityConfig_Apply(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	invalidCA := filepath.Join(t.TempDir(), "invalid.pem")
+	if err := os.WriteFile(invalidCA, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		security SecurityConfig
+		check    func(t *testing.T, cfg *sarama.Config)
+		wantErr  string
+	}{
+		{
+			name: "未配置时不启用认证和加密",
+			check: func(t *testing.T, cfg *sarama.Config) {
+				if cfg.Net.SASL.Enable || cfg.Net.TLS.Enable {
+					t.Errorf("SASL.Enable = %v, TLS.Enable = %v, 期望均为 false", cfg.Net.SASL.Enable, cfg.Net.TLS.Enable)
+				}
+			},
+		},
+		{
+			name:     "PLAIN认证",
+			security: SecurityConfig{SASL: SASLConfig{Mechanism: "plain", Username: "user", Password: "secret"}},
+			check: func(t *testing.T, cfg *sarama.Config) {
+				if !cfg.Net.SASL.Enable || cfg.Net.SASL.Mechanism != sarama.SASLTypePlaintext {
+					t.Errorf("SASL = %+v", cfg.Net.SASL)
+				}
+				if cfg.Net.SASL.User != "user" || cfg.Net.SASL.Password != "secret" {
+					t.Errorf("用户名或密码未设置: %s/%s", cfg.Net.SASL.User, cfg.Net.SASL.Password)
+				}
+			},
+		},
+		{
+			name: "SCRAM-SHA-512认证和TLS",
+			security: SecurityConfig{
+				SASL: SASLConfig{Mechanism: SASLMechanismSCRAMSHA512, Username: "user", Password: "secret"},
+				TLS:  TLSConfig{Enabled: true, CAFile: certFile},
+			},
+			check: func(t *testing.T, cfg *sarama.Config) {
+				if cfg.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 || cfg.Net.SASL.SCRAMClientGeneratorFunc == nil {
+					t.Fatalf("SASL = %+v", cfg.Net.SASL)
+				}
+				client := cfg.Net.SASL.SCRAMClientGeneratorFunc()
+				if err := client.Begin("user", "secret", ""); err != nil {
+					t.Fatalf("Begin() error = %v", err)
+				}
+				first, err := client.Step("")
+				if err != nil {
+					t.Fatalf("Step() error = %v", err)
+				}
+				if !strings.HasPrefix(first, "n,,n=user,r=") || client.Done() {
+					t.Errorf("SCRAM第一条消息 = %s", first)
+				}
+				if !cfg.Net.TLS.Enable || cfg.Net.TLS.Config.RootCAs == nil {
+					t.Error("TLS未启用或未加载CA证书")
+				}
+				if err := cfg.Validate(); err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+			},
+		},
+		{
+			name:     "双向TLS并跳过服务端证书校验",
+			security: SecurityConfig{TLS: TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile, InsecureSkipVerify: true}},
+			check: func(t *testing.T, cfg *sarama.Config) {
+				tlsConfig := cfg.Net.TLS.Config
+				if len(tlsConfig.Certificates) != 1 || !tlsConfig.InsecureSkipVerify || tlsConfig.RootCAs != nil {
+					t.Errorf("TLS配置不正确: certificates=%d, insecure=%v", len(tlsConfig.Certificates), tlsConfig.InsecureSkipVerify)
+				}
+			},
+		},
+		{
+			name:     "未知的认证机制",
+			security: SecurityConfig{SASL: SASLConfig{Mechanism: "GSSAPI", Username: "user"}},
+			wantErr:  "未知的SASL认证机制",
+		},
+		{
+			name:     "缺少用户名",
+			security: SecurityConfig{SASL: SASLConfig{Mechanism: SASLMechanismSCRAMSHA256}},
+			wantErr:  "用户名不能为空",
+		},
+		{
+			name:     "CA证书无效",
+			security: SecurityConfig{TLS: TLSConfig{Enabled: true, CAFile: invalidCA}},
+			wantErr:  "没有有效的证书",
+		},
+		{
+			name:     "只设置了客户端证书",
+			security: SecurityConfig{TLS: TLSConfig{Enabled: true, CertFile: certFile}},
+			wantErr:  "必须同时设置",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := sarama.NewConfig()
+			err := tt.security.Apply(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Apply() error = %v, 期望包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package consumer
+
+import (
+	"context"
+	"kafka-example/config"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 批次处理或转存死信失败后的重试参数
+const (
+	minRetryBackoff = 100 * time.Millisecond // 失败后的初始等待时间
+	maxRetryBackoff = 30 * time.Second       // 失败后的最大等待时间
+)
+
+// committer 按提交策略在单个分区认领内提交已标记的偏移量
+// sess.Commit 会同步提交整个会话中已标记的偏移量，包括其他分区
+type committer struct {
+	sess    sarama.ConsumerGroupSession
+	mode    string
+	count   int          // count模式下的提交阈值
+	pending int          // 上次提交后标记的消息数
+	ticker  *time.Ticker // interval模式下的定时器
+}
+
+// newCommitter 创建分区认领使用的提交器
+func newCommitter(sess sarama.ConsumerGroupSession, cfg config.CommitConfig) *committer {
+	c := &committer{sess: sess, mode: cfg.Mode, count: cfg.Count}
+	if c.mode == "" {
+		c.mode = config.CommitModeInterval
+	}
+	if c.mode == config.CommitModeInterval {
+		interval := cfg.Interval
+		if interval <= 0 {
+			interval = time.Second
+		}
+		c.ticker = time.NewTicker(interval)
+	}
+	return c
+}
+
+// tick 返回interval模式的定时通道，其他模式返回nil，在select中永远不会就绪
+func (c *committer) tick() <-chan time.Time {
+	if c.ticker == nil {
+		return nil
+	}
+	return c.ticker.C
+}
+
+// marked 在标记消息后调用，n 为本次标记推进的消息数，按提交模式决定是否立即提交
+func (c *committer) marked(n int) {
+	c.pending += n
+	switch c.mode {
+	case config.CommitModeMessage:
+		c.commit()
+	case config.CommitModeCount:
+		if c.pending >= c.count {
+			c.commit()
+		}
+	}
+}
+
+// commit 同步提交已标记的偏移量，没有新标记的消息时跳过
+func (c *committer) commit() {
+	if c.pending == 0 {
+		return
+	}
+	c.sess.Commit()
+	c.pending = 0
+}
+
+// stop 释放定时器
+func (c *committer) stop() {
+	if c.ticker != nil {
+		c.ticker.Stop()
+	}
+}
+
+// consumeBatches 以批量方式消费分区认领中的消息
+// 批次达到 BatchSize 或等待超过 BatchTimeout 时处理一批，整批处理成功（或全部转存死信）后才标记并提交偏移量，失败的批次原地重试；
+// 会话结束时尚未处理的批次直接丢弃，消息会在下次分配时重新消费
+func (h consumerGroupHandler) consumeBatches(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	size := h.commit.BatchSize
+	if size <= 0 {
+		size = 1
+	}
+	timeout := h.commit.BatchTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+
+	bp := newBackpressure(h.throttle, h.pauser, claim.Topic(), claim.Partition())
+	defer bp.release()
+
+	batch := make([]*sarama.ConsumerMessage, 0, size)
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	flush := func() bool {
+		if timer != nil {
+			timer.Stop()
+			timer, timerC = nil, nil
+		}
+		if len(batch) == 0 {
+			return true
+		}
+		ok := h.processBatch(sess, batch)
+		batch = batch[:0]
+		bp.update(len(claim.Messages()))
+		return ok
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				log.Printf("[GroupConsumer] 分区 %d 的消息消费完成", claim.Partition())
+				return nil
+			}
+			if err := h.throttle.wait(sess.Context(), msg.Topic, msg.Partition); err != nil {
+				log.Printf("[GroupConsumer] 会话已结束，停止消费分区 %d，丢弃未处理的 %d 条消息", claim.Partition(), len(batch))
+				return nil
+			}
+			batch = append(batch, msg)
+			bp.update(len(batch) + len(claim.Messages()))
+			if timer == nil {
+				timer = time.NewTimer(timeout)
+				timerC = timer.C
+			}
+			if len(batch) >= size && !flush() {
+				return nil
+			}
+		case <-timerC:
+			timer, timerC = nil, nil
+			if !flush() {
+				return nil
+			}
+		case <-sess.Context().Done():
+			log.Printf("[GroupConsumer] 会话已结束，停止消费分区 %d，丢弃未处理的 %d 条消息", claim.Partition(), len(batch))
+			return nil
+		}
+	}
+}
+
+// processBatch 处理一批消息并在成功后同步提交偏移量
+// 处理失败且未能全部转存死信时按指数退避重试整批，直到成功或会话结束；
+// 在此之前不会消费同一分区的后续批次，避免后续批次的提交越过失败的批次。重试时已转存死信的消息可能重复转存
+// 返回: 会话是否仍然有效，会话已结束时调用方应停止消费
+func (h consumerGroupHandler) processBatch(sess sarama.ConsumerGroupSession, batch []*sarama.ConsumerMessage) bool {
+	first, last := batch[0], batch[len(batch)-1]
+	backoff := minRetryBackoff
+	for !h.handleBatch(sess.Context(), batch) {
+		// 会话已结束导致的失败不标记也不转存死信，整批会在下次分配时重新消费
+		if sess.Context().Err() != nil {
+			log.Printf("[GroupConsumer] 会话已结束，放弃处理批次: topic=%s, partition=%d, offset=%d-%d",
+				first.Topic, first.Partition, first.Offset, last.Offset)
+			return false
+		}
+		log.Printf("[GroupConsumer] 批次未处理完成，%v 后重试: partition=%d, offset=%d-%d",
+			backoff, first.Partition, first.Offset, last.Offset)
+		select {
+		case <-sess.Context().Done():
+			log.Printf("[GroupConsumer] 会话已结束，放弃处理批次: topic=%s, partition=%d, offset=%d-%d",
+				first.Topic, first.Partition, first.Offset, last.Offset)
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+
+	sess.MarkMessage(last, "")
+	sess.Commit()
+	return true
+}
+
+// handleBatch 调用批量处理器，失败时将整批消息转存死信
+// 返回: 整批是否处理成功或全部转存死信，为true时调用方可以标记整批
+func (h consumerGroupHandler) handleBatch(ctx context.Context, batch []*sarama.ConsumerMessage) bool {
+	err := h.batch.HandleBatch(ctx, batch)
+	if err == nil {
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	first, last := batch[0], batch[len(batch)-1]
+	log.Printf("[GroupConsumer] 批量处理消息失败: partition=%d, offset=%d-%d, error=%v",
+		first.Partition, first.Offset, last.Offset, err)
+	for _, msg := range batch {
+		if !h.sendToDeadLetter(msg, err) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,410 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"kafka-example/config"
+	"kafka-example/kafkatest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// recordingHandler 记录每个偏移量被处理的次数
+type recordingHandler struct {
+	mu    sync.Mutex
+	seen  map[int64]int
+	total int
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{seen: make(map[int64]int)}
+}
+
+func (r *recordingHandler) record(msg *sarama.ConsumerMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen[msg.Offset]++
+	r.total++
+}
+
+func (r *recordingHandler) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+func (r *recordingHandler) times(offset int64) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.seen[offset]
+}
+
+// mockDeadLetter 记录发布到死信队列的消息
+type mockDeadLetter struct {
+	mu       sync.Mutex
+	failures int // 发布失败的次数，-1 表示一直失败
+	attempts int
+	messages []*sarama.ConsumerMessage
+}
+
+func (m *mockDeadLetter) Publish(msg *sarama.ConsumerMessage, _ error, _ int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.failures < 0 || m.attempts <= m.failures {
+		return errors.New("死信主题不可用")
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// published 返回成功发布的消息数和发布尝试次数
+func (m *mockDeadLetter) published() (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages), m.attempts
+}
+
+// TestCommitStrategies 测试不同提交模式在会话运行期间提交偏移量，无需等待会话结束
+func TestCommitStrategies(t *testing.T) {
+	tests := []struct {
+		name        string
+		commit      config.CommitConfig
+		messages    int
+		wantOffset  int64 // 会话运行期间应提交到的偏移量
+		wantCommits int   // 会话运行期间的最少提交次数
+	}{
+		{
+			name:        "每条消息提交",
+			commit:      config.CommitConfig{Mode: config.CommitModeMessage},
+			messages:    5,
+			wantOffset:  5,
+			wantCommits: 5,
+		},
+		{
+			name:        "每N条消息提交",
+			commit:      config.CommitConfig{Mode: config.CommitModeCount, Count: 2},
+			messages:    5,
+			wantOffset:  4,
+			wantCommits: 2,
+		},
+		{
+			name:        "定时提交",
+			commit:      config.CommitConfig{Mode: config.CommitModeInterval, Interval: 20 * time.Millisecond},
+			messages:    5,
+			wantOffset:  5,
+			wantCommits: 1,
+		},
+		{
+			name:        "批量处理成功后提交",
+			commit:      config.CommitConfig{Mode: config.CommitModeBatch, BatchSize: 2, BatchTimeout: 20 * time.Millisecond},
+			messages:    5,
+			wantOffset:  5,
+			wantCommits: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker("test-topic", 0)
+			for i := 0; i < tt.messages; i++ {
+				broker.Produce(0, "msg")
+			}
+
+			rec := newRecordingHandler()
+			handler := HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+				rec.record(msg)
+				return nil
+			})
+			service := newGroupConsumer(broker.NewConsumerGroup(), []string{"test-topic"}, nil,
+				newOptions([]Option{WithHandler(handler), WithMiddleware(), WithCommit(tt.commit)}))
+			if err := service.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer service.Stop()
+
+			waitFor(t, time.Second, func() bool {
+				committed, commits := broker.Committed()
+				return committed[0] == tt.wantOffset && commits >= tt.wantCommits
+			})
+			if rec.count() != tt.messages {
+				t.Errorf("处理了 %d 条消息, 期望 %d", rec.count(), tt.messages)
+			}
+
+			// 停止时同步提交剩余的偏移量
+			if err := service.Stop(); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+			if committed, _ := broker.Committed(); committed[0] != int64(tt.messages) {
+				t.Errorf("停止后提交的偏移量 = %d, 期望 %d", committed[0], tt.messages)
+			}
+		})
+	}
+}
+
+// TestCommitStrategies_CrashRecovery 测试处理中途崩溃后重启，未提交的消息会被重新消费（至少一次）
+func TestCommitStrategies_CrashRecovery(t *testing.T) {
+	tests := []struct {
+		name          string
+		commit        config.CommitConfig
+		crashAt       int64 // 处理该偏移量时崩溃
+		wantCommitted int64 // 崩溃后已提交的偏移量
+	}{
+		{
+			name:          "每条消息提交",
+			commit:        config.CommitConfig{Mode: config.CommitModeMessage},
+			crashAt:       3,
+			wantCommitted: 3,
+		},
+		{
+			name:          "每N条消息提交",
+			commit:        config.CommitConfig{Mode: config.CommitModeCount, Count: 2},
+			crashAt:       3,
+			wantCommitted: 2,
+		},
+		{
+			name:          "定时提交",
+			commit:        config.CommitConfig{Mode: config.CommitModeInterval, Interval: time.Hour},
+			crashAt:       3,
+			wantCommitted: 0,
+		},
+		{
+			name:          "批次处理到一半时崩溃",
+			commit:        config.CommitConfig{Mode: config.CommitModeBatch, BatchSize: 3, BatchTimeout: 20 * time.Millisecond},
+			crashAt:       4,
+			wantCommitted: 3,
+		},
+	}
+
+	const messages = 6
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker("test-topic", 0)
+			for i := 0; i < messages; i++ {
+				broker.Produce(0, "msg")
+			}
+
+			// 第一次运行：处理到 crashAt 时模拟进程崩溃
+			rec := newRecordingHandler()
+			group := broker.NewConsumerGroup()
+			crashed := make(chan struct{})
+			var once sync.Once
+			handler := HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+				if msg.Offset == tt.crashAt {
+					once.Do(func() {
+						group.Crash()
+						close(crashed)
+					})
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				rec.record(msg)
+				return nil
+			})
+			service := newGroupConsumer(group, []string{"test-topic"}, nil,
+				newOptions([]Option{WithHandler(handler), WithMiddleware(), WithCommit(tt.commit)}))
+			if err := service.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			select {
+			case <-crashed:
+			case <-time.After(time.Second):
+				t.Fatal("等待崩溃超时")
+			}
+			if err := service.Stop(); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+
+			committed, _ := broker.Committed()
+			if committed[0] != tt.wantCommitted {
+				t.Fatalf("崩溃后提交的偏移量 = %d, 期望 %d", committed[0], tt.wantCommitted)
+			}
+
+			// 第二次运行：从已提交的偏移量继续消费
+			restarted := newGroupConsumer(broker.NewConsumerGroup(), []string{"test-topic"}, nil,
+				newOptions([]Option{WithHandler(HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+					rec.record(msg)
+					return nil
+				})), WithMiddleware(), WithCommit(tt.commit)}))
+			if err := restarted.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			want := rec.count() + messages - int(tt.wantCommitted)
+			waitFor(t, time.Second, func() bool { return rec.count() == want })
+			if err := restarted.Stop(); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+
+			// 每条消息至少处理一次，已提交之后、崩溃之前处理过的消息会重复处理
+			for offset := int64(0); offset < messages; offset++ {
+				if rec.times(offset) == 0 {
+					t.Errorf("偏移量 %d 的消息未被处理", offset)
+				}
+			}
+			for offset := tt.wantCommitted; offset < tt.crashAt; offset++ {
+				if rec.times(offset) != 2 {
+					t.Errorf("偏移量 %d 处理了 %d 次, 期望重启后重复处理", offset, rec.times(offset))
+				}
+			}
+			if committed, _ := broker.Committed(); committed[0] != messages {
+				t.Errorf("重启后提交的偏移量 = %d, 期望 %d", committed[0], messages)
+			}
+		})
+	}
+}
+
+// TestCommitStrategies_BatchHandler 测试批量处理器失败时不提交偏移量，转存死信后提交
+func TestCommitStrategies_BatchHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		deadLetter DeadLetterPublisher
+		wantOffset int64
+	}{
+		{
+			name:       "批次失败且未启用死信队列时不提交",
+			wantOffset: 0,
+		},
+		{
+			name:       "批次失败并转存死信后提交",
+			deadLetter: &mockDeadLetter{},
+			wantOffset: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker("test-topic", 0)
+			for i := 0; i < 3; i++ {
+				broker.Produce(0, "msg")
+			}
+
+			var calls sync.WaitGroup
+			calls.Add(1)
+			var once sync.Once
+			batch := BatchHandlerFunc(func(_ context.Context, msgs []*sarama.ConsumerMessage) error {
+				defer once.Do(calls.Done)
+				if len(msgs) != 3 {
+					t.Errorf("批次大小 = %d, 期望 3", len(msgs))
+				}
+				return errors.New("批量写入失败")
+			})
+			opts := []Option{
+				WithBatchHandler(batch),
+				WithCommit(config.CommitConfig{Mode: config.CommitModeBatch, BatchSize: 3, BatchTimeout: time.Second}),
+			}
+			if tt.deadLetter != nil {
+				opts = append(opts, WithDeadLetter(tt.deadLetter))
+			}
+			service := newGroupConsumer(broker.NewConsumerGroup(), []string{"test-topic"}, nil, newOptions(opts))
+			if err := service.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			calls.Wait()
+			if tt.wantOffset > 0 {
+				waitFor(t, time.Second, func() bool {
+					committed, _ := broker.Committed()
+					return committed[0] == tt.wantOffset
+				})
+			}
+			if err := service.Stop(); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+
+			if committed, _ := broker.Committed(); committed[0] != tt.wantOffset {
+				t.Errorf("提交的偏移量 = %d, 期望 %d", committed[0], tt.wantOffset)
+			}
+		})
+	}
+}
+
+// TestCommitStrategies_BatchRetry 测试批次失败后原地重试，后续批次的提交不会越过失败的批次
+func TestCommitStrategies_BatchRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int   // 第一个批次失败的次数，-1 表示一直失败
+		wantBatches   []int // 依次处理的批次的起始偏移量
+		wantCommitted int64
+	}{
+		{
+			name:          "第一批重试成功后处理第二批",
+			failures:      2,
+			wantBatches:   []int{0, 0, 0, 3},
+			wantCommitted: 6,
+		},
+		{
+			name:          "第一批一直失败时不处理第二批也不提交",
+			failures:      -1,
+			wantBatches:   []int{0, 0},
+			wantCommitted: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker("test-topic", 0)
+			for i := 0; i < 6; i++ {
+				broker.Produce(0, "msg")
+			}
+
+			var mu sync.Mutex
+			var batches []int
+			var committedAtSecond int64 = -1
+			batch := BatchHandlerFunc(func(_ context.Context, msgs []*sarama.ConsumerMessage) error {
+				mu.Lock()
+				defer mu.Unlock()
+				batches = append(batches, int(msgs[0].Offset))
+				if msgs[0].Offset == 0 && (tt.failures < 0 || len(batches) <= tt.failures) {
+					return errors.New("批量写入失败")
+				}
+				if msgs[0].Offset == 3 {
+					committed, _ := broker.Committed()
+					committedAtSecond = committed[0]
+				}
+				return nil
+			})
+			service := newGroupConsumer(broker.NewConsumerGroup(), []string{"test-topic"}, nil, newOptions([]Option{
+				WithBatchHandler(batch),
+				WithCommit(config.CommitConfig{Mode: config.CommitModeBatch, BatchSize: 3, BatchTimeout: time.Second}),
+			}))
+			if err := service.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			waitFor(t, 2*time.Second, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(batches) >= len(tt.wantBatches)
+			})
+			if tt.wantCommitted > 0 {
+				waitFor(t, time.Second, func() bool {
+					committed, _ := broker.Committed()
+					return committed[0] == tt.wantCommitted
+				})
+			}
+			if err := service.Stop(); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for i, want := range tt.wantBatches {
+				if batches[i] != want {
+					t.Fatalf("处理的批次 = %v, 期望以 %v 开头", batches, tt.wantBatches)
+				}
+			}
+			for _, offset := range batches {
+				if tt.failures < 0 && offset != 0 {
+					t.Errorf("第一批失败时处理了后续批次: %v", batches)
+				}
+			}
+			if tt.failures >= 0 && committedAtSecond != 3 {
+				t.Errorf("处理第二批时已提交的偏移量 = %d, 期望 3", committedAtSecond)
+			}
+			if committed, _ := broker.Committed(); committed[0] != tt.wantCommitted {
+				t.Errorf("提交的偏移量 = %d, 期望 %d", committed[0], tt.wantCommitted)
+			}
+		})
+	}
+}
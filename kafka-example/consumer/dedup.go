@@ -0,0 +1,174 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"kafka-example/config"
+	"kafka-example/envelope"
+	"kafka-example/tracing"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// dedupSweepInterval 内存去重存储每记录多少个ID清理一次过期数据
+const dedupSweepInterval = 1024
+
+// DedupStore 已处理消息ID的存储，记录在TTL后过期
+type DedupStore interface {
+	// Seen 判断消息ID是否已处理且未过期
+	Seen(ctx context.Context, id string) (bool, error)
+	// Mark 记录消息ID已处理，ttl 后过期
+	Mark(ctx context.Context, id string, ttl time.Duration) error
+	// Close 释放存储占用的资源
+	Close() error
+}
+
+// NewDedupStore 根据配置创建去重存储
+// 参数:
+//   - cfg: 去重配置
+//
+// 返回:
+//   - DedupStore: 去重存储实例
+//   - error: 创建失败时返回错误
+func NewDedupStore(cfg config.DedupConfig) (DedupStore, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return NewMemoryDedupStore(), nil
+	case "redis":
+		return NewRedisDedupStore(cfg.Redis)
+	default:
+		return nil, fmt.Errorf("未知的去重存储类型: %s", cfg.Store)
+	}
+}
+
+// MemoryDedupStore 基于内存的去重存储，只能在单个进程内去重，进程重启后记录丢失
+type MemoryDedupStore struct {
+	mu      sync.Mutex
+	expires map[string]time.Time // 消息ID的过期时间
+	marks   int                  // 上次清理后记录的ID数
+	now     func() time.Time
+}
+
+// NewMemoryDedupStore 创建基于内存的去重存储
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{expires: make(map[string]time.Time), now: time.Now}
+}
+
+// Seen 判断消息ID是否已处理且未过期
+func (m *MemoryDedupStore) Seen(_ context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expire, ok := m.expires[id]
+	if !ok {
+		return false, nil
+	}
+	if !m.now().Before(expire) {
+		delete(m.expires, id)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Mark 记录消息ID已处理，并定期清理过期的记录
+func (m *MemoryDedupStore) Mark(_ context.Context, id string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.expires[id] = now.Add(ttl)
+	m.marks++
+	if m.marks >= dedupSweepInterval {
+		for k, expire := range m.expires {
+			if !now.Before(expire) {
+				delete(m.expires, k)
+			}
+		}
+		m.marks = 0
+	}
+	return nil
+}
+
+// Close 内存存储无需释放资源
+func (m *MemoryDedupStore) Close() error {
+	return nil
+}
+
+// DedupStats 去重统计数据
+type DedupStats struct {
+	Duplicates  int64 `json:"duplicates"`   // 跳过的重复消息数
+	StoreErrors int64 `json:"store_errors"` // 访问去重存储失败的次数
+}
+
+// Deduplicator 消息去重器，可在消费者组服务和传统消费者服务之间共享
+// 去重键按消费者组划分，不同消费者组各自处理同一条消息，互不影响。
+// 处理成功后才记录消息ID，处理失败的消息再次投递时仍会处理；
+// 去重存储不可用时照常处理消息，宁可重复处理也不丢失消息。
+// 查询和记录不是原子操作：同一条消息在前一次投递处理完成之前再次投递（如再均衡期间两个实例同时处理）时，两次都会处理
+type Deduplicator struct {
+	store       DedupStore
+	ttl         time.Duration
+	duplicates  atomic.Int64
+	storeErrors atomic.Int64
+}
+
+// NewDeduplicator 创建消息去重器
+// 参数:
+//   - store: 去重存储，由调用方在消费者停止后关闭
+//   - ttl: 已处理消息ID的保留时间
+func NewDeduplicator(store DedupStore, ttl time.Duration) *Deduplicator {
+	return &Deduplicator{store: store, ttl: ttl}
+}
+
+// Middleware 返回去重中间件，重复的消息直接返回成功，不调用后续处理器
+// 参数:
+//   - scope: 去重范围，通常为消费者组ID；只有同一范围内已处理的消息才会跳过
+func (d *Deduplicator) Middleware(scope string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			key := dedupKey(scope, msg)
+			seen, err := d.store.Seen(ctx, key)
+			if err != nil {
+				d.storeErrors.Add(1)
+				log.Printf("[Dedup] 查询去重存储失败，继续处理消息: key=%s, error=%v", key, err)
+			} else if seen {
+				d.duplicates.Add(1)
+				log.Printf("[Dedup] 跳过重复消息: key=%s, topic=%s, partition=%d, offset=%d, %s",
+					key, msg.Topic, msg.Partition, msg.Offset, tracing.FromContext(ctx))
+				return nil
+			}
+
+			if err := next.Handle(ctx, msg); err != nil {
+				return err
+			}
+			if err := d.store.Mark(ctx, key, d.ttl); err != nil {
+				d.storeErrors.Add(1)
+				log.Printf("[Dedup] 记录已处理消息失败: key=%s, error=%v", key, err)
+			}
+			return nil
+		})
+	}
+}
+
+// Stats 返回当前的去重统计数据
+func (d *Deduplicator) Stats() DedupStats {
+	return DedupStats{
+		Duplicates:  d.duplicates.Load(),
+		StoreErrors: d.storeErrors.Load(),
+	}
+}
+
+// dedupKey 返回消息在去重范围内的去重键，格式为 <scope>/<topic>/...
+// 优先使用信封消息ID，生产者重试产生的重复消息偏移量不同但ID相同；没有ID时使用主题/分区/偏移量
+func dedupKey(scope string, msg *sarama.ConsumerMessage) string {
+	prefix := scope + "/" + msg.Topic
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == envelope.HeaderID && len(h.Value) > 0 {
+			return prefix + "/id/" + string(h.Value)
+		}
+	}
+	return prefix + "/" + strconv.FormatInt(int64(msg.Partition), 10) + "/" + strconv.FormatInt(msg.Offset, 10)
+}
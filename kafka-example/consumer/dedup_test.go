@@ -0,0 +1,157 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"kafka-example/envelope"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// errorDedupStore 总是返回错误的去重存储
+type errorDedupStore struct{}
+
+func (errorDedupStore) Seen(context.Context, string) (bool, error) {
+	return false, errors.New("store unavailable")
+}
+
+func (errorDedupStore) Mark(context.Context, string, time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+func (errorDedupStore) Close() error { return nil }
+
+// TestMemoryDedupStore 测试内存去重存储的记录和过期
+func TestMemoryDedupStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryDedupStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if seen, _ := store.Seen(ctx, "a"); seen {
+		t.Fatalf("未记录的ID不应已处理")
+	}
+	_ = store.Mark(ctx, "a", time.Minute)
+	if seen, _ := store.Seen(ctx, "a"); !seen {
+		t.Fatalf("记录后的ID应已处理")
+	}
+
+	now = now.Add(time.Minute)
+	if seen, _ := store.Seen(ctx, "a"); seen {
+		t.Errorf("过期的ID不应已处理")
+	}
+	if len(store.expires) != 0 {
+		t.Errorf("过期的ID应被删除，剩余 %d 条", len(store.expires))
+	}
+}
+
+// TestDeduplicator 测试去重中间件跳过重复消息并统计
+func TestDeduplicator(t *testing.T) {
+	withID := func(offset int64, id string) *sarama.ConsumerMessage {
+		msg := testMessage()
+		msg.Offset = offset
+		msg.Headers = []*sarama.RecordHeader{{Key: []byte(envelope.HeaderID), Value: []byte(id)}}
+		return msg
+	}
+	atOffset := func(offset int64) *sarama.ConsumerMessage {
+		msg := testMessage()
+		msg.Offset = offset
+		return msg
+	}
+
+	tests := []struct {
+		name           string
+		store          DedupStore
+		messages       []*sarama.ConsumerMessage
+		failOffsets    map[int64]bool // 处理失败的偏移量
+		wantHandled    int
+		wantDuplicates int64
+		wantErrors     int64
+	}{
+		{
+			name:           "相同消息ID不同偏移量视为重复",
+			store:          NewMemoryDedupStore(),
+			messages:       []*sarama.ConsumerMessage{withID(1, "id-1"), withID(2, "id-1"), withID(3, "id-2")},
+			wantHandled:    2,
+			wantDuplicates: 1,
+		},
+		{
+			name:           "没有消息ID时按偏移量去重",
+			store:          NewMemoryDedupStore(),
+			messages:       []*sarama.ConsumerMessage{atOffset(1), atOffset(1), atOffset(2)},
+			wantHandled:    2,
+			wantDuplicates: 1,
+		},
+		{
+			name:        "处理失败的消息再次投递时重新处理",
+			store:       NewMemoryDedupStore(),
+			messages:    []*sarama.ConsumerMessage{withID(1, "id-1"), withID(1, "id-1")},
+			failOffsets: map[int64]bool{1: true},
+			wantHandled: 2,
+		},
+		{
+			name:        "去重存储不可用时照常处理",
+			store:       errorDedupStore{},
+			messages:    []*sarama.ConsumerMessage{withID(1, "id-1"), withID(2, "id-1")},
+			wantHandled: 2,
+			wantErrors:  4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDeduplicator(tt.store, time.Hour)
+			handled := 0
+			failed := make(map[int64]bool)
+			h := Chain(HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+				handled++
+				// 每个偏移量只失败一次，模拟重新投递后处理成功
+				if tt.failOffsets[msg.Offset] && !failed[msg.Offset] {
+					failed[msg.Offset] = true
+					return errors.New("handle failed")
+				}
+				return nil
+			}), d.Middleware("group"))
+
+			for _, msg := range tt.messages {
+				_ = h.Handle(context.Background(), msg)
+			}
+
+			if handled != tt.wantHandled {
+				t.Errorf("处理器调用次数 = %d, 期望 %d", handled, tt.wantHandled)
+			}
+			stats := d.Stats()
+			if stats.Duplicates != tt.wantDuplicates || stats.StoreErrors != tt.wantErrors {
+				t.Errorf("Stats() = %+v, 期望 duplicates=%d store_errors=%d", stats, tt.wantDuplicates, tt.wantErrors)
+			}
+		})
+	}
+}
+
+// TestDeduplicator_Scope 测试不同消费者组共享去重存储时互不影响，同一消费者组的实例之间去重
+func TestDeduplicator_Scope(t *testing.T) {
+	d := NewDeduplicator(NewMemoryDedupStore(), time.Hour)
+	handled := make(map[string]int)
+	handler := func(scope string) Handler {
+		return Chain(HandlerFunc(func(context.Context, *sarama.ConsumerMessage) error {
+			handled[scope]++
+			return nil
+		}), d.Middleware(scope))
+	}
+	orders, audit, ordersReplica := handler("orders"), handler("audit"), handler("orders")
+
+	msg := testMessage()
+	msg.Headers = []*sarama.RecordHeader{{Key: []byte(envelope.HeaderID), Value: []byte("id-1")}}
+	for _, h := range []Handler{orders, audit, ordersReplica} {
+		_ = h.Handle(context.Background(), msg)
+	}
+
+	if handled["orders"] != 1 || handled["audit"] != 1 {
+		t.Errorf("处理次数 = %v, 期望每个消费者组各处理1次", handled)
+	}
+	if stats := d.Stats(); stats.Duplicates != 1 {
+		t.Errorf("Duplicates = %d, 期望 1", stats.Duplicates)
+	}
+}
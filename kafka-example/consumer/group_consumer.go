@@ -2,9 +2,13 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"kafka-example/common"
+	"kafka-example/config"
+	"kafka-example/tracing"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -13,80 +17,149 @@ import (
 // GroupConsumerService 表示Kafka消费者组服务
 // 用于处理消费者组模式下的消息消费
 type GroupConsumerService struct {
-	group   sarama.ConsumerGroup // Kafka消费者组实例
+	runner  *common.GroupRunner  // 消费循环
 	topics  []string             // 订阅的主题列表
+	groupID string               // 消费者组ID
 	brokers []string             // Kafka broker地址列表
 	handler consumerGroupHandler // 消费者组处理器
 	config  *sarama.Config       // Kafka配置
+
+	stopOnce sync.Once // 确保只停止一次
+	stopErr  error     // Stop的结果
+}
+
+// 消息处理的重试参数
+const (
+	maxProcessRetries    = 3               // 单条消息的最大处理次数
+	processRetryInterval = 1 * time.Second // 处理失败后的重试间隔
+
+	groupLogPrefix = "[GroupConsumer] "
+)
+
+// DeadLetterPublisher 死信队列发布器
+// 用于将多次处理失败的消息转存到死信主题
+type DeadLetterPublisher interface {
+	Publish(msg *sarama.ConsumerMessage, cause error, attempts int) error
 }
 
 // consumerGroupHandler 实现 sarama.ConsumerGroupHandler 接口
 // 用于处理消费者组的生命周期事件和消息消费
 type consumerGroupHandler struct {
-	messageHandler func(*sarama.ConsumerMessage) error // 消息处理函数
+	handler    Handler             // 经过中间件包装的消息处理器
+	deadLetter DeadLetterPublisher // 死信队列发布器，可为空
+	commit     config.CommitConfig // 偏移量提交策略
+	batch      BatchHandler        // batch提交模式下的批量处理器
+	workers    int                 // 每个分区的工作协程数，大于1时按消息键并行处理
+	throttle   *throttle           // 限流和背压状态，所有分区共享
+	pauser     pauser              // 背压时暂停和恢复分区拉取，即消费者组本身
 }
 
 // NewGroupConsumerService 创建一个新的消费者组服务实例
 // topics: 要订阅的主题列表
+// opts: 可选配置，未指定时使用默认配置
 // 返回: 消费者组服务实例和可能的错误
-func NewGroupConsumerService(topics []string) (*GroupConsumerService, error) {
+func NewGroupConsumerService(topics []string, opts ...Option) (*GroupConsumerService, error) {
 	log.Printf("[GroupConsumer] 正在初始化消费者组服务...")
+	o := newOptions(opts)
 
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
-
-	// 偏移量配置
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest // 从最新的偏移量开始消费
-	config.Consumer.Offsets.AutoCommit.Enable = false     // 禁用自动提交
+	config, err := o.config.ConsumerSaramaConfig()
+	if err != nil {
+		log.Printf("[GroupConsumer] 消费者配置不合法: %v", err)
+		return nil, fmt.Errorf("消费者配置不合法: %v", err)
+	}
+	// WithLimits 覆盖的背压高水位同样需要放得进消息通道
+	o.limits.FitChannelBuffer(config)
 
-	consumerGroup, err := sarama.NewConsumerGroup([]string{common.Broker}, "group_consumer", config)
+	consumerGroup, err := o.newConsumerGroup(o.brokers, o.groupID, config)
 	if err != nil {
 		log.Printf("[GroupConsumer] 创建消费者组失败: %v", err)
 		return nil, fmt.Errorf("创建消费者组失败: %v", err)
 	}
 
-	consumerService := &GroupConsumerService{
-		group:   consumerGroup,
+	consumerService := newGroupConsumer(consumerGroup, topics, config, o)
+	log.Printf("[GroupConsumer] 消费者组服务初始化成功，订阅主题: %v, 消费者组: %s", topics, o.groupID)
+	return consumerService, nil
+}
+
+// newGroupConsumer 使用已创建的消费者组组装消费者组服务
+func newGroupConsumer(group sarama.ConsumerGroup, topics []string, config *sarama.Config, o *options) *GroupConsumerService {
+	handler := o.buildHandler(groupLogPrefix, o.groupID)
+	batch := o.batchHandler
+	if batch == nil {
+		batch = batchFromHandler(handler)
+	}
+	h := consumerGroupHandler{
+		handler:    handler,
+		deadLetter: o.deadLetter,
+		commit:     *o.commit,
+		batch:      batch,
+		workers:    *o.workers,
+		throttle:   newThrottle(*o.limits),
+		pauser:     group,
+	}
+	return &GroupConsumerService{
+		runner:  common.NewGroupRunner(group, topics, h, groupLogPrefix),
 		topics:  topics,
-		brokers: []string{common.Broker},
-		handler: consumerGroupHandler{
-			messageHandler: defaultMessageHandler,
-		},
-		config: config,
+		groupID: o.groupID,
+		brokers: o.brokers,
+		handler: h,
+		config:  config,
 	}
-
-	log.Printf("[GroupConsumer] 消费者组服务初始化成功，订阅主题: %v", topics)
-	return consumerService, nil
 }
 
-// defaultMessageHandler 默认的消息处理函数
-func defaultMessageHandler(msg *sarama.ConsumerMessage) error {
-	log.Printf("[GroupConsumer] 处理消息: topic=%s, partition=%d, offset=%d, value=%s",
-		msg.Topic, msg.Partition, msg.Offset, string(msg.Value))
+// processMessage 等待限流令牌后处理单条消息
+// 重试、panic恢复等逻辑由处理器中间件负责
+func (h consumerGroupHandler) processMessage(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	if err := h.throttle.wait(ctx, msg.Topic, msg.Partition); err != nil {
+		return fmt.Errorf("等待限流失败: %w", err)
+	}
+	if err := h.handler.Handle(ctx, msg); err != nil {
+		return fmt.Errorf("处理消息失败: %w", err)
+	}
 	return nil
 }
 
-// processMessage 处理单条消息
-// 包含重试机制和错误处理
-func (h consumerGroupHandler) processMessage(msg *sarama.ConsumerMessage) error {
-	maxRetries := 3
-	retryInterval := 1 * time.Second
-
-	for i := 0; i < maxRetries; i++ {
-		// 处理消息
-		if err := h.messageHandler(msg); err != nil {
-			log.Printf("[GroupConsumer] 处理消息失败: %v", err)
-			if i < maxRetries-1 {
-				log.Printf("[GroupConsumer] 将在 %v 后重试", retryInterval)
-				time.Sleep(retryInterval)
-				continue
-			}
-			return fmt.Errorf("处理消息失败: %v", err)
-		}
-		return nil
+// sendToDeadLetter 将处理失败的消息发布到死信队列
+// 返回: 是否已成功转存到死信队列，成功时调用方可以标记该消息
+func (h consumerGroupHandler) sendToDeadLetter(msg *sarama.ConsumerMessage, cause error) bool {
+	if h.deadLetter == nil {
+		return false
+	}
+	// 重试中间件会记录实际的尝试次数
+	attempts := 1
+	var retryErr *RetryError
+	if errors.As(cause, &retryErr) {
+		attempts = retryErr.Attempts
 	}
+	if err := h.deadLetter.Publish(msg, cause, attempts); err != nil {
+		log.Printf("[GroupConsumer] 发布死信消息失败: topic=%s, partition=%d, offset=%d, error=%v",
+			msg.Topic, msg.Partition, msg.Offset, err)
+		return false
+	}
+	log.Printf("[GroupConsumer] 消息已转存到死信队列: topic=%s, partition=%d, offset=%d",
+		msg.Topic, msg.Partition, msg.Offset)
+	return true
+}
 
-	return fmt.Errorf("消息处理失败，已达到最大重试次数")
+// deadLetterUntilDone 将处理失败的消息转存死信，发布失败时按指数退避重试直到成功或会话结束，
+// 避免后续消息的提交越过既未处理也未转存的消息
+// 返回: 消息是否已转存死信，未启用死信队列或会话已结束时返回false
+func (h consumerGroupHandler) deadLetterUntilDone(ctx context.Context, msg *sarama.ConsumerMessage, cause error) bool {
+	if h.deadLetter == nil {
+		return false
+	}
+	backoff := minRetryBackoff
+	for !h.sendToDeadLetter(msg, cause) {
+		select {
+		case <-ctx.Done():
+			log.Printf("[GroupConsumer] 会话已结束，放弃转存死信: topic=%s, partition=%d, offset=%d",
+				msg.Topic, msg.Partition, msg.Offset)
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+	return true
 }
 
 // Setup 在消费者组会话开始前调用
@@ -97,61 +170,130 @@ func (consumerGroupHandler) Setup(_ sarama.ConsumerGroupSession) error {
 }
 
 // Cleanup 在消费者组会话结束后调用
-// 用于清理消费者组会话
-func (consumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
-	log.Printf("[GroupConsumer] 消费者组会话结束")
+// 会话因再均衡或停止服务而结束时，同步提交已标记的偏移量
+func (consumerGroupHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
+	log.Printf("[GroupConsumer] 消费者组会话结束，正在提交偏移量")
+	sess.Commit()
 	return nil
 }
 
 // ConsumeClaim 处理分配给消费者的消息
-// 这是实际处理消息的地方
+// 这是实际处理消息的地方，会话结束时处理完当前消息后返回；偏移量按提交策略同步提交
 func (h consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	log.Printf("[GroupConsumer] 开始消费分区 %d 的消息", claim.Partition())
-
-	for msg := range claim.Messages() {
-		// 处理消息
-		if err := h.processMessage(msg); err != nil {
-			log.Printf("[GroupConsumer] 处理消息失败: %v", err)
-			// 可以在这里添加死信队列逻辑
-			continue
-		}
+	log.Printf("[GroupConsumer] 开始消费分区 %d 的消息，提交模式: %s", claim.Partition(), h.commit.Mode)
+
+	if h.commit.Mode == config.CommitModeBatch {
+		return h.consumeBatches(sess, claim)
+	}
+	if h.workers > 1 {
+		return h.consumeParallel(sess, claim)
+	}
+
+	c := newCommitter(sess, h.commit)
+	defer c.stop()
+	bp := newBackpressure(h.throttle, h.pauser, claim.Topic(), claim.Partition())
+	defer bp.release()
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				log.Printf("[GroupConsumer] 分区 %d 的消息消费完成", claim.Partition())
+				return nil
+			}
+			// 已拉取但尚未处理的消息都在认领的消息通道中
+			bp.update(len(claim.Messages()))
 
-		// 标记消息已处理
-		sess.MarkMessage(msg, "")
+			// 处理消息
+			if err := h.processMessage(sess.Context(), msg); err != nil {
+				// 会话已结束导致的失败不标记也不转存死信，消息会在下次分配时重新消费
+				if sess.Context().Err() != nil {
+					log.Printf("[GroupConsumer] 会话已结束，放弃处理: topic=%s, partition=%d, offset=%d",
+						msg.Topic, msg.Partition, msg.Offset)
+					return nil
+				}
+				log.Printf("[GroupConsumer] 处理消息失败: partition=%d, offset=%d, %s, error=%v",
+					msg.Partition, msg.Offset, tracing.Extract(msg.Headers), err)
+				if !h.deadLetterUntilDone(sess.Context(), msg, err) {
+					if sess.Context().Err() != nil {
+						return nil
+					}
+					continue
+				}
+			}
+
+			// 标记消息已处理，并按提交策略提交
+			sess.MarkMessage(msg, "")
+			c.marked(1)
+		case <-c.tick():
+			c.commit()
+		case <-sess.Context().Done():
+			log.Printf("[GroupConsumer] 会话已结束，停止消费分区 %d", claim.Partition())
+			return nil
+		}
 	}
+}
+
+// GroupID 返回消费者组ID
+func (g *GroupConsumerService) GroupID() string {
+	return g.groupID
+}
+
+// Topics 返回订阅的主题列表
+func (g *GroupConsumerService) Topics() []string {
+	return g.topics
+}
+
+// Limits 返回当前的限流和背压参数
+func (g *GroupConsumerService) Limits() config.LimitsConfig {
+	return g.handler.throttle.current()
+}
 
-	log.Printf("[GroupConsumer] 分区 %d 的消息消费完成", claim.Partition())
+// SetLimits 在运行时调整限流和背压参数，对所有分区立即生效
+// 参数:
+//   - limits: 新的限流和背压参数
+//
+// 返回:
+//   - error: 参数不合法，或背压高水位不小于创建时确定的消息通道容量时返回错误
+func (g *GroupConsumerService) SetLimits(limits config.LimitsConfig) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	// 消息通道容量在创建消费者组时确定，运行时无法增大
+	if g.config != nil && limits.HighWaterMark >= g.config.ChannelBufferSize {
+		return fmt.Errorf("背压高水位必须小于消息通道容量 %d: high=%d", g.config.ChannelBufferSize, limits.HighWaterMark)
+	}
+	g.handler.throttle.setLimits(limits)
+	log.Printf("[GroupConsumer] 限流和背压参数已更新: %+v", limits)
 	return nil
 }
 
+// PausedPartitions 返回因背压暂停拉取的分区，按主题分组
+func (g *GroupConsumerService) PausedPartitions() map[string][]int32 {
+	return g.handler.throttle.pausedPartitions()
+}
+
 // Start 启动消费者组服务
-// ctx: 上下文，用于控制服务的生命周期
+// ctx: 上下文，用于控制服务的生命周期，取消后消费循环退出
 func (g *GroupConsumerService) Start(ctx context.Context) error {
 	log.Printf("[GroupConsumer] 正在启动消费者组服务...")
-
-	go func() {
-		for {
-			if err := g.group.Consume(ctx, g.topics, g.handler); err != nil {
-				log.Printf("[GroupConsumer] 消费错误: %v", err)
-				continue
-			}
-		}
-	}()
-
+	if err := g.runner.Start(ctx); err != nil {
+		return fmt.Errorf("消费者组服务已启动: %w", err)
+	}
 	log.Printf("[GroupConsumer] 消费者组服务启动成功")
 	return nil
 }
 
 // Stop 停止消费者组服务
-// 关闭消费者组连接
+// 取消消费循环，等待正在执行的 ConsumeClaim 返回并提交偏移量后，关闭消费者组连接
 func (g *GroupConsumerService) Stop() error {
-	log.Printf("[GroupConsumer] 正在停止消费者组服务...")
-
-	if err := g.group.Close(); err != nil {
-		log.Printf("[GroupConsumer] 停止服务失败: %v", err)
-		return fmt.Errorf("停止消费者组服务失败: %v", err)
-	}
-
-	log.Printf("[GroupConsumer] 消费者组服务已成功停止")
-	return nil
+	g.stopOnce.Do(func() {
+		log.Printf("[GroupConsumer] 正在停止消费者组服务...")
+		if err := g.runner.Stop(); err != nil {
+			log.Printf("[GroupConsumer] 停止服务失败: %v", err)
+			g.stopErr = fmt.Errorf("停止消费者组服务失败: %w", err)
+			return
+		}
+		log.Printf("[GroupConsumer] 消费者组服务已成功停止")
+	})
+	return g.stopErr
 }
@@ -0,0 +1,228 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"kafka-example/config"
+	"kafka-example/kafkatest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// waitFor 轮询等待条件成立
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("等待条件成立超时")
+}
+
+// TestNewGroupConsumerService 测试通过公开构造函数创建的消费者组服务完成消费、重试和提交
+// 使用 kafkatest 的内存消费者组，不需要连接Kafka
+func TestNewGroupConsumerService(t *testing.T) {
+	broker := kafkatest.NewBroker("test-topic", 0, 1)
+	factory := broker.ConsumerGroupFactory()
+
+	var attempts, processed atomic.Int32
+	handler := HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		if string(msg.Value) == "flaky" && attempts.Add(1) == 1 {
+			return errors.New("临时错误")
+		}
+		processed.Add(1)
+		return nil
+	})
+
+	var gotGroupID string
+	service, err := NewGroupConsumerService([]string{"test-topic"},
+		WithGroupID("test-group"),
+		WithHandler(handler),
+		WithMiddleware(Retry(3, time.Millisecond, time.Millisecond)),
+		WithCommit(config.CommitConfig{Mode: config.CommitModeMessage}),
+		WithConsumerGroupFactory(func(addrs []string, groupID string, cfg *sarama.Config) (sarama.ConsumerGroup, error) {
+			gotGroupID = groupID
+			return factory(addrs, groupID, cfg)
+		}))
+	if err != nil {
+		t.Fatalf("NewGroupConsumerService() error = %v", err)
+	}
+	if gotGroupID != "test-group" {
+		t.Errorf("消费者组ID = %s, 期望 test-group", gotGroupID)
+	}
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	broker.Produce(0, "a")
+	broker.Produce(0, "flaky")
+	broker.Produce(1, "b")
+	waitFor(t, time.Second, func() bool { return processed.Load() == 3 })
+	if err := service.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	if attempts.Load() != 2 {
+		t.Errorf("flaky 消息尝试 %d 次, 期望 2 次", attempts.Load())
+	}
+	if committed, _ := broker.Committed(); committed[0] != 2 || committed[1] != 1 {
+		t.Errorf("提交的偏移量 = %v, 期望 map[0:2 1:1]", committed)
+	}
+
+	// 创建消费者组失败时返回错误
+	_, err = NewGroupConsumerService([]string{"test-topic"},
+		WithConsumerGroupFactory(func([]string, string, *sarama.Config) (sarama.ConsumerGroup, error) {
+			return nil, sarama.ErrOutOfBrokers
+		}))
+	if err == nil {
+		t.Error("创建消费者组失败时应返回错误")
+	}
+}
+
+// TestGroupConsumerService_GracefulStop 测试停止时等待进行中的消息处理完成并提交偏移量
+func TestGroupConsumerService_GracefulStop(t *testing.T) {
+	broker := kafkatest.NewBroker("test-topic", 0)
+	group := broker.NewConsumerGroup()
+
+	var started, finished atomic.Int32
+	handler := HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		started.Add(1)
+		// 模拟忽略上下文的慢处理器，停止时应等待其完成
+		time.Sleep(100 * time.Millisecond)
+		finished.Add(1)
+		return nil
+	})
+
+	service := newGroupConsumer(group, []string{"test-topic"}, nil,
+		newOptions([]Option{WithHandler(handler), WithMiddleware()}))
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	broker.Produce(0, "a")
+	waitFor(t, time.Second, func() bool { return started.Load() == 1 })
+
+	if err := service.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if finished.Load() != 1 {
+		t.Errorf("Stop() 返回时进行中的消息尚未处理完成")
+	}
+
+	committed, commits := broker.Committed()
+	if commits == 0 || committed[0] != 1 {
+		t.Errorf("提交的偏移量 = %v (提交%d次), 期望 map[0:1]", committed, commits)
+	}
+
+	// 重复停止不应报错
+	if err := service.Stop(); err != nil {
+		t.Errorf("重复调用 Stop() error = %v", err)
+	}
+}
+
+// TestGroupConsumerService_ContextCancel 测试取消启动上下文后消费循环退出
+func TestGroupConsumerService_ContextCancel(t *testing.T) {
+	broker := kafkatest.NewBroker("test-topic", 0, 1)
+	group := broker.NewConsumerGroup()
+
+	var processed atomic.Int32
+	handler := HandlerFunc(func(context.Context, *sarama.ConsumerMessage) error {
+		processed.Add(1)
+		return nil
+	})
+
+	service := newGroupConsumer(group, []string{"test-topic"}, nil,
+		newOptions([]Option{WithHandler(handler), WithMiddleware()}))
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := service.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	broker.Produce(0, "a")
+	broker.Produce(1, "b")
+	broker.Produce(1, "c")
+	waitFor(t, time.Second, func() bool { return processed.Load() == 3 })
+
+	cancel()
+	// 取消上下文后 Stop 只需等待消费循环退出
+	if err := service.Stop(); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+
+	committed, _ := broker.Committed()
+	if committed[0] != 1 || committed[1] != 2 {
+		t.Errorf("提交的偏移量 = %v, 期望 map[0:1 1:2]", committed)
+	}
+}
+
+// TestGroupConsumerService_DeadLetterRetry 测试转存死信失败时重试，后续消息的提交不会越过未转存的消息
+func TestGroupConsumerService_DeadLetterRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		workers       int
+		failures      int // 死信发布失败的次数，-1 表示一直失败
+		wantCommitted int64
+	}{
+		{name: "逐条消费时重试后转存成功", workers: 1, failures: 2, wantCommitted: 2},
+		{name: "逐条消费时一直失败不提交", workers: 1, failures: -1, wantCommitted: 0},
+		{name: "并行消费时重试后转存成功", workers: 4, failures: 2, wantCommitted: 2},
+		{name: "并行消费时一直失败不提交", workers: 4, failures: -1, wantCommitted: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker("test-topic", 0)
+			broker.Produce(0, "bad")
+			broker.Produce(0, "ok")
+
+			var processed atomic.Int32
+			handler := HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+				if string(msg.Value) == "bad" {
+					return errors.New("处理失败")
+				}
+				processed.Add(1)
+				return nil
+			})
+			deadLetter := &mockDeadLetter{failures: tt.failures}
+			service := newGroupConsumer(broker.NewConsumerGroup(), []string{"test-topic"}, nil, newOptions([]Option{
+				WithHandler(handler),
+				WithMiddleware(),
+				WithWorkers(tt.workers),
+				WithDeadLetter(deadLetter),
+				WithCommit(config.CommitConfig{Mode: config.CommitModeMessage}),
+			}))
+			if err := service.Start(context.Background()); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+
+			if tt.failures < 0 {
+				// 等待多次发布失败，并行消费时后续消息可能已处理完成
+				waitFor(t, 2*time.Second, func() bool {
+					_, attempts := deadLetter.published()
+					return attempts >= 3
+				})
+			} else {
+				waitFor(t, 2*time.Second, func() bool {
+					committed, _ := broker.Committed()
+					return committed[0] == tt.wantCommitted
+				})
+			}
+			if err := service.Stop(); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+
+			if committed, _ := broker.Committed(); committed[0] != tt.wantCommitted {
+				t.Errorf("提交的偏移量 = %d, 期望 %d", committed[0], tt.wantCommitted)
+			}
+			if n, attempts := deadLetter.published(); tt.failures >= 0 && (n != 1 || attempts != tt.failures+1) {
+				t.Errorf("转存死信 %d 条, 尝试 %d 次, 期望 1 条, %d 次", n, attempts, tt.failures+1)
+			}
+		})
+	}
+}
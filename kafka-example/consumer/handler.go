@@ -0,0 +1,80 @@
+package consumer
+
+import (
+	"context"
+	"kafka-example/tracing"
+	"log"
+
+	"github.com/IBM/sarama"
+)
+
+// Handler 消息处理器
+// 业务方实现该接口后即可接入消费者组服务或传统消费者服务
+type Handler interface {
+	Handle(ctx context.Context, msg *sarama.ConsumerMessage) error
+}
+
+// HandlerFunc 将普通函数适配为 Handler
+type HandlerFunc func(ctx context.Context, msg *sarama.ConsumerMessage) error
+
+// Handle 调用函数本身
+func (f HandlerFunc) Handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	return f(ctx, msg)
+}
+
+// BatchHandler 批量消息处理器
+// 在 batch 提交模式下使用，整批处理成功后才会提交偏移量
+type BatchHandler interface {
+	HandleBatch(ctx context.Context, msgs []*sarama.ConsumerMessage) error
+}
+
+// BatchHandlerFunc 将普通函数适配为 BatchHandler
+type BatchHandlerFunc func(ctx context.Context, msgs []*sarama.ConsumerMessage) error
+
+// HandleBatch 调用函数本身
+func (f BatchHandlerFunc) HandleBatch(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+	return f(ctx, msgs)
+}
+
+// batchFromHandler 将单条消息处理器适配为批量处理器
+// 按顺序逐条处理，遇到第一个失败即返回，整批视为失败
+func batchFromHandler(h Handler) BatchHandler {
+	return BatchHandlerFunc(func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		for _, msg := range msgs {
+			if err := h.Handle(ctx, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Middleware 消息处理中间件，用于在 Handler 外层附加通用逻辑
+type Middleware func(Handler) Handler
+
+// Chain 使用中间件包装处理器
+// 第一个中间件位于最外层，最先执行
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// DefaultMiddlewares 返回消费者默认使用的中间件
+// 与原有行为保持一致：失败后按固定次数重试，并在每次尝试时捕获panic
+func DefaultMiddlewares() []Middleware {
+	return []Middleware{
+		Retry(maxProcessRetries, processRetryInterval, processRetryInterval),
+		Recovery(),
+	}
+}
+
+// logHandler 返回只打印消息内容的处理器，作为未指定处理器时的默认实现
+func logHandler(logPrefix string) Handler {
+	return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		log.Printf("%s处理消息: topic=%s, partition=%d, offset=%d, %s, value=%s",
+			logPrefix, msg.Topic, msg.Partition, msg.Offset, tracing.FromContext(ctx), string(msg.Value))
+		return nil
+	})
+}
@@ -0,0 +1,248 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kafka-example/claimcheck"
+	"kafka-example/tracing"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrHandlerPanic 处理器发生panic时返回的错误
+var ErrHandlerPanic = errors.New("消息处理器发生panic")
+
+// RetryError 重试耗尽后返回的错误，记录实际尝试的次数
+type RetryError struct {
+	Attempts int   // 实际尝试次数
+	Err      error // 最后一次失败的错误
+}
+
+// Error 实现 error 接口
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("消息处理失败，已尝试%d次: %v", e.Attempts, e.Err)
+}
+
+// Unwrap 返回最后一次失败的错误
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// PermanentError 重试也无法成功的处理错误，例如消息格式或版本不兼容
+// Retry 中间件遇到该错误时立即停止重试
+type PermanentError struct {
+	Err error
+}
+
+// Error 实现 error 接口
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 将错误标记为不可重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Trace 从消息头中提取 traceparent、tracestate 和请求ID放入上下文
+// 处理器可以通过 tracing.FromContext 获取，并在向下游发送消息时通过 producer.WithContext 继续传递；
+// 消费者服务总是在最外层使用该中间件，Logging 等中间件会在日志中输出追踪信息
+func Trace() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return next.Handle(tracing.NewContext(ctx, tracing.Extract(msg.Headers)), msg)
+		})
+	}
+}
+
+// ClaimCheck 在处理前还原压缩或转存到blob存储的大消息
+// 处理器和后续中间件收到还原后的消息副本；还原失败（例如blob已超过保留期被清理）时不调用处理器，
+// 返回 PermanentError，原消息按处理失败进入死信队列
+func ClaimCheck(c *claimcheck.ClaimCheck) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			resolved, err := c.Resolve(ctx, msg)
+			if err != nil {
+				log.Printf("[ConsumerMiddleware] 还原大消息失败: topic=%s, partition=%d, offset=%d, %s, error=%v",
+					msg.Topic, msg.Partition, msg.Offset, tracing.FromContext(ctx), err)
+				return Permanent(err)
+			}
+			return next.Handle(ctx, resolved)
+		})
+	}
+}
+
+// Recovery 捕获处理器中的panic并转换为错误，避免消费协程崩溃
+func Recovery() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[ConsumerMiddleware] 处理器发生panic: topic=%s, partition=%d, offset=%d, %s, panic=%v\n%s",
+						msg.Topic, msg.Partition, msg.Offset, tracing.FromContext(ctx), r, debug.Stack())
+					err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+				}
+			}()
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// Logging 以键值对的形式记录每条消息的处理结果和耗时
+// logPrefix: 日志前缀，如 "[GroupConsumer] "
+func Logging(logPrefix string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			start := time.Now()
+			err := next.Handle(ctx, msg)
+			if err != nil {
+				log.Printf("%s消息处理失败: topic=%s partition=%d offset=%d key=%s %s duration=%v error=%v",
+					logPrefix, msg.Topic, msg.Partition, msg.Offset, string(msg.Key), tracing.FromContext(ctx), time.Since(start), err)
+				return err
+			}
+			log.Printf("%s消息处理成功: topic=%s partition=%d offset=%d key=%s %s duration=%v",
+				logPrefix, msg.Topic, msg.Partition, msg.Offset, string(msg.Key), tracing.FromContext(ctx), time.Since(start))
+			return nil
+		})
+	}
+}
+
+// Retry 处理失败时按指数退避重试
+// 参数:
+//   - maxAttempts: 最大尝试次数（包含第一次）
+//   - initialBackoff: 第一次重试前的等待时间
+//   - maxBackoff: 单次等待时间的上限
+//
+// 重试耗尽后返回 *RetryError；上下文取消或遇到 *PermanentError 时立即返回
+func Retry(maxAttempts int, initialBackoff, maxBackoff time.Duration) Middleware {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			backoff := initialBackoff
+			var err error
+			for attempt := 1; attempt <= maxAttempts; attempt++ {
+				if err = next.Handle(ctx, msg); err == nil {
+					return nil
+				}
+				var permanent *PermanentError
+				if errors.As(err, &permanent) {
+					return &RetryError{Attempts: attempt, Err: err}
+				}
+				if attempt == maxAttempts {
+					break
+				}
+
+				log.Printf("[ConsumerMiddleware] 处理消息失败，将在 %v 后进行第%d次重试: topic=%s, partition=%d, offset=%d, error=%v",
+					backoff, attempt+1, msg.Topic, msg.Partition, msg.Offset, err)
+				select {
+				case <-ctx.Done():
+					return &RetryError{Attempts: attempt, Err: errors.Join(err, ctx.Err())}
+				case <-time.After(backoff):
+				}
+
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+			}
+			return &RetryError{Attempts: maxAttempts, Err: err}
+		})
+	}
+}
+
+// Timeout 限制单次处理的最长时间
+// 超时通过 ctx 的截止时间传给处理器，处理器应当响应 ctx.Done() 尽快返回。
+// 中间件总是等待处理器返回后才返回，保证同一分区的消息依次处理；处理器返回时已超时则返回包含 context.DeadlineExceeded 的错误
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			parent := ctx
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			err := next.Handle(ctx, msg)
+			// 只报告本中间件的超时，上层上下文结束时原样返回处理器的结果
+			if parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+					err = errors.Join(context.DeadlineExceeded, err)
+				}
+				return fmt.Errorf("消息处理超时(%v): %w", d, err)
+			}
+			return err
+		})
+	}
+}
+
+// Metrics 消息处理的耗时统计，可安全地在多个协程中使用
+type Metrics struct {
+	processed     atomic.Int64 // 处理成功的消息数
+	failed        atomic.Int64 // 处理失败的消息数
+	totalDuration atomic.Int64 // 累计耗时（纳秒）
+	maxDuration   atomic.Int64 // 最大耗时（纳秒）
+}
+
+// MetricsSnapshot 统计数据快照
+type MetricsSnapshot struct {
+	Processed   int64         `json:"processed"`    // 处理成功的消息数
+	Failed      int64         `json:"failed"`       // 处理失败的消息数
+	AvgDuration time.Duration `json:"avg_duration"` // 平均耗时
+	MaxDuration time.Duration `json:"max_duration"` // 最大耗时
+}
+
+// observe 记录一次处理结果
+func (m *Metrics) observe(d time.Duration, err error) {
+	if err != nil {
+		m.failed.Add(1)
+	} else {
+		m.processed.Add(1)
+	}
+	m.totalDuration.Add(int64(d))
+	for {
+		current := m.maxDuration.Load()
+		if int64(d) <= current || m.maxDuration.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
+}
+
+// Snapshot 返回当前的统计数据
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	processed := m.processed.Load()
+	failed := m.failed.Load()
+	snapshot := MetricsSnapshot{
+		Processed:   processed,
+		Failed:      failed,
+		MaxDuration: time.Duration(m.maxDuration.Load()),
+	}
+	if total := processed + failed; total > 0 {
+		snapshot.AvgDuration = time.Duration(m.totalDuration.Load() / total)
+	}
+	return snapshot
+}
+
+// Timing 统计每条消息的处理耗时和成功失败次数
+func Timing(m *Metrics) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			start := time.Now()
+			err := next.Handle(ctx, msg)
+			m.observe(time.Since(start), err)
+			return err
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"kafka-example/claimcheck"
+	"kafka-example/config"
+	"kafka-example/tracing"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// testMessage 创建测试用的消费消息
+func testMessage() *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Topic: "test-topic", Partition: 0, Offset: 1, Value: []byte("test")}
+}
+
+// TestChain 测试中间件的执行顺序
+func TestChain(t *testing.T) {
+	var order []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+				order = append(order, name)
+				return next.Handle(ctx, msg)
+			})
+		}
+	}
+
+	h := Chain(HandlerFunc(func(context.Context, *sarama.ConsumerMessage) error {
+		order = append(order, "handler")
+		return nil
+	}), record("a"), record("b"))
+
+	if err := h.Handle(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if got := len(order); got != 3 || order[0] != "a" || order[1] != "b" || order[2] != "handler" {
+		t.Errorf("执行顺序 = %v, 期望 [a b handler]", order)
+	}
+}
+
+// TestMiddlewares 测试各个中间件的行为
+func TestMiddlewares(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name       string
+		middleware Middleware
+		handler    func(calls int) error
+		wantCalls  int
+		check      func(t *testing.T, err error)
+	}{
+		{
+			name:       "Recovery将panic转换为错误",
+			middleware: Recovery(),
+			handler:    func(int) error { panic("boom") },
+			wantCalls:  1,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrHandlerPanic) {
+					t.Errorf("error = %v, 期望 ErrHandlerPanic", err)
+				}
+			},
+		},
+		{
+			name:       "Retry重试后成功",
+			middleware: Retry(3, time.Millisecond, time.Millisecond),
+			handler: func(calls int) error {
+				if calls < 3 {
+					return errFailed
+				}
+				return nil
+			},
+			wantCalls: 3,
+			check: func(t *testing.T, err error) {
+				if err != nil {
+					t.Errorf("error = %v, 期望 nil", err)
+				}
+			},
+		},
+		{
+			name:       "Retry重试耗尽返回RetryError",
+			middleware: Retry(2, time.Millisecond, time.Millisecond),
+			handler:    func(int) error { return errFailed },
+			wantCalls:  2,
+			check: func(t *testing.T, err error) {
+				var retryErr *RetryError
+				if !errors.As(err, &retryErr) || retryErr.Attempts != 2 || !errors.Is(err, errFailed) {
+					t.Errorf("error = %v, 期望尝试2次的 RetryError", err)
+				}
+			},
+		},
+		{
+			name:       "Retry遇到不可重试错误立即返回",
+			middleware: Retry(3, time.Millisecond, time.Millisecond),
+			handler:    func(int) error { return Permanent(errFailed) },
+			wantCalls:  1,
+			check: func(t *testing.T, err error) {
+				var retryErr *RetryError
+				if !errors.As(err, &retryErr) || retryErr.Attempts != 1 || !errors.Is(err, errFailed) {
+					t.Errorf("error = %v, 期望尝试1次的 RetryError", err)
+				}
+			},
+		},
+		{
+			name:       "Timeout超时返回DeadlineExceeded",
+			middleware: Timeout(10 * time.Millisecond),
+			handler: func(int) error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			},
+			wantCalls: 1,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("error = %v, 期望 context.DeadlineExceeded", err)
+				}
+			},
+		},
+		{
+			name:       "Logging透传错误",
+			middleware: Logging("[Test] "),
+			handler:    func(int) error { return errFailed },
+			wantCalls:  1,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errFailed) {
+					t.Errorf("error = %v, 期望 errFailed", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			h := Chain(HandlerFunc(func(context.Context, *sarama.ConsumerMessage) error {
+				return tt.handler(int(calls.Add(1)))
+			}), tt.middleware)
+
+			err := h.Handle(context.Background(), testMessage())
+			tt.check(t, err)
+			if calls := int(calls.Load()); calls != tt.wantCalls {
+				t.Errorf("调用次数 = %d, 期望 %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// TestTimeout 测试超时中间件等待处理器返回后才返回，不会与同一分区的下一条消息并发执行
+func TestTimeout(t *testing.T) {
+	errFailed := errors.New("处理失败")
+
+	tests := []struct {
+		name    string
+		handler func(ctx context.Context) error
+		cancel  bool // 调用前取消上层上下文
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "处理器响应ctx时在截止时间返回",
+			handler: func(ctx context.Context) error {
+				if _, ok := ctx.Deadline(); !ok {
+					t.Error("处理器的ctx没有截止时间")
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("error = %v, 期望 context.DeadlineExceeded", err)
+				}
+			},
+		},
+		{
+			name: "处理器忽略ctx时等待其返回后报告超时",
+			handler: func(context.Context) error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("error = %v, 期望 context.DeadlineExceeded", err)
+				}
+			},
+		},
+		{
+			name:    "未超时时返回处理器的错误",
+			handler: func(context.Context) error { return errFailed },
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errFailed) || errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("error = %v, 期望 errFailed", err)
+				}
+			},
+		},
+		{
+			name:    "上层上下文结束时不报告超时",
+			cancel:  true,
+			handler: func(ctx context.Context) error { return ctx.Err() },
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("error = %v, 期望 context.Canceled", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running atomic.Int32
+			h := Chain(HandlerFunc(func(ctx context.Context, _ *sarama.ConsumerMessage) error {
+				running.Add(1)
+				defer running.Add(-1)
+				return tt.handler(ctx)
+			}), Timeout(10*time.Millisecond))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			err := h.Handle(ctx, testMessage())
+			if n := running.Load(); n != 0 {
+				t.Errorf("Handle() 返回时仍有 %d 个处理器在执行", n)
+			}
+			tt.check(t, err)
+		})
+	}
+}
+
+// TestTiming 测试耗时统计
+func TestTiming(t *testing.T) {
+	metrics := &Metrics{}
+	fail := false
+	h := Chain(HandlerFunc(func(context.Context, *sarama.ConsumerMessage) error {
+		time.Sleep(time.Millisecond)
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	}), Timing(metrics))
+
+	_ = h.Handle(context.Background(), testMessage())
+	_ = h.Handle(context.Background(), testMessage())
+	fail = true
+	_ = h.Handle(context.Background(), testMessage())
+
+	snapshot := metrics.Snapshot()
+	if snapshot.Processed != 2 || snapshot.Failed != 1 {
+		t.Errorf("统计数据 = %+v, 期望成功2次失败1次", snapshot)
+	}
+	if snapshot.AvgDuration <= 0 || snapshot.MaxDuration < snapshot.AvgDuration {
+		t.Errorf("耗时统计不正确: %+v", snapshot)
+	}
+}
+
+// TestTrace 测试从消息头中提取追踪信息放入处理器的上下文
+func TestTrace(t *testing.T) {
+	var got tracing.Context
+	h := Chain(HandlerFunc(func(ctx context.Context, _ *sarama.ConsumerMessage) error {
+		got = tracing.FromContext(ctx)
+		return nil
+	}), Trace())
+
+	msg := testMessage()
+	msg.Headers = []*sarama.RecordHeader{
+		{Key: []byte(tracing.HeaderTraceParent), Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+		{Key: []byte(tracing.HeaderRequestID), Value: []byte("req-1")},
+	}
+	if err := h.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if got.RequestID != "req-1" || got.TraceID() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("处理器中的追踪信息 = %+v, 期望与消息头一致", got)
+	}
+}
+
+// TestClaimCheck 测试处理器收到还原后的大消息，blob不存在时返回不可重试错误且不调用处理器
+func TestClaimCheck(t *testing.T) {
+	store, err := claimcheck.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	cc := claimcheck.New(store, config.ClaimCheckConfig{MaxInlineBytes: 10, Retention: time.Hour}, 0)
+
+	var got []byte
+	var calls atomic.Int32
+	h := Chain(HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		calls.Add(1)
+		got = msg.Value
+		return nil
+	}), ClaimCheck(cc))
+
+	// 生产者转存消息体后，消费者收到的消息只有引用消息头
+	out := &sarama.ProducerMessage{Topic: "test-topic", Value: sarama.StringEncoder("a large payload")}
+	if err := cc.Offload(context.Background(), out); err != nil {
+		t.Fatalf("Offload() error = %v", err)
+	}
+	msg := testMessage()
+	msg.Value = nil
+	for i := range out.Headers {
+		msg.Headers = append(msg.Headers, &out.Headers[i])
+	}
+	if err := h.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if string(got) != "a large payload" {
+		t.Errorf("处理器收到的消息体 = %q, 期望还原后的内容", got)
+	}
+
+	missing := testMessage()
+	missing.Headers = []*sarama.RecordHeader{{Key: []byte(claimcheck.HeaderRef), Value: []byte("20250101-missing")}}
+	err = h.Handle(context.Background(), missing)
+	var permanent *PermanentError
+	if !errors.As(err, &permanent) || !errors.Is(err, claimcheck.ErrBlobNotFound) {
+		t.Errorf("Handle() error = %v, 期望不可重试的 ErrBlobNotFound", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("处理器调用 %d 次, 期望 1 次", calls.Load())
+	}
+}
@@ -0,0 +1,182 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kafka-example/config"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// OffsetStore 偏移量存储
+// 保存的是每个分区下一条待消费消息的偏移量，即已处理消息的偏移量+1
+type OffsetStore interface {
+	// Load 读取主题下所有分区已保存的偏移量
+	Load(topic string) (map[int32]int64, error)
+	// Save 保存主题下指定分区的偏移量，未包含的分区保持不变
+	Save(topic string, offsets map[int32]int64) error
+	// Close 释放存储占用的资源
+	Close() error
+}
+
+// NewOffsetStore 根据配置创建偏移量存储
+// 参数:
+//   - cfg: 偏移量存储配置
+//
+// 返回:
+//   - OffsetStore: 偏移量存储实例
+//   - error: 创建失败时返回错误
+func NewOffsetStore(cfg config.OffsetStoreConfig) (OffsetStore, error) {
+	switch cfg.Type {
+	case "", "file":
+		return NewFileOffsetStore(cfg.Path)
+	case "redis":
+		return NewRedisOffsetStore(cfg.Redis)
+	case "memory":
+		return NewMemoryOffsetStore(), nil
+	default:
+		return nil, fmt.Errorf("未知的偏移量存储类型: %s", cfg.Type)
+	}
+}
+
+// MemoryOffsetStore 基于内存的偏移量存储，进程退出后偏移量丢失，适用于测试
+type MemoryOffsetStore struct {
+	mu      sync.Mutex
+	offsets map[string]map[int32]int64
+}
+
+// NewMemoryOffsetStore 创建基于内存的偏移量存储
+func NewMemoryOffsetStore() *MemoryOffsetStore {
+	return &MemoryOffsetStore{offsets: make(map[string]map[int32]int64)}
+}
+
+// Load 读取主题下所有分区已保存的偏移量
+func (m *MemoryOffsetStore) Load(topic string) (map[int32]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyOffsets(m.offsets[topic]), nil
+}
+
+// Save 保存主题下指定分区的偏移量
+func (m *MemoryOffsetStore) Save(topic string, offsets map[int32]int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.offsets[topic] == nil {
+		m.offsets[topic] = make(map[int32]int64)
+	}
+	for partition, offset := range offsets {
+		m.offsets[topic][partition] = offset
+	}
+	return nil
+}
+
+// Close 内存存储无需释放资源
+func (m *MemoryOffsetStore) Close() error {
+	return nil
+}
+
+// FileOffsetStore 基于本地JSON文件的偏移量存储
+// 文件内容形如 {"topic": {"0": 12, "1": 30}}，写入时先写临时文件再重命名，避免写到一半时崩溃导致文件损坏
+type FileOffsetStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileOffsetStore 创建基于本地文件的偏移量存储
+// path: 偏移量文件路径，所在目录不存在时会自动创建
+func NewFileOffsetStore(path string) (*FileOffsetStore, error) {
+	if path == "" {
+		return nil, errors.New("偏移量文件路径不能为空")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建偏移量文件目录失败: %w", err)
+	}
+	return &FileOffsetStore{path: path}, nil
+}
+
+// Load 读取主题下所有分区已保存的偏移量
+func (f *FileOffsetStore) Load(topic string) (map[int32]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	all, err := f.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int32]int64, len(all[topic]))
+	for key, offset := range all[topic] {
+		partition, err := strconv.ParseInt(key, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("偏移量文件中的分区不合法: %s", key)
+		}
+		offsets[int32(partition)] = offset
+	}
+	return offsets, nil
+}
+
+// Save 保存主题下指定分区的偏移量
+func (f *FileOffsetStore) Save(topic string, offsets map[int32]int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	all, err := f.readAll()
+	if err != nil {
+		return err
+	}
+	if all[topic] == nil {
+		all[topic] = make(map[string]int64)
+	}
+	for partition, offset := range offsets {
+		all[topic][strconv.FormatInt(int64(partition), 10)] = offset
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化偏移量失败: %w", err)
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入偏移量文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("替换偏移量文件失败: %w", err)
+	}
+	return nil
+}
+
+// Close 文件存储无需释放资源
+func (f *FileOffsetStore) Close() error {
+	return nil
+}
+
+// readAll 读取文件中所有主题的偏移量，文件不存在时返回空结果
+func (f *FileOffsetStore) readAll() (map[string]map[string]int64, error) {
+	all := make(map[string]map[string]int64)
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取偏移量文件失败: %w", err)
+	}
+	if len(data) == 0 {
+		return all, nil
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("解析偏移量文件失败: %w", err)
+	}
+	return all, nil
+}
+
+// copyOffsets 复制偏移量，避免调用方修改内部状态
+func copyOffsets(offsets map[int32]int64) map[int32]int64 {
+	copied := make(map[int32]int64, len(offsets))
+	for partition, offset := range offsets {
+		copied[partition] = offset
+	}
+	return copied
+}
@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestOffsetStore 测试偏移量存储的读写
+func TestOffsetStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		newStore func(t *testing.T) OffsetStore
+	}{
+		{
+			name: "内存存储",
+			newStore: func(t *testing.T) OffsetStore {
+				return NewMemoryOffsetStore()
+			},
+		},
+		{
+			name: "文件存储",
+			newStore: func(t *testing.T) OffsetStore {
+				store, err := NewFileOffsetStore(filepath.Join(t.TempDir(), "nested", "offsets.json"))
+				if err != nil {
+					t.Fatalf("NewFileOffsetStore() error = %v", err)
+				}
+				return store
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.newStore(t)
+			defer store.Close()
+
+			offsets, err := store.Load("topic-a")
+			if err != nil || len(offsets) != 0 {
+				t.Fatalf("Load() = %v, %v, 期望空结果", offsets, err)
+			}
+
+			if err := store.Save("topic-a", map[int32]int64{0: 10, 1: 20}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if err := store.Save("topic-a", map[int32]int64{1: 25}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if err := store.Save("topic-b", map[int32]int64{0: 5}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			offsets, err = store.Load("topic-a")
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if len(offsets) != 2 || offsets[0] != 10 || offsets[1] != 25 {
+				t.Errorf("Load() = %v, 期望 map[0:10 1:25]", offsets)
+			}
+		})
+	}
+}
+
+// TestFileOffsetStore_Reopen 测试文件存储在重新打开后仍能读取偏移量
+func TestFileOffsetStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.json")
+	store, err := NewFileOffsetStore(path)
+	if err != nil {
+		t.Fatalf("NewFileOffsetStore() error = %v", err)
+	}
+	if err := store.Save("topic", map[int32]int64{3: 42}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reopened, err := NewFileOffsetStore(path)
+	if err != nil {
+		t.Fatalf("NewFileOffsetStore() error = %v", err)
+	}
+	offsets, err := reopened.Load("topic")
+	if err != nil || offsets[3] != 42 {
+		t.Errorf("Load() = %v, %v, 期望 map[3:42]", offsets, err)
+	}
+}
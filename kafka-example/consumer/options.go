@@ -0,0 +1,210 @@
+package consumer
+
+import (
+	"kafka-example/claimcheck"
+	"kafka-example/config"
+
+	"github.com/IBM/sarama"
+)
+
+// options 消费者服务的可选配置
+type options struct {
+	config  *config.Config // Kafka配置
+	brokers []string       // 覆盖配置中的broker地址列表
+	groupID string         // 覆盖配置中的消费者组ID
+
+	deadLetter  DeadLetterPublisher // 死信队列发布器，为空时不启用死信队列
+	handler     Handler             // 业务消息处理器，为空时只打印消息
+	middlewares []Middleware        // 处理器中间件，为nil时使用 DefaultMiddlewares
+	offsetStore OffsetStore         // 传统消费者的偏移量存储
+
+	commit       *config.CommitConfig   // 覆盖配置中的偏移量提交策略
+	batchHandler BatchHandler           // batch提交模式下的批量处理器，为空时逐条调用 handler
+	workers      *int                   // 覆盖配置中每个分区的工作协程数
+	dedup        *Deduplicator          // 消息去重器，为空时不去重
+	limits       *config.LimitsConfig   // 覆盖配置中消费者组的限流和背压参数
+	claimCheck   *claimcheck.ClaimCheck // 大消息的还原，为空时不处理
+
+	newConsumerGroup ConsumerGroupFactory // 创建sarama消费者组，默认 sarama.NewConsumerGroup
+	newConsumer      ConsumerFactory      // 创建sarama消费者，为空时通过客户端创建
+}
+
+// ConsumerGroupFactory 创建sarama消费者组的函数，签名与 sarama.NewConsumerGroup 相同
+type ConsumerGroupFactory func(addrs []string, groupID string, config *sarama.Config) (sarama.ConsumerGroup, error)
+
+// ConsumerFactory 创建sarama消费者的函数，签名与 sarama.NewConsumer 相同
+type ConsumerFactory func(addrs []string, config *sarama.Config) (sarama.Consumer, error)
+
+// Option 消费者服务的函数式选项
+type Option func(*options)
+
+// WithConfig 使用指定的配置创建消费者
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithBrokers 覆盖配置中的broker地址列表
+func WithBrokers(brokers ...string) Option {
+	return func(o *options) {
+		o.brokers = brokers
+	}
+}
+
+// WithGroupID 覆盖配置中的消费者组ID
+func WithGroupID(groupID string) Option {
+	return func(o *options) {
+		o.groupID = groupID
+	}
+}
+
+// WithDeadLetter 启用死信队列
+// 消息多次处理失败后会发布到死信主题，而不是直接跳过；发布失败时按退避重试，成功前不会提交该消息之后的偏移量
+func WithDeadLetter(publisher DeadLetterPublisher) Option {
+	return func(o *options) {
+		o.deadLetter = publisher
+	}
+}
+
+// WithHandler 指定业务消息处理器
+func WithHandler(h Handler) Option {
+	return func(o *options) {
+		o.handler = h
+	}
+}
+
+// WithMiddleware 指定处理器中间件，替换默认的重试和panic恢复中间件
+// 第一个中间件位于最外层，最先执行
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append([]Middleware{}, middlewares...)
+	}
+}
+
+// WithOffsetStore 指定传统消费者的偏移量存储
+// 消费者停止时会关闭该存储
+func WithOffsetStore(store OffsetStore) Option {
+	return func(o *options) {
+		o.offsetStore = store
+	}
+}
+
+// WithCommit 覆盖配置中的消费者组偏移量提交策略
+func WithCommit(commit config.CommitConfig) Option {
+	return func(o *options) {
+		o.commit = &commit
+	}
+}
+
+// WithBatchHandler 指定batch提交模式下的批量处理器
+// 批量处理器不经过处理器中间件，需要自行处理重试和panic
+func WithBatchHandler(h BatchHandler) Option {
+	return func(o *options) {
+		o.batchHandler = h
+	}
+}
+
+// WithWorkers 覆盖配置中消费者组每个分区的工作协程数
+// 大于1时按消息键把消息分配给工作协程，相同键的消息按序处理，不同键的消息并行处理
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.workers = &n
+	}
+}
+
+// WithLimits 覆盖配置中消费者组的限流和背压参数
+func WithLimits(limits config.LimitsConfig) Option {
+	return func(o *options) {
+		o.limits = &limits
+	}
+}
+
+// WithDedup 启用消息去重，重复投递的消息不再调用处理器
+// 去重器可以在多个消费者之间共享，消费者停止时不会关闭它；batch提交模式下的批量处理器不经过去重
+func WithDedup(d *Deduplicator) Option {
+	return func(o *options) {
+		o.dedup = d
+	}
+}
+
+// WithClaimCheck 在处理前还原生产者压缩或转存到blob存储的大消息
+// batch提交模式下的批量处理器不经过该中间件，需要自行调用 ClaimCheck.Resolve
+func WithClaimCheck(c *claimcheck.ClaimCheck) Option {
+	return func(o *options) {
+		o.claimCheck = c
+	}
+}
+
+// WithConsumerGroupFactory 指定创建sarama消费者组的函数
+// 测试中可以使用 kafkatest.Broker 提供的内存消费者组，不需要连接Kafka
+func WithConsumerGroupFactory(factory ConsumerGroupFactory) Option {
+	return func(o *options) {
+		o.newConsumerGroup = factory
+	}
+}
+
+// WithConsumerFactory 指定创建传统消费者所用sarama消费者的函数
+// 测试中可以返回 mocks.Consumer；此时没有客户端，发现新增分区时不会主动刷新主题元数据
+func WithConsumerFactory(factory ConsumerFactory) Option {
+	return func(o *options) {
+		o.newConsumer = factory
+	}
+}
+
+// buildHandler 使用中间件包装业务处理器
+// Trace 中间件总是位于最外层，使追踪信息对所有中间件和处理器可见；
+// 随后还原大消息，使去重和其他中间件看到完整的消息体；
+// 去重中间件紧随其后，只有经过重试最终处理成功的消息才会被记录
+// logPrefix 用于未指定处理器时的默认日志处理器，dedupScope 为去重范围
+func (o *options) buildHandler(logPrefix, dedupScope string) Handler {
+	h := o.handler
+	if h == nil {
+		h = logHandler(logPrefix)
+	}
+	middlewares := o.middlewares
+	if middlewares == nil {
+		middlewares = DefaultMiddlewares()
+	}
+	outer := []Middleware{Trace()}
+	if o.claimCheck != nil {
+		outer = append(outer, ClaimCheck(o.claimCheck))
+	}
+	if o.dedup != nil {
+		outer = append(outer, o.dedup.Middleware(dedupScope))
+	}
+	return Chain(h, append(outer, middlewares...)...)
+}
+
+// newOptions 应用选项并补全默认值
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.config == nil {
+		o.config = config.Default()
+	}
+	if len(o.brokers) == 0 {
+		o.brokers = o.config.Brokers
+	}
+	if o.groupID == "" {
+		o.groupID = o.config.Consumer.GroupID
+	}
+	if o.commit == nil {
+		commit := o.config.Consumer.Commit
+		o.commit = &commit
+	}
+	if o.workers == nil {
+		workers := o.config.Consumer.Workers
+		o.workers = &workers
+	}
+	if o.limits == nil {
+		limits := o.config.Consumer.Limits
+		o.limits = &limits
+	}
+	if o.newConsumerGroup == nil {
+		o.newConsumerGroup = sarama.NewConsumerGroup
+	}
+	return o
+}
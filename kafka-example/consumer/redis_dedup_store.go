@@ -0,0 +1,72 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"kafka-example/config"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisDedupStore 基于Redis的去重存储，多个消费者实例共享已处理的消息ID
+// 每个去重键对应一个带过期时间的键 <key_prefix>:<id>，id 中包含消费者组ID
+type RedisDedupStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewRedisDedupStore 创建基于Redis的去重存储
+// 创建时会检查Redis连接是否可用
+func NewRedisDedupStore(cfg config.RedisStoreConfig) (*RedisDedupStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("连接Redis失败: %w", err)
+	}
+
+	return &RedisDedupStore{client: client, keyPrefix: cfg.KeyPrefix}, nil
+}
+
+// key 返回消息ID对应的键
+func (r *RedisDedupStore) key(id string) string {
+	if r.keyPrefix == "" {
+		return id
+	}
+	return r.keyPrefix + ":" + id
+}
+
+// Seen 判断消息ID是否已处理且未过期
+func (r *RedisDedupStore) Seen(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	n, err := r.client.Exists(ctx, r.key(id)).Result()
+	if err != nil {
+		return false, fmt.Errorf("从Redis查询消息ID失败: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Mark 记录消息ID已处理，ttl 后由Redis自动删除
+func (r *RedisDedupStore) Mark(ctx context.Context, id string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	if err := r.client.Set(ctx, r.key(id), 1, ttl).Err(); err != nil {
+		return fmt.Errorf("向Redis记录消息ID失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭Redis连接
+func (r *RedisDedupStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,97 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"kafka-example/config"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout Redis操作的超时时间
+const redisTimeout = 3 * time.Second
+
+// RedisOffsetStore 基于Redis哈希的偏移量存储
+// 每个主题对应一个哈希键 <key_prefix>:<topic>，字段为分区号，值为偏移量
+type RedisOffsetStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewRedisOffsetStore 创建基于Redis的偏移量存储
+// 创建时会检查Redis连接是否可用
+func NewRedisOffsetStore(cfg config.RedisStoreConfig) (*RedisOffsetStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("连接Redis失败: %w", err)
+	}
+
+	return &RedisOffsetStore{client: client, keyPrefix: cfg.KeyPrefix}, nil
+}
+
+// key 返回主题对应的哈希键
+func (r *RedisOffsetStore) key(topic string) string {
+	if r.keyPrefix == "" {
+		return topic
+	}
+	return r.keyPrefix + ":" + topic
+}
+
+// Load 读取主题下所有分区已保存的偏移量
+func (r *RedisOffsetStore) Load(topic string) (map[int32]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	values, err := r.client.HGetAll(ctx, r.key(topic)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("从Redis读取偏移量失败: %w", err)
+	}
+
+	offsets := make(map[int32]int64, len(values))
+	for field, value := range values {
+		partition, err := strconv.ParseInt(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Redis中的分区不合法: %s", field)
+		}
+		offset, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Redis中的偏移量不合法: %s", value)
+		}
+		offsets[int32(partition)] = offset
+	}
+	return offsets, nil
+}
+
+// Save 保存主题下指定分区的偏移量
+func (r *RedisOffsetStore) Save(topic string, offsets map[int32]int64) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(offsets))
+	for partition, offset := range offsets {
+		values[strconv.FormatInt(int64(partition), 10)] = offset
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.HSet(ctx, r.key(topic), values).Err(); err != nil {
+		return fmt.Errorf("向Redis保存偏移量失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭Redis连接
+func (r *RedisOffsetStore) Close() error {
+	return r.client.Close()
+}
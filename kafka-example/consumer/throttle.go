@@ -0,0 +1,218 @@
+package consumer
+
+import (
+	"context"
+	"kafka-example/config"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶限流器
+// 令牌按 rate 每秒匀速补充，最多积累 burst 个；令牌不足时预占未来的令牌并返回需要等待的时间
+type tokenBucket struct {
+	rate   float64   // 每秒补充的令牌数，不大于0时不限制
+	burst  float64   // 令牌桶容量
+	tokens float64   // 当前令牌数，预占后可能为负数
+	last   time.Time // 上次补充令牌的时间
+}
+
+// newTokenBucket 创建令牌桶，初始时令牌桶是满的
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	b := &tokenBucket{last: now}
+	b.setLimit(rate, burst, now)
+	b.tokens = b.burst
+	return b
+}
+
+// setLimit 调整令牌桶的速率和容量，已积累的令牌不超过新的容量
+// burst 为0时容量与每秒令牌数相同，至少为1
+func (b *tokenBucket) setLimit(rate float64, burst int, now time.Time) {
+	b.advance(now)
+	b.rate = rate
+	b.burst = float64(burst)
+	if burst <= 0 {
+		b.burst = math.Max(1, math.Ceil(rate))
+	}
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// advance 按经过的时间补充令牌
+func (b *tokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 && b.rate > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// reserve 预占一个令牌
+// 返回: 需要等待的时间，不限制或令牌充足时为0
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.advance(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel 归还预占的令牌，放弃等待时调用
+func (b *tokenBucket) cancel() {
+	if b.rate > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+1)
+	}
+}
+
+// topicPartition 主题和分区
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// throttle 消费者组的限流和背压状态，被所有分区的 ConsumeClaim 共享
+type throttle struct {
+	mu         sync.Mutex
+	limits     config.LimitsConfig
+	consumer   *tokenBucket                    // 整个消费者的令牌桶
+	partitions map[topicPartition]*tokenBucket // 每个分区的令牌桶，首次消费时创建
+	paused     map[topicPartition]bool         // 因背压暂停拉取的分区
+	now        func() time.Time
+}
+
+// newThrottle 创建限流和背压状态
+func newThrottle(limits config.LimitsConfig) *throttle {
+	t := &throttle{
+		limits:     limits,
+		partitions: make(map[topicPartition]*tokenBucket),
+		paused:     make(map[topicPartition]bool),
+		now:        time.Now,
+	}
+	t.consumer = newTokenBucket(limits.Rate, limits.Burst, t.now())
+	return t
+}
+
+// wait 等待消费者和分区的令牌桶都有可用令牌
+// 返回: 上下文取消时返回上下文的错误，预占的令牌会归还
+func (t *throttle) wait(ctx context.Context, topic string, partition int32) error {
+	t.mu.Lock()
+	now := t.now()
+	tp := topicPartition{topic, partition}
+	pb, ok := t.partitions[tp]
+	if !ok {
+		pb = newTokenBucket(t.limits.PartitionRate, t.limits.PartitionBurst, now)
+		t.partitions[tp] = pb
+	}
+	delay := max(pb.reserve(now), t.consumer.reserve(now))
+	t.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		pb.cancel()
+		t.consumer.cancel()
+		t.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// current 返回当前的限流和背压参数
+func (t *throttle) current() config.LimitsConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits
+}
+
+// setLimits 调整限流和背压参数，对已创建的令牌桶立即生效
+func (t *throttle) setLimits(limits config.LimitsConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.limits = limits
+	t.consumer.setLimit(limits.Rate, limits.Burst, now)
+	for _, b := range t.partitions {
+		b.setLimit(limits.PartitionRate, limits.PartitionBurst, now)
+	}
+}
+
+// setPaused 记录分区是否因背压暂停
+func (t *throttle) setPaused(tp topicPartition, paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if paused {
+		t.paused[tp] = true
+	} else {
+		delete(t.paused, tp)
+	}
+}
+
+// pausedPartitions 返回因背压暂停拉取的分区，按主题分组
+func (t *throttle) pausedPartitions() map[string][]int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make(map[string][]int32)
+	for tp := range t.paused {
+		result[tp.topic] = append(result[tp.topic], tp.partition)
+	}
+	return result
+}
+
+// pauser 暂停和恢复分区拉取，sarama.ConsumerGroup 实现了该接口
+type pauser interface {
+	Pause(partitions map[string][]int32)
+	Resume(partitions map[string][]int32)
+}
+
+// backpressure 单个分区认领的背压控制
+// 待处理消息数达到高水位时暂停拉取该分区，降到低水位时恢复；暂停期间已拉取的消息继续处理。
+// 暂停慢分区可以避免它占满拉取缓冲区，拖慢同一broker上其他分区的拉取
+type backpressure struct {
+	throttle *throttle
+	pauser   pauser
+	tp       topicPartition
+	paused   bool
+}
+
+// newBackpressure 创建分区认领的背压控制
+func newBackpressure(t *throttle, p pauser, topic string, partition int32) *backpressure {
+	return &backpressure{throttle: t, pauser: p, tp: topicPartition{topic, partition}}
+}
+
+// update 根据分区当前的待处理消息数暂停或恢复拉取
+func (b *backpressure) update(inFlight int) {
+	limits := b.throttle.current()
+	switch {
+	case !b.paused && limits.HighWaterMark > 0 && inFlight >= limits.HighWaterMark:
+		b.pauser.Pause(map[string][]int32{b.tp.topic: {b.tp.partition}})
+		b.paused = true
+		b.throttle.setPaused(b.tp, true)
+		log.Printf("[GroupConsumer] 待处理消息达到高水位，暂停拉取分区 %s/%d: in_flight=%d, high=%d",
+			b.tp.topic, b.tp.partition, inFlight, limits.HighWaterMark)
+	case b.paused && (limits.HighWaterMark <= 0 || inFlight <= limits.LowWaterMark):
+		b.release()
+		log.Printf("[GroupConsumer] 待处理消息降到低水位，恢复拉取分区 %s/%d: in_flight=%d, low=%d",
+			b.tp.topic, b.tp.partition, inFlight, limits.LowWaterMark)
+	}
+}
+
+// release 恢复已暂停的分区，分区认领结束时调用
+func (b *backpressure) release() {
+	if !b.paused {
+		return
+	}
+	b.pauser.Resume(map[string][]int32{b.tp.topic: {b.tp.partition}})
+	b.paused = false
+	b.throttle.setPaused(b.tp, false)
+}
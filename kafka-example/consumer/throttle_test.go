@@ -0,0 +1,211 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"kafka-example/config"
+	"kafka-example/kafkatest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TestTokenBucket 测试令牌桶的突发容量、等待时间和运行时调整
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(10, 2, now)
+
+	// 初始的2个令牌可以立即使用，之后每个令牌需要等待0.1秒
+	for i, want := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if got := b.reserve(now); got != want {
+			t.Errorf("第%d次 reserve() = %v, 期望 %v", i+1, got, want)
+		}
+	}
+
+	// 放弃等待的令牌归还后，1秒补充的令牌不超过容量
+	b.cancel()
+	b.cancel()
+	now = now.Add(time.Second)
+	if got := b.reserve(now); got != 0 {
+		t.Errorf("补充令牌后 reserve() = %v, 期望 0", got)
+	}
+	if b.tokens != 1 {
+		t.Errorf("tokens = %v, 期望 1", b.tokens)
+	}
+
+	// 取消限制后不再等待；容量为0时与每秒令牌数相同
+	b.setLimit(0, 0, now)
+	for i := 0; i < 5; i++ {
+		if got := b.reserve(now); got != 0 {
+			t.Fatalf("不限制时 reserve() = %v, 期望 0", got)
+		}
+	}
+	b.setLimit(2.5, 0, now)
+	if b.burst != 3 {
+		t.Errorf("burst = %v, 期望 3", b.burst)
+	}
+}
+
+// TestBackpressure 测试待处理消息达到高水位时暂停分区，降到低水位或关闭背压时恢复
+func TestBackpressure(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      config.LimitsConfig
+		inFlight    []int
+		setLimits   *config.LimitsConfig // 最后一次更新前调整的参数
+		wantPauses  int
+		wantResumes int
+		wantPaused  bool
+	}{
+		{
+			name:       "未启用背压",
+			inFlight:   []int{100, 200},
+			wantPaused: false,
+		},
+		{
+			name:       "达到高水位时暂停",
+			limits:     config.LimitsConfig{HighWaterMark: 3, LowWaterMark: 1},
+			inFlight:   []int{1, 3, 4, 2},
+			wantPauses: 1,
+			wantPaused: true,
+		},
+		{
+			name:        "降到低水位时恢复",
+			limits:      config.LimitsConfig{HighWaterMark: 3, LowWaterMark: 1},
+			inFlight:    []int{3, 2, 1, 2},
+			wantPauses:  1,
+			wantResumes: 1,
+		},
+		{
+			name:        "运行时关闭背压时恢复",
+			limits:      config.LimitsConfig{HighWaterMark: 3, LowWaterMark: 1},
+			inFlight:    []int{5, 5},
+			setLimits:   &config.LimitsConfig{},
+			wantPauses:  1,
+			wantResumes: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := kafkatest.NewBroker("test-topic", 0).NewConsumerGroup()
+			th := newThrottle(tt.limits)
+			bp := newBackpressure(th, group, "test-topic", 0)
+			for i, n := range tt.inFlight {
+				if tt.setLimits != nil && i == len(tt.inFlight)-1 {
+					th.setLimits(*tt.setLimits)
+				}
+				bp.update(n)
+			}
+
+			pauses, resumes := group.PauseCounts()
+			if pauses != tt.wantPauses || resumes != tt.wantResumes {
+				t.Errorf("暂停 %d 次、恢复 %d 次, 期望 %d、%d", pauses, resumes, tt.wantPauses, tt.wantResumes)
+			}
+			if paused := len(th.pausedPartitions()) > 0; paused != tt.wantPaused {
+				t.Errorf("分区是否暂停 = %v, 期望 %v", paused, tt.wantPaused)
+			}
+
+			bp.release()
+			if len(th.pausedPartitions()) != 0 {
+				t.Errorf("release() 后不应有暂停的分区")
+			}
+		})
+	}
+}
+
+// TestGroupConsumerService_Limits 测试分区限流降低处理速度，运行时调整参数立即生效，工作协程积压时暂停分区
+func TestGroupConsumerService_Limits(t *testing.T) {
+	broker := kafkatest.NewBroker("test-topic", 0)
+	group := broker.NewConsumerGroup()
+
+	release := make(chan struct{})
+	var processed atomic.Int32
+	handler := HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		if string(msg.Value) == "block" {
+			<-release
+		}
+		processed.Add(1)
+		return nil
+	})
+
+	service := newGroupConsumer(group, []string{"test-topic"}, nil, newOptions([]Option{
+		WithHandler(handler),
+		WithMiddleware(),
+		WithCommit(config.CommitConfig{Mode: config.CommitModeMessage}),
+		WithWorkers(2),
+		WithLimits(config.LimitsConfig{PartitionRate: 20, PartitionBurst: 1}),
+	}))
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = service.Stop() }()
+
+	// 每秒20条、容量1时，5条消息至少需要0.2秒
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		broker.ProduceKey(0, fmt.Sprintf("key-%d", i), "v")
+	}
+	waitFor(t, 2*time.Second, func() bool { return processed.Load() == 5 })
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("限流后处理5条消息耗时 %v, 期望不少于200ms", elapsed)
+	}
+
+	if err := service.SetLimits(config.LimitsConfig{HighWaterMark: 1, LowWaterMark: 2}); err == nil {
+		t.Error("低水位不小于高水位时 SetLimits() 应返回错误")
+	}
+	if err := service.SetLimits(config.LimitsConfig{HighWaterMark: 2}); err != nil {
+		t.Fatalf("SetLimits() error = %v", err)
+	}
+	if got := service.Limits(); got.PartitionRate != 0 || got.HighWaterMark != 2 {
+		t.Errorf("Limits() = %+v", got)
+	}
+
+	// 阻塞的消息未完成时待处理消息达到高水位，暂停分区；完成后恢复
+	broker.ProduceKey(0, "a", "block")
+	broker.ProduceKey(0, "b", "v")
+	waitFor(t, time.Second, func() bool { return len(service.PausedPartitions()["test-topic"]) == 1 })
+	close(release)
+	waitFor(t, time.Second, func() bool { return len(service.PausedPartitions()) == 0 })
+	if pauses, resumes := group.PauseCounts(); pauses != 1 || resumes != 1 {
+		t.Errorf("暂停 %d 次、恢复 %d 次, 期望各 1 次", pauses, resumes)
+	}
+}
+
+// TestGroupConsumerService_LimitsChannelBuffer 测试创建时按背压高水位增大消息通道容量，运行时拒绝超过容量的高水位
+func TestGroupConsumerService_LimitsChannelBuffer(t *testing.T) {
+	broker := kafkatest.NewBroker("test-topic", 0)
+	var got *sarama.Config
+	service, err := NewGroupConsumerService([]string{"test-topic"},
+		WithLimits(config.LimitsConfig{HighWaterMark: 500, LowWaterMark: 100}),
+		WithConsumerGroupFactory(func(addrs []string, groupID string, cfg *sarama.Config) (sarama.ConsumerGroup, error) {
+			got = cfg
+			return broker.ConsumerGroupFactory()(addrs, groupID, cfg)
+		}))
+	if err != nil {
+		t.Fatalf("NewGroupConsumerService() error = %v", err)
+	}
+	if got.ChannelBufferSize != 501 {
+		t.Errorf("ChannelBufferSize = %d, 期望 501", got.ChannelBufferSize)
+	}
+
+	tests := []struct {
+		name          string
+		highWaterMark int
+		wantErr       bool
+	}{
+		{name: "高水位小于通道容量", highWaterMark: 500},
+		{name: "高水位等于通道容量", highWaterMark: 501, wantErr: true},
+		{name: "高水位大于通道容量", highWaterMark: 1000, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.SetLimits(config.LimitsConfig{HighWaterMark: tt.highWaterMark})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
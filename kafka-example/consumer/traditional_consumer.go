@@ -1,123 +1,293 @@
 package consumer
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"kafka-example/common"
+	"kafka-example/tracing"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
 )
 
 // TraditionalConsumerService 表示传统的Kafka消费者服务
-// 用于处理单个分区的消息消费
+// 为主题的每个分区启动一个分区消费者，并定期发现新增的分区；
+// 偏移量保存在 OffsetStore 中，重启后从上次提交的位置继续消费
 type TraditionalConsumerService struct {
-	consumer  sarama.Consumer          // Kafka消费者实例
-	topic     string                   // 订阅的主题
-	broker    string                   // Kafka broker地址
-	partition sarama.PartitionConsumer // 分区消费者
-	stopChan  chan struct{}            // 停止通道
-	config    *sarama.Config           // Kafka配置
+	client   sarama.Client      // Kafka客户端，用于刷新主题元数据
+	consumer sarama.Consumer    // Kafka消费者实例
+	topic    string             // 订阅的主题
+	brokers  []string           // Kafka broker地址列表
+	stopChan chan struct{}      // 停止通道
+	config   *sarama.Config     // Kafka配置
+	handler  Handler            // 经过中间件包装的消息处理器
+	ctx      context.Context    // 传递给处理器的上下文，停止时取消
+	cancel   context.CancelFunc // 取消处理器上下文
+	wg       sync.WaitGroup     // 等待所有消费协程退出
+
+	partitionsMu sync.Mutex                         // 保护partitions
+	partitions   map[int32]sarama.PartitionConsumer // 分区号到分区消费者的映射
+
+	store          OffsetStore     // 偏移量存储
+	commitInterval time.Duration   // 定期提交偏移量的间隔
+	offsetsMu      sync.Mutex      // 保护offsets和dirty
+	offsets        map[int32]int64 // 每个分区下一条待消费消息的偏移量
+	dirty          bool            // 是否有尚未提交的偏移量
 }
 
+const (
+	traditionalLogPrefix  = "[TraditionalConsumer] "
+	traditionalDedupScope = "traditional" // 传统消费者不属于消费者组，使用固定的去重范围
+
+	partitionDiscoveryInterval = 30 * time.Second // 发现新增分区的间隔
+	defaultCommitInterval      = 5 * time.Second  // 默认的偏移量提交间隔
+)
+
 // NewTraditionalConsumerService 创建一个新的传统消费者服务实例
 // topic: 要订阅的主题
+// opts: 可选配置，未指定时使用默认配置，未指定偏移量存储时使用内存存储
 // 返回: 传统消费者服务实例和可能的错误
-func NewTraditionalConsumerService(topic string) (*TraditionalConsumerService, error) {
+func NewTraditionalConsumerService(topic string, opts ...Option) (*TraditionalConsumerService, error) {
 	log.Printf("[TraditionalConsumer] 正在初始化传统消费者服务...")
-
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
+	o := newOptions(opts)
 
 	// 消费者配置
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest // 从最新的偏移量开始消费
-	config.Consumer.Offsets.AutoCommit.Enable = false     // 禁用自动提交
-
-	// 创建消费者
-	consumer, err := sarama.NewConsumer([]string{common.Broker}, config)
+	config, err := o.config.ConsumerSaramaConfig()
 	if err != nil {
-		log.Printf("[TraditionalConsumer] 创建消费者失败: %v", err)
-		return nil, fmt.Errorf("创建消费者失败: %v", err)
+		log.Printf("[TraditionalConsumer] 消费者配置不合法: %v", err)
+		return nil, fmt.Errorf("消费者配置不合法: %v", err)
 	}
 
-	// 创建分区消费者
-	partition, err := consumer.ConsumePartition(topic, 0, sarama.OffsetNewest)
+	// 创建客户端和消费者
+	client, consumer, err := o.buildConsumer(config)
 	if err != nil {
-		log.Printf("[TraditionalConsumer] 创建分区消费者失败: %v", err)
-		if err := consumer.Close(); err != nil {
-			log.Printf("[TraditionalConsumer] 关闭消费者失败: %v", err)
-		}
-		return nil, fmt.Errorf("创建分区消费者失败: %v", err)
+		return nil, err
 	}
 
-	service := &TraditionalConsumerService{
-		consumer:  consumer,
-		topic:     common.SyncTopic,
-		broker:    common.Broker,
-		partition: partition,
-		stopChan:  make(chan struct{}),
+	// 检查主题是否存在
+	if _, err := consumer.Partitions(topic); err != nil {
+		log.Printf("[TraditionalConsumer] 获取主题分区失败: %v", err)
+		_ = consumer.Close()
+		if client != nil {
+			_ = client.Close()
+		}
+		return nil, fmt.Errorf("获取主题分区失败: %v", err)
 	}
 
+	service := newTraditionalConsumer(topic, client, consumer, config, o)
 	log.Printf("[TraditionalConsumer] 传统消费者服务初始化成功，订阅主题: %s", topic)
 	return service, nil
 }
 
+// buildConsumer 创建传统消费者使用的客户端和sarama消费者
+// 指定了 WithConsumerFactory 时直接使用它创建消费者，此时客户端为空
+// 返回: 客户端、消费者和可能的错误
+func (o *options) buildConsumer(config *sarama.Config) (sarama.Client, sarama.Consumer, error) {
+	if o.newConsumer != nil {
+		consumer, err := o.newConsumer(o.brokers, config)
+		if err != nil {
+			log.Printf("[TraditionalConsumer] 创建消费者失败: %v", err)
+			return nil, nil, fmt.Errorf("创建消费者失败: %v", err)
+		}
+		return nil, consumer, nil
+	}
+
+	client, err := sarama.NewClient(o.brokers, config)
+	if err != nil {
+		log.Printf("[TraditionalConsumer] 创建客户端失败: %v", err)
+		return nil, nil, fmt.Errorf("创建客户端失败: %v", err)
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		log.Printf("[TraditionalConsumer] 创建消费者失败: %v", err)
+		_ = client.Close()
+		return nil, nil, fmt.Errorf("创建消费者失败: %v", err)
+	}
+	return client, consumer, nil
+}
+
+// newTraditionalConsumer 使用已创建的客户端和消费者组装传统消费者服务
+// client 可以为空，此时不会主动刷新主题元数据
+func newTraditionalConsumer(topic string, client sarama.Client, consumer sarama.Consumer,
+	config *sarama.Config, o *options) *TraditionalConsumerService {
+	store := o.offsetStore
+	if store == nil {
+		store = NewMemoryOffsetStore()
+	}
+	commitInterval := o.config.Consumer.OffsetStore.CommitInterval
+	if commitInterval <= 0 {
+		commitInterval = defaultCommitInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TraditionalConsumerService{
+		client:         client,
+		consumer:       consumer,
+		topic:          topic,
+		brokers:        o.brokers,
+		stopChan:       make(chan struct{}),
+		config:         config,
+		handler:        o.buildHandler(traditionalLogPrefix, traditionalDedupScope),
+		ctx:            ctx,
+		cancel:         cancel,
+		partitions:     make(map[int32]sarama.PartitionConsumer),
+		store:          store,
+		commitInterval: commitInterval,
+		offsets:        make(map[int32]int64),
+	}
+}
+
 // processMessage 处理单条消息
-// 包含重试机制和错误处理
+// 处理器的重试、panic恢复由中间件负责，处理成功后记录偏移量
 func (s *TraditionalConsumerService) processMessage(msg *sarama.ConsumerMessage) error {
-	maxRetries := 3
-	retryInterval := 1 * time.Second
-
-	for i := 0; i < maxRetries; i++ {
-		// 处理消息
-		log.Printf("[TraditionalConsumer] 处理消息: topic=%s, partition=%d, offset=%d, value=%s",
-			msg.Topic, msg.Partition, msg.Offset, string(msg.Value))
-
-		// 模拟消息处理
-		time.Sleep(100 * time.Millisecond)
-
-		// 如果处理成功，提交偏移量
-		if err := s.commitOffset(msg); err != nil {
-			log.Printf("[TraditionalConsumer] 提交偏移量失败: %v", err)
-			if i < maxRetries-1 {
-				log.Printf("[TraditionalConsumer] 将在 %v 后重试", retryInterval)
-				time.Sleep(retryInterval)
-				continue
-			}
-			return fmt.Errorf("提交偏移量失败: %v", err)
-		}
+	if err := s.handler.Handle(s.ctx, msg); err != nil {
+		return fmt.Errorf("处理消息失败: %w", err)
+	}
 
+	s.markOffset(msg)
+	return nil
+}
+
+// markOffset 在内存中记录已处理消息的偏移量，由 commitOffsets 定期持久化
+func (s *TraditionalConsumerService) markOffset(msg *sarama.ConsumerMessage) {
+	s.offsetsMu.Lock()
+	defer s.offsetsMu.Unlock()
+	s.offsets[msg.Partition] = msg.Offset + 1
+	s.dirty = true
+}
+
+// commitOffsets 将内存中记录的偏移量提交到偏移量存储
+func (s *TraditionalConsumerService) commitOffsets() error {
+	s.offsetsMu.Lock()
+	if !s.dirty {
+		s.offsetsMu.Unlock()
 		return nil
 	}
+	offsets := copyOffsets(s.offsets)
+	s.dirty = false
+	s.offsetsMu.Unlock()
 
-	return fmt.Errorf("消息处理失败，已达到最大重试次数")
+	if err := s.store.Save(s.topic, offsets); err != nil {
+		// 提交失败时保留脏标记，下次继续提交
+		s.offsetsMu.Lock()
+		s.dirty = true
+		s.offsetsMu.Unlock()
+		return err
+	}
+
+	log.Printf("[TraditionalConsumer] 提交偏移量: topic=%s, offsets=%v", s.topic, offsets)
+	return nil
 }
 
-// commitOffset 提交消息偏移量
-func (s *TraditionalConsumerService) commitOffset(msg *sarama.ConsumerMessage) error {
-	// 这里可以添加持久化逻辑，确保偏移量不会丢失
-	log.Printf("[TraditionalConsumer] 提交偏移量: topic=%s, partition=%d, offset=%d",
-		msg.Topic, msg.Partition, msg.Offset)
+// syncPartitions 为尚未消费的分区启动分区消费者
+// initial: 是否为启动时的首次同步；之后发现的新分区从最早的偏移量开始消费，避免漏掉分区创建后写入的消息
+func (s *TraditionalConsumerService) syncPartitions(initial bool) error {
+	if !initial && s.client != nil {
+		if err := s.client.RefreshMetadata(s.topic); err != nil {
+			return fmt.Errorf("刷新主题元数据失败: %w", err)
+		}
+	}
+
+	partitions, err := s.consumer.Partitions(s.topic)
+	if err != nil {
+		return fmt.Errorf("获取主题分区失败: %w", err)
+	}
+
+	stored, err := s.store.Load(s.topic)
+	if err != nil {
+		return fmt.Errorf("读取已保存的偏移量失败: %w", err)
+	}
+
+	s.partitionsMu.Lock()
+	defer s.partitionsMu.Unlock()
+
+	for _, partition := range partitions {
+		if _, ok := s.partitions[partition]; ok {
+			continue
+		}
+
+		fallback := s.config.Consumer.Offsets.Initial
+		if !initial {
+			fallback = sarama.OffsetOldest
+		}
+		offset, ok := stored[partition]
+		if !ok {
+			offset = fallback
+		}
+
+		pc, err := s.consumer.ConsumePartition(s.topic, partition, offset)
+		if errors.Is(err, sarama.ErrOffsetOutOfRange) && ok {
+			// 已保存的偏移量已被清理，退回到默认策略
+			log.Printf("[TraditionalConsumer] 分区 %d 已保存的偏移量 %d 不可用，改为从 %d 开始消费",
+				partition, offset, fallback)
+			pc, err = s.consumer.ConsumePartition(s.topic, partition, fallback)
+		}
+		if err != nil {
+			return fmt.Errorf("创建分区 %d 的消费者失败: %w", partition, err)
+		}
+
+		s.partitions[partition] = pc
+		s.wg.Add(1)
+		go s.consumePartition(partition, pc)
+		log.Printf("[TraditionalConsumer] 开始消费分区: topic=%s, partition=%d, offset=%d", s.topic, partition, offset)
+	}
 	return nil
 }
 
+// consumePartition 消费单个分区的消息，直到收到停止信号
+func (s *TraditionalConsumerService) consumePartition(partition int32, pc sarama.PartitionConsumer) {
+	defer s.wg.Done()
+	for {
+		select {
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return
+			}
+			if err := s.processMessage(msg); err != nil {
+				log.Printf("[TraditionalConsumer] 处理消息失败: partition=%d, offset=%d, %s, error=%v",
+					partition, msg.Offset, tracing.Extract(msg.Headers), err)
+			}
+		case err, ok := <-pc.Errors():
+			if !ok {
+				return
+			}
+			log.Printf("[TraditionalConsumer] 分区 %d 消费错误: %v", partition, err)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
 // Start 启动消费者服务
-// 开始消费消息
+// 为所有分区启动消费协程，并在后台定期提交偏移量、发现新增的分区
 func (s *TraditionalConsumerService) Start() error {
 	log.Printf("[TraditionalConsumer] 正在启动消费者服务...")
 
+	if err := s.syncPartitions(true); err != nil {
+		log.Printf("[TraditionalConsumer] 启动分区消费者失败: %v", err)
+		return err
+	}
+
+	s.wg.Add(1)
 	go func() {
-		log.Printf("[TraditionalConsumer] 开始消费消息...")
+		defer s.wg.Done()
+		commitTicker := time.NewTicker(s.commitInterval)
+		defer commitTicker.Stop()
+		discoveryTicker := time.NewTicker(partitionDiscoveryInterval)
+		defer discoveryTicker.Stop()
+
 		for {
 			select {
-			case msg := <-s.partition.Messages():
-				if err := s.processMessage(msg); err != nil {
-					log.Printf("[TraditionalConsumer] 处理消息失败: %v", err)
-					// 可以在这里添加死信队列逻辑
+			case <-commitTicker.C:
+				if err := s.commitOffsets(); err != nil {
+					log.Printf("[TraditionalConsumer] 提交偏移量失败: %v", err)
+				}
+			case <-discoveryTicker.C:
+				if err := s.syncPartitions(false); err != nil {
+					log.Printf("[TraditionalConsumer] 发现新分区失败: %v", err)
 				}
-			case err := <-s.partition.Errors():
-				log.Printf("[TraditionalConsumer] 消费错误: %v", err)
-				// 可以在这里添加错误恢复逻辑
 			case <-s.stopChan:
 				log.Printf("[TraditionalConsumer] 收到停止信号")
 				return
@@ -130,30 +300,52 @@ func (s *TraditionalConsumerService) Start() error {
 }
 
 // Stop 停止消费者服务
-// 关闭分区消费者和消费者连接
+// 等待消费协程退出后提交偏移量，再关闭分区消费者和消费者连接
 func (s *TraditionalConsumerService) Stop() error {
 	log.Printf("[TraditionalConsumer] 正在停止消费者服务...")
 
-	// 发送停止信号
+	// 发送停止信号，并取消正在执行的处理器
 	close(s.stopChan)
+	s.cancel()
 
-	// 等待一段时间确保消息处理完成
-	time.Sleep(1 * time.Second)
+	// 等待所有消费协程退出，确保不会再有新的偏移量
+	s.wg.Wait()
+
+	var errs []error
+	if err := s.commitOffsets(); err != nil {
+		log.Printf("[TraditionalConsumer] 提交偏移量失败: %v", err)
+		errs = append(errs, fmt.Errorf("提交偏移量失败: %v", err))
+	}
 
 	// 关闭分区消费者
-	if err := s.partition.Close(); err != nil {
-		log.Printf("[TraditionalConsumer] 关闭分区消费者失败: %v", err)
-		return fmt.Errorf("关闭分区消费者失败: %v", err)
+	s.partitionsMu.Lock()
+	for partition, pc := range s.partitions {
+		if err := pc.Close(); err != nil {
+			log.Printf("[TraditionalConsumer] 关闭分区 %d 的消费者失败: %v", partition, err)
+			errs = append(errs, fmt.Errorf("关闭分区消费者失败: %v", err))
+		}
 	}
+	s.partitionsMu.Unlock()
 	log.Printf("[TraditionalConsumer] 分区消费者已关闭")
 
 	// 关闭消费者
 	if err := s.consumer.Close(); err != nil {
 		log.Printf("[TraditionalConsumer] 关闭消费者失败: %v", err)
-		return fmt.Errorf("关闭消费者失败: %v", err)
+		errs = append(errs, fmt.Errorf("关闭消费者失败: %v", err))
+	}
+	if s.client != nil && !s.client.Closed() {
+		if err := s.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("关闭客户端失败: %v", err))
+		}
+	}
+	if err := s.store.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("关闭偏移量存储失败: %v", err))
 	}
 	log.Printf("[TraditionalConsumer] 消费者已关闭")
 
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
 	log.Printf("[TraditionalConsumer] 消费者服务已成功停止")
 	return nil
 }
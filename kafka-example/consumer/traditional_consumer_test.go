@@ -0,0 +1,141 @@
+package consumer
+
+import (
+	"context"
+	"kafka-example/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// TestNewTraditionalConsumerService 测试通过 WithConsumerFactory 注入mock消费者创建传统消费者服务
+func TestNewTraditionalConsumerService(t *testing.T) {
+	tests := []struct {
+		name       string
+		topic      string
+		factoryErr error
+		wantErr    bool
+	}{
+		{
+			name:    "正常创建传统消费者",
+			topic:   "test-topic",
+			wantErr: false,
+		},
+		{
+			name:    "主题不存在",
+			topic:   "unknown-topic",
+			wantErr: true,
+		},
+		{
+			name:       "创建消费者失败",
+			topic:      "test-topic",
+			factoryErr: sarama.ErrOutOfBrokers,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := func(_ []string, cfg *sarama.Config) (sarama.Consumer, error) {
+				if tt.factoryErr != nil {
+					return nil, tt.factoryErr
+				}
+				mockConsumer := mocks.NewConsumer(t, cfg)
+				mockConsumer.SetTopicMetadata(map[string][]int32{"test-topic": {0}})
+				return mockConsumer, nil
+			}
+
+			service, err := NewTraditionalConsumerService(tt.topic, WithConsumerFactory(factory))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTraditionalConsumerService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if service == nil {
+				return
+			}
+			if service.client != nil {
+				t.Error("注入消费者时不应创建客户端")
+			}
+			if err := service.Stop(); err != nil {
+				t.Errorf("Stop() error = %v", err)
+			}
+		})
+	}
+}
+
+// TestTraditionalConsumerService_MultiPartition 测试多分区消费和偏移量恢复
+func TestTraditionalConsumerService_MultiPartition(t *testing.T) {
+	const topic = "test-topic"
+
+	cfg := config.Default()
+	cfg.Consumer.OffsetReset = "oldest"
+	saramaConfig, err := cfg.ConsumerSaramaConfig()
+	if err != nil {
+		t.Fatalf("ConsumerSaramaConfig() error = %v", err)
+	}
+
+	// 分区1已保存偏移量10，应从10继续消费；分区0没有保存的偏移量，按配置从最早的位置开始
+	store := NewMemoryOffsetStore()
+	if err := store.Save(topic, map[int32]int64{1: 10}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	mockConsumer := mocks.NewConsumer(t, nil)
+	mockConsumer.SetTopicMetadata(map[string][]int32{topic: {0, 1}})
+	p0 := mockConsumer.ExpectConsumePartition(topic, 0, sarama.OffsetOldest)
+	p1 := mockConsumer.ExpectConsumePartition(topic, 1, 10)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(3)
+	received := make(map[int32][]int64)
+	handler := HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		mu.Lock()
+		received[msg.Partition] = append(received[msg.Partition], msg.Offset)
+		mu.Unlock()
+		wg.Done()
+		return nil
+	})
+
+	o := newOptions([]Option{WithConfig(cfg), WithHandler(handler), WithOffsetStore(store)})
+	service := newTraditionalConsumer(topic, nil, mockConsumer, saramaConfig, o)
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	p0.YieldMessage(&sarama.ConsumerMessage{Value: []byte("a")})
+	p0.YieldMessage(&sarama.ConsumerMessage{Value: []byte("b")})
+	p1.YieldMessage(&sarama.ConsumerMessage{Value: []byte("c")})
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("等待消息处理超时")
+	}
+
+	// 停止时会把内存中记录的偏移量提交到存储
+	if err := service.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received[0]) != 2 || len(received[1]) != 1 || received[1][0] != 10 {
+		t.Errorf("收到的消息 = %v, 期望分区0两条、分区1从偏移量10开始", received)
+	}
+
+	offsets, err := store.Load(topic)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if offsets[0] != 2 || offsets[1] != 11 {
+		t.Errorf("提交的偏移量 = %v, 期望 map[0:2 1:11]", offsets)
+	}
+}
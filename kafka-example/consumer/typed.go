@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"context"
+	"kafka-example/envelope"
+
+	"github.com/IBM/sarama"
+)
+
+// Consumer 消费 T 类型消息的处理器
+// 从标准信封中解码消息内容后交给业务函数；类型或版本不兼容的消息返回 *envelope.IncompatibleError，
+// 该错误不会被重试中间件重试，配置了死信队列时直接转存
+type Consumer[T any] struct {
+	codec  envelope.Codec[T]
+	schema envelope.Schema
+	handle func(ctx context.Context, env envelope.Envelope[T]) error
+}
+
+// NewConsumer 创建类型化消费处理器，通过 WithHandler 接入消费者组服务或传统消费者服务
+// 参数:
+//   - codec: 消息内容的编解码器
+//   - schema: 期望的消息类型和兼容的版本范围
+//   - handle: 业务处理函数
+//
+// 返回:
+//   - *Consumer[T]: 实现 Handler 接口的处理器
+func NewConsumer[T any](codec envelope.Codec[T], schema envelope.Schema,
+	handle func(ctx context.Context, env envelope.Envelope[T]) error) *Consumer[T] {
+	return &Consumer[T]{
+		codec:  codec,
+		schema: schema,
+		handle: handle,
+	}
+}
+
+// Handle 解码信封后调用业务处理函数
+func (c *Consumer[T]) Handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	env, err := envelope.Decode(msg.Value, c.codec, c.schema)
+	if err != nil {
+		return Permanent(err)
+	}
+	return c.handle(ctx, env)
+}
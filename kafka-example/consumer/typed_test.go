@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"kafka-example/envelope"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+type testOrder struct {
+	ID string `json:"id"`
+}
+
+// TestConsumer_Handle 测试类型化处理器解码信封，并拒绝不兼容的版本
+func TestConsumer_Handle(t *testing.T) {
+	codec := envelope.JSONCodec[testOrder]{}
+	tests := []struct {
+		name             string
+		produced         envelope.Schema
+		wantHandled      bool
+		wantIncompatible bool
+	}{
+		{
+			name:        "兼容的版本",
+			produced:    envelope.Schema{Type: "order", Version: 2},
+			wantHandled: true,
+		},
+		{
+			name:             "不兼容的版本",
+			produced:         envelope.Schema{Type: "order", Version: 3},
+			wantIncompatible: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _, err := envelope.Encode(envelope.New(tt.produced, "test", testOrder{ID: "o-1"}), codec)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			handled := false
+			c := NewConsumer[testOrder](codec, envelope.Schema{Type: "order", Version: 2, MinVersion: 1},
+				func(_ context.Context, env envelope.Envelope[testOrder]) error {
+					handled = env.Payload.ID == "o-1"
+					return nil
+				})
+			// 经过重试中间件，不兼容的消息不应被重试
+			h := Chain(c, Retry(3, 0, 0))
+			err = h.Handle(context.Background(), &sarama.ConsumerMessage{Value: value})
+
+			if handled != tt.wantHandled {
+				t.Errorf("handled = %v, 期望 %v", handled, tt.wantHandled)
+			}
+			if errors.Is(err, envelope.ErrIncompatible) != tt.wantIncompatible {
+				t.Errorf("error = %v, 期望不兼容错误: %v", err, tt.wantIncompatible)
+			}
+			var retryErr *RetryError
+			if tt.wantIncompatible && (!errors.As(err, &retryErr) || retryErr.Attempts != 1) {
+				t.Errorf("error = %v, 期望只尝试1次", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package consumer
+
+import (
+	"context"
+	"hash/fnv"
+	"kafka-example/tracing"
+	"log"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// workerQueueSize 每个工作协程的待处理消息队列长度
+const workerQueueSize = 64
+
+// workerResult 工作协程处理一条消息的结果
+type workerResult struct {
+	msg  *sarama.ConsumerMessage
+	done bool // 是否处理完成（成功、转存死信或放弃），会话结束导致未处理时为false
+}
+
+// offsetTracker 记录分区内已分发消息的完成情况
+// 消息可能乱序完成，只有从最早未完成消息之前的连续前缀才能标记，保证崩溃后不会跳过未处理的消息
+type offsetTracker struct {
+	pending []*sarama.ConsumerMessage // 已分发但尚未标记的消息，按偏移量递增
+	done    map[int64]bool            // 已完成但因前面有未完成消息而无法标记的偏移量
+}
+
+// newOffsetTracker 创建偏移量跟踪器
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{done: make(map[int64]bool)}
+}
+
+// add 记录一条已分发的消息，必须按偏移量顺序调用
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) {
+	t.pending = append(t.pending, msg)
+}
+
+// complete 记录消息处理完成，并推进连续完成的前缀
+// 参数:
+//   - offset: 处理完成的消息偏移量
+//
+// 返回:
+//   - *sarama.ConsumerMessage: 连续完成前缀的最后一条消息，前缀没有推进时为nil
+//   - int: 前缀推进的消息数
+func (t *offsetTracker) complete(offset int64) (*sarama.ConsumerMessage, int) {
+	t.done[offset] = true
+	var last *sarama.ConsumerMessage
+	n := 0
+	for n < len(t.pending) && t.done[t.pending[n].Offset] {
+		last = t.pending[n]
+		delete(t.done, last.Offset)
+		n++
+	}
+	t.pending = t.pending[n:]
+	return last, n
+}
+
+// workerIndex 按消息键的哈希选择工作协程，相同键的消息总是分配给同一个工作协程
+// 没有键的消息之间没有顺序要求，按偏移量轮流分配
+func workerIndex(msg *sarama.ConsumerMessage, workers int) int {
+	if msg.Key == nil {
+		return int(msg.Offset % int64(workers))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(msg.Key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// consumeParallel 使用工作协程池并行消费分区认领中的消息
+// 消息按键分配给工作协程：相同键的消息按偏移量顺序处理，不同键的消息并行处理；
+// 只标记连续完成的偏移量前缀，会话结束时已分发未完成的消息会在下次分配时重新消费
+func (h consumerGroupHandler) consumeParallel(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := sess.Context()
+	c := newCommitter(sess, h.commit)
+	defer c.stop()
+
+	results := make(chan workerResult, h.workers)
+	queues := make([]chan *sarama.ConsumerMessage, h.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, workerQueueSize)
+		wg.Add(1)
+		go func(queue <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for msg := range queue {
+				results <- workerResult{msg: msg, done: h.processInWorker(ctx, msg)}
+			}
+		}(queues[i])
+	}
+
+	tracker := newOffsetTracker()
+	// 待处理消息包括已分发未完成的消息和认领消息通道中尚未分发的消息
+	bp := newBackpressure(h.throttle, h.pauser, claim.Topic(), claim.Partition())
+	defer bp.release()
+	complete := func(r workerResult) {
+		if !r.done {
+			return
+		}
+		if last, n := tracker.complete(r.msg.Offset); last != nil {
+			sess.MarkMessage(last, "")
+			c.marked(n)
+		}
+		bp.update(len(tracker.pending) + len(claim.Messages()))
+	}
+	// 退出时关闭队列，等待工作协程处理完已分发的消息并标记结果
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		for r := range results {
+			complete(r)
+		}
+	}()
+
+	log.Printf("[GroupConsumer] 分区 %d 使用 %d 个工作协程并行消费", claim.Partition(), h.workers)
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				log.Printf("[GroupConsumer] 分区 %d 的消息消费完成", claim.Partition())
+				return nil
+			}
+			tracker.add(msg)
+			bp.update(len(tracker.pending) + len(claim.Messages()))
+			queue := queues[workerIndex(msg, h.workers)]
+			// 队列已满时继续接收处理结果，避免与工作协程互相等待
+			for dispatched := false; !dispatched; {
+				select {
+				case queue <- msg:
+					dispatched = true
+				case r := <-results:
+					complete(r)
+				case <-ctx.Done():
+					log.Printf("[GroupConsumer] 会话已结束，停止消费分区 %d", claim.Partition())
+					return nil
+				}
+			}
+		case r := <-results:
+			complete(r)
+		case <-c.tick():
+			c.commit()
+		case <-ctx.Done():
+			log.Printf("[GroupConsumer] 会话已结束，停止消费分区 %d", claim.Partition())
+			return nil
+		}
+	}
+}
+
+// processInWorker 在工作协程中处理一条消息
+// 返回: 消息是否处理完成；会话已结束时跳过或放弃的消息返回false，不会被标记
+func (h consumerGroupHandler) processInWorker(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err := h.processMessage(ctx, msg); err != nil {
+		if ctx.Err() != nil {
+			log.Printf("[GroupConsumer] 会话已结束，放弃处理: topic=%s, partition=%d, offset=%d",
+				msg.Topic, msg.Partition, msg.Offset)
+			return false
+		}
+		log.Printf("[GroupConsumer] 处理消息失败: partition=%d, offset=%d, %s, error=%v",
+			msg.Partition, msg.Offset, tracing.Extract(msg.Headers), err)
+		// 与逐条消费一致，转存死信失败时重试直到成功，会话已结束时不标记
+		if !h.deadLetterUntilDone(ctx, msg, err) && ctx.Err() != nil {
+			return false
+		}
+	}
+	return true
+}
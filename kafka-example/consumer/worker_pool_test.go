@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"kafka-example/config"
+	"kafka-example/kafkatest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TestOffsetTracker_complete 测试乱序完成时只推进连续完成的偏移量前缀
+func TestOffsetTracker_complete(t *testing.T) {
+	tests := []struct {
+		name      string
+		completed []int64 // 依次完成的偏移量
+		wantLast  []int64 // 每次完成后前缀最后一条消息的偏移量，-1表示没有推进
+		wantN     []int
+	}{
+		{
+			name:      "按顺序完成",
+			completed: []int64{0, 1, 2},
+			wantLast:  []int64{0, 1, 2},
+			wantN:     []int{1, 1, 1},
+		},
+		{
+			name:      "后面的消息先完成",
+			completed: []int64{2, 1, 0, 3},
+			wantLast:  []int64{-1, -1, 2, 3},
+			wantN:     []int{0, 0, 3, 1},
+		},
+		{
+			name:      "中间有未完成的消息",
+			completed: []int64{0, 2, 3},
+			wantLast:  []int64{0, -1, -1},
+			wantN:     []int{1, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for i := int64(0); i < 4; i++ {
+				tracker.add(&sarama.ConsumerMessage{Offset: i})
+			}
+			for i, offset := range tt.completed {
+				last, n := tracker.complete(offset)
+				gotLast := int64(-1)
+				if last != nil {
+					gotLast = last.Offset
+				}
+				if gotLast != tt.wantLast[i] || n != tt.wantN[i] {
+					t.Errorf("complete(%d) = (%d, %d), 期望 (%d, %d)", offset, gotLast, n, tt.wantLast[i], tt.wantN[i])
+				}
+			}
+		})
+	}
+}
+
+// TestGroupConsumerService_ParallelWorkers 测试相同键的消息按顺序处理、不同键的消息并行处理，
+// 并且只提交连续完成的偏移量前缀
+func TestGroupConsumerService_ParallelWorkers(t *testing.T) {
+	const workers = 4
+	slowKey := "slow"
+	// 选出与 slowKey 分配到不同工作协程的键
+	var fastKeys []string
+	for i := 0; len(fastKeys) < 3; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if workerIndex(&sarama.ConsumerMessage{Key: []byte(key)}, workers) != workerIndex(&sarama.ConsumerMessage{Key: []byte(slowKey)}, workers) {
+			fastKeys = append(fastKeys, key)
+		}
+	}
+
+	broker := kafkatest.NewBroker("test-topic", 0)
+	group := broker.NewConsumerGroup()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	order := make(map[string][]string)
+	var processed atomic.Int32
+	handler := HandlerFunc(func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		if string(msg.Value) == "slow-1" {
+			<-release
+		}
+		mu.Lock()
+		order[string(msg.Key)] = append(order[string(msg.Key)], string(msg.Value))
+		mu.Unlock()
+		processed.Add(1)
+		return nil
+	})
+
+	service := newGroupConsumer(group, []string{"test-topic"}, nil, newOptions([]Option{
+		WithHandler(handler),
+		WithMiddleware(),
+		WithCommit(config.CommitConfig{Mode: config.CommitModeMessage}),
+		WithWorkers(workers),
+	}))
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = service.Stop() }()
+
+	broker.ProduceKey(0, slowKey, "slow-1")
+	for i, key := range fastKeys {
+		broker.ProduceKey(0, key, fmt.Sprintf("%s-1", key))
+		broker.ProduceKey(0, key, fmt.Sprintf("%s-2", key))
+		if i == 0 {
+			broker.ProduceKey(0, slowKey, "slow-2")
+		}
+	}
+
+	// slowKey 的第一条消息阻塞时，其他键的消息仍然被处理
+	waitFor(t, time.Second, func() bool { return processed.Load() == int32(2*len(fastKeys)) })
+	mu.Lock()
+	slowDone := len(order[slowKey])
+	mu.Unlock()
+	if slowDone != 0 {
+		t.Errorf("slowKey 的第一条消息阻塞时已处理 %d 条同键消息, 期望 0", slowDone)
+	}
+	if committed, _ := broker.Committed(); committed[0] != 0 {
+		t.Errorf("最早的消息未完成时提交的偏移量 = %d, 期望 0", committed[0])
+	}
+
+	close(release)
+	total := int64(2*len(fastKeys) + 2)
+	waitFor(t, time.Second, func() bool {
+		committed, _ := broker.Committed()
+		return committed[0] == total
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"slow-1", "slow-2"}; !reflect.DeepEqual(order[slowKey], want) {
+		t.Errorf("slowKey 的处理顺序 = %v, 期望 %v", order[slowKey], want)
+	}
+	for _, key := range fastKeys {
+		if want := []string{key + "-1", key + "-2"}; !reflect.DeepEqual(order[key], want) {
+			t.Errorf("%s 的处理顺序 = %v, 期望 %v", key, order[key], want)
+		}
+	}
+}
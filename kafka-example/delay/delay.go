@@ -0,0 +1,378 @@
+package delay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kafka-example/common"
+	"kafka-example/config"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 延迟消息头，记录消息的目标主题和投递时间
+const (
+	HeaderTargetTopic = "delay-target-topic" // 到期后发布到的目标主题
+	HeaderDeliverAt   = "delay-deliver-at"   // 投递时间，Unix毫秒
+	HeaderDueAt       = "delay-due-at"       // 在当前级别主题中的到期时间，Unix毫秒
+
+	logPrefix = "[Delay] "
+
+	forwardRetryBackoff = time.Second // 转发失败后重试的等待时间
+)
+
+// LevelTopic 返回延迟级别对应的主题，如 kafka-example-delay-10s
+func LevelTopic(prefix string, level time.Duration) string {
+	return prefix + "-" + levelName(level)
+}
+
+// levelName 返回延迟级别的简短名称：整小时、整分钟、整秒分别用 h、m、s，其余用毫秒
+func levelName(level time.Duration) string {
+	switch {
+	case level%time.Hour == 0:
+		return strconv.FormatInt(int64(level/time.Hour), 10) + "h"
+	case level%time.Minute == 0:
+		return strconv.FormatInt(int64(level/time.Minute), 10) + "m"
+	case level%time.Second == 0:
+		return strconv.FormatInt(int64(level/time.Second), 10) + "s"
+	default:
+		return strconv.FormatInt(level.Milliseconds(), 10) + "ms"
+	}
+}
+
+// chooseLevel 选择不超过剩余延迟的最大级别，剩余延迟小于最小级别时选择最小级别
+// levels 必须递增
+func chooseLevel(levels []time.Duration, remaining time.Duration) time.Duration {
+	level := levels[0]
+	for _, l := range levels[1:] {
+		if l > remaining {
+			break
+		}
+		level = l
+	}
+	return level
+}
+
+// pauser 暂停和恢复分区拉取，sarama.ConsumerGroup 实现了该接口
+type pauser interface {
+	Pause(partitions map[string][]int32)
+	Resume(partitions map[string][]int32)
+}
+
+// Service 延迟队列
+// 延迟消息按剩余延迟写入固定延迟级别的主题；同一级别主题中消息的到期时间基本按偏移量递增，
+// 转发器消费级别主题，队首消息未到期时暂停该分区直到到期，然后发布到目标主题。
+// 延迟超过最大级别的消息会经过多个级别，每一跳按剩余延迟重新选择级别
+type Service struct {
+	runner   *common.GroupRunner // 消费级别主题的消费循环
+	producer sarama.SyncProducer // 写入级别主题和目标主题的生产者
+	router   *router             // 延迟级别路由
+	topics   []string            // 所有级别主题
+
+	stopOnce sync.Once // 确保只停止一次
+	stopErr  error     // Stop的结果
+}
+
+// router 根据剩余延迟选择级别主题并设置延迟消息头
+type router struct {
+	prefix string
+	levels []time.Duration
+	now    func() time.Time
+}
+
+// forwardHandler 实现 sarama.ConsumerGroupHandler 接口
+// 逐条转发到期的消息，转发成功后才标记偏移量
+type forwardHandler struct {
+	producer sarama.SyncProducer
+	router   *router
+	pauser   pauser
+}
+
+// NewService 创建延迟队列
+// 参数:
+//   - cfg: Kafka配置，使用其中的 Delay 配置
+//
+// 返回:
+//   - *Service: 延迟队列实例
+//   - error: 创建失败时返回错误
+func NewService(cfg *config.Config) (*Service, error) {
+	d := cfg.Delay
+	log.Printf("%s正在创建延迟队列: topic_prefix=%s, levels=%v, group=%s", logPrefix, d.TopicPrefix, d.Levels, d.GroupID)
+
+	saramaConfig, err := cfg.DelaySaramaConfig()
+	if err != nil {
+		return nil, fmt.Errorf("延迟队列配置不合法: %w", err)
+	}
+
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建生产者失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建生产者失败: %w", err)
+	}
+	group, err := sarama.NewConsumerGroup(cfg.Brokers, d.GroupID, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建消费者组失败: %v", logPrefix, err)
+		_ = producer.Close()
+		return nil, fmt.Errorf("创建消费者组失败: %w", err)
+	}
+
+	log.Printf("%s延迟队列创建成功", logPrefix)
+	return newService(group, producer, d), nil
+}
+
+// newService 使用已创建的消费者组和生产者组装延迟队列
+func newService(group sarama.ConsumerGroup, producer sarama.SyncProducer, d config.DelayConfig) *Service {
+	r := &router{prefix: d.TopicPrefix, levels: d.Levels, now: time.Now}
+	topics := make([]string, len(d.Levels))
+	for i, level := range d.Levels {
+		topics[i] = LevelTopic(d.TopicPrefix, level)
+	}
+	handler := &forwardHandler{producer: producer, router: r, pauser: group}
+	return &Service{
+		runner:   common.NewGroupRunner(group, topics, handler, logPrefix),
+		producer: producer,
+		router:   r,
+		topics:   topics,
+	}
+}
+
+// Topics 返回所有级别主题
+func (s *Service) Topics() []string {
+	return append([]string(nil), s.topics...)
+}
+
+// SendDelayed 发送延迟消息，消息在延迟到期后发布到 msg.Topic
+// 消息键、内容和消息头保持不变；delay 不大于0时直接发送到目标主题
+// 参数:
+//   - msg: 要发送的消息，Topic 为目标主题
+//   - delay: 延迟时间
+//
+// 返回:
+//   - int32: 写入的分区
+//   - int64: 写入的偏移量
+//   - error: 发送失败时返回错误
+func (s *Service) SendDelayed(msg *sarama.ProducerMessage, delay time.Duration) (int32, int64, error) {
+	if msg.Topic == "" {
+		return 0, 0, errors.New("延迟消息的目标主题不能为空")
+	}
+	target := msg.Topic
+	if delay > 0 {
+		s.router.route(msg, target, s.router.now().Add(delay))
+	}
+
+	partition, offset, err := s.producer.SendMessage(msg)
+	if err != nil {
+		log.Printf("%s发送延迟消息失败: target=%s, delay=%v, error=%v", logPrefix, target, delay, err)
+		return 0, 0, fmt.Errorf("发送延迟消息失败: %w", err)
+	}
+	log.Printf("%s延迟消息发送成功: target=%s, delay=%v, %s/%d/%d", logPrefix, target, delay, msg.Topic, partition, offset)
+	return partition, offset, nil
+}
+
+// route 将消息改写为发往级别主题的延迟消息
+// 在级别主题中的到期时间不晚于投递时间，剩余延迟小于最小级别的消息在投递时间准时到期
+func (r *router) route(msg *sarama.ProducerMessage, target string, deliverAt time.Time) {
+	now := r.now()
+	level := chooseLevel(r.levels, deliverAt.Sub(now))
+	dueAt := now.Add(level)
+	if dueAt.After(deliverAt) {
+		dueAt = deliverAt
+	}
+
+	msg.Topic = LevelTopic(r.prefix, level)
+	msg.Headers = append(withoutDelayHeaders(msg.Headers),
+		sarama.RecordHeader{Key: []byte(HeaderTargetTopic), Value: []byte(target)},
+		sarama.RecordHeader{Key: []byte(HeaderDeliverAt), Value: []byte(formatMillis(deliverAt))},
+		sarama.RecordHeader{Key: []byte(HeaderDueAt), Value: []byte(formatMillis(dueAt))},
+	)
+}
+
+// Setup 在消费者组会话开始前调用
+func (*forwardHandler) Setup(_ sarama.ConsumerGroupSession) error {
+	log.Printf("%s消费者组会话开始", logPrefix)
+	return nil
+}
+
+// Cleanup 在消费者组会话结束后调用
+func (*forwardHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
+	log.Printf("%s消费者组会话结束", logPrefix)
+	return nil
+}
+
+// ConsumeClaim 按偏移量顺序转发级别主题分区中的消息
+// 队首消息未到期时暂停拉取该分区，避免在等待期间缓存大量消息；到期后恢复拉取并转发。
+// 转发失败时等待后重试，不跳过消息，保证延迟消息至少投递一次
+func (h *forwardHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	log.Printf("%s开始转发分区 %s/%d 的延迟消息", logPrefix, claim.Topic(), claim.Partition())
+	ctx := sess.Context()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				log.Printf("%s分区 %s/%d 的消息消费完成", logPrefix, claim.Topic(), claim.Partition())
+				return nil
+			}
+			if !h.waitUntilDue(ctx, msg) {
+				return nil
+			}
+			for {
+				err := h.forward(msg)
+				if err == nil {
+					break
+				}
+				log.Printf("%s转发延迟消息失败，%v 后重试: %s/%d/%d, error=%v",
+					logPrefix, forwardRetryBackoff, msg.Topic, msg.Partition, msg.Offset, err)
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(forwardRetryBackoff):
+				}
+			}
+			sess.MarkMessage(msg, "")
+		case <-ctx.Done():
+			log.Printf("%s会话已结束，停止转发分区 %s/%d", logPrefix, claim.Topic(), claim.Partition())
+			return nil
+		}
+	}
+}
+
+// waitUntilDue 等待消息到期，等待期间暂停拉取消息所在的分区
+// 返回: 消息是否已到期；会话结束时返回false
+func (h *forwardHandler) waitUntilDue(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	wait := dueAt(msg).Sub(h.router.now())
+	if wait <= 0 {
+		return true
+	}
+
+	partitions := map[string][]int32{msg.Topic: {msg.Partition}}
+	h.pauser.Pause(partitions)
+	defer h.pauser.Resume(partitions)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// forward 将到期的消息发布到目标主题；投递时间未到时按剩余延迟发布到下一个级别主题
+// 缺少目标主题的消息无法投递，记录日志后丢弃
+func (h *forwardHandler) forward(msg *sarama.ConsumerMessage) error {
+	target := header(msg.Headers, HeaderTargetTopic)
+	if target == "" {
+		log.Printf("%s延迟消息缺少目标主题，丢弃: %s/%d/%d", logPrefix, msg.Topic, msg.Partition, msg.Offset)
+		return nil
+	}
+	deliverAt, _ := parseMillis(header(msg.Headers, HeaderDeliverAt))
+
+	out := &sarama.ProducerMessage{Topic: target, Value: sarama.ByteEncoder(msg.Value)}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, rh := range msg.Headers {
+		if rh != nil {
+			out.Headers = append(out.Headers, sarama.RecordHeader{Key: rh.Key, Value: rh.Value})
+		}
+	}
+	if deliverAt.After(h.router.now()) {
+		h.router.route(out, target, deliverAt)
+	} else {
+		out.Headers = withoutDelayHeaders(out.Headers)
+	}
+
+	partition, offset, err := h.producer.SendMessage(out)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s延迟消息已转发: %s/%d/%d -> %s/%d/%d",
+		logPrefix, msg.Topic, msg.Partition, msg.Offset, out.Topic, partition, offset)
+	return nil
+}
+
+// Start 启动转发器
+// ctx: 上下文，用于控制转发器的生命周期，取消后消费循环退出
+func (s *Service) Start(ctx context.Context) error {
+	log.Printf("%s正在启动延迟消息转发器: topics=%v", logPrefix, s.topics)
+	if err := s.runner.Start(ctx); err != nil {
+		return fmt.Errorf("延迟消息转发器已启动: %w", err)
+	}
+	log.Printf("%s延迟消息转发器启动成功", logPrefix)
+	return nil
+}
+
+// Stop 停止转发器
+// 取消消费循环，关闭消费者组后再关闭生产者
+func (s *Service) Stop() error {
+	s.stopOnce.Do(func() {
+		log.Printf("%s正在停止延迟队列...", logPrefix)
+		var errs []error
+		if err := s.runner.Stop(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := s.producer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("关闭生产者失败: %w", err))
+		}
+		s.stopErr = errors.Join(errs...)
+
+		if s.stopErr != nil {
+			log.Printf("%s停止延迟队列失败: %v", logPrefix, s.stopErr)
+		} else {
+			log.Printf("%s延迟队列已停止", logPrefix)
+		}
+	})
+	return s.stopErr
+}
+
+// dueAt 返回消息在当前级别主题中的到期时间，没有到期时间时使用投递时间
+func dueAt(msg *sarama.ConsumerMessage) time.Time {
+	if t, ok := parseMillis(header(msg.Headers, HeaderDueAt)); ok {
+		return t
+	}
+	t, _ := parseMillis(header(msg.Headers, HeaderDeliverAt))
+	return t
+}
+
+// header 返回指定消息头的值，不存在时返回空字符串
+func header(headers []*sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// withoutDelayHeaders 返回去掉延迟消息头后的消息头，业务中以 delay- 开头的其他消息头保留
+func withoutDelayHeaders(headers []sarama.RecordHeader) []sarama.RecordHeader {
+	kept := make([]sarama.RecordHeader, 0, len(headers))
+	for _, h := range headers {
+		switch string(h.Key) {
+		case HeaderTargetTopic, HeaderDeliverAt, HeaderDueAt:
+		default:
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+// formatMillis 将时间格式化为Unix毫秒
+func formatMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// parseMillis 解析Unix毫秒，格式不合法时返回零值和false
+func parseMillis(s string) (time.Time, bool) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
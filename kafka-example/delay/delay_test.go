@@ -0,0 +1,230 @@
+package delay
+
+import (
+	"context"
+	"errors"
+	"kafka-example/config"
+	"kafka-example/kafkatest"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+var testLevels = []time.Duration{time.Second, 10 * time.Second, time.Minute, 10 * time.Minute}
+
+func newTestProducer(t *testing.T) *mocks.SyncProducer {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	return mocks.NewSyncProducer(t, cfg)
+}
+
+// TestLevelTopic 测试级别主题命名
+func TestLevelTopic(t *testing.T) {
+	tests := []struct {
+		level time.Duration
+		want  string
+	}{
+		{level: 500 * time.Millisecond, want: "d-500ms"},
+		{level: 10 * time.Second, want: "d-10s"},
+		{level: 90 * time.Second, want: "d-90s"},
+		{level: 10 * time.Minute, want: "d-10m"},
+		{level: 2 * time.Hour, want: "d-2h"},
+	}
+	for _, tt := range tests {
+		if got := LevelTopic("d", tt.level); got != tt.want {
+			t.Errorf("LevelTopic(%v) = %s, 期望 %s", tt.level, got, tt.want)
+		}
+	}
+}
+
+// TestRouter_route 测试按剩余延迟选择级别主题和到期时间
+func TestRouter_route(t *testing.T) {
+	now := time.UnixMilli(1_000_000)
+	r := &router{prefix: "d", levels: testLevels, now: func() time.Time { return now }}
+
+	tests := []struct {
+		name      string
+		delay     time.Duration
+		wantTopic string
+		wantDue   time.Duration // 到期时间相对当前时间的延迟
+	}{
+		{name: "小于最小级别时在投递时间到期", delay: 300 * time.Millisecond, wantTopic: "d-1s", wantDue: 300 * time.Millisecond},
+		{name: "选择不超过延迟的最大级别", delay: 45 * time.Second, wantTopic: "d-10s", wantDue: 10 * time.Second},
+		{name: "恰好等于级别", delay: time.Minute, wantTopic: "d-1m", wantDue: time.Minute},
+		{name: "超过最大级别", delay: time.Hour, wantTopic: "d-10m", wantDue: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &sarama.ProducerMessage{
+				Topic:   "orders",
+				Headers: []sarama.RecordHeader{{Key: []byte("app"), Value: []byte("x")}},
+			}
+			r.route(msg, "orders", now.Add(tt.delay))
+
+			if msg.Topic != tt.wantTopic {
+				t.Errorf("Topic = %s, 期望 %s", msg.Topic, tt.wantTopic)
+			}
+			headers := consumerHeaders(msg.Headers)
+			if got := header(headers, HeaderTargetTopic); got != "orders" {
+				t.Errorf("目标主题 = %s, 期望 orders", got)
+			}
+			if got := dueAt(&sarama.ConsumerMessage{Headers: headers}); !got.Equal(now.Add(tt.wantDue)) {
+				t.Errorf("到期时间 = %v, 期望 %v", got, now.Add(tt.wantDue))
+			}
+			if header(headers, "app") != "x" {
+				t.Errorf("原有的消息头应保留: %v", msg.Headers)
+			}
+		})
+	}
+}
+
+// TestService_SendDelayed 测试延迟消息写入级别主题，不延迟的消息直接写入目标主题
+func TestService_SendDelayed(t *testing.T) {
+	producer := newTestProducer(t)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checkTopic("d-10s"))
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checkTopic("orders"))
+	s := newService(kafkatest.NewBroker("d-1s", 0).NewConsumerGroup(), producer,
+		config.DelayConfig{TopicPrefix: "d", Levels: testLevels, GroupID: "g"})
+
+	if _, _, err := s.SendDelayed(&sarama.ProducerMessage{Topic: "orders"}, 15*time.Second); err != nil {
+		t.Fatalf("SendDelayed() error = %v", err)
+	}
+	if _, _, err := s.SendDelayed(&sarama.ProducerMessage{Topic: "orders"}, 0); err != nil {
+		t.Fatalf("SendDelayed() error = %v", err)
+	}
+	if _, _, err := s.SendDelayed(&sarama.ProducerMessage{}, time.Second); err == nil {
+		t.Error("目标主题为空时应返回错误")
+	}
+	if len(s.Topics()) != len(testLevels) {
+		t.Errorf("Topics() = %v", s.Topics())
+	}
+	if err := producer.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestForwardHandler_ConsumeClaim 测试到期消息转发到目标主题，未到期时暂停分区，投递时间未到时转发到下一个级别
+func TestForwardHandler_ConsumeClaim(t *testing.T) {
+	now := time.Now()
+	broker := kafkatest.NewBroker("d-1s", 0)
+	broker.ProduceMessage(0, delayedMessage(now.Add(-time.Second), now.Add(-time.Second)))
+	broker.ProduceMessage(0, delayedMessage(now.Add(30*time.Millisecond), now.Add(30*time.Millisecond)))
+	broker.ProduceMessage(0, delayedMessage(now.Add(-time.Second), now.Add(time.Hour)))
+
+	forwarded := make(chan struct{})
+	producer := newTestProducer(t)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checkDelivered)
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checkDelivered)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		defer close(forwarded)
+		return checkTopic("d-10m")(msg)
+	})
+
+	group := broker.NewConsumerGroup()
+	h := &forwardHandler{
+		producer: producer,
+		router:   &router{prefix: "d", levels: testLevels, now: time.Now},
+		pauser:   group,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sess, claim := broker.Claim(ctx, 0)
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- h.ConsumeClaim(sess, claim) }()
+	select {
+	case <-forwarded:
+	case <-time.After(3 * time.Second):
+		t.Fatal("等待转发完成超时")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < forwardRetryBackoff {
+		t.Errorf("转发失败后应等待重试, elapsed = %v", elapsed)
+	}
+	sess.Commit()
+	if committed, _ := broker.Committed(); committed[0] != 3 {
+		t.Errorf("提交的偏移量 = %d, 期望 3", committed[0])
+	}
+	if pauses, resumes := group.PauseCounts(); pauses != 1 || resumes != 1 {
+		t.Errorf("暂停 %d 次、恢复 %d 次, 期望各 1 次", pauses, resumes)
+	}
+	if err := producer.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestService_Stop 测试停止延迟队列时关闭消费者组和生产者
+func TestService_Stop(t *testing.T) {
+	producer := newTestProducer(t)
+	group := kafkatest.NewBroker("d-1s", 0).NewConsumerGroup()
+	s := newService(group, producer, config.DelayConfig{TopicPrefix: "d", Levels: testLevels, GroupID: "g"})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := s.Start(context.Background()); err == nil {
+		t.Error("重复启动应返回错误")
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if !group.Closed() {
+		t.Error("消费者组未关闭")
+	}
+}
+
+// delayedMessage 创建级别主题中的延迟消息，主题、分区和偏移量由broker设置
+func delayedMessage(due, deliverAt time.Time) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Value: []byte("v"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderTargetTopic), Value: []byte("orders")},
+			{Key: []byte(HeaderDeliverAt), Value: []byte(formatMillis(deliverAt))},
+			{Key: []byte(HeaderDueAt), Value: []byte(formatMillis(due))},
+			{Key: []byte("app"), Value: []byte("x")},
+			{Key: []byte("delay-reason"), Value: []byte("retry")},
+		},
+	}
+}
+
+// consumerHeaders 将生产者消息头转换为消费者消息头
+func consumerHeaders(headers []sarama.RecordHeader) []*sarama.RecordHeader {
+	result := make([]*sarama.RecordHeader, len(headers))
+	for i := range headers {
+		result[i] = &headers[i]
+	}
+	return result
+}
+
+func checkTopic(want string) mocks.MessageChecker {
+	return func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != want {
+			return errors.New("主题 " + msg.Topic + " 不等于 " + want)
+		}
+		return nil
+	}
+}
+
+// checkDelivered 检查消息投递到目标主题，去掉了延迟消息头并保留业务消息头
+func checkDelivered(msg *sarama.ProducerMessage) error {
+	if msg.Topic != "orders" {
+		return errors.New("主题 " + msg.Topic + " 不等于 orders")
+	}
+	headers := consumerHeaders(msg.Headers)
+	for _, key := range []string{HeaderTargetTopic, HeaderDeliverAt, HeaderDueAt} {
+		if header(headers, key) != "" {
+			return errors.New("投递的消息不应包含延迟消息头: " + key)
+		}
+	}
+	if header(headers, "app") != "x" || header(headers, "delay-reason") != "retry" {
+		return errors.New("业务消息头丢失")
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+package dlq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"kafka-example/config"
+	"kafka-example/producer"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 死信消息头，记录消息的来源和失败原因
+const (
+	TopicSuffix = ".dlq" // 死信主题后缀
+
+	HeaderOriginalTopic     = "dlq-original-topic"     // 原始主题
+	HeaderOriginalPartition = "dlq-original-partition" // 原始分区
+	HeaderOriginalOffset    = "dlq-original-offset"    // 原始偏移量
+	HeaderError             = "dlq-error"              // 处理失败的错误信息
+	HeaderAttempts          = "dlq-attempts"           // 处理尝试次数
+	HeaderTimestamp         = "dlq-timestamp"          // 进入死信队列的时间
+
+	logPrefix = "[DLQ] "
+
+	fetchTimeout = 3 * time.Second // 读取死信消息时等待新消息的超时时间
+
+	MaxReplayMessages = 1000 // 单次重放的最大消息数
+)
+
+// ErrReplayRangeTooLarge 重放的偏移量范围超过 MaxReplayMessages
+var ErrReplayRangeTooLarge = fmt.Errorf("重放范围过大，单次最多重放 %d 条消息", MaxReplayMessages)
+
+// Topic 返回源主题对应的死信主题
+// 已经是死信主题时原样返回
+func Topic(source string) string {
+	if strings.HasSuffix(source, TopicSuffix) {
+		return source
+	}
+	return source + TopicSuffix
+}
+
+// Message 表示一条死信消息
+type Message struct {
+	Topic             string            `json:"topic"`              // 死信主题
+	Partition         int32             `json:"partition"`          // 死信分区
+	Offset            int64             `json:"offset"`             // 死信偏移量
+	OriginalTopic     string            `json:"original_topic"`     // 原始主题
+	OriginalPartition int32             `json:"original_partition"` // 原始分区
+	OriginalOffset    int64             `json:"original_offset"`    // 原始偏移量
+	Error             string            `json:"error"`              // 失败原因
+	Attempts          int               `json:"attempts"`           // 处理尝试次数
+	FailedAt          time.Time         `json:"failed_at"`          // 进入死信队列的时间
+	Key               string            `json:"key"`                // 消息键
+	Value             string            `json:"value"`              // 消息内容
+	Headers           map[string]string `json:"headers"`            // 原始消息头
+}
+
+// Service 死信队列服务
+// 负责发布死信消息、查询死信消息以及将死信消息重放回源主题
+type Service struct {
+	client   sarama.Client       // Kafka客户端，用于查询偏移量和分区
+	producer sarama.SyncProducer // 同步生产者，用于发布和重放消息
+	consumer sarama.Consumer     // 消费者，用于读取死信消息
+}
+
+// NewService 创建死信队列服务
+// 参数:
+//   - cfg: Kafka配置
+//
+// 返回:
+//   - *Service: 死信队列服务实例
+//   - error: 创建失败时返回错误
+func NewService(cfg *config.Config) (*Service, error) {
+	log.Printf("%s正在创建死信队列服务: brokers=%v", logPrefix, cfg.Brokers)
+
+	saramaConfig, err := cfg.ProducerSaramaConfig()
+	if err != nil {
+		return nil, fmt.Errorf("死信队列配置不合法: %w", err)
+	}
+	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Consumer.Return.Errors = true
+
+	client, err := sarama.NewClient(cfg.Brokers, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建客户端失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建客户端失败: %w", err)
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		log.Printf("%s创建生产者失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建生产者失败: %w", err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		_ = producer.Close()
+		_ = client.Close()
+		log.Printf("%s创建消费者失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建消费者失败: %w", err)
+	}
+
+	log.Printf("%s死信队列服务创建成功", logPrefix)
+	return &Service{
+		client:   client,
+		producer: producer,
+		consumer: consumer,
+	}, nil
+}
+
+// Publish 将处理失败的消息发布到死信主题
+// 参数:
+//   - msg: 处理失败的原始消息
+//   - cause: 失败原因
+//   - attempts: 已尝试处理的次数
+//
+// 返回:
+//   - error: 发布失败时返回错误
+func (s *Service) Publish(msg *sarama.ConsumerMessage, cause error, attempts int) error {
+	dlqMsg := NewMessage(msg, cause, attempts)
+
+	partition, offset, err := s.producer.SendMessage(dlqMsg)
+	if err != nil {
+		log.Printf("%s发布死信消息失败: topic=%s, partition=%d, offset=%d, error=%v",
+			logPrefix, msg.Topic, msg.Partition, msg.Offset, err)
+		return fmt.Errorf("发布死信消息失败: %w", err)
+	}
+
+	log.Printf("%s死信消息发布成功: %s/%d/%d -> %s/%d/%d",
+		logPrefix, msg.Topic, msg.Partition, msg.Offset, dlqMsg.Topic, partition, offset)
+	return nil
+}
+
+// Spill 将生产者最终发送失败的消息发布到死信主题
+// 实现异步生产者的 FailureSink 接口；消息从未写入源主题，原始分区和偏移量记为-1
+// 参数:
+//   - msg: 发送失败的消息
+//   - cause: 失败原因
+//
+// 返回:
+//   - error: 发布失败时返回错误
+func (s *Service) Spill(msg *sarama.ProducerMessage, cause error) error {
+	dlqMsg := producerDeadLetterMessage(msg, cause, time.Now())
+
+	partition, offset, err := s.producer.SendMessage(dlqMsg)
+	if err != nil {
+		log.Printf("%s发布发送失败的消息失败: topic=%s, error=%v", logPrefix, msg.Topic, err)
+		return fmt.Errorf("发布死信消息失败: %w", err)
+	}
+
+	log.Printf("%s发送失败的消息已发布到死信主题: %s -> %s/%d/%d",
+		logPrefix, msg.Topic, dlqMsg.Topic, partition, offset)
+	return nil
+}
+
+// List 查询死信消息
+// 参数:
+//   - topic: 源主题或死信主题
+//   - partition: 死信分区，小于0时查询所有分区
+//   - offset: 起始偏移量，小于0时从最早的消息开始
+//   - limit: 最多返回的消息数
+//
+// 返回:
+//   - []Message: 死信消息列表
+//   - error: 查询失败时返回错误
+func (s *Service) List(topic string, partition int32, offset int64, limit int) ([]Message, error) {
+	dlqTopic := Topic(topic)
+
+	partitions, err := s.partitions(dlqTopic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0)
+	for _, p := range partitions {
+		if len(messages) >= limit {
+			break
+		}
+		consumed, err := s.fetch(dlqTopic, p, offset, -1, limit-len(messages))
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range consumed {
+			messages = append(messages, parseMessage(msg))
+		}
+	}
+	return messages, nil
+}
+
+// Replay 将死信分区中指定偏移量范围内的消息重放回源主题
+// 偏移量范围先截断到分区现有的消息，截断后超过 MaxReplayMessages 条时不重放
+// 参数:
+//   - topic: 源主题或死信主题
+//   - partition: 死信分区
+//   - startOffset: 起始偏移量（包含）
+//   - endOffset: 结束偏移量（包含），小于startOffset时只重放startOffset一条
+//
+// 返回:
+//   - []Message: 已重放的死信消息
+//   - error: 范围过大时返回 ErrReplayRangeTooLarge，重放失败时返回错误，已重放的消息仍会返回
+func (s *Service) Replay(topic string, partition int32, startOffset, endOffset int64) ([]Message, error) {
+	dlqTopic := Topic(topic)
+	if endOffset < startOffset {
+		endOffset = startOffset
+	}
+
+	oldest, newest, err := s.offsets(dlqTopic, partition)
+	if err != nil {
+		return nil, err
+	}
+	requestedStart, requestedEnd := startOffset, endOffset
+	startOffset = max(startOffset, oldest)
+	endOffset = min(endOffset, newest-1)
+	if startOffset > endOffset {
+		return nil, fmt.Errorf("未找到死信消息: topic=%s, partition=%d, offset=%d-%d",
+			dlqTopic, partition, requestedStart, requestedEnd)
+	}
+	if endOffset-startOffset+1 > MaxReplayMessages {
+		return nil, fmt.Errorf("%w: topic=%s, partition=%d, offset=%d-%d",
+			ErrReplayRangeTooLarge, dlqTopic, partition, startOffset, endOffset)
+	}
+
+	consumed, err := s.read(dlqTopic, partition, startOffset, endOffset, int(endOffset-startOffset+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(consumed) == 0 {
+		return nil, fmt.Errorf("未找到死信消息: topic=%s, partition=%d, offset=%d-%d",
+			dlqTopic, partition, startOffset, endOffset)
+	}
+
+	replayed := make([]Message, 0, len(consumed))
+	for _, msg := range consumed {
+		replay := replayMessage(msg)
+		if _, _, err := s.producer.SendMessage(replay); err != nil {
+			log.Printf("%s重放死信消息失败: %s/%d/%d -> %s, error=%v",
+				logPrefix, msg.Topic, msg.Partition, msg.Offset, replay.Topic, err)
+			return replayed, fmt.Errorf("重放死信消息失败: offset=%d, %w", msg.Offset, err)
+		}
+		log.Printf("%s死信消息重放成功: %s/%d/%d -> %s",
+			logPrefix, msg.Topic, msg.Partition, msg.Offset, replay.Topic)
+		replayed = append(replayed, parseMessage(msg))
+	}
+	return replayed, nil
+}
+
+// Close 关闭死信队列服务
+func (s *Service) Close() error {
+	log.Printf("%s正在关闭死信队列服务", logPrefix)
+	var errs []error
+	if err := s.consumer.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.producer.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.client.Close(); err != nil && !errors.Is(err, sarama.ErrClosedClient) {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// partitions 返回需要查询的分区列表
+func (s *Service) partitions(topic string, partition int32) ([]int32, error) {
+	if partition >= 0 {
+		return []int32{partition}, nil
+	}
+	partitions, err := s.client.Partitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("获取死信主题分区失败: %w", err)
+	}
+	return partitions, nil
+}
+
+// fetch 读取分区中指定偏移量范围内的消息
+// endOffset小于0时读取到分区末尾
+func (s *Service) fetch(topic string, partition int32, startOffset, endOffset int64, limit int) ([]*sarama.ConsumerMessage, error) {
+	oldest, newest, err := s.offsets(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	if startOffset < oldest {
+		startOffset = oldest
+	}
+	if endOffset < 0 || endOffset >= newest {
+		endOffset = newest - 1
+	}
+	return s.read(topic, partition, startOffset, endOffset, limit)
+}
+
+// offsets 返回分区最早的偏移量和下一条消息的偏移量
+func (s *Service) offsets(topic string, partition int32) (oldest, newest int64, err error) {
+	oldest, err = s.client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("获取最早偏移量失败: %w", err)
+	}
+	newest, err = s.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("获取最新偏移量失败: %w", err)
+	}
+	return oldest, newest, nil
+}
+
+// read 读取分区中 [startOffset, endOffset] 范围内最多 limit 条消息，偏移量应在分区现有的范围内
+func (s *Service) read(topic string, partition int32, startOffset, endOffset int64, limit int) ([]*sarama.ConsumerMessage, error) {
+	if startOffset > endOffset || limit <= 0 {
+		return nil, nil
+	}
+
+	pc, err := s.consumer.ConsumePartition(topic, partition, startOffset)
+	if err != nil {
+		return nil, fmt.Errorf("读取死信分区失败: %w", err)
+	}
+	defer func() {
+		if err := pc.Close(); err != nil {
+			log.Printf("%s关闭分区消费者失败: %v", logPrefix, err)
+		}
+	}()
+
+	messages := make([]*sarama.ConsumerMessage, 0)
+	timer := time.NewTimer(fetchTimeout)
+	defer timer.Stop()
+	for len(messages) < limit {
+		select {
+		case msg := <-pc.Messages():
+			messages = append(messages, msg)
+			if msg.Offset >= endOffset {
+				return messages, nil
+			}
+		case err := <-pc.Errors():
+			return nil, fmt.Errorf("读取死信消息失败: %w", err)
+		case <-timer.C:
+			return messages, nil
+		}
+	}
+	return messages, nil
+}
+
+// NewMessage 根据处理失败的原始消息构造死信消息，不发布
+// 供需要在事务中写入死信消息的调用方使用
+// 参数:
+//   - msg: 处理失败的原始消息
+//   - cause: 失败原因
+//   - attempts: 已尝试处理的次数
+//
+// 返回:
+//   - *sarama.ProducerMessage: 发往死信主题的消息
+func NewMessage(msg *sarama.ConsumerMessage, cause error, attempts int) *sarama.ProducerMessage {
+	return deadLetterMessage(msg, cause, attempts, time.Now())
+}
+
+// deadLetterMessage 根据原始消息构造死信消息
+// 保留原始消息的键、内容和消息头，并追加死信相关的消息头
+func deadLetterMessage(msg *sarama.ConsumerMessage, cause error, attempts int, now time.Time) *sarama.ProducerMessage {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, *h)
+		}
+	}
+
+	errText := ""
+	if cause != nil {
+		errText = cause.Error()
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(strconv.FormatInt(int64(msg.Partition), 10))},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(errText)},
+		sarama.RecordHeader{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+		sarama.RecordHeader{Key: []byte(HeaderTimestamp), Value: []byte(now.UTC().Format(time.RFC3339Nano))},
+	)
+
+	dlqMsg := &sarama.ProducerMessage{
+		Topic:   Topic(msg.Topic),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		dlqMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+	if msg.Value != nil {
+		dlqMsg.Value = sarama.ByteEncoder(msg.Value)
+	}
+	return dlqMsg
+}
+
+// producerDeadLetterMessage 根据生产者发送失败的消息构造死信消息
+// 尝试次数为异步生产者记录的重试次数加1，重试计数头不再保留
+func producerDeadLetterMessage(msg *sarama.ProducerMessage, cause error, now time.Time) *sarama.ProducerMessage {
+	attempts := 1
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+	for _, h := range msg.Headers {
+		if string(h.Key) == producer.RetryCountHeader {
+			if len(h.Value) == 2 {
+				attempts += int(binary.BigEndian.Uint16(h.Value))
+			}
+			continue
+		}
+		headers = append(headers, h)
+	}
+
+	errText := ""
+	if cause != nil {
+		errText = cause.Error()
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte("-1")},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte("-1")},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(errText)},
+		sarama.RecordHeader{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+		sarama.RecordHeader{Key: []byte(HeaderTimestamp), Value: []byte(now.UTC().Format(time.RFC3339Nano))},
+	)
+
+	return &sarama.ProducerMessage{
+		Topic:   Topic(msg.Topic),
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+}
+
+// replayMessage 根据死信消息构造重放到源主题的消息
+// 去掉死信相关的消息头，只保留原始消息头
+func replayMessage(msg *sarama.ConsumerMessage) *sarama.ProducerMessage {
+	topic := strings.TrimSuffix(msg.Topic, TopicSuffix)
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+		key := string(h.Key)
+		if key == HeaderOriginalTopic && len(h.Value) > 0 {
+			topic = string(h.Value)
+		}
+		if strings.HasPrefix(key, "dlq-") {
+			continue
+		}
+		headers = append(headers, *h)
+	}
+
+	replay := &sarama.ProducerMessage{
+		Topic:   topic,
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		replay.Key = sarama.ByteEncoder(msg.Key)
+	}
+	if msg.Value != nil {
+		replay.Value = sarama.ByteEncoder(msg.Value)
+	}
+	return replay
+}
+
+// parseMessage 将死信消息解析为便于展示的结构
+func parseMessage(msg *sarama.ConsumerMessage) Message {
+	m := Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Value:     string(msg.Value),
+		Headers:   make(map[string]string),
+	}
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+		value := string(h.Value)
+		switch string(h.Key) {
+		case HeaderOriginalTopic:
+			m.OriginalTopic = value
+		case HeaderOriginalPartition:
+			p, _ := strconv.ParseInt(value, 10, 32)
+			m.OriginalPartition = int32(p)
+		case HeaderOriginalOffset:
+			m.OriginalOffset, _ = strconv.ParseInt(value, 10, 64)
+		case HeaderError:
+			m.Error = value
+		case HeaderAttempts:
+			m.Attempts, _ = strconv.Atoi(value)
+		case HeaderTimestamp:
+			m.FailedAt, _ = time.Parse(time.RFC3339Nano, value)
+		default:
+			m.Headers[string(h.Key)] = value
+		}
+	}
+	return m
+}
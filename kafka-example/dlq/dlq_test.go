@@ -0,0 +1,280 @@
+package dlq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"kafka-example/producer"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// mockConsumerMessage 创建测试用的消费消息
+func mockConsumerMessage() *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Topic:     "kafka-example-async",
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("order-1"),
+		Value:     []byte("test dlq message"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("trace-id"), Value: []byte("abc")},
+		},
+	}
+}
+
+// headerMap 将生产者消息头转换为map，便于断言
+func headerMap(headers []sarama.RecordHeader) map[string]string {
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		m[string(h.Key)] = string(h.Value)
+	}
+	return m
+}
+
+// TestService_Publish 测试发布死信消息
+func TestService_Publish(t *testing.T) {
+	tests := []struct {
+		name      string
+		setupMock func(p *mocks.SyncProducer)
+		wantErr   bool
+	}{
+		{
+			name: "发布成功并携带死信消息头",
+			setupMock: func(p *mocks.SyncProducer) {
+				p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+					if msg.Topic != "kafka-example-async.dlq" {
+						return fmt.Errorf("死信主题不正确: %s", msg.Topic)
+					}
+					headers := headerMap(msg.Headers)
+					want := map[string]string{
+						HeaderOriginalTopic:     "kafka-example-async",
+						HeaderOriginalPartition: "2",
+						HeaderOriginalOffset:    "42",
+						HeaderError:             "handler failed",
+						HeaderAttempts:          "3",
+						"trace-id":              "abc",
+					}
+					for k, v := range want {
+						if headers[k] != v {
+							return fmt.Errorf("消息头%s = %q, 期望 %q", k, headers[k], v)
+						}
+					}
+					if _, err := time.Parse(time.RFC3339Nano, headers[HeaderTimestamp]); err != nil {
+						return fmt.Errorf("时间戳格式不正确: %v", err)
+					}
+					return nil
+				})
+			},
+			wantErr: false,
+		},
+		{
+			name: "发布失败",
+			setupMock: func(p *mocks.SyncProducer) {
+				p.ExpectSendMessageAndFail(sarama.ErrLeaderNotAvailable)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProducer := mocks.NewSyncProducer(t, nil)
+			tt.setupMock(mockProducer)
+			service := &Service{producer: mockProducer}
+
+			err := service.Publish(mockConsumerMessage(), errors.New("handler failed"), 3)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mockProducer.Close(); err != nil {
+				t.Errorf("关闭mock生产者时发生错误: %v", err)
+			}
+		})
+	}
+}
+
+// TestProducerDeadLetterMessage 测试生产者发送失败的消息转为死信消息
+func TestProducerDeadLetterMessage(t *testing.T) {
+	retries := make([]byte, 2)
+	binary.BigEndian.PutUint16(retries, 5)
+	msg := &sarama.ProducerMessage{
+		Topic: "kafka-example-async",
+		Value: sarama.StringEncoder("test spill message"),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("trace-id"), Value: []byte("abc")},
+			{Key: []byte(producer.RetryCountHeader), Value: retries},
+		},
+	}
+
+	dlqMsg := producerDeadLetterMessage(msg, errors.New("retries exhausted"), time.Now())
+	if dlqMsg.Topic != "kafka-example-async.dlq" {
+		t.Errorf("死信主题 = %s, 期望 kafka-example-async.dlq", dlqMsg.Topic)
+	}
+	headers := headerMap(dlqMsg.Headers)
+	want := map[string]string{
+		HeaderOriginalTopic:     "kafka-example-async",
+		HeaderOriginalPartition: "-1",
+		HeaderOriginalOffset:    "-1",
+		HeaderError:             "retries exhausted",
+		HeaderAttempts:          "6",
+		"trace-id":              "abc",
+	}
+	for k, v := range want {
+		if headers[k] != v {
+			t.Errorf("消息头%s = %q, 期望 %q", k, headers[k], v)
+		}
+	}
+	if _, ok := headers[producer.RetryCountHeader]; ok {
+		t.Error("死信消息不应保留重试计数头")
+	}
+}
+
+// TestReplayMessage 测试死信消息还原为源主题消息
+func TestReplayMessage(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	dlqMsg := deadLetterMessage(mockConsumerMessage(), errors.New("handler failed"), 3, now)
+
+	// 模拟从死信主题读取到的消息
+	consumed := &sarama.ConsumerMessage{
+		Topic:     dlqMsg.Topic,
+		Partition: 0,
+		Offset:    7,
+		Key:       []byte("order-1"),
+		Value:     []byte("test dlq message"),
+	}
+	for i := range dlqMsg.Headers {
+		consumed.Headers = append(consumed.Headers, &dlqMsg.Headers[i])
+	}
+
+	replay := replayMessage(consumed)
+	if replay.Topic != "kafka-example-async" {
+		t.Errorf("重放主题 = %s, 期望 kafka-example-async", replay.Topic)
+	}
+	headers := headerMap(replay.Headers)
+	if len(headers) != 1 || headers["trace-id"] != "abc" {
+		t.Errorf("重放消息应只保留原始消息头, 实际: %v", headers)
+	}
+
+	parsed := parseMessage(consumed)
+	if parsed.OriginalPartition != 2 || parsed.OriginalOffset != 42 || parsed.Attempts != 3 {
+		t.Errorf("解析死信消息不正确: %+v", parsed)
+	}
+	if !parsed.FailedAt.Equal(now) || parsed.Error != "handler failed" {
+		t.Errorf("解析死信消息不正确: %+v", parsed)
+	}
+}
+
+// TestTopic 测试死信主题名称
+func TestTopic(t *testing.T) {
+	if got := Topic("orders"); got != "orders.dlq" {
+		t.Errorf("Topic() = %s, 期望 orders.dlq", got)
+	}
+	if got := Topic("orders.dlq"); got != "orders.dlq" {
+		t.Errorf("Topic() = %s, 期望 orders.dlq", got)
+	}
+}
+
+// offsetClient 返回固定偏移量范围的模拟客户端，只实现 Replay 用到的方法
+type offsetClient struct {
+	sarama.Client
+	oldest, newest int64
+}
+
+func (c *offsetClient) GetOffset(_ string, _ int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return c.oldest, nil
+	}
+	return c.newest, nil
+}
+
+// TestService_Replay 测试重放范围截断到分区末尾，截断后超过上限时不读取
+func TestService_Replay(t *testing.T) {
+	const dlqTopic = "orders.dlq"
+
+	tests := []struct {
+		name        string
+		newest      int64
+		start, end  int64
+		wantOffsets []int64 // 期望重放的偏移量，为空时期望返回错误
+		wantErr     error
+	}{
+		{
+			name:        "结束偏移量超过分区末尾时截断",
+			newest:      3,
+			start:       1,
+			end:         1 << 40,
+			wantOffsets: []int64{1, 2},
+		},
+		{
+			name:        "只重放一条",
+			newest:      3,
+			start:       2,
+			end:         0,
+			wantOffsets: []int64{2},
+		},
+		{
+			name:    "截断后仍超过上限",
+			newest:  MaxReplayMessages + 10,
+			start:   0,
+			end:     MaxReplayMessages,
+			wantErr: ErrReplayRangeTooLarge,
+		},
+		{
+			name:   "起始偏移量超过分区末尾",
+			newest: 3,
+			start:  5,
+			end:    6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consumer := mocks.NewConsumer(t, nil)
+			producer := mocks.NewSyncProducer(t, nil)
+			if len(tt.wantOffsets) > 0 {
+				pc := consumer.ExpectConsumePartition(dlqTopic, 0, tt.start)
+				for range tt.wantOffsets {
+					pc.YieldMessage(&sarama.ConsumerMessage{
+						Value:   []byte("v"),
+						Headers: []*sarama.RecordHeader{{Key: []byte(HeaderOriginalTopic), Value: []byte("orders")}},
+					})
+					producer.ExpectSendMessageAndSucceed()
+				}
+			}
+			s := &Service{client: &offsetClient{newest: tt.newest}, producer: producer, consumer: consumer}
+
+			start := time.Now()
+			replayed, err := s.Replay("orders", 0, tt.start, tt.end)
+			if elapsed := time.Since(start); elapsed >= fetchTimeout {
+				t.Errorf("Replay() 耗时 %v, 不应等待到读取超时", elapsed)
+			}
+			if len(tt.wantOffsets) == 0 {
+				if err == nil {
+					t.Fatal("Replay() 期望返回错误")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("Replay() error = %v, 期望 %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+			if len(replayed) != len(tt.wantOffsets) {
+				t.Fatalf("重放 %d 条, 期望 %d 条", len(replayed), len(tt.wantOffsets))
+			}
+			for i, offset := range tt.wantOffsets {
+				if replayed[i].Offset != offset {
+					t.Errorf("第%d条重放的偏移量 = %d, 期望 %d", i+1, replayed[i].Offset, offset)
+				}
+			}
+			if err := producer.Close(); err != nil {
+				t.Errorf("关闭mock生产者时发生错误: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 编解码器的内容类型，记录在信封中，消费时用于校验
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeGob      = "application/x-gob"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Codec 消息内容的编解码器
+type Codec[T any] interface {
+	ContentType() string
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec 使用 encoding/json 编解码
+type JSONCodec[T any] struct{}
+
+// ContentType 返回 application/json
+func (JSONCodec[T]) ContentType() string { return ContentTypeJSON }
+
+// Marshal 编码为JSON
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("JSON编码失败: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal 从JSON解码
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("JSON解码失败: %w", err)
+	}
+	return v, nil
+}
+
+// GobCodec 使用 encoding/gob 编解码，只适用于Go服务之间
+type GobCodec[T any] struct{}
+
+// ContentType 返回 application/x-gob
+func (GobCodec[T]) ContentType() string { return ContentTypeGob }
+
+// Marshal 编码为gob
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("gob编码失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal 从gob解码
+func (GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return v, fmt.Errorf("gob解码失败: %w", err)
+	}
+	return v, nil
+}
+
+// ProtoCodec 使用protobuf编解码
+// T 为生成代码中的消息指针类型，New 用于创建解码目标，例如 func() *pb.Order { return new(pb.Order) }
+type ProtoCodec[T proto.Message] struct {
+	New func() T
+}
+
+// ContentType 返回 application/x-protobuf
+func (ProtoCodec[T]) ContentType() string { return ContentTypeProtobuf }
+
+// Marshal 编码为protobuf
+func (ProtoCodec[T]) Marshal(v T) ([]byte, error) {
+	data, err := proto.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf编码失败: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal 从protobuf解码
+func (c ProtoCodec[T]) Unmarshal(data []byte) (T, error) {
+	v := c.New()
+	if err := proto.Unmarshal(data, v); err != nil {
+		return v, fmt.Errorf("protobuf解码失败: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,197 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 信封消息头
+const (
+	HeaderID            = "msg-id"             // 消息ID
+	HeaderType          = "msg-type"           // 消息类型
+	HeaderSchemaVersion = "msg-schema-version" // 消息结构版本
+	HeaderProducedAt    = "msg-produced-at"    // 生产时间，RFC3339Nano格式
+	HeaderSource        = "msg-source"         // 生产方
+	HeaderContentType   = "msg-content-type"   // 内容的编码格式
+)
+
+// ErrIncompatible 消息与消费方期望的类型或版本不兼容
+var ErrIncompatible = errors.New("消息版本不兼容")
+
+// Envelope 标准消息信封
+// 元数据同时写入消息头和消息体：消息头便于不解析消息体就能路由和过滤，消息体保证元数据随内容一起保存
+type Envelope[T any] struct {
+	ID            string    // 消息ID
+	Type          string    // 消息类型
+	SchemaVersion int       // 消息结构版本
+	ProducedAt    time.Time // 生产时间
+	Source        string    // 生产方
+	Payload       T         // 消息内容
+}
+
+// Schema 描述消息类型及其版本
+// 生产时使用 Version；消费时接受 [MinVersion, Version] 范围内的版本，MinVersion 为0时只接受 Version
+type Schema struct {
+	Type       string // 消息类型
+	Version    int    // 当前版本
+	MinVersion int    // 消费时兼容的最低版本
+}
+
+// accepts 判断版本是否在兼容范围内
+func (s Schema) accepts(version int) bool {
+	minVersion := s.MinVersion
+	if minVersion <= 0 {
+		minVersion = s.Version
+	}
+	return version >= minVersion && version <= s.Version
+}
+
+// IncompatibleError 消息类型或版本不兼容的详细信息
+type IncompatibleError struct {
+	Type          string // 消息的类型
+	SchemaVersion int    // 消息的版本
+	Expected      Schema // 消费方期望的类型和版本
+}
+
+func (e *IncompatibleError) Error() string {
+	if e.Expected.Type != "" && e.Type != e.Expected.Type {
+		return fmt.Sprintf("消息类型不兼容: 收到 %s, 期望 %s", e.Type, e.Expected.Type)
+	}
+	minVersion := e.Expected.MinVersion
+	if minVersion <= 0 {
+		minVersion = e.Expected.Version
+	}
+	return fmt.Sprintf("消息版本不兼容: 类型 %s 的版本 %d 不在支持范围 [%d, %d] 内",
+		e.Type, e.SchemaVersion, minVersion, e.Expected.Version)
+}
+
+// Is 使 errors.Is(err, ErrIncompatible) 成立
+func (e *IncompatibleError) Is(target error) bool {
+	return target == ErrIncompatible
+}
+
+// body 信封在消息体中的JSON结构
+// JSON编码的内容直接内嵌，其他编码的内容以base64字符串保存
+type body struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Source        string          `json:"source"`
+	ContentType   string          `json:"content_type"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// New 使用 schema 的类型和当前版本创建信封，生成消息ID并记录生产时间
+func New[T any](schema Schema, source string, payload T) Envelope[T] {
+	return Envelope[T]{
+		ID:            newID(),
+		Type:          schema.Type,
+		SchemaVersion: schema.Version,
+		ProducedAt:    time.Now().UTC(),
+		Source:        source,
+		Payload:       payload,
+	}
+}
+
+// newID 生成32位十六进制的随机消息ID
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Encode 将信封编码为消息体和消息头
+// 参数:
+//   - env: 信封
+//   - codec: 消息内容的编解码器
+//
+// 返回:
+//   - []byte: 消息体
+//   - []sarama.RecordHeader: 信封消息头
+//   - error: 编码失败时返回错误
+func Encode[T any](env Envelope[T], codec Codec[T]) ([]byte, []sarama.RecordHeader, error) {
+	data, err := codec.Marshal(env.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := json.RawMessage(data)
+	if codec.ContentType() != ContentTypeJSON {
+		if payload, err = json.Marshal(data); err != nil {
+			return nil, nil, fmt.Errorf("编码消息内容失败: %w", err)
+		}
+	}
+
+	value, err := json.Marshal(body{
+		ID:            env.ID,
+		Type:          env.Type,
+		SchemaVersion: env.SchemaVersion,
+		ProducedAt:    env.ProducedAt,
+		Source:        env.Source,
+		ContentType:   codec.ContentType(),
+		Payload:       payload,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("编码信封失败: %w", err)
+	}
+
+	headers := []sarama.RecordHeader{
+		{Key: []byte(HeaderID), Value: []byte(env.ID)},
+		{Key: []byte(HeaderType), Value: []byte(env.Type)},
+		{Key: []byte(HeaderSchemaVersion), Value: []byte(strconv.Itoa(env.SchemaVersion))},
+		{Key: []byte(HeaderProducedAt), Value: []byte(env.ProducedAt.Format(time.RFC3339Nano))},
+		{Key: []byte(HeaderSource), Value: []byte(env.Source)},
+		{Key: []byte(HeaderContentType), Value: []byte(codec.ContentType())},
+	}
+	return value, headers, nil
+}
+
+// Decode 从消息体解码信封，并校验类型、版本和编码格式
+// 参数:
+//   - value: 消息体
+//   - codec: 消息内容的编解码器
+//   - schema: 期望的消息类型和兼容版本，Type 为空时不校验类型
+//
+// 返回:
+//   - Envelope[T]: 信封
+//   - error: 解码失败时返回错误；类型或版本不兼容时返回 *IncompatibleError
+func Decode[T any](value []byte, codec Codec[T], schema Schema) (Envelope[T], error) {
+	var env Envelope[T]
+	var b body
+	if err := json.Unmarshal(value, &b); err != nil {
+		return env, fmt.Errorf("解析信封失败: %w", err)
+	}
+	if (schema.Type != "" && b.Type != schema.Type) || !schema.accepts(b.SchemaVersion) {
+		return env, &IncompatibleError{Type: b.Type, SchemaVersion: b.SchemaVersion, Expected: schema}
+	}
+	if b.ContentType != codec.ContentType() {
+		return env, fmt.Errorf("消息编码格式不匹配: 收到 %s, 期望 %s", b.ContentType, codec.ContentType())
+	}
+
+	data := []byte(b.Payload)
+	if b.ContentType != ContentTypeJSON {
+		if err := json.Unmarshal(b.Payload, &data); err != nil {
+			return env, fmt.Errorf("解析消息内容失败: %w", err)
+		}
+	}
+	payload, err := codec.Unmarshal(data)
+	if err != nil {
+		return env, err
+	}
+
+	return Envelope[T]{
+		ID:            b.ID,
+		Type:          b.Type,
+		SchemaVersion: b.SchemaVersion,
+		ProducedAt:    b.ProducedAt,
+		Source:        b.Source,
+		Payload:       payload,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package envelope
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type order struct {
+	ID     string
+	Amount int
+}
+
+// TestEncodeDecode 测试不同编解码器的信封往返编解码
+func TestEncodeDecode(t *testing.T) {
+	schema := Schema{Type: "order.created", Version: 2}
+
+	t.Run("JSON", func(t *testing.T) {
+		testRoundTrip[order](t, JSONCodec[order]{}, schema, order{ID: "o-1", Amount: 3},
+			func(a, b order) bool { return a == b })
+	})
+	t.Run("gob", func(t *testing.T) {
+		testRoundTrip[order](t, GobCodec[order]{}, schema, order{ID: "o-2", Amount: 5},
+			func(a, b order) bool { return a == b })
+	})
+	t.Run("protobuf", func(t *testing.T) {
+		codec := ProtoCodec[*wrapperspb.StringValue]{New: func() *wrapperspb.StringValue { return new(wrapperspb.StringValue) }}
+		testRoundTrip[*wrapperspb.StringValue](t, codec, schema, wrapperspb.String("o-3"),
+			func(a, b *wrapperspb.StringValue) bool { return a.GetValue() == b.GetValue() })
+	})
+}
+
+func testRoundTrip[T any](t *testing.T, codec Codec[T], schema Schema, payload T, equal func(a, b T) bool) {
+	t.Helper()
+	env := New(schema, "test-service", payload)
+	value, headers, err := Encode(env, codec)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	got := make(map[string]string, len(headers))
+	for _, h := range headers {
+		got[string(h.Key)] = string(h.Value)
+	}
+	want := map[string]string{
+		HeaderID:            env.ID,
+		HeaderType:          "order.created",
+		HeaderSchemaVersion: "2",
+		HeaderSource:        "test-service",
+		HeaderContentType:   codec.ContentType(),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("消息头 %s = %q, 期望 %q", k, got[k], v)
+		}
+	}
+	if got[HeaderProducedAt] == "" {
+		t.Error("缺少生产时间消息头")
+	}
+
+	decoded, err := Decode(value, codec, schema)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if decoded.ID != env.ID || decoded.Source != env.Source || !decoded.ProducedAt.Equal(env.ProducedAt) {
+		t.Errorf("信封元数据不一致: %+v, 期望 %+v", decoded, env)
+	}
+	if !equal(decoded.Payload, payload) {
+		t.Errorf("Payload = %v, 期望 %v", decoded.Payload, payload)
+	}
+}
+
+// TestDecode_Incompatible 测试消费时拒绝不兼容的类型、版本和编码格式
+func TestDecode_Incompatible(t *testing.T) {
+	codec := JSONCodec[order]{}
+	tests := []struct {
+		name             string
+		produced         Schema
+		expected         Schema
+		wantIncompatible bool
+		wantErr          bool
+	}{
+		{
+			name:     "兼容范围内的旧版本",
+			produced: Schema{Type: "order", Version: 1},
+			expected: Schema{Type: "order", Version: 2, MinVersion: 1},
+		},
+		{
+			name:             "低于最低版本",
+			produced:         Schema{Type: "order", Version: 1},
+			expected:         Schema{Type: "order", Version: 3, MinVersion: 2},
+			wantIncompatible: true,
+			wantErr:          true,
+		},
+		{
+			name:             "高于当前版本",
+			produced:         Schema{Type: "order", Version: 3},
+			expected:         Schema{Type: "order", Version: 2, MinVersion: 1},
+			wantIncompatible: true,
+			wantErr:          true,
+		},
+		{
+			name:             "消息类型不一致",
+			produced:         Schema{Type: "payment", Version: 1},
+			expected:         Schema{Type: "order", Version: 1},
+			wantIncompatible: true,
+			wantErr:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _, err := Encode(New(tt.produced, "test", order{ID: "o"}), codec)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			_, err = Decode(value, codec, tt.expected)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrIncompatible) != tt.wantIncompatible {
+				t.Errorf("Decode() error = %v, 期望不兼容错误: %v", err, tt.wantIncompatible)
+			}
+		})
+	}
+
+	t.Run("编码格式不一致", func(t *testing.T) {
+		schema := Schema{Type: "order", Version: 1}
+		value, _, err := Encode(New(schema, "test", order{ID: "o"}), GobCodec[order]{})
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		if _, err := Decode(value, codec, schema); err == nil || errors.Is(err, ErrIncompatible) {
+			t.Errorf("Decode() error = %v, 期望编码格式不匹配的错误", err)
+		}
+	})
+}
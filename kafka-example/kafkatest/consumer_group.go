@@ -0,0 +1,331 @@
+package kafkatest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// Broker 内存中的单主题分区日志和消费者组已提交的偏移量
+// 多个 ConsumerGroup 可以共享同一个 Broker，用于模拟进程崩溃后重启；
+// 配合 sarama/mocks 的生产者，可以在没有Kafka的情况下测试完整的消费、标记、提交和重试流程
+type Broker struct {
+	topic     string
+	mu        sync.Mutex
+	logs      map[int32][]*sarama.ConsumerMessage // 每个分区的消息日志
+	committed map[int32]int64                     // 已提交的偏移量（下一条待消费的偏移量）
+	commits   int                                 // 提交次数
+	notify    chan struct{}                       // 有新消息时关闭并替换
+}
+
+// NewBroker 创建包含指定分区的内存broker
+func NewBroker(topic string, partitions ...int32) *Broker {
+	b := &Broker{
+		topic:     topic,
+		logs:      make(map[int32][]*sarama.ConsumerMessage),
+		committed: make(map[int32]int64),
+		notify:    make(chan struct{}),
+	}
+	for _, p := range partitions {
+		b.logs[p] = nil
+	}
+	return b
+}
+
+// Produce 向指定分区写入一条没有键的消息，偏移量自动递增
+func (b *Broker) Produce(partition int32, value string) {
+	b.ProduceKey(partition, "", value)
+}
+
+// ProduceKey 向指定分区写入一条带键的消息，key 为空时消息没有键
+func (b *Broker) ProduceKey(partition int32, key, value string) {
+	msg := &sarama.ConsumerMessage{Value: []byte(value)}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+	b.ProduceMessage(partition, msg)
+}
+
+// ProduceMessage 向指定分区写入一条消息，保留消息键、消息头和时间戳，主题、分区和偏移量由broker设置
+func (b *Broker) ProduceMessage(partition int32, msg *sarama.ConsumerMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg.Topic = b.topic
+	msg.Partition = partition
+	msg.Offset = int64(len(b.logs[partition]))
+	b.logs[partition] = append(b.logs[partition], msg)
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// read 返回分区中从 offset 开始的消息，以及等待新消息的通知通道
+func (b *Broker) read(partition int32, offset int64) ([]*sarama.ConsumerMessage, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	log := b.logs[partition]
+	if offset >= int64(len(log)) {
+		return nil, b.notify
+	}
+	return append([]*sarama.ConsumerMessage{}, log[offset:]...), b.notify
+}
+
+// commit 提交偏移量
+func (b *Broker) commit(offsets map[int32]int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for partition, offset := range offsets {
+		b.committed[partition] = offset
+	}
+	b.commits++
+}
+
+// Committed 返回已提交的偏移量和提交次数
+func (b *Broker) Committed() (map[int32]int64, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return copyOffsets(b.committed), b.commits
+}
+
+// Claim 创建单个分区的会话和分区认领，用于直接测试处理器的 ConsumeClaim
+// 认领从已提交的偏移量开始发送分区中的消息，ctx 取消后关闭消息通道；会话的 Commit 将已标记的偏移量写入broker
+func (b *Broker) Claim(ctx context.Context, partition int32) (sarama.ConsumerGroupSession, sarama.ConsumerGroupClaim) {
+	committed, _ := b.Committed()
+	sess := &session{ctx: ctx, broker: b, marked: make(map[int32]int64)}
+	c := &claim{
+		topic:     b.topic,
+		partition: partition,
+		offset:    committed[partition],
+		messages:  make(chan *sarama.ConsumerMessage),
+	}
+	go b.feed(ctx, c)
+	return sess, c
+}
+
+// ConsumerGroup 内存中的消费者组，用于在没有Kafka的情况下测试消费者组服务
+// 每次 Consume 都会创建一个会话，从已提交的偏移量开始为每个分区启动 ConsumeClaim，直到上下文取消或消费者组关闭
+type ConsumerGroup struct {
+	broker  *Broker
+	mu      sync.Mutex
+	errors  chan error
+	closed  chan struct{}
+	once    sync.Once
+	crashed bool // 是否模拟崩溃，崩溃时会话结束不调用 Cleanup
+	pauses  int  // 暂停拉取分区的次数
+	resumes int  // 恢复拉取分区的次数
+}
+
+// ConsumerGroupFactory 返回创建连接到该broker的消费者组的函数
+// 签名与 sarama.NewConsumerGroup 相同，可以传给消费者的 WithConsumerGroupFactory
+func (b *Broker) ConsumerGroupFactory() func(addrs []string, groupID string, config *sarama.Config) (sarama.ConsumerGroup, error) {
+	return func([]string, string, *sarama.Config) (sarama.ConsumerGroup, error) {
+		return b.NewConsumerGroup(), nil
+	}
+}
+
+// NewConsumerGroup 创建连接到该broker的消费者组
+func (b *Broker) NewConsumerGroup() *ConsumerGroup {
+	return &ConsumerGroup{
+		broker: b,
+		errors: make(chan error, 16),
+		closed: make(chan struct{}),
+	}
+}
+
+// Crash 模拟进程崩溃：结束当前会话但不调用 Cleanup，已标记未提交的偏移量全部丢失
+func (g *ConsumerGroup) Crash() {
+	g.mu.Lock()
+	g.crashed = true
+	g.mu.Unlock()
+	_ = g.Close()
+}
+
+// Consume 创建会话并消费所有分区，直到上下文取消或消费者组关闭
+func (g *ConsumerGroup) Consume(ctx context.Context, _ []string, handler sarama.ConsumerGroupHandler) error {
+	select {
+	case <-g.closed:
+		return sarama.ErrClosedConsumerGroup
+	default:
+	}
+
+	sessCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sess := &session{ctx: sessCtx, broker: g.broker, marked: make(map[int32]int64)}
+
+	if err := handler.Setup(sess); err != nil {
+		return err
+	}
+
+	committed, _ := g.broker.Committed()
+	var wg sync.WaitGroup
+	for partition := range g.broker.logs {
+		c := &claim{
+			topic:     g.broker.topic,
+			partition: partition,
+			offset:    committed[partition],
+			messages:  make(chan *sarama.ConsumerMessage),
+		}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			g.broker.feed(sessCtx, c)
+		}()
+		go func() {
+			defer wg.Done()
+			if err := handler.ConsumeClaim(sess, c); err != nil {
+				g.errors <- err
+			}
+		}()
+	}
+
+	select {
+	case <-sessCtx.Done():
+	case <-g.closed:
+	}
+	cancel()
+	wg.Wait()
+
+	g.mu.Lock()
+	crashed := g.crashed
+	g.mu.Unlock()
+	if crashed {
+		return sarama.ErrClosedConsumerGroup
+	}
+	return handler.Cleanup(sess)
+}
+
+// feed 将分区日志中的消息依次发送给分区认领，会话结束时关闭消息通道
+func (b *Broker) feed(ctx context.Context, c *claim) {
+	defer close(c.messages)
+	next := c.offset
+	for {
+		msgs, notify := b.read(c.partition, next)
+		for _, msg := range msgs {
+			select {
+			case c.messages <- msg:
+				next++
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(msgs) > 0 {
+			continue
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Errors 返回错误通道
+func (g *ConsumerGroup) Errors() <-chan error { return g.errors }
+
+// Close 关闭消费者组
+func (g *ConsumerGroup) Close() error {
+	g.once.Do(func() {
+		close(g.closed)
+		close(g.errors)
+	})
+	return nil
+}
+
+// Closed 返回消费者组是否已关闭
+func (g *ConsumerGroup) Closed() bool {
+	select {
+	case <-g.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pause 记录暂停拉取分区的次数
+func (g *ConsumerGroup) Pause(map[string][]int32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pauses++
+}
+
+// Resume 记录恢复拉取分区的次数
+func (g *ConsumerGroup) Resume(map[string][]int32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.resumes++
+}
+
+// PauseCounts 返回暂停和恢复拉取分区的次数
+func (g *ConsumerGroup) PauseCounts() (pauses, resumes int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pauses, g.resumes
+}
+
+func (g *ConsumerGroup) PauseAll()  {}
+func (g *ConsumerGroup) ResumeAll() {}
+
+// session 内存中的消费者组会话，提交时将已标记的偏移量写入broker
+type session struct {
+	ctx    context.Context
+	broker *Broker
+	mu     sync.Mutex
+	marked map[int32]int64 // 已标记的偏移量（下一条待消费的偏移量）
+}
+
+func (s *session) Claims() map[string][]int32 { return nil }
+func (s *session) MemberID() string           { return "fake-member" }
+func (s *session) GenerationID() int32        { return 1 }
+func (s *session) Context() context.Context   { return s.ctx }
+
+// MarkOffset 标记偏移量
+func (s *session) MarkOffset(_ string, partition int32, offset int64, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offset > s.marked[partition] {
+		s.marked[partition] = offset
+	}
+}
+
+// ResetOffset 重置偏移量
+func (s *session) ResetOffset(_ string, partition int32, offset int64, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked[partition] = offset
+}
+
+// MarkMessage 标记消息已处理
+func (s *session) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// Commit 同步提交已标记的偏移量
+func (s *session) Commit() {
+	s.mu.Lock()
+	marked := copyOffsets(s.marked)
+	s.mu.Unlock()
+	s.broker.commit(marked)
+}
+
+// claim 内存中的分区认领
+type claim struct {
+	topic     string
+	partition int32
+	offset    int64 // 起始偏移量
+	messages  chan *sarama.ConsumerMessage
+}
+
+func (c *claim) Topic() string                            { return c.topic }
+func (c *claim) Partition() int32                         { return c.partition }
+func (c *claim) InitialOffset() int64                     { return c.offset }
+func (c *claim) HighWaterMarkOffset() int64               { return 0 }
+func (c *claim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// copyOffsets 复制偏移量，避免调用方修改内部状态
+func copyOffsets(offsets map[int32]int64) map[int32]int64 {
+	result := make(map[int32]int64, len(offsets))
+	for partition, offset := range offsets {
+		result[partition] = offset
+	}
+	return result
+}
@@ -1,13 +1,31 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"kafka-example/common"
+	"errors"
+	"flag"
+	"fmt"
+	"kafka-example/admin"
+	"kafka-example/archive"
+	"kafka-example/claimcheck"
+	"kafka-example/config"
 	"kafka-example/consumer"
+	"kafka-example/delay"
+	"kafka-example/dlq"
+	"kafka-example/pipeline"
 	"kafka-example/producer"
+	"kafka-example/reply"
+	"kafka-example/tracing"
 	"log"
 	"net/http"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,102 +35,447 @@ var (
 	asyncProducerService       *producer.AsyncProducerService       // 异步生产者服务
 	groupConsumerService       *consumer.GroupConsumerService       // 消费者组服务
 	traditionalConsumerService *consumer.TraditionalConsumerService // 传统消费者服务
+	deadLetterService          *dlq.Service                         // 死信队列服务
+	pipelineService            *pipeline.Service                    // 事务管道服务，未启用时为空
+	delayService               *delay.Service                       // 延迟队列服务，未启用时为空
+	adminService               *admin.Service                       // 集群管理服务
+	dedupStore                 consumer.DedupStore                  // 去重存储，未启用去重时为空
+	deduplicator               *consumer.Deduplicator               // 两个消费者共享的消息去重器，未启用去重时为空
+	claimChecker               *claimcheck.ClaimCheck               // 生产者和消费者共享的大消息处理器，未启用时为空
+	requester                  *reply.Requester                     // 请求-回复的请求方，未启用时为空
+	responderService           *consumer.GroupConsumerService       // 示例回复方的消费者组服务，未启用请求-回复时为空
+	archiveWriter              *archive.Writer                      // 归档分段写入器，未启用归档时为空
+	archiveService             *consumer.GroupConsumerService       // 归档消费者组服务，未启用归档时为空
+)
+
+const (
+	shutdownTimeout        = 10 * time.Second // 关闭HTTP服务器时等待进行中请求的最长时间
+	defaultDeliveryTimeout = 5 * time.Second  // 异步发送接口等待发送结果的默认时间
+	maxBatchMessages       = 1000             // 批量发送接口单次请求的最大消息数
 )
 
 func main() {
+	// 读取配置文件路径参数
+	configPath := flag.String("config", "config.yaml", "配置文件路径")
+	flag.Parse()
+
 	log.Printf("[Main] 正在启动Kafka示例服务...")
 
-	// 初始化生产者服务（使用默认配置）
-	var err error
+	// 收到SIGINT或SIGTERM时取消上下文，触发优雅退出
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 加载配置
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("[Main] 加载配置失败: %v", err)
+	}
+	log.Printf("[Main] 配置加载成功: brokers=%v", cfg.Brokers)
+
+	// 初始化死信队列服务，生产者和消费者组都会用到
+	log.Printf("[Main] 正在初始化死信队列服务...")
+	deadLetterService, err = dlq.NewService(cfg)
+	if err != nil {
+		log.Fatalf("[Main] 初始化死信队列服务失败: %v", err)
+	}
+	log.Printf("[Main] 死信队列服务初始化成功")
+
+	// 初始化大消息处理器，生产者和消费者使用同一个blob存储
+	var producerClaimOpts []producer.Option
+	var consumerClaimOpts []consumer.Option
+	if cfg.ClaimCheck.Enabled {
+		log.Printf("[Main] 正在初始化大消息处理: dir=%s, retention=%s", cfg.ClaimCheck.Dir, cfg.ClaimCheck.Retention)
+		blobStore, err := claimcheck.NewBlobStore(cfg.ClaimCheck)
+		if err != nil {
+			log.Fatalf("[Main] 初始化blob存储失败: %v", err)
+		}
+		producerSaramaConfig, err := cfg.ProducerSaramaConfig()
+		if err != nil {
+			log.Fatalf("[Main] 构建生产者配置失败: %v", err)
+		}
+		claimChecker = claimcheck.New(blobStore, cfg.ClaimCheck, producerSaramaConfig.Producer.MaxMessageBytes)
+		producerClaimOpts = append(producerClaimOpts, producer.WithClaimCheck(claimChecker))
+		consumerClaimOpts = append(consumerClaimOpts, consumer.WithClaimCheck(claimChecker))
+		// 收到退出信号时上下文取消，清理协程随之退出
+		go claimChecker.RunRetention(ctx)
+		log.Printf("[Main] 大消息处理初始化成功")
+	}
+
+	// 初始化生产者服务
 	log.Printf("[Main] 正在初始化同步生产者服务...")
-	syncProducerService, err = producer.NewSyncProducerService()
+	syncProducerService, err = producer.NewSyncProducerService(
+		append([]producer.Option{producer.WithConfig(cfg)}, producerClaimOpts...)...)
 	if err != nil {
 		log.Fatalf("[Main] 初始化同步生产者服务失败: %v", err)
 	}
 	log.Printf("[Main] 同步生产者服务初始化成功")
 
 	log.Printf("[Main] 正在初始化异步生产者服务...")
-	asyncProducerService, err = producer.NewAsyncProducerService()
+	asyncOpts := append([]producer.Option{producer.WithConfig(cfg)}, producerClaimOpts...)
+	if cfg.Producer.AsyncRetry.Spill == "dlq" {
+		// 重试耗尽的消息发布到死信主题
+		asyncOpts = append(asyncOpts, producer.WithFailureSink(deadLetterService))
+	}
+	asyncProducerService, err = producer.NewAsyncProducerService(asyncOpts...)
 	if err != nil {
 		log.Fatalf("[Main] 初始化异步生产者服务失败: %v", err)
 	}
 	log.Printf("[Main] 异步生产者服务初始化成功")
 
-	// 确保在程序退出时关闭生产者服务
-	defer func(sps *producer.SyncProducerService, aps *producer.AsyncProducerService) {
-		log.Printf("[Main] 正在关闭生产者服务...")
-		if err := sps.Close(); err != nil {
-			log.Printf("[Main] 关闭同步生产者服务失败: %v", err)
-		}
-		if err := aps.Close(); err != nil {
-			log.Printf("[Main] 关闭异步生产者服务失败: %v", err)
+	// 初始化消费者服务
+	// 两个消费者共用的选项
+	sharedOpts := consumerClaimOpts
+	if cfg.Consumer.Dedup.Enabled {
+		log.Printf("[Main] 正在初始化去重存储: store=%s, ttl=%s", cfg.Consumer.Dedup.Store, cfg.Consumer.Dedup.TTL)
+		dedupStore, err = consumer.NewDedupStore(cfg.Consumer.Dedup)
+		if err != nil {
+			log.Fatalf("[Main] 初始化去重存储失败: %v", err)
 		}
-		log.Printf("[Main] 生产者服务已关闭")
-	}(syncProducerService, asyncProducerService)
+		deduplicator = consumer.NewDeduplicator(dedupStore, cfg.Consumer.Dedup.TTL)
+		sharedOpts = append(sharedOpts, consumer.WithDedup(deduplicator))
+		log.Printf("[Main] 去重存储初始化成功")
+	}
 
-	// 初始化消费者服务
 	log.Printf("[Main] 正在初始化消费者组服务...")
-	groupConsumerService, err = consumer.NewGroupConsumerService([]string{common.AsyncTopic})
+	groupConsumerService, err = consumer.NewGroupConsumerService([]string{cfg.Topics.Async},
+		append([]consumer.Option{consumer.WithConfig(cfg), consumer.WithDeadLetter(deadLetterService)}, sharedOpts...)...)
 	if err != nil {
 		log.Fatalf("[Main] 初始化消费者组服务失败: %v", err)
 	}
 	log.Printf("[Main] 消费者组服务初始化成功")
 
-	// 确保在程序退出时关闭消费者组服务
-	defer func(g *consumer.GroupConsumerService) {
-		log.Printf("[Main] 正在关闭消费者组服务...")
-		if err := g.Stop(); err != nil {
-			log.Printf("[Main] 关闭消费者组服务失败: %v", err)
-		}
-		log.Printf("[Main] 消费者组服务已关闭")
-	}(groupConsumerService)
-
 	log.Printf("[Main] 正在初始化传统消费者服务...")
-	traditionalConsumerService, err = consumer.NewTraditionalConsumerService(common.SyncTopic)
+	offsetStore, err := consumer.NewOffsetStore(cfg.Consumer.OffsetStore)
+	if err != nil {
+		log.Fatalf("[Main] 初始化偏移量存储失败: %v", err)
+	}
+	traditionalConsumerService, err = consumer.NewTraditionalConsumerService(cfg.Topics.Sync,
+		append([]consumer.Option{consumer.WithConfig(cfg), consumer.WithOffsetStore(offsetStore)}, sharedOpts...)...)
 	if err != nil {
 		log.Fatalf("[Main] 初始化传统消费者服务失败: %v", err)
 	}
 	log.Printf("[Main] 传统消费者服务初始化成功")
 
-	// 确保在程序退出时关闭传统消费者服务
-	defer func(g *consumer.TraditionalConsumerService) {
-		log.Printf("[Main] 正在关闭传统消费者服务...")
-		if err := g.Stop(); err != nil {
-			log.Printf("[Main] 关闭传统消费者服务失败: %v", err)
+	if cfg.Pipeline.Enabled {
+		log.Printf("[Main] 正在初始化事务管道服务...")
+		pipelineService, err = pipeline.NewService(cfg, upperCaseTransform)
+		if err != nil {
+			log.Fatalf("[Main] 初始化事务管道服务失败: %v", err)
 		}
-		log.Printf("[Main] 传统消费者服务已关闭")
-	}(traditionalConsumerService)
+		log.Printf("[Main] 事务管道服务初始化成功")
+	}
+
+	if cfg.Delay.Enabled {
+		log.Printf("[Main] 正在初始化延迟队列服务...")
+		delayService, err = delay.NewService(cfg)
+		if err != nil {
+			log.Fatalf("[Main] 初始化延迟队列服务失败: %v", err)
+		}
+		log.Printf("[Main] 延迟队列服务初始化成功")
+	}
+
+	if cfg.Reply.Enabled {
+		log.Printf("[Main] 正在初始化请求-回复服务...")
+		requester, err = reply.NewRequester(cfg)
+		if err != nil {
+			log.Fatalf("[Main] 初始化请求方失败: %v", err)
+		}
+		// 示例回复方通过同步生产者发送回复
+		responderService, err = consumer.NewGroupConsumerService([]string{cfg.Reply.RequestTopic},
+			append([]consumer.Option{
+				consumer.WithConfig(cfg),
+				consumer.WithGroupID(cfg.Reply.GroupID),
+				consumer.WithHandler(reply.NewResponder(syncProducerService, upperCaseReply)),
+			}, consumerClaimOpts...)...)
+		if err != nil {
+			log.Fatalf("[Main] 初始化回复方失败: %v", err)
+		}
+		log.Printf("[Main] 请求-回复服务初始化成功: reply_topic=%s", requester.ReplyTopic())
+	}
+
+	if cfg.Archive.Enabled {
+		log.Printf("[Main] 正在初始化归档服务: topics=%v, dir=%s", cfg.Archive.Topics, cfg.Archive.Dir)
+		archiveWriter, err = archive.NewWriter(cfg.Archive)
+		if err != nil {
+			log.Fatalf("[Main] 初始化归档写入器失败: %v", err)
+		}
+		// 归档消费者组首次启动时从最早的消息开始，不受业务消费者的限流影响；
+		// 消息按原样归档，不使用大消息还原和去重
+		archiveCfg := *cfg
+		archiveCfg.Consumer.OffsetReset = "oldest"
+		sink := archive.NewSink(archiveWriter)
+		archiveService, err = consumer.NewGroupConsumerService(cfg.Archive.Topics,
+			consumer.WithConfig(&archiveCfg),
+			consumer.WithGroupID(cfg.Archive.GroupID),
+			consumer.WithHandler(sink),
+			consumer.WithBatchHandler(sink),
+			consumer.WithCommit(config.CommitConfig{
+				Mode:         config.CommitModeBatch,
+				BatchSize:    cfg.Archive.BatchSize,
+				BatchTimeout: cfg.Archive.BatchTimeout,
+			}),
+			consumer.WithLimits(config.LimitsConfig{}))
+		if err != nil {
+			log.Fatalf("[Main] 初始化归档消费者失败: %v", err)
+		}
+		log.Printf("[Main] 归档服务初始化成功")
+	}
+
+	log.Printf("[Main] 正在初始化集群管理服务...")
+	adminService, err = admin.NewService(cfg)
+	if err != nil {
+		log.Fatalf("[Main] 初始化集群管理服务失败: %v", err)
+	}
+	log.Printf("[Main] 集群管理服务初始化成功")
 
 	// 启动消费者服务
 	log.Printf("[Main] 正在启动消费者服务...")
-	if err := groupConsumerService.Start(context.Background()); err != nil {
+	if err := groupConsumerService.Start(ctx); err != nil {
 		log.Fatalf("[Main] 启动消费者组服务失败: %v", err)
 	}
 	if err := traditionalConsumerService.Start(); err != nil {
 		log.Fatalf("[Main] 启动传统消费者服务失败: %v", err)
 	}
+	if pipelineService != nil {
+		if err := pipelineService.Start(ctx); err != nil {
+			log.Fatalf("[Main] 启动事务管道服务失败: %v", err)
+		}
+	}
+	if delayService != nil {
+		if err := delayService.Start(ctx); err != nil {
+			log.Fatalf("[Main] 启动延迟队列服务失败: %v", err)
+		}
+	}
+	if responderService != nil {
+		if err := responderService.Start(ctx); err != nil {
+			log.Fatalf("[Main] 启动回复方失败: %v", err)
+		}
+	}
+	if archiveService != nil {
+		if err := archiveService.Start(ctx); err != nil {
+			log.Fatalf("[Main] 启动归档服务失败: %v", err)
+		}
+		// 收到退出信号时上下文取消，滚动协程随之退出
+		go archiveWriter.RunRotation(ctx)
+	}
 	log.Printf("[Main] 消费者服务启动成功")
 
 	// 创建 Gin 路由
 	log.Printf("[Main] 正在初始化Web服务器...")
 	r := gin.Default()
+	r.Use(requestTracing())
 
 	// 注册路由
 	r.GET("/sync", handleSyncSendMessage)
 	r.GET("/async", handleAsyncSendMessage)
+	r.POST("/messages", handleSendMessages)
+	r.POST("/delay", handleSendDelayed)
+	r.POST("/request", handleRequest)
+	r.GET("/dlq/messages", handleListDeadLetters)
+	r.POST("/dlq/replay", handleReplayDeadLetters)
+	r.GET("/admin/topics", handleListTopics)
+	r.POST("/admin/topics", handleCreateTopic)
+	r.GET("/admin/topics/:topic", handleDescribeTopic)
+	r.DELETE("/admin/topics/:topic", handleDeleteTopic)
+	r.GET("/admin/groups", handleListConsumerGroups)
+	r.GET("/admin/groups/:group", handleDescribeConsumerGroup)
+	r.GET("/admin/groups/:group/lag", handleConsumerGroupLag)
+	r.GET("/admin/lag", handleGroupConsumerLag)
+	r.POST("/admin/groups/:group/reset", handleResetOffsets)
+	r.POST("/admin/reset", handleResetGroupConsumerOffsets)
+	r.GET("/dedup/stats", handleDedupStats)
+	r.GET("/claimcheck/stats", handleClaimCheckStats)
+	r.GET("/consumer/limits", handleGetConsumerLimits)
+	r.PUT("/consumer/limits", handleSetConsumerLimits)
 	log.Printf("[Main] 路由注册完成")
 
 	// 启动服务器
-	log.Printf("[Main] 服务器启动在 :8081 端口")
-	if err := r.Run(":8081"); err != nil {
-		log.Fatalf("[Main] 启动服务器失败: %v", err)
+	srv := &http.Server{
+		Addr:    ":8081",
+		Handler: r,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("[Main] 服务器启动在 :8081 端口")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// 等待退出信号或服务器异常退出
+	select {
+	case <-ctx.Done():
+		log.Printf("[Main] 收到退出信号，开始优雅退出")
+	case err := <-serverErr:
+		log.Printf("[Main] 服务器异常退出: %v", err)
+	}
+	stop()
+
+	shutdown(srv)
+	log.Printf("[Main] Kafka示例服务已退出")
+}
+
+// shutdown 按顺序关闭所有服务
+// 先停止接收HTTP请求，再停止消费者并提交偏移量，然后关闭生产者，最后关闭消费者和异步生产者可能用到的死信队列
+func shutdown(srv *http.Server) {
+	log.Printf("[Main] 正在关闭Web服务器...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("[Main] 关闭Web服务器失败: %v", err)
+	}
+	log.Printf("[Main] Web服务器已关闭")
+
+	log.Printf("[Main] 正在关闭消费者组服务...")
+	if err := groupConsumerService.Stop(); err != nil {
+		log.Printf("[Main] 关闭消费者组服务失败: %v", err)
+	}
+	log.Printf("[Main] 消费者组服务已关闭")
+
+	log.Printf("[Main] 正在关闭传统消费者服务...")
+	if err := traditionalConsumerService.Stop(); err != nil {
+		log.Printf("[Main] 关闭传统消费者服务失败: %v", err)
+	}
+	log.Printf("[Main] 传统消费者服务已关闭")
+
+	// 去重存储由两个消费者共享，在它们都停止后关闭
+	if dedupStore != nil {
+		if err := dedupStore.Close(); err != nil {
+			log.Printf("[Main] 关闭去重存储失败: %v", err)
+		}
+	}
+
+	if pipelineService != nil {
+		log.Printf("[Main] 正在关闭事务管道服务...")
+		if err := pipelineService.Stop(); err != nil {
+			log.Printf("[Main] 关闭事务管道服务失败: %v", err)
+		}
+		log.Printf("[Main] 事务管道服务已关闭")
+	}
+
+	if delayService != nil {
+		log.Printf("[Main] 正在关闭延迟队列服务...")
+		if err := delayService.Stop(); err != nil {
+			log.Printf("[Main] 关闭延迟队列服务失败: %v", err)
+		}
+		log.Printf("[Main] 延迟队列服务已关闭")
+	}
+
+	// 归档消费者停止后再完成正在写入的分段
+	if archiveService != nil {
+		log.Printf("[Main] 正在关闭归档服务...")
+		if err := archiveService.Stop(); err != nil {
+			log.Printf("[Main] 关闭归档消费者失败: %v", err)
+		}
+		if err := archiveWriter.Close(); err != nil {
+			log.Printf("[Main] 关闭归档写入器失败: %v", err)
+		}
+		log.Printf("[Main] 归档服务已关闭")
+	}
+
+	// 回复方通过同步生产者发送回复，在生产者之前停止
+	if responderService != nil {
+		log.Printf("[Main] 正在关闭请求-回复服务...")
+		if err := responderService.Stop(); err != nil {
+			log.Printf("[Main] 关闭回复方失败: %v", err)
+		}
+		if err := requester.Close(); err != nil {
+			log.Printf("[Main] 关闭请求方失败: %v", err)
+		}
+		log.Printf("[Main] 请求-回复服务已关闭")
+	}
+
+	log.Printf("[Main] 正在关闭生产者服务...")
+	if err := syncProducerService.Close(); err != nil {
+		log.Printf("[Main] 关闭同步生产者服务失败: %v", err)
+	}
+	if err := asyncProducerService.Close(); err != nil {
+		log.Printf("[Main] 关闭异步生产者服务失败: %v", err)
+	}
+	log.Printf("[Main] 生产者服务已关闭")
+
+	if err := deadLetterService.Close(); err != nil {
+		log.Printf("[Main] 关闭死信队列服务失败: %v", err)
+	}
+	if err := adminService.Close(); err != nil {
+		log.Printf("[Main] 关闭集群管理服务失败: %v", err)
+	}
+}
+
+// requestTracing 为每个请求建立追踪信息并放入请求上下文
+// 延续调用方的 traceparent 和 X-Request-ID，没有时生成新的；请求ID通过响应头返回，
+// 发送消息时写入消息头，消费者处理时在日志中输出，从而将一次请求从HTTP接口串联到消费者
+func requestTracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tc := tracing.FromHTTP(c.Request.Header)
+		c.Request = c.Request.WithContext(tracing.NewContext(c.Request.Context(), tc))
+		c.Header("X-Request-ID", tc.RequestID)
+		c.Next()
+	}
+}
+
+// upperCaseTransform 示例转换函数，将消息内容转为大写并保留消息键和消息头
+func upperCaseTransform(_ context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	out := &sarama.ProducerMessage{
+		Value: sarama.StringEncoder(strings.ToUpper(string(msg.Value))),
+	}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, h := range msg.Headers {
+		if h != nil {
+			out.Headers = append(out.Headers, *h)
+		}
+	}
+	return []*sarama.ProducerMessage{out}, nil
+}
+
+// parseSendOptions 从查询参数中解析消息键、分区和消息头，并传递请求的追踪信息
+// 查询参数:
+//   - key: 消息键，相同键的消息写入同一分区
+//   - partition: 指定分区，需要使用manual分区器
+//   - header: 消息头，格式为 name:value，可重复
+func parseSendOptions(c *gin.Context) ([]producer.SendOption, error) {
+	opts := []producer.SendOption{producer.WithContext(c.Request.Context())}
+	if key, ok := c.GetQuery("key"); ok {
+		opts = append(opts, producer.WithKey(key))
+	}
+	if v := c.Query("partition"); v != "" {
+		partition, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || partition < 0 {
+			return nil, errors.New("partition参数不合法")
+		}
+		opts = append(opts, producer.WithPartition(int32(partition)))
+	}
+	if values := c.QueryArray("header"); len(values) > 0 {
+		headers := make(map[string]string, len(values))
+		for _, v := range values {
+			name, value, ok := strings.Cut(v, ":")
+			if !ok || name == "" {
+				return nil, errors.New("header参数格式应为 name:value")
+			}
+			headers[name] = value
+		}
+		opts = append(opts, producer.WithHeaders(headers))
+	}
+	return opts, nil
+}
+
+// sendErrorStatus 根据发送失败的原因选择HTTP状态码，请求参数导致的失败返回400
+func sendErrorStatus(err error) int {
+	if errors.Is(err, producer.ErrManualPartitionRequired) {
+		return http.StatusBadRequest
 	}
+	return http.StatusInternalServerError
 }
 
 // handleSyncSendMessage 同步处理发送消息的请求
 // 接收GET请求，从查询参数中获取消息内容并同步发送到Kafka
+// 查询参数:
+//   - msg: 消息内容（必填）
+//   - key, partition, header: 见 parseSendOptions
 func handleSyncSendMessage(c *gin.Context) {
-	log.Printf("[Main] 收到同步发送消息请求")
+	log.Printf("[Main] 收到同步发送消息请求: %s", tracing.FromContext(c.Request.Context()))
 
 	// 获取消息参数
 	message := c.Query("msg")
@@ -124,12 +487,18 @@ func handleSyncSendMessage(c *gin.Context) {
 		return
 	}
 
+	opts, err := parseSendOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 发送消息到 Kafka
 	log.Printf("[Main] 正在同步发送消息: %s", message)
-	err := syncProducerService.SendMessage(message)
+	err = syncProducerService.SendMessage(message, opts...)
 	if err != nil {
 		log.Printf("[Main] 同步发送消息失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(sendErrorStatus(err), gin.H{
 			"error": "发送消息失败: " + err.Error(),
 		})
 		return
@@ -147,8 +516,13 @@ func handleSyncSendMessage(c *gin.Context) {
 
 // handleAsyncSendMessage 异步处理发送消息的请求
 // 接收GET请求，从查询参数中获取消息内容并异步发送到Kafka
+// 查询参数:
+//   - msg: 消息内容（必填）
+//   - key, partition, header: 见 parseSendOptions
+//   - wait: 为true时等待发送结果，返回消息写入的分区和偏移量
+//   - timeout: 等待发送结果的最长时间，默认5s
 func handleAsyncSendMessage(c *gin.Context) {
-	log.Printf("[Main] 收到异步发送消息请求")
+	log.Printf("[Main] 收到异步发送消息请求: %s", tracing.FromContext(c.Request.Context()))
 
 	// 获取消息参数
 	message := c.Query("msg")
@@ -159,17 +533,687 @@ func handleAsyncSendMessage(c *gin.Context) {
 		})
 		return
 	}
+	wait, err := strconv.ParseBool(c.DefaultQuery("wait", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wait参数不合法"})
+		return
+	}
+	timeout, err := time.ParseDuration(c.DefaultQuery("timeout", defaultDeliveryTimeout.String()))
+	if err != nil || timeout <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout参数不合法"})
+		return
+	}
+	opts, err := parseSendOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 发送消息到 Kafka
 	log.Printf("[Main] 正在异步发送消息: %s", message)
-	asyncProducerService.SendMessage(message)
+	delivery := asyncProducerService.SendMessage(message, opts...)
+	select {
+	case <-delivery.Done():
+		// 消息参数不合法时立即失败，不论是否等待都返回错误
+		if result := delivery.Result(); errors.Is(result.Err, producer.ErrManualPartitionRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": result.Err.Error()})
+			return
+		}
+	default:
+	}
 
-	// 返回成功响应
-	log.Printf("[Main] 异步发送消息成功: %s", message)
+	if !wait {
+		// 返回成功响应
+		log.Printf("[Main] 异步发送消息成功: %s", message)
+		c.JSON(http.StatusOK, gin.H{
+			"message": "消息发送成功",
+			"data": gin.H{
+				"content": message,
+			},
+		})
+		return
+	}
+
+	// 等待发送结果
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	result, err := delivery.Wait(ctx)
+	if err != nil {
+		log.Printf("[Main] 等待异步发送结果超时: %s", message)
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": "等待发送结果超时，消息仍可能发送成功",
+		})
+		return
+	}
+	if result.Err != nil {
+		log.Printf("[Main] 异步发送消息失败: %v", result.Err)
+		c.JSON(sendErrorStatus(result.Err), gin.H{
+			"error": "发送消息失败: " + result.Err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[Main] 异步发送消息成功: %s, partition=%d, offset=%d", message, result.Partition, result.Offset)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "消息发送成功",
 		"data": gin.H{
-			"content": message,
+			"content":   message,
+			"topic":     result.Topic,
+			"partition": result.Partition,
+			"offset":    result.Offset,
+		},
+	})
+}
+
+// handleListDeadLetters 查询死信消息
+// 接收GET请求，查询参数:
+//   - topic: 源主题或死信主题（必填）
+//   - partition: 死信分区，默认查询所有分区
+//   - offset: 起始偏移量，默认从最早的消息开始
+//   - limit: 最多返回的消息数，默认50
+func handleListDeadLetters(c *gin.Context) {
+	topic := c.Query("topic")
+	if topic == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "topic不能为空",
+		})
+		return
+	}
+
+	partition, err := strconv.ParseInt(c.DefaultQuery("partition", "-1"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "partition参数不合法"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "-1"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset参数不合法"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit参数不合法"})
+		return
+	}
+
+	messages, err := deadLetterService.List(topic, int32(partition), offset, limit)
+	if err != nil {
+		log.Printf("[Main] 查询死信消息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询死信消息失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    messages,
+	})
+}
+
+// delayedMessageRequest 发送延迟消息的请求
+type delayedMessageRequest struct {
+	Topic   string            `json:"topic" binding:"required"` // 目标主题
+	Key     *string           `json:"key"`                      // 消息键，可为空
+	Value   string            `json:"value"`                    // 消息内容
+	Headers map[string]string `json:"headers"`                  // 消息头
+	Delay   string            `json:"delay" binding:"required"` // 延迟时间，如 30s、5m
+}
+
+// handleSendDelayed 发送延迟消息
+// 接收POST请求，请求体为 delayedMessageRequest；消息先写入延迟级别主题，到期后由转发器发布到目标主题
+func handleSendDelayed(c *gin.Context) {
+	if delayService == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用延迟队列"})
+		return
+	}
+	var req delayedMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数不合法: " + err.Error()})
+		return
+	}
+	delayDuration, err := time.ParseDuration(req.Delay)
+	if err != nil || delayDuration < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delay参数不合法"})
+		return
+	}
+	topic := req.Topic
+	msg := &sarama.ProducerMessage{Topic: topic, Value: sarama.StringEncoder(req.Value)}
+	if req.Key != nil {
+		msg.Key = sarama.StringEncoder(*req.Key)
+	}
+	for k, v := range req.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	tracing.Inject(c.Request.Context(), msg)
+
+	log.Printf("[Main] 正在发送延迟消息: topic=%s, delay=%v, %s", topic, delayDuration, tracing.FromContext(c.Request.Context()))
+	partition, offset, err := delayService.SendDelayed(msg, delayDuration)
+	if err != nil {
+		log.Printf("[Main] 发送延迟消息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送延迟消息失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "延迟消息发送成功",
+		"data": gin.H{
+			"topic":      topic,
+			"level":      msg.Topic,
+			"partition":  partition,
+			"offset":     offset,
+			"deliver_at": time.Now().Add(delayDuration),
+		},
+	})
+}
+
+// upperCaseReply 示例回复方的处理函数，将请求内容转换为大写后回复
+func upperCaseReply(_ context.Context, msg *sarama.ConsumerMessage) ([]byte, error) {
+	if len(msg.Value) == 0 {
+		return nil, errors.New("请求内容不能为空")
+	}
+	return bytes.ToUpper(msg.Value), nil
+}
+
+// requestRequest 请求-回复接口的请求
+type requestRequest struct {
+	Key     *string           `json:"key"`     // 消息键，可为空
+	Value   string            `json:"value"`   // 请求内容
+	Headers map[string]string `json:"headers"` // 消息头
+	Timeout string            `json:"timeout"` // 等待回复的超时时间，如 3s，为空时使用配置的默认值
+}
+
+// handleRequest 演示请求-回复
+// 接收POST请求，请求体为 requestRequest；请求写入请求主题，示例回复方将内容转换为大写后写入当前实例的回复主题，
+// 接口等待回复后返回。超时返回504，回复方处理失败返回502
+func handleRequest(c *gin.Context) {
+	if requester == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用请求-回复"})
+		return
+	}
+	var req requestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数不合法: " + err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	if req.Timeout != "" {
+		timeout, err := time.ParseDuration(req.Timeout)
+		if err != nil || timeout <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "timeout参数不合法"})
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 未指定主题，发送到配置的请求主题
+	msg := &sarama.ProducerMessage{Value: sarama.StringEncoder(req.Value)}
+	if req.Key != nil {
+		msg.Key = sarama.StringEncoder(*req.Key)
+	}
+	for k, v := range req.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	tracing.Inject(ctx, msg)
+
+	log.Printf("[Main] 正在发送请求: topic=%s, %s", msg.Topic, tracing.FromContext(ctx))
+	start := time.Now()
+	resp, err := requester.Request(ctx, msg)
+	if err != nil {
+		log.Printf("[Main] 请求失败: %v", err)
+		var remote *reply.RemoteError
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, reply.ErrTimeout):
+			status = http.StatusGatewayTimeout
+		case errors.As(err, &remote):
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"error": "请求失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "收到回复",
+		"data": gin.H{
+			"correlation_id": reply.CorrelationID(resp),
+			"reply_topic":    resp.Topic,
+			"value":          string(resp.Value),
+			"elapsed":        time.Since(start).String(),
+		},
+	})
+}
+
+// handleGetConsumerLimits 查询消费者组当前的限流和背压参数，以及因背压暂停拉取的分区
+func handleGetConsumerLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data": gin.H{
+			"limits": groupConsumerService.Limits(),
+			"paused": groupConsumerService.PausedPartitions(),
+		},
+	})
+}
+
+// handleSetConsumerLimits 在运行时调整消费者组的限流和背压参数
+// 接收PUT请求，请求体为 config.LimitsConfig 的JSON，未出现的字段保持当前值
+func handleSetConsumerLimits(c *gin.Context) {
+	limits := groupConsumerService.Limits()
+	if err := c.ShouldBindJSON(&limits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数不合法: " + err.Error()})
+		return
+	}
+	if err := groupConsumerService.SetLimits(limits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[Main] 消费者组限流和背压参数已更新: %+v, %s", limits, tracing.FromContext(c.Request.Context()))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "更新成功",
+		"data":    limits,
+	})
+}
+
+// handleDedupStats 查询消费者跳过的重复消息数
+func handleDedupStats(c *gin.Context) {
+	if deduplicator == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用消息去重"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    deduplicator.Stats(),
+	})
+}
+
+// handleClaimCheckStats 查询大消息的压缩、转存、还原和清理次数
+func handleClaimCheckStats(c *gin.Context) {
+	if claimChecker == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用大消息处理"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    claimChecker.Stats(),
+	})
+}
+
+// batchMessage 批量发送请求中的一条消息
+type batchMessage struct {
+	Topic   string            `json:"topic"`   // 消息主题，为空时使用生产者的主题
+	Key     *string           `json:"key"`     // 消息键，可为空
+	Value   string            `json:"value"`   // 消息内容
+	Headers map[string]string `json:"headers"` // 消息头
+}
+
+// batchMessageResult 批量发送中一条消息的结果
+type batchMessageResult struct {
+	Index     int    `json:"index"`           // 消息在请求中的位置
+	Topic     string `json:"topic"`           // 消息主题
+	Partition int32  `json:"partition"`       // 写入的分区，失败时无意义
+	Offset    int64  `json:"offset"`          // 写入的偏移量，失败时无意义
+	Error     string `json:"error,omitempty"` // 失败原因，成功时为空
+}
+
+// newBatchMessageResult 将发送结果转换为响应中的一条结果
+func newBatchMessageResult(index int, result producer.DeliveryResult) batchMessageResult {
+	r := batchMessageResult{Index: index, Topic: result.Topic}
+	if result.Err != nil {
+		r.Error = result.Err.Error()
+		return r
+	}
+	r.Partition = result.Partition
+	r.Offset = result.Offset
+	return r
+}
+
+// handleSendMessages 批量发送消息
+// 接收POST请求，请求体为 batchMessage 数组，返回每条消息的发送结果；全部成功返回200，否则返回207
+// 查询参数:
+//   - mode: sync（默认）使用同步生产者一次发送整批消息；async 将整批消息放入异步生产者并等待全部发送结果
+//   - timeout: 等待发送结果的最长时间，默认5s；sync模式下超时后停止重试，尚未成功的消息返回错误
+func handleSendMessages(c *gin.Context) {
+	var req []batchMessage
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数不合法: " + err.Error()})
+		return
+	}
+	if len(req) == 0 || len(req) > maxBatchMessages {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "消息数量必须在1~" + strconv.Itoa(maxBatchMessages) + "之间",
+		})
+		return
+	}
+	mode := c.DefaultQuery("mode", "sync")
+	if mode != "sync" && mode != "async" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode参数应为sync或async"})
+		return
+	}
+	timeout, err := time.ParseDuration(c.DefaultQuery("timeout", defaultDeliveryTimeout.String()))
+	if err != nil || timeout <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout参数不合法"})
+		return
+	}
+
+	messages := make([]producer.Message, len(req))
+	for i, m := range req {
+		messages[i] = producer.Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: m.Headers}
+	}
+
+	log.Printf("[Main] 正在批量发送消息: mode=%s, 数量=%d, %s", mode, len(messages), tracing.FromContext(c.Request.Context()))
+	results := make([]batchMessageResult, len(messages))
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	if mode == "sync" {
+		for i, result := range syncProducerService.SendMessages(ctx, messages) {
+			results[i] = newBatchMessageResult(i, result)
+		}
+	} else {
+		for i, delivery := range asyncProducerService.SendMessages(c.Request.Context(), messages) {
+			result, err := delivery.Wait(ctx)
+			if err != nil {
+				results[i] = batchMessageResult{Index: i, Topic: messages[i].Topic, Error: "等待发送结果超时，消息仍可能发送成功"}
+				continue
+			}
+			results[i] = newBatchMessageResult(i, result)
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	log.Printf("[Main] 批量发送完成: mode=%s, 成功=%d, 失败=%d", mode, len(results)-failed, failed)
+	c.JSON(status, gin.H{
+		"message": "批量发送完成",
+		"data": gin.H{
+			"succeeded": len(results) - failed,
+			"failed":    failed,
+			"results":   results,
+		},
+	})
+}
+
+// replayRequest 死信消息重放请求
+type replayRequest struct {
+	Topic     string `json:"topic" binding:"required"` // 源主题或死信主题
+	Partition int32  `json:"partition"`                // 死信分区
+	Offset    int64  `json:"offset"`                   // 起始偏移量
+	EndOffset *int64 `json:"end_offset"`               // 结束偏移量（包含），为空时只重放一条；单次最多重放 dlq.MaxReplayMessages 条
+}
+
+// handleReplayDeadLetters 将死信消息重放回源主题
+// 接收POST请求，请求体为 replayRequest
+func handleReplayDeadLetters(c *gin.Context) {
+	var req replayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数不合法: " + err.Error(),
+		})
+		return
+	}
+
+	endOffset := req.Offset
+	if req.EndOffset != nil {
+		endOffset = *req.EndOffset
+	}
+
+	log.Printf("[Main] 正在重放死信消息: topic=%s, partition=%d, offset=%d-%d",
+		req.Topic, req.Partition, req.Offset, endOffset)
+	replayed, err := deadLetterService.Replay(req.Topic, req.Partition, req.Offset, endOffset)
+	if errors.Is(err, dlq.ErrReplayRangeTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("[Main] 重放死信消息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "重放死信消息失败: " + err.Error(),
+			"data":  replayed,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "重放成功",
+		"data":    replayed,
+	})
+}
+
+// adminErrorStatus 根据集群管理操作失败的原因选择HTTP状态码
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sarama.ErrUnknownTopicOrPartition), errors.Is(err, sarama.ErrGroupIDNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, sarama.ErrTopicAlreadyExists), errors.Is(err, admin.ErrGroupNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, admin.ErrInvalidReset), errors.Is(err, sarama.ErrInvalidTopic), errors.Is(err, sarama.ErrInvalidPartitions),
+		errors.Is(err, sarama.ErrInvalidReplicationFactor), errors.Is(err, sarama.ErrInvalidConfig):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleListTopics 列出集群中的所有主题
+func handleListTopics(c *gin.Context) {
+	topics, err := adminService.ListTopics()
+	if err != nil {
+		log.Printf("[Main] 查询主题列表失败: %v", err)
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    topics,
+	})
+}
+
+// createTopicRequest 创建主题请求
+type createTopicRequest struct {
+	Name              string            `json:"name" binding:"required"` // 主题名称
+	Partitions        int32             `json:"partitions"`              // 分区数，默认1
+	ReplicationFactor int16             `json:"replication_factor"`      // 副本数，默认1
+	Configs           map[string]string `json:"configs"`                 // 主题配置，例如 retention.ms
+}
+
+// handleCreateTopic 创建主题
+// 接收POST请求，请求体为 createTopicRequest
+func handleCreateTopic(c *gin.Context) {
+	var req createTopicRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数不合法: " + err.Error()})
+		return
+	}
+	if req.Partitions <= 0 {
+		req.Partitions = 1
+	}
+	if req.ReplicationFactor <= 0 {
+		req.ReplicationFactor = 1
+	}
+
+	if err := adminService.CreateTopic(req.Name, req.Partitions, req.ReplicationFactor, req.Configs); err != nil {
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "主题创建成功",
+		"data":    req,
+	})
+}
+
+// handleDescribeTopic 查询主题的分区分布和配置
+func handleDescribeTopic(c *gin.Context) {
+	detail, err := adminService.DescribeTopic(c.Param("topic"))
+	if err != nil {
+		log.Printf("[Main] 查询主题失败: %v", err)
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    detail,
+	})
+}
+
+// handleDeleteTopic 删除主题
+func handleDeleteTopic(c *gin.Context) {
+	topic := c.Param("topic")
+	if err := adminService.DeleteTopic(topic); err != nil {
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "主题删除成功",
+		"data":    gin.H{"name": topic},
+	})
+}
+
+// handleListConsumerGroups 列出所有消费者组及其成员
+func handleListConsumerGroups(c *gin.Context) {
+	groups, err := adminService.ListConsumerGroups()
+	if err != nil {
+		log.Printf("[Main] 查询消费者组列表失败: %v", err)
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    groups,
+	})
+}
+
+// handleDescribeConsumerGroup 查询消费者组的状态和成员
+func handleDescribeConsumerGroup(c *gin.Context) {
+	group, err := adminService.DescribeConsumerGroup(c.Param("group"))
+	if err != nil {
+		log.Printf("[Main] 查询消费者组失败: %v", err)
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data":    group,
+	})
+}
+
+// handleConsumerGroupLag 查询消费者组在各分区上的消费延迟
+// 查询参数:
+//   - topic: 要查询的主题，可重复；为空时查询消费者组提交过偏移量的所有主题
+func handleConsumerGroupLag(c *gin.Context) {
+	respondConsumerGroupLag(c, c.Param("group"), c.QueryArray("topic"))
+}
+
+// handleGroupConsumerLag 查询本服务消费者组在订阅主题各分区上的消费延迟
+func handleGroupConsumerLag(c *gin.Context) {
+	respondConsumerGroupLag(c, groupConsumerService.GroupID(), groupConsumerService.Topics())
+}
+
+// respondConsumerGroupLag 查询消费延迟并返回每个分区的延迟和总延迟
+func respondConsumerGroupLag(c *gin.Context, group string, topics []string) {
+	lags, err := adminService.ConsumerGroupLag(group, topics)
+	if err != nil {
+		log.Printf("[Main] 查询消费延迟失败: %v", err)
+		c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	var total int64
+	for _, lag := range lags {
+		total += lag.Lag
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询成功",
+		"data": gin.H{
+			"group":      group,
+			"total_lag":  total,
+			"partitions": lags,
+		},
+	})
+}
+
+// resetOffsetsRequest 消费者组偏移量重置请求
+type resetOffsetsRequest struct {
+	Topics    []string                   `json:"topics"`                      // 要重置的主题
+	Strategy  string                     `json:"strategy" binding:"required"` // earliest、latest、offset 或 timestamp
+	Offsets   map[string]map[int32]int64 `json:"offsets"`                     // offset策略下每个分区的目标偏移量
+	Timestamp time.Time                  `json:"timestamp"`                   // timestamp策略下的时间戳，RFC3339格式
+	DryRun    bool                       `json:"dry_run"`                     // 为true时只返回重置计划，不提交
+}
+
+// handleResetOffsets 重置消费者组的偏移量
+// 接收POST请求，请求体为 resetOffsetsRequest；提交前要求消费者组没有活跃成员，否则返回409
+func handleResetOffsets(c *gin.Context) {
+	var req resetOffsetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数不合法: " + err.Error()})
+		return
+	}
+	resetOffsets(c, c.Param("group"), nil, req)
+}
+
+// handleResetGroupConsumerOffsets 预览本服务消费者组的偏移量重置，未指定主题时使用订阅的主题
+// 本服务的消费者组服务运行期间消费者组总有活跃成员，提交必然失败，因此只接受 dry_run 请求，否则返回400；
+// 需要提交时先停止所有实例，再调用 /admin/groups/:group/reset
+func handleResetGroupConsumerOffsets(c *gin.Context) {
+	var req resetOffsetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数不合法: " + err.Error()})
+		return
+	}
+	group := groupConsumerService.GroupID()
+	if !req.DryRun {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("本服务运行时消费者组%s有活跃成员，此接口只支持dry_run；停止所有实例后使用 /admin/groups/%s/reset 提交", group, group),
+		})
+		return
+	}
+	resetOffsets(c, group, groupConsumerService.Topics(), req)
+}
+
+// resetOffsets 执行重置请求，defaultTopics 在请求未指定主题且不是offset策略时使用
+func resetOffsets(c *gin.Context, group string, defaultTopics []string, req resetOffsetsRequest) {
+	topics := req.Topics
+	if len(topics) == 0 && req.Strategy != admin.ResetOffset {
+		topics = defaultTopics
+	}
+
+	log.Printf("[Main] 正在重置消费者组偏移量: group=%s, strategy=%s, dry_run=%v", group, req.Strategy, req.DryRun)
+	plans, err := adminService.ResetOffsets(admin.ResetRequest{
+		Group:     group,
+		Topics:    topics,
+		Strategy:  req.Strategy,
+		Offsets:   req.Offsets,
+		Timestamp: req.Timestamp,
+		DryRun:    req.DryRun,
+	})
+	if err != nil {
+		log.Printf("[Main] 重置消费者组偏移量失败: %v", err)
+		c.JSON(adminErrorStatus(err), gin.H{
+			"error": err.Error(),
+			"data":  plans,
+		})
+		return
+	}
+
+	message := "偏移量重置成功"
+	if req.DryRun {
+		message = "偏移量重置预览"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data": gin.H{
+			"group":   group,
+			"dry_run": req.DryRun,
+			"plans":   plans,
 		},
 	})
 }
@@ -0,0 +1,291 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kafka-example/common"
+	"kafka-example/config"
+	"kafka-example/dlq"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	logPrefix = "[Pipeline] "
+
+	defaultBatchSize    = 100         // 未配置时每个事务最多包含的输入消息数
+	defaultBatchTimeout = time.Second // 未配置时批次未满的最长等待时间
+)
+
+// TransformFunc 将一条输入消息转换为零到多条输出消息
+// 输出消息未指定主题时写入管道的输出主题；返回错误时输入消息在同一事务中转存到死信主题
+type TransformFunc func(ctx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error)
+
+// Service 事务消费-转换-生产管道
+// 从输入主题消费消息，转换后写入输出主题；输出消息和消费偏移量在同一个Kafka事务中提交，
+// 下游以 read_committed 隔离级别消费时，每条输入消息的结果恰好可见一次
+type Service struct {
+	runner   *common.GroupRunner // 消费输入主题的消费循环
+	producer sarama.SyncProducer // 事务生产者
+	topics   []string            // 输入主题
+	handler  *txnHandler         // 消费者组处理器
+
+	stopOnce sync.Once // 确保只停止一次
+	stopErr  error     // Stop的结果
+}
+
+// txnHandler 实现 sarama.ConsumerGroupHandler 接口
+// 每个批次在一个事务中写入输出消息并提交偏移量
+type txnHandler struct {
+	producer     sarama.SyncProducer
+	groupID      string
+	outputTopic  string
+	transform    TransformFunc
+	batchSize    int
+	batchTimeout time.Duration
+	onFatal      func(err error) // 事务生产者进入不可恢复状态时调用
+
+	txnMu sync.Mutex // 事务生产者同一时间只能进行一个事务，多个分区的批次串行提交
+}
+
+// NewService 创建事务管道
+// 参数:
+//   - cfg: Kafka配置，使用其中的 Pipeline 配置
+//   - transform: 消息转换函数
+//
+// 返回:
+//   - *Service: 事务管道实例
+//   - error: 创建失败时返回错误
+func NewService(cfg *config.Config, transform TransformFunc) (*Service, error) {
+	p := cfg.Pipeline
+	log.Printf("%s正在创建事务管道: %s -> %s, group=%s, transactional_id=%s",
+		logPrefix, p.InputTopic, p.OutputTopic, p.GroupID, p.TransactionalID)
+
+	saramaConfig, err := cfg.PipelineSaramaConfig()
+	if err != nil {
+		return nil, fmt.Errorf("管道配置不合法: %w", err)
+	}
+
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建事务生产者失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建事务生产者失败: %w", err)
+	}
+	group, err := sarama.NewConsumerGroup(cfg.Brokers, p.GroupID, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建消费者组失败: %v", logPrefix, err)
+		_ = producer.Close()
+		return nil, fmt.Errorf("创建消费者组失败: %w", err)
+	}
+
+	log.Printf("%s事务管道创建成功", logPrefix)
+	return newService(group, producer, p, transform), nil
+}
+
+// newService 使用已创建的消费者组和事务生产者组装管道
+func newService(group sarama.ConsumerGroup, producer sarama.SyncProducer, p config.PipelineConfig, transform TransformFunc) *Service {
+	s := &Service{
+		producer: producer,
+		topics:   []string{p.InputTopic},
+	}
+	s.handler = &txnHandler{
+		producer:     producer,
+		groupID:      p.GroupID,
+		outputTopic:  p.OutputTopic,
+		transform:    transform,
+		batchSize:    p.BatchSize,
+		batchTimeout: p.BatchTimeout,
+		onFatal:      func(error) { s.runner.Cancel() },
+	}
+	if s.handler.batchSize <= 0 {
+		s.handler.batchSize = defaultBatchSize
+	}
+	if s.handler.batchTimeout <= 0 {
+		s.handler.batchTimeout = defaultBatchTimeout
+	}
+	// 事务失败导致会话结束后 Consume 返回，重新加入后从已提交的偏移量继续
+	s.runner = common.NewGroupRunner(group, s.topics, s.handler, logPrefix)
+	return s
+}
+
+// Setup 在消费者组会话开始前调用
+func (*txnHandler) Setup(_ sarama.ConsumerGroupSession) error {
+	log.Printf("%s消费者组会话开始", logPrefix)
+	return nil
+}
+
+// Cleanup 在消费者组会话结束后调用
+// 偏移量只随事务提交，这里不调用 sess.Commit
+func (*txnHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
+	log.Printf("%s消费者组会话结束", logPrefix)
+	return nil
+}
+
+// ConsumeClaim 按批次消费分区消息，每个批次一个事务
+// 批次达到 batchSize 或等待超过 batchTimeout 时提交；事务失败时中止事务并返回错误，
+// 会话随之结束，重新分配后从上次事务提交的偏移量继续消费，已中止事务中的输出对下游不可见
+func (h *txnHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	log.Printf("%s开始消费分区 %d 的消息", logPrefix, claim.Partition())
+
+	ctx := sess.Context()
+	batch := make([]*sarama.ConsumerMessage, 0, h.batchSize)
+	timer := time.NewTimer(h.batchTimeout)
+	defer timer.Stop()
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := h.processBatch(ctx, batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				// 未提交的批次在下次分配时重新消费
+				log.Printf("%s分区 %d 的消息消费完成", logPrefix, claim.Partition())
+				return nil
+			}
+			if len(batch) == 0 {
+				timer.Reset(h.batchTimeout)
+			}
+			batch = append(batch, msg)
+			if len(batch) < h.batchSize {
+				continue
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			log.Printf("%s会话已结束，停止消费分区 %d", logPrefix, claim.Partition())
+			return nil
+		}
+	}
+}
+
+// processBatch 在一个事务中写入批次的输出消息，并将批次最后一条消息之后的偏移量提交到消费者组
+// 返回:
+//   - error: 事务未提交时返回错误，此时事务已中止
+func (h *txnHandler) processBatch(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+	outputs, err := h.transformBatch(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	h.txnMu.Lock()
+	defer h.txnMu.Unlock()
+
+	if err := h.producer.BeginTxn(); err != nil {
+		return h.abort(fmt.Errorf("开启事务失败: %w", err))
+	}
+	if len(outputs) > 0 {
+		if err := h.producer.SendMessages(outputs); err != nil {
+			return h.abort(fmt.Errorf("写入输出消息失败: %w", err))
+		}
+	}
+	// 同一批次的消息来自同一分区，提交最后一条消息即可
+	last := batch[len(batch)-1]
+	if err := h.producer.AddMessageToTxn(last, h.groupID, nil); err != nil {
+		return h.abort(fmt.Errorf("将偏移量加入事务失败: %w", err))
+	}
+	if err := h.producer.CommitTxn(); err != nil {
+		return h.abort(fmt.Errorf("提交事务失败: %w", err))
+	}
+
+	log.Printf("%s事务提交成功: topic=%s, partition=%d, offsets=%d-%d, outputs=%d",
+		logPrefix, last.Topic, last.Partition, batch[0].Offset, last.Offset, len(outputs))
+	return nil
+}
+
+// transformBatch 转换批次中的每条消息
+// 转换失败的消息转为死信消息，与输出消息一起写入事务
+func (h *txnHandler) transformBatch(ctx context.Context, batch []*sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	outputs := make([]*sarama.ProducerMessage, 0, len(batch))
+	for _, msg := range batch {
+		results, err := h.transform(ctx, msg)
+		if err != nil {
+			// 会话已结束导致的失败不转存死信，消息会在下次分配时重新消费
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("%s转换消息失败，转存到死信主题: topic=%s, partition=%d, offset=%d, error=%v",
+				logPrefix, msg.Topic, msg.Partition, msg.Offset, err)
+			outputs = append(outputs, dlq.NewMessage(msg, err, 1))
+			continue
+		}
+		for _, out := range results {
+			if out.Topic == "" {
+				out.Topic = h.outputTopic
+			}
+			outputs = append(outputs, out)
+		}
+	}
+	return outputs, nil
+}
+
+// abort 中止当前事务
+// 事务生产者处于不可恢复状态时无法中止，通知管道停止；事务未开启时无需中止
+func (h *txnHandler) abort(cause error) error {
+	status := h.producer.TxnStatus()
+	if status&sarama.ProducerTxnFlagFatalError != 0 {
+		log.Printf("%s事务生产者不可恢复，停止管道: %v", logPrefix, cause)
+		if h.onFatal != nil {
+			h.onFatal(cause)
+		}
+		return cause
+	}
+	if status&sarama.ProducerTxnFlagInTransaction == 0 {
+		return cause
+	}
+	if err := h.producer.AbortTxn(); err != nil {
+		log.Printf("%s中止事务失败: %v, cause=%v", logPrefix, err, cause)
+		return errors.Join(cause, fmt.Errorf("中止事务失败: %w", err))
+	}
+	log.Printf("%s事务已中止: %v", logPrefix, cause)
+	return cause
+}
+
+// Start 启动管道
+// ctx: 上下文，用于控制管道的生命周期，取消后消费循环退出
+func (s *Service) Start(ctx context.Context) error {
+	log.Printf("%s正在启动事务管道...", logPrefix)
+	if err := s.runner.Start(ctx); err != nil {
+		return fmt.Errorf("事务管道已启动: %w", err)
+	}
+	log.Printf("%s事务管道启动成功", logPrefix)
+	return nil
+}
+
+// Stop 停止管道
+// 取消消费循环，等待当前批次的事务结束后关闭消费者组和事务生产者
+func (s *Service) Stop() error {
+	s.stopOnce.Do(func() {
+		log.Printf("%s正在停止事务管道...", logPrefix)
+		var errs []error
+		if err := s.runner.Stop(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := s.producer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("关闭事务生产者失败: %w", err))
+		}
+		s.stopErr = errors.Join(errs...)
+
+		if s.stopErr != nil {
+			log.Printf("%s停止事务管道失败: %v", logPrefix, s.stopErr)
+		} else {
+			log.Printf("%s事务管道已停止", logPrefix)
+		}
+	})
+	return s.stopErr
+}
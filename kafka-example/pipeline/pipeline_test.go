@@ -0,0 +1,292 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"kafka-example/config"
+	"kafka-example/dlq"
+	"kafka-example/kafkatest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// txnProducer 在 mocks.SyncProducer 的基础上记录事务操作
+type txnProducer struct {
+	*mocks.SyncProducer
+
+	mu        sync.Mutex
+	commits   int
+	aborts    int
+	offsets   []int64 // 加入事务的消息偏移量
+	commitErr error   // CommitTxn 返回的错误
+	fatal     bool    // 模拟事务生产者不可恢复
+}
+
+func newTxnProducer(t *testing.T) *txnProducer {
+	cfg := mocks.NewTestConfig()
+	cfg.Version = sarama.V2_1_0_0
+	cfg.Producer.Idempotent = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Transaction.ID = "test-txn"
+	cfg.Net.MaxOpenRequests = 1
+	return &txnProducer{SyncProducer: mocks.NewSyncProducer(t, cfg)}
+}
+
+func (p *txnProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupID string, metadata *string) error {
+	p.mu.Lock()
+	p.offsets = append(p.offsets, msg.Offset)
+	p.mu.Unlock()
+	return p.SyncProducer.AddMessageToTxn(msg, groupID, metadata)
+}
+
+func (p *txnProducer) CommitTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.commitErr != nil {
+		return p.commitErr
+	}
+	p.commits++
+	return p.SyncProducer.CommitTxn()
+}
+
+func (p *txnProducer) AbortTxn() error {
+	p.mu.Lock()
+	p.aborts++
+	p.mu.Unlock()
+	return p.SyncProducer.AbortTxn()
+}
+
+func (p *txnProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	if p.fatal {
+		return sarama.ProducerTxnFlagFatalError
+	}
+	return p.SyncProducer.TxnStatus()
+}
+
+func (p *txnProducer) counts() (commits, aborts int, offsets []int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.commits, p.aborts, append([]int64(nil), p.offsets...)
+}
+
+// upperTransform 将消息内容转为大写，内容为 bad 时返回错误
+func upperTransform(_ context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	if string(msg.Value) == "bad" {
+		return nil, errors.New("无法转换")
+	}
+	return []*sarama.ProducerMessage{{Value: sarama.StringEncoder(strings.ToUpper(string(msg.Value)))}}, nil
+}
+
+func newTestHandler(producer sarama.SyncProducer, batchSize int, onFatal func(error)) *txnHandler {
+	return &txnHandler{
+		producer:     producer,
+		groupID:      "test-group",
+		outputTopic:  "out",
+		transform:    upperTransform,
+		batchSize:    batchSize,
+		batchTimeout: 10 * time.Millisecond,
+		onFatal:      onFatal,
+	}
+}
+
+// newTestBroker 创建输入主题为 in 的内存broker，依次向分区0写入消息
+func newTestBroker(values ...string) *kafkatest.Broker {
+	broker := kafkatest.NewBroker("in", 0)
+	for _, v := range values {
+		broker.Produce(0, v)
+	}
+	return broker
+}
+
+func messages(values ...string) []*sarama.ConsumerMessage {
+	msgs := make([]*sarama.ConsumerMessage, len(values))
+	for i, v := range values {
+		msgs[i] = &sarama.ConsumerMessage{Topic: "in", Partition: 0, Offset: int64(i), Value: []byte(v)}
+	}
+	return msgs
+}
+
+// TestTxnHandler_processBatch 测试批次在一个事务中写入输出并提交偏移量，失败时中止事务
+func TestTxnHandler_processBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      []string
+		setup       func(p *txnProducer)
+		wantErr     bool
+		wantCommits int
+		wantAborts  int
+		wantFatal   bool
+	}{
+		{
+			name:   "成功提交事务",
+			values: []string{"a", "b"},
+			setup: func(p *txnProducer) {
+				p.ExpectSendMessageWithCheckerFunctionAndSucceed(checkValue("A"))
+				p.ExpectSendMessageWithCheckerFunctionAndSucceed(checkValue("B"))
+			},
+			wantCommits: 1,
+		},
+		{
+			name:   "转换失败的消息在事务中转存死信",
+			values: []string{"a", "bad"},
+			setup: func(p *txnProducer) {
+				p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checkTopic("out"))
+				p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checkTopic(dlq.Topic("in")))
+			},
+			wantCommits: 1,
+		},
+		{
+			name:   "写入输出失败时中止事务",
+			values: []string{"a"},
+			setup: func(p *txnProducer) {
+				p.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+			},
+			wantErr:    true,
+			wantAborts: 1,
+		},
+		{
+			name:   "提交事务失败时中止事务",
+			values: []string{"a"},
+			setup: func(p *txnProducer) {
+				p.ExpectSendMessageAndSucceed()
+				p.commitErr = sarama.ErrProducerFenced
+			},
+			wantErr:    true,
+			wantAborts: 1,
+		},
+		{
+			name:   "事务生产者不可恢复时停止管道",
+			values: []string{"a"},
+			setup: func(p *txnProducer) {
+				p.ExpectSendMessageAndSucceed()
+				p.commitErr = sarama.ErrProducerFenced
+				p.fatal = true
+			},
+			wantErr:   true,
+			wantFatal: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := newTxnProducer(t)
+			tt.setup(producer)
+			fatal := false
+			h := newTestHandler(producer, 10, func(error) { fatal = true })
+
+			err := h.processBatch(context.Background(), messages(tt.values...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("processBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			commits, aborts, offsets := producer.counts()
+			if commits != tt.wantCommits || aborts != tt.wantAborts {
+				t.Errorf("commits = %d, aborts = %d, 期望 %d, %d", commits, aborts, tt.wantCommits, tt.wantAborts)
+			}
+			if tt.wantCommits > 0 && (len(offsets) != 1 || offsets[0] != int64(len(tt.values)-1)) {
+				t.Errorf("加入事务的偏移量 = %v, 期望批次最后一条消息", offsets)
+			}
+			if fatal != tt.wantFatal {
+				t.Errorf("fatal = %v, 期望 %v", fatal, tt.wantFatal)
+			}
+			if err := producer.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestTxnHandler_ConsumeClaim 测试按批次大小和超时提交事务，事务失败时返回错误结束会话
+func TestTxnHandler_ConsumeClaim(t *testing.T) {
+	t.Run("按批次提交事务", func(t *testing.T) {
+		producer := newTxnProducer(t)
+		for i := 0; i < 3; i++ {
+			producer.ExpectSendMessageAndSucceed()
+		}
+		h := newTestHandler(producer, 2, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		sess, claim := newTestBroker("a", "b", "c").Claim(ctx, 0)
+		done := make(chan error, 1)
+		go func() { done <- h.ConsumeClaim(sess, claim) }()
+
+		// 前两条消息凑满一个批次，第三条消息等待超时后单独提交
+		deadline := time.After(time.Second)
+		for {
+			if commits, _, _ := producer.counts(); commits == 2 {
+				break
+			}
+			select {
+			case <-deadline:
+				t.Fatal("等待事务提交超时")
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("ConsumeClaim() error = %v", err)
+		}
+		if _, _, offsets := producer.counts(); len(offsets) != 2 || offsets[0] != 1 || offsets[1] != 2 {
+			t.Errorf("加入事务的偏移量 = %v, 期望 [1 2]", offsets)
+		}
+	})
+
+	t.Run("事务失败时返回错误", func(t *testing.T) {
+		producer := newTxnProducer(t)
+		producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+		h := newTestHandler(producer, 1, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := h.ConsumeClaim(newTestBroker("a", "b").Claim(ctx, 0))
+		if err == nil {
+			t.Fatal("ConsumeClaim() 期望返回错误")
+		}
+		if commits, aborts, _ := producer.counts(); commits != 0 || aborts != 1 {
+			t.Errorf("commits = %d, aborts = %d, 期望 0, 1", commits, aborts)
+		}
+	})
+}
+
+// TestService_Stop 测试停止管道时关闭消费者组和事务生产者
+func TestService_Stop(t *testing.T) {
+	producer := newTxnProducer(t)
+	group := newTestBroker().NewConsumerGroup()
+	s := newService(group, producer, config.PipelineConfig{InputTopic: "in", OutputTopic: "out"}, upperTransform)
+	if s.handler.batchSize != defaultBatchSize || s.handler.batchTimeout != defaultBatchTimeout {
+		t.Errorf("未配置时应使用默认批次参数: %d, %v", s.handler.batchSize, s.handler.batchTimeout)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if !group.Closed() {
+		t.Error("消费者组未关闭")
+	}
+}
+
+func checkValue(want string) mocks.ValueChecker {
+	return func(val []byte) error {
+		if string(val) != want {
+			return errors.New("输出内容 " + string(val) + " 不等于 " + want)
+		}
+		return nil
+	}
+}
+
+func checkTopic(want string) mocks.MessageChecker {
+	return func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != want {
+			return errors.New("输出主题 " + msg.Topic + " 不等于 " + want)
+		}
+		return nil
+	}
+}
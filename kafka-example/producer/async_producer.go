@@ -1,98 +1,249 @@
 package producer
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"kafka-example/claimcheck"
 	"kafka-example/common"
+	"kafka-example/config"
 	"log"
+	"math"
 	"sync"
 
 	"github.com/IBM/sarama"
 )
 
-// 全局变量，用于确保错误处理协程只启动一次
-var (
-	errorHandler   sync.Once // 错误处理协程的Once对象
-	successHandler sync.Once // 成功处理协程的Once对象
-)
+// RetryCountHeader 记录应用层重试次数的消息头，值为大端序的uint16，死信队列据此计算尝试次数
+const RetryCountHeader = "retry_count"
 
 // AsyncProducerService 表示Kafka异步生产者服务
-// 该服务提供异步发送消息的功能，不等待消息发送完成就返回
+// 该服务提供异步发送消息的功能，不等待消息发送完成就返回，发送结果通过 Delivery 获取；
+// 发送失败的消息按指数退避延迟重试，最终失败的消息交给 FailureSink，不会导致进程退出
 type AsyncProducerService struct {
-	producer sarama.AsyncProducer // Kafka异步生产者实例
-	brokers  []string             // Kafka broker地址列表
+	producer  sarama.AsyncProducer    // Kafka异步生产者实例
+	brokers   []string                // Kafka broker地址列表
+	topic     string                  // 发送消息的主题
+	retry     config.AsyncRetryConfig // 应用层重试配置
+	scheduler *retryScheduler         // 延迟重试调度器
+	sink      FailureSink             // 最终失败消息的去向，可为空
+	closeSink func() error            // 关闭服务自行创建的落盘文件，可为空
+	manual    bool                    // 是否使用manual分区器
+	wg        sync.WaitGroup          // 等待结果处理协程退出
+
+	claimCheck *claimcheck.ClaimCheck // 大消息的压缩和转存，可为空
 }
 
 // NewAsyncProducerService 创建一个异步生产者服务
+// 参数:
+//   - opts: 可选配置，未指定时使用默认配置
+//
 // 返回:
 //   - *AsyncProducerService: 异步生产者服务实例
 //   - error: 创建失败时返回错误
-func NewAsyncProducerService() (*AsyncProducerService, error) {
-	log.Printf("%s正在创建异步生产者: brokers=%v", common.LogPrefixService, []string{common.Broker})
+func NewAsyncProducerService(opts ...Option) (*AsyncProducerService, error) {
+	o := newOptions(opts, func(cfg *config.Config) string { return cfg.Topics.Async })
+	log.Printf("%s正在创建异步生产者: brokers=%v, topic=%s", common.LogPrefixService, o.brokers, o.topic)
 
 	// 配置生产者参数
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll // 等待所有副本确认
-	config.Producer.Idempotent = true                // 启用幂等性，确保消息不会重复发送
-	config.Producer.Retry.Max = 5                    // 最大重试次数
-	config.Net.MaxOpenRequests = 1                   // 最大并发请求数
-	config.Producer.Return.Errors = true             // 返回错误信息
+	config, err := o.config.ProducerSaramaConfig()
+	if err != nil {
+		log.Printf("%s生产者配置不合法: %v", common.LogPrefixService, err)
+		return nil, err
+	}
+	config.Producer.Return.Errors = true    // 返回错误信息
+	config.Producer.Return.Successes = true // 返回成功信息，用于完成 Delivery
+	manual, err := o.applyPartitioner(config)
+	if err != nil {
+		log.Printf("%s分区器配置不合法: %v", common.LogPrefixService, err)
+		return nil, err
+	}
 
 	// 创建异步生产者
-	producer, err := sarama.NewAsyncProducer([]string{common.Broker}, config)
+	producer, err := o.newAsyncProducer(o.brokers, config)
 	if err != nil {
 		log.Printf("%s创建异步生产者失败: %v", common.LogPrefixService, err)
 		return nil, err
 	}
 
-	s := &AsyncProducerService{
-		producer: producer,
-		brokers:  []string{common.Broker},
+	// 准备最终失败消息的去向
+	sink, closeSink, err := o.buildFailureSink()
+	if err != nil {
+		log.Printf("%s创建失败消息去向失败: %v", common.LogPrefixService, err)
+		_ = producer.Close()
+		return nil, err
 	}
 
-	// 启动错误处理协程
-	errorHandler.Do(s.errorHanding)
+	s := newAsyncProducer(producer, o, sink)
+	s.closeSink = closeSink
+	s.manual = manual
 	log.Printf("%s异步生产者创建成功", common.LogPrefixService)
 	return s, nil
 }
 
+// newAsyncProducer 使用已创建的异步生产者组装服务，并启动该实例的结果处理协程
+func newAsyncProducer(producer sarama.AsyncProducer, o *options, sink FailureSink) *AsyncProducerService {
+	s := &AsyncProducerService{
+		producer: producer,
+		brokers:  o.brokers,
+		topic:    o.topic,
+		retry:    o.config.Producer.AsyncRetry,
+		sink:     sink,
+
+		claimCheck: o.claimCheck,
+	}
+	s.scheduler = newRetryScheduler(producer.Input(), s.retry, s.fail)
+
+	// 启动成功和错误处理协程
+	s.successHanding()
+	s.errorHanding()
+	return s
+}
+
+// successHanding 处理发送成功的消息
+// 启动一个协程监听成功通道，完成消息关联的 Delivery
+func (s *AsyncProducerService) successHanding() {
+	log.Printf("%s启动成功处理协程", common.LogPrefixAsync)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for msg := range s.producer.Successes() {
+			resolveDelivery(msg, nil)
+		}
+	}()
+}
+
 // errorHanding 处理异步发送过程中的错误
-// 启动一个协程监听错误通道，对可重试的错误进行重试
+// 启动一个协程监听错误通道，按错误分类决定是否重试，重试耗尽的消息交给 FailureSink
 func (s *AsyncProducerService) errorHanding() {
 	log.Printf("%s启动错误处理协程", common.LogPrefixAsync)
+	s.wg.Add(1)
 	go func() {
+		defer s.wg.Done()
 		// 从错误通道中读取错误
 		for result := range s.producer.Errors() {
-			if common.IsRetryableError(result.Err) {
-				log.Printf("%s消息发送失败，准备重试: topic=%s, partition=%d, error=%v",
-					common.LogPrefixAsync, result.Msg.Topic, result.Msg.Partition, result.Err)
-				err := s.retrySend(result.Msg, 5)
-				if err != nil {
-					log.Fatal(err)
-				}
-			} else {
-				log.Printf("%s消息发送失败(不可重试): topic=%s, partition=%d, error=%v",
-					common.LogPrefixAsync, result.Msg.Topic, result.Msg.Partition, result.Err)
+			if err := s.handleError(result); err != nil {
+				s.fail(result.Msg, err)
 			}
 		}
 	}()
 }
 
+// handleError 根据错误分类处理单条发送失败的消息
+// 可重试错误最多重试 MaxRetries 次，未知错误最多重试 common.UnknownErrorMaxRetries 次，不可重试错误直接交给 FailureSink
+// 返回:
+//   - error: 重试次数耗尽时返回错误
+func (s *AsyncProducerService) handleError(result *sarama.ProducerError) error {
+	switch common.ClassifyError(result.Err) {
+	case common.ErrorClassRetryable:
+		log.Printf("%s消息发送失败，准备重试: topic=%s, partition=%d, error=%v",
+			common.LogPrefixAsync, result.Msg.Topic, result.Msg.Partition, result.Err)
+		return s.retrySend(result.Msg, s.maxRetries())
+	case common.ErrorClassUnknown:
+		log.Printf("%s消息发送失败(未知错误)，准备重试: topic=%s, partition=%d, error=%v",
+			common.LogPrefixAsync, result.Msg.Topic, result.Msg.Partition, result.Err)
+		return s.retrySend(result.Msg, common.UnknownErrorMaxRetries)
+	default:
+		log.Printf("%s消息发送失败(不可重试): topic=%s, partition=%d, error=%v",
+			common.LogPrefixAsync, result.Msg.Topic, result.Msg.Partition, result.Err)
+		s.fail(result.Msg, result.Err)
+		return nil
+	}
+}
+
+// maxRetries 返回可重试错误的最大重试次数，未配置时为5次，超过重试计数头能表示的范围时取 math.MaxUint16
+func (s *AsyncProducerService) maxRetries() uint16 {
+	if s.retry.MaxRetries <= 0 {
+		return 5
+	}
+	return uint16(min(s.retry.MaxRetries, math.MaxUint16))
+}
+
+// fail 处理最终发送失败的消息
+// 交给 FailureSink 保存后，以失败结果完成消息关联的 Delivery
+func (s *AsyncProducerService) fail(msg *sarama.ProducerMessage, cause error) {
+	if s.sink != nil {
+		if err := s.sink.Spill(msg, cause); err != nil {
+			log.Printf("%s保存失败消息失败，消息丢失: topic=%s, error=%v, cause=%v",
+				common.LogPrefixAsync, msg.Topic, err, cause)
+		} else {
+			log.Printf("%s失败消息已保存: topic=%s, cause=%v", common.LogPrefixAsync, msg.Topic, cause)
+		}
+	} else {
+		log.Printf("%s消息最终发送失败，已丢弃: topic=%s, cause=%v", common.LogPrefixAsync, msg.Topic, cause)
+	}
+	resolveDelivery(msg, cause)
+}
+
 // SendMessage 异步发送消息
 // 参数:
 //   - message: 要发送的消息内容
-func (s *AsyncProducerService) SendMessage(message string) {
-	// 创建生产者消息
-	msg := &sarama.ProducerMessage{
-		Topic: common.AsyncTopic,
-		Value: sarama.StringEncoder(message),
-	}
-	log.Printf("%s发送消息: topic=%s, message=%s", common.LogPrefixAsync, common.AsyncTopic, message)
-	// 将消息发送到输入通道
+//   - opts: 消息键、分区、消息头以及发送完成（成功或最终失败）后的回调
+//
+// 返回:
+//   - *Delivery: 发送结果的future，可以忽略；消息参数不合法时立即以失败完成
+func (s *AsyncProducerService) SendMessage(message string, opts ...SendOption) *Delivery {
+	msg, callbacks, err := buildMessage(s.topic, message, s.manual, opts)
+	if err != nil {
+		log.Printf("%s消息参数不合法: topic=%s, error=%v", common.LogPrefixAsync, s.topic, err)
+		delivery := newDelivery(callbacks)
+		delivery.resolve(DeliveryResult{Topic: s.topic, Err: err})
+		return delivery
+	}
+	log.Printf("%s发送消息: topic=%s, message=%s", common.LogPrefixAsync, s.topic, message)
+	return s.send(msg, callbacks)
+}
+
+// SendMessages 将一批消息放入输入通道，不等待发送完成
+// 参数:
+//   - ctx: 上下文，其中的追踪信息会写入每条消息的消息头
+//   - messages: 要发送的消息，未指定主题的消息发送到服务的主题
+//
+// 返回:
+//   - []*Delivery: 与 messages 一一对应的发送结果
+func (s *AsyncProducerService) SendMessages(ctx context.Context, messages []Message) []*Delivery {
+	log.Printf("%s批量发送消息: 数量=%d", common.LogPrefixAsync, len(messages))
+	deliveries := make([]*Delivery, len(messages))
+	for i, m := range messages {
+		deliveries[i] = s.send(m.build(ctx, s.topic), nil)
+	}
+	return deliveries
+}
+
+// Send 异步发送已构造好的消息，实现 Sender 接口
+// 消息未指定主题时发送到服务的主题；消息的Metadata会被替换为返回的 Delivery
+// 参数:
+//   - msg: 要发送的消息
+//   - callbacks: 发送完成（成功或最终失败）后的回调
+//
+// 返回:
+//   - *Delivery: 发送结果的future
+func (s *AsyncProducerService) Send(msg *sarama.ProducerMessage, callbacks ...DeliveryCallback) *Delivery {
+	if msg.Topic == "" {
+		msg.Topic = s.topic
+	}
+	log.Printf("%s发送消息: topic=%s", common.LogPrefixAsync, msg.Topic)
+	return s.send(msg, callbacks)
+}
+
+// send 通过Metadata关联发送结果后，将消息放入输入通道
+// 启用claim-check时先压缩或转存大消息的消息体，失败时立即以失败完成
+func (s *AsyncProducerService) send(msg *sarama.ProducerMessage, callbacks []DeliveryCallback) *Delivery {
+	delivery := newDelivery(callbacks)
+	if s.claimCheck != nil {
+		if err := s.claimCheck.Offload(context.Background(), msg); err != nil {
+			log.Printf("%s处理大消息失败: topic=%s, error=%v", common.LogPrefixAsync, msg.Topic, err)
+			delivery.resolve(DeliveryResult{Topic: msg.Topic, Err: err})
+			return delivery
+		}
+	}
+	msg.Metadata = delivery
 	s.producer.Input() <- msg
+	return delivery
 }
 
 // retrySend 异步重试发送消息
+// 更新消息头中的重试计数后交给调度器，按指数退避加随机抖动延迟发送
 // 参数:
 //   - msg: 要重试发送的消息
 //   - maxRetries: 最大重试次数
@@ -100,16 +251,15 @@ func (s *AsyncProducerService) SendMessage(message string) {
 // 返回:
 //   - error: 重试失败时返回错误
 func (s *AsyncProducerService) retrySend(msg *sarama.ProducerMessage, maxRetries uint16) error {
-	value := make([]byte, 2)
+	// 检查消息头中是否已有重试计数，值不是2字节时（如调用方自行设置的消息头）按0处理并覆盖
 	var retryCount uint16 = 0
-
-	// 检查消息头中是否已有重试计数
+	index := -1
 	for i := range msg.Headers {
-		if string(msg.Headers[i].Key) == "retry_count" {
-			retryCount = binary.BigEndian.Uint16(msg.Headers[i].Value)
-			value := make([]byte, 2)
-			binary.BigEndian.PutUint16(value, retryCount+1)
-			msg.Headers[i].Value = value
+		if string(msg.Headers[i].Key) == RetryCountHeader {
+			if len(msg.Headers[i].Value) == 2 {
+				retryCount = binary.BigEndian.Uint16(msg.Headers[i].Value)
+			}
+			index = i
 			break
 		}
 	}
@@ -121,29 +271,42 @@ func (s *AsyncProducerService) retrySend(msg *sarama.ProducerMessage, maxRetries
 		return errors.New("消息重发失败，超过重试次数上限")
 	}
 
-	// 如果是首次重试，添加重试计数头
-	if retryCount == 0 {
-		binary.BigEndian.PutUint16(value, retryCount+1)
+	// 更新重试计数头，首次重试时添加
+	value := make([]byte, 2)
+	binary.BigEndian.PutUint16(value, retryCount+1)
+	if index >= 0 {
+		msg.Headers[index].Value = value
+	} else {
 		msg.Headers = append(msg.Headers, sarama.RecordHeader{
-			Key:   []byte("retry_count"),
+			Key:   []byte(RetryCountHeader),
 			Value: value,
 		})
 	}
 
-	log.Printf("%s开始第%d次重试: topic=%s", common.LogPrefixAsync, retryCount+1, msg.Topic)
-	// 将消息重新发送到输入通道
-	s.producer.Input() <- msg
+	log.Printf("%s安排第%d次重试: topic=%s", common.LogPrefixAsync, retryCount+1, msg.Topic)
+	s.scheduler.schedule(msg, int(retryCount)+1)
 	return nil
 }
 
 // Close 关闭异步生产者服务
+// 先放弃等待中的重试，再关闭生产者并等待结果处理协程退出，关闭期间失败的消息同样交给 FailureSink
 // 返回:
 //   - error: 关闭失败时返回错误
 func (s *AsyncProducerService) Close() error {
 	log.Printf("%s正在关闭异步生产者服务", common.LogPrefixAsync)
-	if err := s.producer.Close(); err != nil {
+	if s.scheduler != nil {
+		s.scheduler.close()
+	}
+	err := s.producer.Close()
+	if err != nil {
 		log.Printf("%s关闭异步生产者失败: %v", common.LogPrefixAsync, err)
-		return err
 	}
-	return nil
+	s.wg.Wait()
+	if s.closeSink != nil {
+		if cerr := s.closeSink(); cerr != nil {
+			log.Printf("%s关闭失败消息落盘文件失败: %v", common.LogPrefixAsync, cerr)
+			err = errors.Join(err, cerr)
+		}
+	}
+	return err
 }
@@ -1,29 +1,66 @@
 package producer
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"kafka-example/common"
+	"kafka-example/config"
+	"math"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
 )
 
 // TestNewAsyncProducerService 测试异步生产者服务的创建
+// 通过 WithAsyncProducerFactory 注入mock生产者，不需要连接Kafka
 func TestNewAsyncProducerService(t *testing.T) {
+	// 不落盘，避免测试在包目录下创建失败消息文件
+	noSpill := config.Default()
+	noSpill.Producer.AsyncRetry.Spill = "none"
+	dlq := config.Default()
+	dlq.Producer.AsyncRetry.Spill = "dlq"
+
 	tests := []struct {
-		name    string
-		wantErr bool
+		name       string
+		cfg        *config.Config
+		factoryErr error
+		wantErr    bool
 	}{
 		{
 			name:    "正常创建异步生产者",
+			cfg:     noSpill,
 			wantErr: false,
 		},
+		{
+			name:       "创建sarama生产者失败",
+			cfg:        noSpill,
+			factoryErr: errors.New("连接broker失败"),
+			wantErr:    true,
+		},
+		{
+			name:    "失败消息去向不合法时关闭已创建的生产者",
+			cfg:     dlq,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			producer, err := NewAsyncProducerService()
+			factory := func(_ []string, cfg *sarama.Config) (sarama.AsyncProducer, error) {
+				if tt.factoryErr != nil {
+					return nil, tt.factoryErr
+				}
+				if !cfg.Producer.Return.Successes || !cfg.Producer.Return.Errors {
+					t.Error("异步生产者需要返回成功和错误信息")
+				}
+				return mocks.NewAsyncProducer(t, cfg), nil
+			}
+			producer, err := NewAsyncProducerService(WithConfig(tt.cfg), WithAsyncProducerFactory(factory))
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewAsyncProducerService() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -49,6 +86,7 @@ func TestAsyncProducerService_SendMessage(t *testing.T) {
 	service := &AsyncProducerService{
 		producer: mockProducer,
 		brokers:  []string{common.Broker},
+		topic:    common.AsyncTopic,
 	}
 
 	// 设置预期
@@ -75,10 +113,8 @@ func TestAsyncProducerService_SendMessage(t *testing.T) {
 // TestAsyncProducerService_retrySend 测试异步重试发送
 func TestAsyncProducerService_retrySend(t *testing.T) {
 	mockProducer := createMockAsyncProducer(t)
-	service := &AsyncProducerService{
-		producer: mockProducer,
-		brokers:  []string{common.Broker},
-	}
+	service := newTestAsyncProducer(mockProducer, nil)
+	defer service.Close()
 
 	tests := []struct {
 		name       string
@@ -132,13 +168,25 @@ func TestAsyncProducerService_retrySend(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockProducer.ExpectInputAndSucceed()
+			if !tt.wantErr {
+				mockProducer.ExpectInputAndSucceed()
+			}
 			msg := tt.setupMsg()
+			delivery := newDelivery(nil)
+			msg.Metadata = delivery
 
 			err := service.retrySend(msg, tt.maxRetries)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("retrySend() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if !tt.wantErr {
+				// 等待调度器延迟后重新发送成功
+				select {
+				case <-delivery.Done():
+				case <-time.After(time.Second):
+					t.Fatal("等待重试发送超时")
+				}
+			}
 
 			if !tt.wantErr {
 				// 验证重试计数
@@ -162,3 +210,186 @@ func TestAsyncProducerService_retrySend(t *testing.T) {
 		})
 	}
 }
+
+// TestAsyncProducerService_Delivery 测试异步发送结果的回调和future
+func TestAsyncProducerService_Delivery(t *testing.T) {
+	mockProducer := createMockAsyncProducer(t)
+	service := &AsyncProducerService{
+		producer: mockProducer,
+		brokers:  []string{common.Broker},
+		topic:    common.AsyncTopic,
+	}
+	service.successHanding()
+	defer service.Close()
+
+	t.Run("发送成功后返回分区和偏移量", func(t *testing.T) {
+		mockProducer.ExpectInputAndSucceed()
+
+		called := make(chan DeliveryResult, 1)
+		delivery := service.SendMessage("test delivery", WithCallback(func(result DeliveryResult) {
+			called <- result
+		}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		result, err := delivery.Wait(ctx)
+		if err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		if result.Err != nil || result.Topic != common.AsyncTopic || result.Offset != 1 {
+			t.Errorf("Wait() = %+v, 期望发送成功且偏移量为1", result)
+		}
+		if got := <-called; got != result {
+			t.Errorf("回调结果 = %+v, 期望 %+v", got, result)
+		}
+	})
+
+	t.Run("批量发送返回每条消息的结果", func(t *testing.T) {
+		mockProducer.ExpectInputAndSucceed()
+		mockProducer.ExpectInputAndSucceed()
+
+		deliveries := service.SendMessages(context.Background(), []Message{{Value: "a"}, {Topic: "other-topic", Value: "b"}})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		for i, want := range []string{common.AsyncTopic, "other-topic"} {
+			result, err := deliveries[i].Wait(ctx)
+			if err != nil {
+				t.Fatalf("Wait() error = %v", err)
+			}
+			if result.Err != nil || result.Topic != want {
+				t.Errorf("第%d条消息的结果 = %+v, 期望发送到 %s", i+1, result, want)
+			}
+		}
+	})
+
+	t.Run("不可重试错误返回最终错误", func(t *testing.T) {
+		delivery := newDelivery(nil)
+		msg := mockMessage(common.AsyncTopic, "test delivery")
+		msg.Metadata = delivery
+		if err := service.handleError(&sarama.ProducerError{Msg: msg, Err: sarama.ErrMessageSizeTooLarge}); err != nil {
+			t.Fatalf("handleError() error = %v", err)
+		}
+		if result := delivery.Result(); !errors.Is(result.Err, sarama.ErrMessageSizeTooLarge) {
+			t.Errorf("Result().Err = %v, 期望 %v", result.Err, sarama.ErrMessageSizeTooLarge)
+		}
+	})
+
+	t.Run("等待超时", func(t *testing.T) {
+		delivery := newDelivery(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := delivery.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Wait() error = %v, 期望 %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+// TestAsyncProducerService_MalformedRetryCount 测试调用方设置的retry_count消息头不合法时按0处理，不会导致崩溃
+func TestAsyncProducerService_MalformedRetryCount(t *testing.T) {
+	mockProducer := createMockAsyncProducer(t)
+	service := newTestAsyncProducer(mockProducer, &recordingSink{})
+	defer service.Close()
+
+	mockProducer.ExpectInputAndFail(sarama.ErrLeaderNotAvailable)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		for _, h := range msg.Headers {
+			if string(h.Key) == RetryCountHeader {
+				if len(h.Value) != 2 || binary.BigEndian.Uint16(h.Value) != 1 {
+					return fmt.Errorf("重试计数头 = %v, 期望覆盖为1", h.Value)
+				}
+				return nil
+			}
+		}
+		return errors.New("缺少重试计数头")
+	})
+
+	delivery := service.SendMessage("test malformed", WithHeaders(map[string]string{RetryCountHeader: "1"}))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := delivery.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if result.Err != nil {
+		t.Errorf("重试后应发送成功, Err = %v", result.Err)
+	}
+}
+
+// recordingSink 记录最终发送失败的消息
+type recordingSink struct {
+	mu     sync.Mutex
+	causes []error
+}
+
+func (r *recordingSink) Spill(_ *sarama.ProducerMessage, cause error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.causes = append(r.causes, cause)
+	return nil
+}
+
+func (r *recordingSink) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.causes)
+}
+
+// TestAsyncProducerService_RetryExhausted 测试重试耗尽的消息交给 FailureSink，且每个实例都会处理错误
+func TestAsyncProducerService_RetryExhausted(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		sink := &recordingSink{}
+		mockProducer := createMockAsyncProducer(t)
+		service := newTestAsyncProducer(mockProducer, sink)
+
+		// 首次发送和5次重试全部失败
+		for j := 0; j <= 5; j++ {
+			mockProducer.ExpectInputAndFail(sarama.ErrLeaderNotAvailable)
+		}
+		delivery := service.SendMessage("test exhausted")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		result, err := delivery.Wait(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("实例%d: Wait() error = %v", i, err)
+		}
+		if result.Err == nil {
+			t.Errorf("实例%d: 重试耗尽后应返回错误", i)
+		}
+		if sink.count() != 1 {
+			t.Errorf("实例%d: 落盘消息数 = %d, 期望 1", i, sink.count())
+		}
+		if err := service.Close(); err != nil {
+			t.Errorf("实例%d: Close() error = %v", i, err)
+		}
+	}
+}
+
+// newTestAsyncProducer 使用模拟生产者创建异步生产者服务，重试等待时间很短
+func newTestAsyncProducer(producer sarama.AsyncProducer, sink FailureSink) *AsyncProducerService {
+	o := newOptions(nil, func(cfg *config.Config) string { return cfg.Topics.Async })
+	o.config.Producer.AsyncRetry.Backoff = time.Millisecond
+	o.config.Producer.AsyncRetry.MaxBackoff = 5 * time.Millisecond
+	return newAsyncProducer(producer, o, sink)
+}
+
+// TestAsyncProducerService_maxRetries 测试最大重试次数不超过重试计数头能表示的范围
+func TestAsyncProducerService_maxRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		want       uint16
+	}{
+		{name: "未配置时默认5次", maxRetries: 0, want: 5},
+		{name: "按配置", maxRetries: 3, want: 3},
+		{name: "超过uint16范围时截断", maxRetries: 70000, want: math.MaxUint16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AsyncProducerService{retry: config.AsyncRetryConfig{MaxRetries: tt.maxRetries}}
+			if got := s.maxRetries(); got != tt.want {
+				t.Errorf("maxRetries() = %d, 期望 %d", got, tt.want)
+			}
+		})
+	}
+}
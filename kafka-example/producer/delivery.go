@@ -0,0 +1,89 @@
+package producer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// DeliveryResult 异步发送消息的最终结果
+type DeliveryResult struct {
+	Topic     string // 消息写入的主题
+	Partition int32  // 消息写入的分区，失败时无意义
+	Offset    int64  // 消息写入的偏移量，失败时无意义
+	Err       error  // 最终错误，为空表示发送成功
+}
+
+// DeliveryCallback 异步发送完成后的回调
+// 在生产者的结果处理协程中调用，不应执行耗时操作
+type DeliveryCallback func(result DeliveryResult)
+
+// Delivery 异步发送结果的future
+// 通过 sarama.ProducerMessage.Metadata 与消息关联，重试不会改变关联关系
+type Delivery struct {
+	done      chan struct{}
+	once      sync.Once
+	result    DeliveryResult
+	callbacks []DeliveryCallback
+}
+
+// newDelivery 创建未完成的发送结果
+func newDelivery(callbacks []DeliveryCallback) *Delivery {
+	return &Delivery{
+		done:      make(chan struct{}),
+		callbacks: callbacks,
+	}
+}
+
+// Done 返回发送完成时关闭的通道
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Result 阻塞直到发送完成并返回结果
+func (d *Delivery) Result() DeliveryResult {
+	<-d.done
+	return d.result
+}
+
+// Wait 等待发送完成，上下文先结束时返回上下文的错误
+// 参数:
+//   - ctx: 用于控制等待时间的上下文
+//
+// 返回:
+//   - DeliveryResult: 发送结果，其中的Err为发送失败的原因
+//   - error: 等待超时或上下文取消时返回错误
+func (d *Delivery) Wait(ctx context.Context) (DeliveryResult, error) {
+	select {
+	case <-d.done:
+		return d.result, nil
+	case <-ctx.Done():
+		return DeliveryResult{}, ctx.Err()
+	}
+}
+
+// resolve 设置发送结果并调用回调，只有第一次调用生效
+func (d *Delivery) resolve(result DeliveryResult) {
+	d.once.Do(func() {
+		d.result = result
+		close(d.done)
+		for _, callback := range d.callbacks {
+			callback(result)
+		}
+	})
+}
+
+// resolveDelivery 根据消息关联的 Delivery 设置发送结果，未关联时忽略
+func resolveDelivery(msg *sarama.ProducerMessage, err error) {
+	d, ok := msg.Metadata.(*Delivery)
+	if !ok {
+		return
+	}
+	d.resolve(DeliveryResult{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Err:       err,
+	})
+}
@@ -0,0 +1,139 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"kafka-example/tracing"
+	"sort"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrManualPartitionRequired 指定分区但未使用manual分区器（或实现了 ManualPartitioner 的自定义分区器）时返回的错误
+var ErrManualPartitionRequired = errors.New("指定分区需要使用manual分区器")
+
+// sendOptions 单条消息的可选参数
+type sendOptions struct {
+	key       *string
+	partition *int32
+	headers   map[string]string
+	callbacks []DeliveryCallback
+	ctx       context.Context
+}
+
+// SendOption 发送单条消息时的函数式选项
+type SendOption func(*sendOptions)
+
+// WithKey 指定消息键，相同键的消息写入同一分区，保证按键有序
+func WithKey(key string) SendOption {
+	return func(o *sendOptions) {
+		o.key = &key
+	}
+}
+
+// WithPartition 指定消息写入的分区，只有使用manual分区器或实现了 ManualPartitioner 的自定义分区器时生效，否则发送失败
+func WithPartition(partition int32) SendOption {
+	return func(o *sendOptions) {
+		o.partition = &partition
+	}
+}
+
+// WithHeaders 追加消息头
+func WithHeaders(headers map[string]string) SendOption {
+	return func(o *sendOptions) {
+		if o.headers == nil {
+			o.headers = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			o.headers[k] = v
+		}
+	}
+}
+
+// WithCallback 发送完成（成功或最终失败）后的回调
+func WithCallback(callback DeliveryCallback) SendOption {
+	return func(o *sendOptions) {
+		o.callbacks = append(o.callbacks, callback)
+	}
+}
+
+// WithContext 将上下文中的追踪信息（traceparent、tracestate、请求ID）写入消息头
+// 通过 WithHeaders 显式指定的同名消息头优先
+func WithContext(ctx context.Context) SendOption {
+	return func(o *sendOptions) {
+		o.ctx = ctx
+	}
+}
+
+// Message 批量发送中的一条消息
+type Message struct {
+	Topic   string            // 消息主题，为空时使用服务的主题
+	Key     *string           // 消息键，可为空
+	Value   string            // 消息内容
+	Headers map[string]string // 消息头
+}
+
+// build 构造生产者消息，并写入上下文中的追踪信息
+func (m Message) build(ctx context.Context, defaultTopic string) *sarama.ProducerMessage {
+	topic := m.Topic
+	if topic == "" {
+		topic = defaultTopic
+	}
+	opts := []SendOption{WithContext(ctx)}
+	if m.Key != nil {
+		opts = append(opts, WithKey(*m.Key))
+	}
+	if len(m.Headers) > 0 {
+		opts = append(opts, WithHeaders(m.Headers))
+	}
+	// 未指定分区，不会返回错误
+	msg, _, _ := buildMessage(topic, m.Value, false, opts)
+	return msg
+}
+
+// buildMessage 根据消息内容和选项构造生产者消息
+// 参数:
+//   - topic: 消息主题
+//   - message: 消息内容
+//   - manual: 是否使用消息中指定的分区
+//   - opts: 单条消息的可选参数
+//
+// 返回:
+//   - *sarama.ProducerMessage: 生产者消息
+//   - []DeliveryCallback: 发送完成后的回调
+//   - error: 指定了分区但未使用manual分区器时返回错误
+func buildMessage(topic, message string, manual bool, opts []SendOption) (*sarama.ProducerMessage, []DeliveryCallback, error) {
+	o := &sendOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.StringEncoder(message),
+	}
+	if o.key != nil {
+		msg.Key = sarama.StringEncoder(*o.key)
+	}
+	if o.partition != nil {
+		if !manual {
+			return nil, o.callbacks, ErrManualPartitionRequired
+		}
+		msg.Partition = *o.partition
+	}
+	if len(o.headers) > 0 {
+		// 按键排序，保证消息头顺序稳定
+		keys := make([]string, 0, len(o.headers))
+		for k := range o.headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(o.headers[k])})
+		}
+	}
+	if o.ctx != nil {
+		tracing.Inject(o.ctx, msg)
+	}
+	return msg, o.callbacks, nil
+}
@@ -0,0 +1,88 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"kafka-example/tracing"
+	"testing"
+)
+
+// TestBuildMessage 测试根据选项构造消息
+func TestBuildMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		manual  bool
+		opts    []SendOption
+		check   func(t *testing.T, key string, partition int32, headers []string)
+		wantErr error
+	}{
+		{
+			name: "指定消息键和消息头",
+			opts: []SendOption{WithKey("user-1"), WithHeaders(map[string]string{"b": "2", "a": "1"})},
+			check: func(t *testing.T, key string, _ int32, headers []string) {
+				if key != "user-1" {
+					t.Errorf("key = %q, 期望 user-1", key)
+				}
+				if len(headers) != 2 || headers[0] != "a=1" || headers[1] != "b=2" {
+					t.Errorf("headers = %v, 期望按名称排序", headers)
+				}
+			},
+		},
+		{
+			name:   "manual分区器下指定分区",
+			manual: true,
+			opts:   []SendOption{WithPartition(3)},
+			check: func(t *testing.T, _ string, partition int32, _ []string) {
+				if partition != 3 {
+					t.Errorf("partition = %d, 期望 3", partition)
+				}
+			},
+		},
+		{
+			name: "写入上下文中的追踪信息，显式指定的消息头优先",
+			opts: []SendOption{
+				WithHeaders(map[string]string{tracing.HeaderRequestID: "explicit"}),
+				WithContext(tracing.NewContext(context.Background(), tracing.Context{
+					TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+					RequestID:   "from-context",
+				})),
+			},
+			check: func(t *testing.T, _ string, _ int32, headers []string) {
+				want := []string{
+					"x-request-id=explicit",
+					"traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				}
+				if len(headers) != 2 || headers[0] != want[0] || headers[1] != want[1] {
+					t.Errorf("headers = %v, 期望 %v", headers, want)
+				}
+			},
+		},
+		{
+			name:    "非manual分区器下指定分区",
+			opts:    []SendOption{WithPartition(3)},
+			wantErr: ErrManualPartitionRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _, err := buildMessage("test-topic", "hello", tt.manual, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("buildMessage() error = %v, 期望 %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var key string
+			if msg.Key != nil {
+				b, _ := msg.Key.Encode()
+				key = string(b)
+			}
+			headers := make([]string, 0, len(msg.Headers))
+			for _, h := range msg.Headers {
+				headers = append(headers, string(h.Key)+"="+string(h.Value))
+			}
+			tt.check(t, key, msg.Partition, headers)
+		})
+	}
+}
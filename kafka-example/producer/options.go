@@ -0,0 +1,184 @@
+package producer
+
+import (
+	"errors"
+	"fmt"
+	"kafka-example/claimcheck"
+	"kafka-example/config"
+
+	"github.com/IBM/sarama"
+)
+
+// options 生产者服务的可选配置
+type options struct {
+	config  *config.Config // Kafka配置
+	brokers []string       // 覆盖配置中的broker地址列表
+	topic   string         // 覆盖配置中的主题
+
+	failureSink FailureSink                   // 异步生产者最终失败消息的去向，覆盖配置中的spill
+	partitioner sarama.PartitionerConstructor // 自定义分区器，覆盖配置中的partitioner
+	claimCheck  *claimcheck.ClaimCheck        // 大消息的压缩和转存，为空时不处理
+
+	newSyncProducer  SyncProducerFactory  // 创建sarama同步生产者，默认 sarama.NewSyncProducer
+	newAsyncProducer AsyncProducerFactory // 创建sarama异步生产者，默认 sarama.NewAsyncProducer
+}
+
+// SyncProducerFactory 创建sarama同步生产者的函数，签名与 sarama.NewSyncProducer 相同
+type SyncProducerFactory func(addrs []string, config *sarama.Config) (sarama.SyncProducer, error)
+
+// AsyncProducerFactory 创建sarama异步生产者的函数，签名与 sarama.NewAsyncProducer 相同
+type AsyncProducerFactory func(addrs []string, config *sarama.Config) (sarama.AsyncProducer, error)
+
+// Option 生产者服务的函数式选项
+type Option func(*options)
+
+// WithConfig 使用指定的配置创建生产者
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithBrokers 覆盖配置中的broker地址列表
+func WithBrokers(brokers ...string) Option {
+	return func(o *options) {
+		o.brokers = brokers
+	}
+}
+
+// WithTopic 覆盖配置中的主题
+func WithTopic(topic string) Option {
+	return func(o *options) {
+		o.topic = topic
+	}
+}
+
+// WithFailureSink 指定异步生产者最终失败消息的去向，例如死信队列
+func WithFailureSink(sink FailureSink) Option {
+	return func(o *options) {
+		o.failureSink = sink
+	}
+}
+
+// WithPartitioner 使用自定义分区器，覆盖配置中的partitioner
+func WithPartitioner(partitioner sarama.PartitionerConstructor) Option {
+	return func(o *options) {
+		o.partitioner = partitioner
+	}
+}
+
+// WithClaimCheck 发送前压缩超过阈值的消息体，压缩后仍然过大的转存到blob存储
+// 消费者需要使用同一个blob存储才能还原消息体
+func WithClaimCheck(c *claimcheck.ClaimCheck) Option {
+	return func(o *options) {
+		o.claimCheck = c
+	}
+}
+
+// WithSyncProducerFactory 指定创建sarama同步生产者的函数
+// 测试中可以返回 mocks.SyncProducer，不需要连接Kafka
+func WithSyncProducerFactory(factory SyncProducerFactory) Option {
+	return func(o *options) {
+		o.newSyncProducer = factory
+	}
+}
+
+// WithAsyncProducerFactory 指定创建sarama异步生产者的函数
+// 测试中可以返回 mocks.AsyncProducer，不需要连接Kafka
+func WithAsyncProducerFactory(factory AsyncProducerFactory) Option {
+	return func(o *options) {
+		o.newAsyncProducer = factory
+	}
+}
+
+// ManualPartitioner 按消息中指定的分区写入的自定义分区器
+// 通过 WithPartitioner 注册的分区器实现该接口且 HonorsMessagePartition 返回true时，
+// 与manual分区器一样允许 WithPartition 指定分区；未实现时指定分区会返回 ErrManualPartitionRequired
+type ManualPartitioner interface {
+	sarama.Partitioner
+	// HonorsMessagePartition 是否使用消息中指定的分区
+	HonorsMessagePartition() bool
+}
+
+// applyPartitioner 根据选项和配置设置sarama的分区器
+// 返回:
+//   - bool: 是否使用manual分区器（或实现了 ManualPartitioner 的自定义分区器），只有此时消息中指定的分区才会生效
+//   - error: 分区器不合法时返回错误
+func (o *options) applyPartitioner(cfg *sarama.Config) (bool, error) {
+	if o.partitioner != nil {
+		cfg.Producer.Partitioner = o.partitioner
+		p, ok := o.partitioner(o.topic).(ManualPartitioner)
+		return ok && p.HonorsMessagePartition(), nil
+	}
+	switch o.config.Producer.Partitioner {
+	case "", config.PartitionerHash:
+		cfg.Producer.Partitioner = sarama.NewHashPartitioner
+	case config.PartitionerMurmur2:
+		cfg.Producer.Partitioner = NewMurmur2Partitioner
+	case config.PartitionerRoundRobin:
+		cfg.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	case config.PartitionerManual:
+		cfg.Producer.Partitioner = sarama.NewManualPartitioner
+		return true, nil
+	case config.PartitionerCustom:
+		return false, errors.New("partitioner为custom时需要通过WithPartitioner指定分区器")
+	default:
+		return false, fmt.Errorf("未知的分区器: %s", o.config.Producer.Partitioner)
+	}
+	return false, nil
+}
+
+// buildFailureSink 根据选项和配置创建最终失败消息的去向
+// 返回:
+//   - FailureSink: 失败消息的去向，spill为none时为空
+//   - func() error: 关闭服务自行创建的落盘文件，无需关闭时为空
+//   - error: 创建失败时返回错误
+func (o *options) buildFailureSink() (FailureSink, func() error, error) {
+	if o.failureSink != nil {
+		return o.failureSink, nil, nil
+	}
+	retry := o.config.Producer.AsyncRetry
+	switch retry.Spill {
+	case "", "file":
+		path := retry.SpillPath
+		if path == "" {
+			path = "data/async_spill.jsonl"
+		}
+		spill, err := NewFileSpill(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return spill, spill.Close, nil
+	case "none":
+		return nil, nil, nil
+	case "dlq":
+		return nil, nil, errors.New("spill为dlq时需要通过WithFailureSink指定死信队列")
+	default:
+		return nil, nil, fmt.Errorf("未知的失败消息去向: %s", retry.Spill)
+	}
+}
+
+// newOptions 应用选项并补全默认值
+// defaultTopic 用于从配置中选出同步或异步主题
+func newOptions(opts []Option, defaultTopic func(*config.Config) string) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.config == nil {
+		o.config = config.Default()
+	}
+	if len(o.brokers) == 0 {
+		o.brokers = o.config.Brokers
+	}
+	if o.topic == "" {
+		o.topic = defaultTopic(o.config)
+	}
+	if o.newSyncProducer == nil {
+		o.newSyncProducer = sarama.NewSyncProducer
+	}
+	if o.newAsyncProducer == nil {
+		o.newAsyncProducer = sarama.NewAsyncProducer
+	}
+	return o
+}
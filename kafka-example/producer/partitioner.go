@@ -0,0 +1,73 @@
+package producer
+
+import (
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+// murmur2Partitioner 与Java客户端默认分区器一致的分区器
+// 有消息键时按 murmur2(key) 的非负值对分区数取模，与Java客户端写入同一主题时相同的键落在同一分区；
+// 没有消息键时随机选择分区
+type murmur2Partitioner struct {
+	random sarama.Partitioner
+}
+
+// NewMurmur2Partitioner 创建与Java客户端兼容的murmur2分区器，可用作 sarama.PartitionerConstructor
+func NewMurmur2Partitioner(topic string) sarama.Partitioner {
+	return &murmur2Partitioner{random: sarama.NewRandomPartitioner(topic)}
+}
+
+// Partition 选择消息的分区
+func (p *murmur2Partitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if msg.Key == nil {
+		return p.random.Partition(msg, numPartitions)
+	}
+	key, err := msg.Key.Encode()
+	if err != nil {
+		return -1, fmt.Errorf("编码消息键失败: %w", err)
+	}
+	return int32(murmur2(key)&0x7fffffff) % numPartitions, nil
+}
+
+// RequiresConsistency 相同的键必须始终落在同一分区
+func (p *murmur2Partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// murmur2 Java客户端 org.apache.kafka.common.utils.Utils.murmur2 的实现
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,112 @@
+package producer
+
+import (
+	"kafka-example/config"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// TestMurmur2 测试murmur2哈希与Java客户端的结果一致
+// 期望值来自Kafka源码中的 UtilsTest.testMurmur2
+func TestMurmur2(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int32
+	}{
+		{key: "21", want: -973932308},
+		{key: "foobar", want: -790332482},
+		{key: "a-little-bit-long-string", want: -985981536},
+		{key: "a-little-bit-longer-string", want: -1486304829},
+		{key: "lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", want: -58897971},
+		{key: "abc", want: 479470107},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := int32(murmur2([]byte(tt.key))); got != tt.want {
+				t.Errorf("murmur2(%q) = %d, 期望 %d", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMurmur2Partitioner 测试相同的键总是落在同一分区
+func TestMurmur2Partitioner(t *testing.T) {
+	p := NewMurmur2Partitioner("test-topic")
+	msg := &sarama.ProducerMessage{Key: sarama.StringEncoder("foobar")}
+	first, err := p.Partition(msg, 12)
+	if err != nil {
+		t.Fatalf("Partition() error = %v", err)
+	}
+	// (-790332482 & 0x7fffffff) % 12
+	if first != 6 {
+		t.Errorf("Partition() = %d, 期望 6", first)
+	}
+	for i := 0; i < 10; i++ {
+		if got, _ := p.Partition(msg, 12); got != first {
+			t.Fatalf("相同的键落在不同分区: %d != %d", got, first)
+		}
+	}
+	if got, err := p.Partition(&sarama.ProducerMessage{}, 12); err != nil || got < 0 || got >= 12 {
+		t.Errorf("无键消息的分区 = %d, error = %v", got, err)
+	}
+}
+
+// testManualPartitioner 使用消息中指定分区的自定义分区器
+type testManualPartitioner struct {
+	sarama.Partitioner
+}
+
+func newTestManualPartitioner(topic string) sarama.Partitioner {
+	return testManualPartitioner{Partitioner: sarama.NewManualPartitioner(topic)}
+}
+
+func (testManualPartitioner) HonorsMessagePartition() bool {
+	return true
+}
+
+// TestOptions_applyPartitioner 测试根据配置选择分区器
+func TestOptions_applyPartitioner(t *testing.T) {
+	tests := []struct {
+		name        string
+		partitioner string
+		custom      sarama.PartitionerConstructor
+		wantManual  bool
+		wantErr     bool
+	}{
+		{name: "默认hash分区器", partitioner: ""},
+		{name: "murmur2分区器", partitioner: config.PartitionerMurmur2},
+		{name: "轮询分区器", partitioner: config.PartitionerRoundRobin},
+		{name: "manual分区器", partitioner: config.PartitionerManual, wantManual: true},
+		{name: "custom分区器未注册", partitioner: config.PartitionerCustom, wantErr: true},
+		{name: "custom分区器", partitioner: config.PartitionerCustom, custom: sarama.NewRandomPartitioner},
+		{name: "custom分区器使用消息中的分区", partitioner: config.PartitionerCustom, custom: newTestManualPartitioner, wantManual: true},
+		{name: "未知的分区器", partitioner: "sticky", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Producer.Partitioner = tt.partitioner
+			opts := []Option{WithConfig(cfg)}
+			if tt.custom != nil {
+				opts = append(opts, WithPartitioner(tt.custom))
+			}
+			o := newOptions(opts, func(cfg *config.Config) string { return cfg.Topics.Sync })
+
+			saramaConfig := sarama.NewConfig()
+			saramaConfig.Producer.Partitioner = nil
+			manual, err := o.applyPartitioner(saramaConfig)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyPartitioner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if manual != tt.wantManual {
+				t.Errorf("manual = %v, 期望 %v", manual, tt.wantManual)
+			}
+			if !tt.wantErr && saramaConfig.Producer.Partitioner == nil {
+				t.Error("未设置分区器")
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package producer
+
+import (
+	"errors"
+	"kafka-example/config"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// errProducerClosed 生产者关闭时仍在等待重试的消息以该错误结束
+var errProducerClosed = errors.New("生产者已关闭，放弃重试")
+
+// retryScheduler 延迟重试调度器
+// 按指数退避加随机抖动延迟后，将消息重新放回异步生产者的输入通道
+type retryScheduler struct {
+	input   chan<- *sarama.ProducerMessage               // 异步生产者的输入通道
+	fail    func(msg *sarama.ProducerMessage, err error) // 关闭时处理尚未重试的消息
+	backoff time.Duration                                // 首次重试前的等待时间
+	max     time.Duration                                // 等待时间上限
+	jitter  float64                                      // 随机抖动比例
+
+	mu       sync.Mutex
+	closed   bool
+	nextID   uint64
+	pending  map[uint64]*pendingRetry // 等待中的重试，由取出者负责发送或放弃
+	closing  chan struct{}            // 关闭时关闭，中断阻塞在输入通道上的发送
+	inflight sync.WaitGroup           // 正在向输入通道发送的消息
+}
+
+// pendingRetry 等待中的一次重试
+type pendingRetry struct {
+	timer *time.Timer
+	msg   *sarama.ProducerMessage
+}
+
+// newRetryScheduler 创建延迟重试调度器
+func newRetryScheduler(input chan<- *sarama.ProducerMessage, cfg config.AsyncRetryConfig,
+	fail func(*sarama.ProducerMessage, error)) *retryScheduler {
+	return &retryScheduler{
+		input:   input,
+		fail:    fail,
+		backoff: cfg.Backoff,
+		max:     cfg.MaxBackoff,
+		jitter:  cfg.Jitter,
+		pending: make(map[uint64]*pendingRetry),
+		closing: make(chan struct{}),
+	}
+}
+
+// delay 计算第 attempt 次重试前的等待时间
+// 等待时间为 backoff*2^(attempt-1)，不超过上限，再叠加 ±jitter 比例的随机抖动
+func (r *retryScheduler) delay(attempt int) time.Duration {
+	if r.backoff <= 0 || attempt <= 0 {
+		return 0
+	}
+	d := r.backoff
+	for i := 1; i < attempt && (r.max <= 0 || d < r.max); i++ {
+		d *= 2
+	}
+	if r.max > 0 && d > r.max {
+		d = r.max
+	}
+	if r.jitter > 0 {
+		d = time.Duration(float64(d) * (1 + r.jitter*(rand.Float64()*2-1)))
+	}
+	return d
+}
+
+// schedule 在第 attempt 次重试的等待时间后重新发送消息
+// 调度器已关闭时直接放弃该消息
+func (r *retryScheduler) schedule(msg *sarama.ProducerMessage, attempt int) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		r.fail(msg, errProducerClosed)
+		return
+	}
+	id := r.nextID
+	r.nextID++
+	r.pending[id] = &pendingRetry{
+		msg:   msg,
+		timer: time.AfterFunc(r.delay(attempt), func() { r.fire(id) }),
+	}
+	r.mu.Unlock()
+}
+
+// fire 等待时间到达后发送消息
+func (r *retryScheduler) fire(id uint64) {
+	r.mu.Lock()
+	p, ok := r.pending[id]
+	if !ok {
+		// 已被 close 取出
+		r.mu.Unlock()
+		return
+	}
+	delete(r.pending, id)
+	r.inflight.Add(1)
+	r.mu.Unlock()
+	defer r.inflight.Done()
+
+	select {
+	case r.input <- p.msg:
+	case <-r.closing:
+		r.fail(p.msg, errProducerClosed)
+	}
+}
+
+// close 停止调度，放弃所有等待中的重试
+// 返回后不会再向输入通道发送消息，可以安全关闭生产者
+func (r *retryScheduler) close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	pending := r.pending
+	r.pending = make(map[uint64]*pendingRetry)
+	r.mu.Unlock()
+
+	close(r.closing)
+	r.inflight.Wait()
+	for _, p := range pending {
+		p.timer.Stop()
+		r.fail(p.msg, errProducerClosed)
+	}
+}
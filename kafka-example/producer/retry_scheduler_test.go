@@ -0,0 +1,100 @@
+package producer
+
+import (
+	"errors"
+	"kafka-example/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TestRetryScheduler_delay 测试指数退避和随机抖动
+func TestRetryScheduler_delay(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.AsyncRetryConfig
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{
+			name:    "首次重试使用初始等待时间",
+			cfg:     config.AsyncRetryConfig{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second},
+			attempt: 1,
+			min:     100 * time.Millisecond,
+			max:     100 * time.Millisecond,
+		},
+		{
+			name:    "等待时间指数增长",
+			cfg:     config.AsyncRetryConfig{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second},
+			attempt: 3,
+			min:     400 * time.Millisecond,
+			max:     400 * time.Millisecond,
+		},
+		{
+			name:    "不超过等待时间上限",
+			cfg:     config.AsyncRetryConfig{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second},
+			attempt: 10,
+			min:     time.Second,
+			max:     time.Second,
+		},
+		{
+			name:    "随机抖动在比例范围内",
+			cfg:     config.AsyncRetryConfig{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.5},
+			attempt: 2,
+			min:     100 * time.Millisecond,
+			max:     300 * time.Millisecond,
+		},
+		{
+			name:    "未配置等待时间时立即重试",
+			cfg:     config.AsyncRetryConfig{},
+			attempt: 3,
+			min:     0,
+			max:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRetryScheduler(nil, tt.cfg, nil)
+			for i := 0; i < 100; i++ {
+				if d := r.delay(tt.attempt); d < tt.min || d > tt.max {
+					t.Fatalf("delay(%d) = %v, 期望在 [%v, %v] 之间", tt.attempt, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+// TestRetryScheduler_close 测试关闭时放弃等待中的重试
+func TestRetryScheduler_close(t *testing.T) {
+	input := make(chan *sarama.ProducerMessage, 1)
+	var mu sync.Mutex
+	var failed []error
+	r := newRetryScheduler(input, config.AsyncRetryConfig{Backoff: time.Hour}, func(_ *sarama.ProducerMessage, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, err)
+	})
+
+	r.schedule(mockMessage("test-topic", "pending"), 1)
+	r.close()
+	// 关闭后安排的重试直接放弃
+	r.schedule(mockMessage("test-topic", "after close"), 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 2 {
+		t.Fatalf("放弃的消息数 = %d, 期望 2", len(failed))
+	}
+	for _, err := range failed {
+		if !errors.Is(err, errProducerClosed) {
+			t.Errorf("放弃原因 = %v, 期望 %v", err, errProducerClosed)
+		}
+	}
+	if len(input) != 0 {
+		t.Error("关闭后不应再向输入通道发送消息")
+	}
+}
@@ -0,0 +1,107 @@
+package producer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// FailureSink 最终发送失败的消息的去向
+// 异步生产者重试耗尽或关闭时仍未发送成功的消息会交给它，避免消息直接丢失
+type FailureSink interface {
+	Spill(msg *sarama.ProducerMessage, cause error) error
+}
+
+// spillRecord 落盘文件中的一条失败消息
+type spillRecord struct {
+	Topic    string            `json:"topic"`
+	Key      string            `json:"key,omitempty"`
+	Value    string            `json:"value"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Error    string            `json:"error"`
+	FailedAt time.Time         `json:"failed_at"`
+}
+
+// FileSpill 将失败消息以JSON Lines格式追加到本地文件
+type FileSpill struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSpill 创建落盘文件，文件所在目录不存在时自动创建
+// 参数:
+//   - path: 落盘文件路径
+//
+// 返回:
+//   - *FileSpill: 落盘文件实例
+//   - error: 创建失败时返回错误
+func NewFileSpill(path string) (*FileSpill, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建落盘目录失败: %w", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开落盘文件失败: %w", err)
+	}
+	return &FileSpill{file: file}, nil
+}
+
+// Spill 追加一条失败消息
+func (f *FileSpill) Spill(msg *sarama.ProducerMessage, cause error) error {
+	record := spillRecord{
+		Topic:    msg.Topic,
+		Error:    cause.Error(),
+		FailedAt: time.Now(),
+	}
+	if msg.Key != nil {
+		key, err := msg.Key.Encode()
+		if err != nil {
+			return fmt.Errorf("编码消息键失败: %w", err)
+		}
+		record.Key = string(key)
+	}
+	if msg.Value != nil {
+		value, err := msg.Value.Encode()
+		if err != nil {
+			return fmt.Errorf("编码消息内容失败: %w", err)
+		}
+		record.Value = string(value)
+	}
+	if len(msg.Headers) > 0 {
+		record.Headers = make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			if string(h.Key) == RetryCountHeader && len(h.Value) == 2 {
+				record.Headers[RetryCountHeader] = strconv.Itoa(int(binary.BigEndian.Uint16(h.Value)))
+				continue
+			}
+			record.Headers[string(h.Key)] = string(h.Value)
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化失败消息失败: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入落盘文件失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭落盘文件
+func (f *FileSpill) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,57 @@
+package producer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// TestFileSpill 测试失败消息追加到落盘文件
+func TestFileSpill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill", "async.jsonl")
+	spill, err := NewFileSpill(path)
+	if err != nil {
+		t.Fatalf("NewFileSpill() error = %v", err)
+	}
+
+	msg := mockMessage("test-topic", "test spill message")
+	msg.Key = sarama.StringEncoder("order-1")
+	msg.Headers = []sarama.RecordHeader{{Key: []byte(RetryCountHeader), Value: []byte{0, 5}}}
+	for i := 0; i < 2; i++ {
+		if err := spill.Spill(msg, errors.New("retries exhausted")); err != nil {
+			t.Fatalf("Spill() error = %v", err)
+		}
+	}
+	if err := spill.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开落盘文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var records []spillRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record spillRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("解析落盘记录失败: %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("落盘记录数 = %d, 期望 2", len(records))
+	}
+	got := records[0]
+	if got.Topic != "test-topic" || got.Key != "order-1" || got.Value != "test spill message" ||
+		got.Error != "retries exhausted" || got.Headers[RetryCountHeader] != "5" {
+		t.Errorf("落盘记录不正确: %+v", got)
+	}
+}
@@ -1,38 +1,71 @@
 package producer
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"kafka-example/claimcheck"
 	"kafka-example/common"
+	"kafka-example/config"
 	"log"
 	"time"
 
 	"github.com/IBM/sarama"
 )
 
+// 同步重试的退避参数
+const (
+	minRetryBackoff = 100 * time.Millisecond // 第一次重试前的等待时间
+	maxRetryBackoff = 30 * time.Second       // 重试等待时间上限
+)
+
+// retryBackoff 返回第n次（从0开始）重试前的等待时间，按指数增长且不超过 maxRetryBackoff
+func retryBackoff(n int) time.Duration {
+	backoff := minRetryBackoff
+	for i := 0; i < n && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
 // SyncProducerService 表示Kafka同步生产者服务
 // 该服务提供同步发送消息的功能，确保消息发送成功后才返回
 type SyncProducerService struct {
 	producer sarama.SyncProducer // Kafka同步生产者实例
 	brokers  []string            // Kafka broker地址列表
+	topic    string              // 发送消息的主题
+	manual   bool                // 是否使用manual分区器
+	retryMax int                 // 发送失败后的最大重试次数，来自 producer.retry_max
+
+	claimCheck *claimcheck.ClaimCheck // 大消息的压缩和转存，可为空
 }
 
 // NewSyncProducerService 创建一个同步生产者服务
+// 参数:
+//   - opts: 可选配置，未指定时使用默认配置
+//
 // 返回:
 //   - *SyncProducerService: 同步生产者服务实例
 //   - error: 创建失败时返回错误
-func NewSyncProducerService() (*SyncProducerService, error) {
-	log.Printf("%s正在创建同步生产者: brokers=%v", common.LogPrefixService, []string{common.Broker})
+func NewSyncProducerService(opts ...Option) (*SyncProducerService, error) {
+	o := newOptions(opts, func(cfg *config.Config) string { return cfg.Topics.Sync })
+	log.Printf("%s正在创建同步生产者: brokers=%v, topic=%s", common.LogPrefixService, o.brokers, o.topic)
 
 	// 配置生产者参数
-	config := sarama.NewConfig()
-	config.Producer.Return.Successes = true          // 要求返回发送成功确认
-	config.Producer.Idempotent = true                // 启用幂等性，确保消息不会重复发送
-	config.Net.MaxOpenRequests = 1                   // 限制最大并发请求数
-	config.Producer.RequiredAcks = sarama.WaitForAll // 等待所有副本确认
-	config.Producer.Retry.Max = 5                    // 最大重试次数
+	config, err := o.config.ProducerSaramaConfig()
+	if err != nil {
+		log.Printf("%s生产者配置不合法: %v", common.LogPrefixService, err)
+		return nil, err
+	}
+	config.Producer.Return.Successes = true // 要求返回发送成功确认
+	manual, err := o.applyPartitioner(config)
+	if err != nil {
+		log.Printf("%s分区器配置不合法: %v", common.LogPrefixService, err)
+		return nil, err
+	}
 
 	// 创建同步生产者
-	producer, err := sarama.NewSyncProducer([]string{common.Broker}, config)
+	producer, err := o.newSyncProducer(o.brokers, config)
 	if err != nil {
 		log.Printf("%s创建同步生产者失败: %v", common.LogPrefixService, err)
 		return nil, err
@@ -41,52 +74,231 @@ func NewSyncProducerService() (*SyncProducerService, error) {
 	log.Printf("%s同步生产者创建成功", common.LogPrefixService)
 	return &SyncProducerService{
 		producer: producer,
-		brokers:  []string{common.Broker},
+		brokers:  o.brokers,
+		topic:    o.topic,
+		manual:   manual,
+		retryMax: o.config.Producer.RetryMax,
+
+		claimCheck: o.claimCheck,
 	}, nil
 }
 
 // SendMessage 同步发送消息到指定的topic
 // 参数:
 //   - message: 要发送的消息内容
+//   - opts: 消息键、分区、消息头等可选参数
 //
 // 返回:
 //   - error: 发送失败时返回错误
-func (s *SyncProducerService) SendMessage(message string) error {
+func (s *SyncProducerService) SendMessage(message string, opts ...SendOption) error {
 	// 创建生产者消息
-	msg := &sarama.ProducerMessage{
-		Topic: common.SyncTopic,
-		Value: sarama.StringEncoder(message),
+	msg, callbacks, err := buildMessage(s.topic, message, s.manual, opts)
+	if err != nil {
+		log.Printf("%s消息参数不合法: topic=%s, error=%v", common.LogPrefixSync, s.topic, err)
+		newDelivery(callbacks).resolve(DeliveryResult{Topic: s.topic, Err: err})
+		return err
+	}
+
+	log.Printf("%s开始发送消息: topic=%s, message=%s", common.LogPrefixSync, s.topic, message)
+	delivery := newDelivery(callbacks)
+	err = s.send(msg)
+	delivery.resolve(DeliveryResult{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Err: err})
+	return err
+}
+
+// Send 同步发送已构造好的消息，实现 Sender 接口
+// 消息未指定主题时发送到服务的主题；返回时发送已经完成
+// 参数:
+//   - msg: 要发送的消息
+//   - callbacks: 发送完成后的回调
+//
+// 返回:
+//   - *Delivery: 已完成的发送结果
+func (s *SyncProducerService) Send(msg *sarama.ProducerMessage, callbacks ...DeliveryCallback) *Delivery {
+	if msg.Topic == "" {
+		msg.Topic = s.topic
 	}
+	log.Printf("%s开始发送消息: topic=%s", common.LogPrefixSync, msg.Topic)
 
-	log.Printf("%s开始发送消息: topic=%s, message=%s", common.LogPrefixSync, common.SyncTopic, message)
+	delivery := newDelivery(callbacks)
+	err := s.send(msg)
+	delivery.resolve(DeliveryResult{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Err: err})
+	return delivery
+}
+
+// SendMessages 同步批量发送消息
+// 整批通过一次 SendMessages 调用发送；发送失败的消息按错误分类筛选后，每轮通过一次 SendMessages 调用一起重试，
+// 轮次之间按指数退避等待，可重试错误最多重试 producer.retry_max 轮，未知错误最多重试 common.UnknownErrorMaxRetries 轮
+// 参数:
+//   - ctx: 上下文，其中的追踪信息会写入每条消息的消息头；结束时停止重试，尚未成功的消息返回上下文的错误
+//   - messages: 要发送的消息，未指定主题的消息发送到服务的主题
+//
+// 返回:
+//   - []DeliveryResult: 与 messages 一一对应的发送结果
+func (s *SyncProducerService) SendMessages(ctx context.Context, messages []Message) []DeliveryResult {
+	results := make([]DeliveryResult, len(messages))
+	index := make(map[*sarama.ProducerMessage]int, len(messages))
+	pending := make([]*sarama.ProducerMessage, 0, len(messages))
+	for i, m := range messages {
+		msg := m.build(ctx, s.topic)
+		results[i] = DeliveryResult{Topic: msg.Topic}
+		if err := s.offload(msg); err != nil {
+			// 转存失败的消息不发送，直接作为最终失败
+			results[i].Err = err
+			continue
+		}
+		index[msg] = i
+		pending = append(pending, msg)
+	}
+
+	log.Printf("%s开始批量发送消息: 数量=%d", common.LogPrefixSync, len(pending))
+	unknownRetries := make(map[*sarama.ProducerMessage]int)
+	for round := 0; len(pending) > 0; round++ {
+		failed := s.sendBatch(pending)
+		var retry []*sarama.ProducerMessage
+		for _, msg := range pending {
+			i := index[msg]
+			err, ok := failed[msg]
+			if !ok {
+				results[i] = DeliveryResult{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+				continue
+			}
+			switch common.ClassifyError(err) {
+			case common.ErrorClassNonRetryable:
+				results[i].Err = fmt.Errorf("消息发送失败(不可重试): %w", err)
+				continue
+			case common.ErrorClassUnknown:
+				unknownRetries[msg]++
+				if unknownRetries[msg] > common.UnknownErrorMaxRetries {
+					results[i].Err = fmt.Errorf("消息发送失败(未知错误): %w", err)
+					continue
+				}
+			}
+			if round >= s.retryMax {
+				results[i].Err = fmt.Errorf("消息发送失败，超过重试次数上限: %w", err)
+				continue
+			}
+			results[i].Err = err
+			retry = append(retry, msg)
+		}
+		pending = retry
+		if len(pending) == 0 {
+			break
+		}
+
+		backoff := retryBackoff(round)
+		log.Printf("%s批量发送部分失败，%v 后重试: 第%d轮, 数量=%d", common.LogPrefixSync, backoff, round+1, len(pending))
+		select {
+		case <-ctx.Done():
+			log.Printf("%s上下文已结束，停止重试: 未完成数量=%d, error=%v", common.LogPrefixSync, len(pending), ctx.Err())
+			for _, msg := range pending {
+				i := index[msg]
+				results[i].Err = fmt.Errorf("等待重试时上下文已结束: %w", errors.Join(ctx.Err(), results[i].Err))
+			}
+			pending = nil
+		case <-time.After(backoff):
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	log.Printf("%s批量发送完成: 数量=%d, 失败=%d", common.LogPrefixSync, len(messages), failed)
+	return results
+}
+
+// sendBatch 通过一次 SendMessages 调用发送一批消息
+// 返回: 发送失败的消息及其错误，无法区分哪些消息失败时整批视为失败
+func (s *SyncProducerService) sendBatch(batch []*sarama.ProducerMessage) map[*sarama.ProducerMessage]error {
+	failed := make(map[*sarama.ProducerMessage]error)
+	err := s.producer.SendMessages(batch)
+	if err == nil {
+		return failed
+	}
+	var producerErrs sarama.ProducerErrors
+	if errors.As(err, &producerErrs) {
+		for _, pe := range producerErrs {
+			failed[pe.Msg] = pe.Err
+		}
+		return failed
+	}
+	for _, msg := range batch {
+		failed[msg] = err
+	}
+	return failed
+}
+
+// send 发送消息并等待结果，失败时按错误分类重试
+func (s *SyncProducerService) send(msg *sarama.ProducerMessage) error {
+	if err := s.offload(msg); err != nil {
+		return err
+	}
 
 	// 发送消息并等待结果
 	partition, offset, err := s.producer.SendMessage(msg)
 	if err != nil {
-		log.Printf("%s消息发送失败，准备重试: topic=%s, error=%v", common.LogPrefixSync, common.SyncTopic, err)
-		return s.retrySend(msg, 5) // 失败时进行重试
+		return s.handleSendError(msg, err)
 	}
 
 	log.Printf("%s消息发送成功: topic=%s, partition=%d, offset=%d",
-		common.LogPrefixSync, common.SyncTopic, partition, offset)
+		common.LogPrefixSync, msg.Topic, partition, offset)
 	return nil
 }
 
+// offload 发送前压缩或转存大消息的消息体，未启用claim-check时不处理
+func (s *SyncProducerService) offload(msg *sarama.ProducerMessage) error {
+	if s.claimCheck == nil {
+		return nil
+	}
+	if err := s.claimCheck.Offload(context.Background(), msg); err != nil {
+		log.Printf("%s处理大消息失败: topic=%s, error=%v", common.LogPrefixSync, msg.Topic, err)
+		return err
+	}
+	return nil
+}
+
+// handleSendError 根据错误分类处理发送失败的消息
+// 不可重试错误直接返回，未知错误最多重试 common.UnknownErrorMaxRetries 次，其他错误最多重试 producer.retry_max 次
+func (s *SyncProducerService) handleSendError(msg *sarama.ProducerMessage, err error) error {
+	switch common.ClassifyError(err) {
+	case common.ErrorClassNonRetryable:
+		log.Printf("%s消息发送失败(不可重试): topic=%s, error=%v", common.LogPrefixSync, msg.Topic, err)
+		return fmt.Errorf("消息发送失败(不可重试): %w", err)
+	case common.ErrorClassUnknown:
+		log.Printf("%s消息发送失败(未知错误)，准备重试: topic=%s, error=%v", common.LogPrefixSync, msg.Topic, err)
+		return s.retrySend(msg, common.UnknownErrorMaxRetries)
+	default:
+		if s.retryMax <= 0 {
+			log.Printf("%s消息发送失败(未启用重试): topic=%s, error=%v", common.LogPrefixSync, msg.Topic, err)
+			return fmt.Errorf("消息发送失败: %w", err)
+		}
+		log.Printf("%s消息发送失败，准备重试: topic=%s, error=%v", common.LogPrefixSync, msg.Topic, err)
+		return s.retrySend(msg, s.retryMax) // 失败时进行重试
+	}
+}
+
 // retrySend 同步重试发送消息
+// 可重试错误按指数退避重试，不可重试错误立即返回，
+// 未知错误最多重试 common.UnknownErrorMaxRetries 次
 // 参数:
 //   - msg: 要重试发送的消息
 //   - maxRetries: 最大重试次数
 //
 // 返回:
-//   - error: 重试失败时返回错误
+//   - error: 重试失败时返回错误，包含最后一次发送的错误
 func (s *SyncProducerService) retrySend(msg *sarama.ProducerMessage, maxRetries int) error {
+	var lastErr error
+	unknownRetries := 0
 	for i := 0; i <= maxRetries; i++ {
 		// 达到最大重试次数时，不再重试
 		if i == maxRetries {
 			// 重试失败或达到最大重试次数
 			log.Printf("%s重试终止: topic=%s, 重试次数=%d, 错误=%v",
-				common.LogPrefixSync, msg.Topic, i+1, errors.New("消息重发失败，超过重试次数上限"))
-			return errors.New("消息重发失败，超过重试次数上限")
+				common.LogPrefixSync, msg.Topic, i+1, lastErr)
+			return fmt.Errorf("消息重发失败，超过重试次数上限: %w", lastErr)
 		}
 
 		log.Printf("%s开始第%d次重试: topic=%s", common.LogPrefixSync, i+1, msg.Topic)
@@ -98,18 +310,31 @@ func (s *SyncProducerService) retrySend(msg *sarama.ProducerMessage, maxRetries
 				common.LogPrefixSync, msg.Topic, i+1, partition, offset)
 			return nil
 		}
+		lastErr = err
 
-		// 如果错误可重试，则等待后继续
-		if common.IsRetryableError(err) {
-			backoff := time.Duration(1<<i) * 100 * time.Millisecond // 指数退避
-			log.Printf("%s重试发送失败: topic=%s, 重试次数=%d, 等待时间=%v, 错误=%v",
-				common.LogPrefixSync, msg.Topic, i+1, backoff, err)
-			time.Sleep(backoff)
-			continue
+		switch common.ClassifyError(err) {
+		case common.ErrorClassNonRetryable:
+			// 不可重试的错误，立即终止
+			log.Printf("%s重试终止(不可重试): topic=%s, 重试次数=%d, 错误=%v",
+				common.LogPrefixSync, msg.Topic, i+1, err)
+			return fmt.Errorf("消息重发失败(不可重试): %w", err)
+		case common.ErrorClassUnknown:
+			// 未知错误，只允许有限次数的重试
+			unknownRetries++
+			if unknownRetries > common.UnknownErrorMaxRetries {
+				log.Printf("%s重试终止(未知错误): topic=%s, 重试次数=%d, 错误=%v",
+					common.LogPrefixSync, msg.Topic, i+1, err)
+				return fmt.Errorf("消息重发失败(未知错误): %w", err)
+			}
 		}
 
+		// 等待后继续
+		backoff := retryBackoff(i)
+		log.Printf("%s重试发送失败: topic=%s, 重试次数=%d, 等待时间=%v, 错误=%v",
+			common.LogPrefixSync, msg.Topic, i+1, backoff, err)
+		time.Sleep(backoff)
 	}
-	return nil
+	return lastErr
 }
 
 // Close 关闭同步生产者服务
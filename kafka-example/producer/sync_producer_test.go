@@ -1,27 +1,76 @@
 package producer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"kafka-example/claimcheck"
 	"kafka-example/common"
+	"kafka-example/config"
 	"testing"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
 )
 
 // TestNewSyncProducerService 测试同步生产者服务的创建
+// 通过 WithSyncProducerFactory 注入mock生产者，不需要连接Kafka
 func TestNewSyncProducerService(t *testing.T) {
+	errDial := errors.New("连接broker失败")
+
 	tests := []struct {
 		name    string
+		opts    []Option
+		factory func(t *testing.T) SyncProducerFactory
 		wantErr bool
 	}{
 		{
-			name:    "正常创建同步生产者",
+			name: "正常创建同步生产者",
+			opts: []Option{WithBrokers("broker-1:9092"), WithTopic("orders")},
+			factory: func(t *testing.T) SyncProducerFactory {
+				return func(addrs []string, cfg *sarama.Config) (sarama.SyncProducer, error) {
+					if len(addrs) != 1 || addrs[0] != "broker-1:9092" {
+						t.Errorf("broker地址 = %v, 期望 [broker-1:9092]", addrs)
+					}
+					if !cfg.Producer.Return.Successes {
+						t.Error("同步生产者需要返回发送成功确认")
+					}
+					return mocks.NewSyncProducer(t, cfg), nil
+				}
+			},
 			wantErr: false,
 		},
+		{
+			name: "创建sarama生产者失败",
+			factory: func(t *testing.T) SyncProducerFactory {
+				return func([]string, *sarama.Config) (sarama.SyncProducer, error) {
+					return nil, errDial
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "自定义分区器未指定",
+			opts: []Option{WithConfig(func() *config.Config {
+				cfg := config.Default()
+				cfg.Producer.Partitioner = config.PartitionerCustom
+				return cfg
+			}())},
+			factory: func(t *testing.T) SyncProducerFactory {
+				return func([]string, *sarama.Config) (sarama.SyncProducer, error) {
+					t.Error("配置不合法时不应创建sarama生产者")
+					return nil, errDial
+				}
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service, err := NewSyncProducerService()
+			opts := append([]Option{WithSyncProducerFactory(tt.factory(t))}, tt.opts...)
+			service, err := NewSyncProducerService(opts...)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewSyncProducerService() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -37,6 +86,49 @@ func TestNewSyncProducerService(t *testing.T) {
 			if !tt.wantErr && service == nil {
 				t.Error("NewSyncProducerService() 返回的生产者为空")
 			}
+			if service != nil && service.topic != "orders" {
+				t.Errorf("topic = %s, 期望 orders", service.topic)
+			}
+		})
+	}
+}
+
+// TestSyncProducerService_RetryMax 测试同步生产者服务按配置的 producer.retry_max 重试
+func TestSyncProducerService_RetryMax(t *testing.T) {
+	tests := []struct {
+		name     string
+		retryMax int
+		wantSend int // 包括首次发送的总发送次数
+	}{
+		{name: "不重试", retryMax: 0, wantSend: 1},
+		{name: "重试1次", retryMax: 1, wantSend: 2},
+		{name: "重试2次", retryMax: 2, wantSend: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Producer.Idempotent = false // 幂等生产者要求 retry_max 至少为1
+			cfg.Producer.RetryMax = tt.retryMax
+			var mockProducer *mocks.SyncProducer
+			service, err := NewSyncProducerService(WithConfig(cfg), WithSyncProducerFactory(
+				func(_ []string, sc *sarama.Config) (sarama.SyncProducer, error) {
+					mockProducer = mocks.NewSyncProducer(t, sc)
+					for i := 0; i < tt.wantSend; i++ {
+						mockProducer.ExpectSendMessageAndFail(sarama.ErrLeaderNotAvailable)
+					}
+					return mockProducer, nil
+				}))
+			if err != nil {
+				t.Fatalf("NewSyncProducerService() error = %v", err)
+			}
+			if err := service.SendMessage("test retry max"); !errors.Is(err, sarama.ErrLeaderNotAvailable) {
+				t.Errorf("SendMessage() error = %v, 期望 %v", err, sarama.ErrLeaderNotAvailable)
+			}
+			// 关闭时验证发送次数与期望恰好一致
+			if err := service.Close(); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
 		})
 	}
 }
@@ -47,6 +139,7 @@ func TestSyncProducerService_retrySend(t *testing.T) {
 	service := &SyncProducerService{
 		producer: mockProducer,
 		brokers:  []string{common.Broker},
+		topic:    common.SyncTopic,
 	}
 
 	msg := mockMessage(common.SyncTopic, "test retry message")
@@ -89,12 +182,87 @@ func TestSyncProducerService_retrySend(t *testing.T) {
 	}
 }
 
+// TestSyncProducerService_retrySendAttempts 测试重试按错误分类终止，发送次数与期望恰好一致
+func TestSyncProducerService_retrySendAttempts(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		errs       []error // 依次发送的结果，nil 表示发送成功
+		wantErr    bool
+	}{
+		{
+			name:       "重试成功后不再发送",
+			maxRetries: 3,
+			errs:       []error{sarama.ErrLeaderNotAvailable, nil},
+			wantErr:    false,
+		},
+		{
+			name:       "达到最大重试次数",
+			maxRetries: 2,
+			errs:       []error{sarama.ErrLeaderNotAvailable, sarama.ErrLeaderNotAvailable},
+			wantErr:    true,
+		},
+		{
+			name:       "不可重试错误立即终止",
+			maxRetries: 5,
+			errs:       []error{sarama.ErrLeaderNotAvailable, sarama.ErrTopicAuthorizationFailed},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProducer := createMockSyncProducer(t)
+			for _, err := range tt.errs {
+				if err == nil {
+					mockProducer.ExpectSendMessageAndSucceed()
+				} else {
+					mockProducer.ExpectSendMessageAndFail(err)
+				}
+			}
+			service := &SyncProducerService{producer: mockProducer, topic: common.SyncTopic}
+			if err := service.retrySend(mockMessage(common.SyncTopic, "test retry message"), tt.maxRetries); (err != nil) != tt.wantErr {
+				t.Errorf("retrySend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// 验证mock生产者的期望恰好被消费完
+			if err := mockProducer.Close(); err != nil {
+				t.Errorf("关闭mock生产者时发生错误: %v", err)
+			}
+		})
+	}
+}
+
 // TestSyncProducerService_SendMessage 测试同步消息发送
+// TestRetryBackoff 测试重试等待时间按指数增长且不超过上限
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want time.Duration
+	}{
+		{name: "第一次重试", n: 0, want: 100 * time.Millisecond},
+		{name: "第三次重试", n: 2, want: 400 * time.Millisecond},
+		{name: "达到上限", n: 9, want: 30 * time.Second},
+		{name: "移位会溢出的次数", n: 64, want: 30 * time.Second},
+		{name: "很大的次数", n: 1000, want: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryBackoff(tt.n); got != tt.want {
+				t.Errorf("retryBackoff(%d) = %v, 期望 %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSyncProducerService_SendMessage(t *testing.T) {
 	mockProducer := createMockSyncProducer(t)
 	service := &SyncProducerService{
 		producer: mockProducer,
 		brokers:  []string{common.Broker},
+		topic:    common.SyncTopic,
+		retryMax: 5,
 	}
 
 	tests := []struct {
@@ -133,6 +301,49 @@ func TestSyncProducerService_SendMessage(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name:    "不可重试错误不进行重试",
+			message: "test too large message",
+			setupMock: func() {
+				mockProducer.ExpectSendMessageAndFail(sarama.ErrMessageSizeTooLarge)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "主题不存在不进行重试",
+			message: "test unknown topic message",
+			setupMock: func() {
+				mockProducer.ExpectSendMessageAndFail(sarama.ErrUnknownTopicOrPartition)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "未知错误有限重试后成功",
+			message: "test unknown error message",
+			setupMock: func() {
+				mockProducer.ExpectSendMessageAndFail(errors.New("unknown failure"))
+				mockProducer.ExpectSendMessageAndSucceed()
+			},
+			wantErr: false,
+		},
+		{
+			name:    "未知错误有限重试后失败",
+			message: "test unknown error message",
+			setupMock: func() {
+				mockProducer.ExpectSendMessageAndFail(errors.New("unknown failure"))
+				mockProducer.ExpectSendMessageAndFail(errors.New("unknown failure"))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "重试过程中遇到不可重试错误",
+			message: "test mixed error message",
+			setupMock: func() {
+				mockProducer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+				mockProducer.ExpectSendMessageAndFail(sarama.ErrSASLAuthenticationFailed)
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -155,3 +366,206 @@ func TestSyncProducerService_SendMessage(t *testing.T) {
 		})
 	}
 }
+
+// batchFailProducer 批量发送时按消息体让消息失败的模拟同步生产者，记录每次 SendMessages 调用的消息数
+type batchFailProducer struct {
+	*mocks.SyncProducer
+	fail  func(round int, value string) error // 第 round 次调用时该消息的发送结果，nil 表示成功
+	calls []int
+}
+
+func (p *batchFailProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	round := len(p.calls)
+	p.calls = append(p.calls, len(msgs))
+	var errs sarama.ProducerErrors
+	for i, msg := range msgs {
+		value, _ := msg.Value.Encode()
+		if err := p.fail(round, string(value)); err != nil {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: err})
+			continue
+		}
+		msg.Partition = 0
+		msg.Offset = int64(i)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// TestSyncProducerService_SendMessageInvalid 测试消息参数不合法时不发送，并以失败调用回调
+func TestSyncProducerService_SendMessageInvalid(t *testing.T) {
+	mockProducer := createMockSyncProducer(t)
+	service := &SyncProducerService{producer: mockProducer, topic: common.SyncTopic, retryMax: 5}
+
+	var results []DeliveryResult
+	err := service.SendMessage("test partition", WithPartition(1), WithCallback(func(result DeliveryResult) {
+		results = append(results, result)
+	}))
+	if !errors.Is(err, ErrManualPartitionRequired) {
+		t.Fatalf("SendMessage() error = %v, 期望 %v", err, ErrManualPartitionRequired)
+	}
+	if len(results) != 1 || !errors.Is(results[0].Err, ErrManualPartitionRequired) || results[0].Topic != common.SyncTopic {
+		t.Errorf("回调结果 = %+v, 期望以 ErrManualPartitionRequired 调用一次", results)
+	}
+	if err := mockProducer.Close(); err != nil {
+		t.Errorf("不应发送消息: %v", err)
+	}
+}
+
+// TestSyncProducerService_SendMessages 测试批量发送返回每条消息的结果，失败的消息按错误分类整批重试
+func TestSyncProducerService_SendMessages(t *testing.T) {
+	errUnknown := errors.New("unknown failure")
+
+	tests := []struct {
+		name      string
+		retryMax  int
+		timeout   time.Duration // 不为0时上下文在该时间后结束
+		fail      func(round int, value string) error
+		wantCalls []int  // 每次 SendMessages 调用的消息数
+		wantErrs  []bool // 每条消息是否最终失败
+		wantCause error  // b 的最终错误
+	}{
+		{
+			name:     "失败的消息一起重试",
+			retryMax: 5,
+			fail: func(round int, value string) error {
+				switch {
+				case value == "b" && round == 0:
+					return sarama.ErrNotLeaderForPartition // 可重试，重试后成功
+				case value == "c":
+					return sarama.ErrSASLAuthenticationFailed // 不可重试
+				case value == "d" && round < 2:
+					return sarama.ErrLeaderNotAvailable // 可重试，第2次重试后成功
+				}
+				return nil
+			},
+			wantCalls: []int{4, 2, 1},
+			wantErrs:  []bool{false, false, true, false},
+		},
+		{
+			name:     "超过重试次数上限",
+			retryMax: 2,
+			fail: func(_ int, value string) error {
+				if value == "b" {
+					return sarama.ErrLeaderNotAvailable
+				}
+				return nil
+			},
+			wantCalls: []int{4, 1, 1},
+			wantErrs:  []bool{false, true, false, false},
+			wantCause: sarama.ErrLeaderNotAvailable,
+		},
+		{
+			name:     "未知错误有限重试",
+			retryMax: 5,
+			fail: func(_ int, value string) error {
+				if value == "b" {
+					return errUnknown
+				}
+				return nil
+			},
+			wantCalls: []int{4, 1},
+			wantErrs:  []bool{false, true, false, false},
+			wantCause: errUnknown,
+		},
+		{
+			name:     "上下文结束时停止重试",
+			retryMax: 10,
+			timeout:  50 * time.Millisecond,
+			fail: func(_ int, value string) error {
+				if value == "b" {
+					return sarama.ErrLeaderNotAvailable
+				}
+				return nil
+			},
+			wantCalls: []int{4},
+			wantErrs:  []bool{false, true, false, false},
+			wantCause: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProducer := &batchFailProducer{SyncProducer: createMockSyncProducer(t), fail: tt.fail}
+			service := &SyncProducerService{producer: mockProducer, topic: common.SyncTopic, retryMax: tt.retryMax}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			key := "user-1"
+			start := time.Now()
+			results := service.SendMessages(ctx, []Message{
+				{Value: "a", Key: &key},
+				{Value: "b"},
+				{Topic: "other-topic", Value: "c"},
+				{Value: "d"},
+			})
+			if tt.timeout > 0 && time.Since(start) > tt.timeout+time.Second {
+				t.Errorf("上下文结束后 %v 才返回", time.Since(start)-tt.timeout)
+			}
+
+			if len(results) != len(tt.wantErrs) {
+				t.Fatalf("结果数量 = %d, 期望 %d", len(results), len(tt.wantErrs))
+			}
+			for i, wantErr := range tt.wantErrs {
+				if (results[i].Err != nil) != wantErr {
+					t.Errorf("第%d条消息的结果 = %+v, 期望失败 %v", i+1, results[i], wantErr)
+				}
+			}
+			if results[0].Topic != common.SyncTopic || results[2].Topic != "other-topic" {
+				t.Errorf("结果中的主题不正确: %+v", results)
+			}
+			if tt.wantCause != nil && !errors.Is(results[1].Err, tt.wantCause) {
+				t.Errorf("第2条消息的错误 = %v, 期望包含 %v", results[1].Err, tt.wantCause)
+			}
+			if fmt.Sprint(mockProducer.calls) != fmt.Sprint(tt.wantCalls) {
+				t.Errorf("SendMessages 调用 = %v, 期望 %v", mockProducer.calls, tt.wantCalls)
+			}
+			if err := mockProducer.Close(); err != nil {
+				t.Errorf("关闭mock生产者时发生错误: %v", err)
+			}
+		})
+	}
+}
+
+// TestSyncProducerService_ClaimCheck 测试启用claim-check后超过内联上限的消息体转存到blob存储，消息中只保留引用
+func TestSyncProducerService_ClaimCheck(t *testing.T) {
+	store, err := claimcheck.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	cc := claimcheck.New(store, config.ClaimCheckConfig{MaxInlineBytes: 16, Retention: time.Hour}, 0)
+
+	mockProducer := createMockSyncProducer(t)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		value, _ := msg.Value.Encode()
+		if len(value) != 0 {
+			return fmt.Errorf("转存后消息体应为空, 实际 %d 字节", len(value))
+		}
+		for _, h := range msg.Headers {
+			if string(h.Key) == claimcheck.HeaderRef {
+				return nil
+			}
+		}
+		return errors.New("缺少claim-check引用消息头")
+	})
+	mockProducer.ExpectSendMessageAndSucceed()
+	service := &SyncProducerService{producer: mockProducer, topic: common.SyncTopic, claimCheck: cc}
+
+	if err := service.SendMessage("a payload larger than sixteen bytes"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if err := service.SendMessage("small"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if got := cc.Stats().Offloaded; got != 1 {
+		t.Errorf("Stats().Offloaded = %d, 期望 1", got)
+	}
+	if err := mockProducer.Close(); err != nil {
+		t.Errorf("关闭mock生产者时发生错误: %v", err)
+	}
+}
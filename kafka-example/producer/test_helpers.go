@@ -13,8 +13,11 @@ func createMockSyncProducer(t *testing.T) *mocks.SyncProducer {
 }
 
 // createMockAsyncProducer 创建模拟的异步生产者
+// 与异步生产者服务一致，返回成功和错误信息
 func createMockAsyncProducer(t *testing.T) *mocks.AsyncProducer {
-	return mocks.NewAsyncProducer(t, nil)
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	return mocks.NewAsyncProducer(t, config)
 }
 
 // mockMessage 创建测试消息
@@ -0,0 +1,62 @@
+package producer
+
+import (
+	"kafka-example/envelope"
+
+	"github.com/IBM/sarama"
+)
+
+// Sender 发送已构造好的消息
+// SyncProducerService 和 AsyncProducerService 都实现了该接口
+type Sender interface {
+	Send(msg *sarama.ProducerMessage, callbacks ...DeliveryCallback) *Delivery
+}
+
+// Producer 发送 T 类型消息的生产者
+// 消息内容经编解码器编码后放入标准信封，信封元数据同时写入消息头和消息体
+type Producer[T any] struct {
+	sender Sender
+	codec  envelope.Codec[T]
+	schema envelope.Schema
+	source string
+}
+
+// NewProducer 创建类型化生产者
+// 参数:
+//   - sender: 底层生产者服务
+//   - codec: 消息内容的编解码器
+//   - schema: 消息类型和当前版本
+//   - source: 生产方名称，写入信封
+//
+// 返回:
+//   - *Producer[T]: 类型化生产者
+func NewProducer[T any](sender Sender, codec envelope.Codec[T], schema envelope.Schema, source string) *Producer[T] {
+	return &Producer[T]{
+		sender: sender,
+		codec:  codec,
+		schema: schema,
+		source: source,
+	}
+}
+
+// Send 将消息内容放入信封后发送
+// 参数:
+//   - payload: 消息内容
+//   - callbacks: 发送完成后的回调
+//
+// 返回:
+//   - envelope.Envelope[T]: 发送的信封，包含生成的消息ID
+//   - *Delivery: 发送结果，同步生产者返回时已完成
+//   - error: 编码失败时返回错误，此时消息未发送
+func (p *Producer[T]) Send(payload T, callbacks ...DeliveryCallback) (envelope.Envelope[T], *Delivery, error) {
+	env := envelope.New(p.schema, p.source, payload)
+	value, headers, err := envelope.Encode(env, p.codec)
+	if err != nil {
+		return env, nil, err
+	}
+	delivery := p.sender.Send(&sarama.ProducerMessage{
+		Value:   sarama.ByteEncoder(value),
+		Headers: headers,
+	}, callbacks...)
+	return env, delivery, nil
+}
@@ -0,0 +1,53 @@
+package producer
+
+import (
+	"errors"
+	"kafka-example/envelope"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+type testOrder struct {
+	ID string `json:"id"`
+}
+
+// TestProducer_Send 测试类型化生产者发送带信封的消息
+func TestProducer_Send(t *testing.T) {
+	schema := envelope.Schema{Type: "order.created", Version: 1}
+	mockProducer := createMockSyncProducer(t)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "orders" {
+			return errors.New("消息未发送到服务的主题: " + msg.Topic)
+		}
+		if len(msg.Headers) == 0 {
+			return errors.New("缺少信封消息头")
+		}
+		value, err := msg.Value.Encode()
+		if err != nil {
+			return err
+		}
+		env, err := envelope.Decode(value, envelope.JSONCodec[testOrder]{}, schema)
+		if err != nil {
+			return err
+		}
+		if env.Payload.ID != "o-1" || env.Source != "order-service" {
+			return errors.New("信封内容不正确")
+		}
+		return nil
+	})
+	service := &SyncProducerService{producer: mockProducer, topic: "orders"}
+	defer service.Close()
+
+	p := NewProducer[testOrder](service, envelope.JSONCodec[testOrder]{}, schema, "order-service")
+	env, delivery, err := p.Send(testOrder{ID: "o-1"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if env.ID == "" {
+		t.Error("未生成消息ID")
+	}
+	if result := delivery.Result(); result.Err != nil || result.Topic != "orders" {
+		t.Errorf("发送结果 = %+v", result)
+	}
+}
@@ -0,0 +1,330 @@
+package reply
+
+import (
+	"context"
+	"errors"
+	"kafka-example/config"
+	"kafka-example/producer"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+const testReplyTopic = "replies-test" // 请求方实例 test 的回复主题
+
+// newTestSaramaConfig 创建返回发送成功确认的mock配置
+func newTestSaramaConfig() *sarama.Config {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	return cfg
+}
+
+// newTestRequester 创建使用mock生产者和mock消费者的请求方，返回回复主题唯一分区的mock消费者
+func newTestRequester(t *testing.T, timeout time.Duration) (*Requester, *mocks.SyncProducer, *mocks.PartitionConsumer) {
+	cfg := newTestSaramaConfig()
+	producer := mocks.NewSyncProducer(t, cfg)
+	consumer := mocks.NewConsumer(t, cfg)
+	consumer.SetTopicMetadata(map[string][]int32{testReplyTopic: {0}})
+	pc := consumer.ExpectConsumePartition(testReplyTopic, 0, sarama.OffsetNewest)
+
+	r, err := newRequester(producer, consumer, config.ReplyConfig{
+		RequestTopic:     "requests",
+		ReplyTopicPrefix: "replies",
+		InstanceID:       "test",
+		Timeout:          timeout,
+	})
+	if err != nil {
+		t.Fatalf("newRequester() error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r, producer, pc
+}
+
+// consumed 将生产者消息转换为消费者收到的消息
+func consumed(t *testing.T, msg *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	out := &sarama.ConsumerMessage{Topic: msg.Topic}
+	if msg.Value != nil {
+		value, err := msg.Value.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Value = value
+	}
+	for i := range msg.Headers {
+		out.Headers = append(out.Headers, &msg.Headers[i])
+	}
+	return out
+}
+
+// replyTo 构造对请求的回复，errMessage 不为空时表示处理失败
+func replyTo(id, value, errMessage string) *sarama.ConsumerMessage {
+	msg := &sarama.ConsumerMessage{
+		Topic:   testReplyTopic,
+		Value:   []byte(value),
+		Headers: []*sarama.RecordHeader{{Key: []byte(HeaderCorrelationID), Value: []byte(id)}},
+	}
+	if errMessage != "" {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(errMessage)})
+	}
+	return msg
+}
+
+// producerHeader 返回生产者消息中指定消息头的值
+func producerHeader(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// TestRequester_Request 测试请求发送后按关联ID等待回复
+func TestRequester_Request(t *testing.T) {
+	errSend := errors.New("broker不可用")
+
+	tests := []struct {
+		name    string
+		reply   func(pc *mocks.PartitionConsumer, id string) // 请求发送时模拟回复方写入回复主题
+		sendErr error
+		want    string
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "收到回复",
+			reply: func(pc *mocks.PartitionConsumer, id string) {
+				pc.YieldMessage(replyTo(id, "pong", ""))
+			},
+			want: "pong",
+		},
+		{
+			name: "忽略其他请求的回复",
+			reply: func(pc *mocks.PartitionConsumer, id string) {
+				pc.YieldMessage(replyTo("other", "wrong", ""))
+				pc.YieldMessage(replyTo(id, "pong", ""))
+			},
+			want: "pong",
+		},
+		{
+			name: "回复方处理失败",
+			reply: func(pc *mocks.PartitionConsumer, id string) {
+				pc.YieldMessage(replyTo(id, "", "库存不足"))
+			},
+			check: func(t *testing.T, err error) {
+				var remote *RemoteError
+				if !errors.As(err, &remote) || remote.Message != "库存不足" {
+					t.Errorf("Request() error = %v, 期望 RemoteError", err)
+				}
+			},
+		},
+		{
+			name:  "等待回复超时",
+			reply: func(*mocks.PartitionConsumer, string) {},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrTimeout) {
+					t.Errorf("Request() error = %v, 期望 ErrTimeout", err)
+				}
+			},
+		},
+		{
+			name:    "发送请求失败",
+			sendErr: errSend,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errSend) {
+					t.Errorf("Request() error = %v, 期望 %v", err, errSend)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, producer, pc := newTestRequester(t, 100*time.Millisecond)
+			if tt.sendErr != nil {
+				producer.ExpectSendMessageAndFail(tt.sendErr)
+			} else {
+				producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+					if got := producerHeader(msg, HeaderReplyTo); got != testReplyTopic {
+						t.Errorf("reply-to = %q, 期望 %q", got, testReplyTopic)
+					}
+					tt.reply(pc, producerHeader(msg, HeaderCorrelationID))
+					return nil
+				})
+			}
+
+			msg := &sarama.ProducerMessage{
+				Topic:   "requests",
+				Value:   sarama.StringEncoder("ping"),
+				Headers: []sarama.RecordHeader{{Key: []byte(HeaderCorrelationID), Value: []byte("stale")}},
+			}
+			reply, err := r.Request(context.Background(), msg)
+			if tt.check != nil {
+				tt.check(t, err)
+			} else if err != nil {
+				t.Fatalf("Request() error = %v", err)
+			} else if string(reply.Value) != tt.want {
+				t.Errorf("回复 = %q, 期望 %q", reply.Value, tt.want)
+			}
+
+			if id := producerHeader(msg, HeaderCorrelationID); id == "stale" || id == "" {
+				t.Errorf("correlation-id = %q, 应生成新的关联ID", id)
+			}
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if len(r.pending) != 0 {
+				t.Errorf("请求结束后仍有 %d 个等待中的请求", len(r.pending))
+			}
+		})
+	}
+}
+
+// TestRequester_Close 测试关闭请求方时等待中的请求立即返回
+func TestRequester_Close(t *testing.T) {
+	r, producer, _ := newTestRequester(t, time.Minute)
+	sent := make(chan struct{})
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "requests" {
+			t.Errorf("请求主题 = %s, 期望使用配置的请求主题", msg.Topic)
+		}
+		close(sent)
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := r.Request(context.Background(), &sarama.ProducerMessage{})
+		errCh <- err
+	}()
+	<-sent
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Request() error = %v, 期望 ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("关闭后等待中的请求没有返回")
+	}
+	if _, err := r.Request(context.Background(), &sarama.ProducerMessage{Topic: "requests"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后 Request() error = %v, 期望 ErrClosed", err)
+	}
+}
+
+// TestResponder_RoundTrip 测试请求经回复方处理后，回复回到请求方
+func TestResponder_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		want      string
+		wantError string
+	}{
+		{name: "返回处理结果", value: "ping", want: "PING"},
+		{name: "返回处理错误", value: "", wantError: "请求内容不能为空"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, requests, pc := newTestRequester(t, time.Second)
+
+			replies := mocks.NewSyncProducer(t, newTestSaramaConfig())
+			sender, err := producer.NewSyncProducerService(producer.WithBrokers("broker-1:9092"),
+				producer.WithSyncProducerFactory(func([]string, *sarama.Config) (sarama.SyncProducer, error) {
+					return replies, nil
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = sender.Close() })
+
+			responder := NewResponder(sender, func(_ context.Context, msg *sarama.ConsumerMessage) ([]byte, error) {
+				if len(msg.Value) == 0 {
+					return nil, errors.New("请求内容不能为空")
+				}
+				return []byte(strings.ToUpper(string(msg.Value))), nil
+			})
+
+			// 请求写入请求主题时交给回复方处理，回复写入回复主题时交给请求方
+			requests.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+				return responder.Handle(context.Background(), consumed(t, msg))
+			})
+			replies.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+				if msg.Topic != testReplyTopic {
+					t.Errorf("回复主题 = %s, 期望 %s", msg.Topic, testReplyTopic)
+				}
+				pc.YieldMessage(consumed(t, msg))
+				return nil
+			})
+
+			reply, err := r.Request(context.Background(), &sarama.ProducerMessage{Topic: "requests", Value: sarama.StringEncoder(tt.value)})
+			if tt.wantError != "" {
+				var remote *RemoteError
+				if !errors.As(err, &remote) || remote.Message != tt.wantError {
+					t.Fatalf("Request() error = %v, 期望 RemoteError(%s)", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Request() error = %v", err)
+			}
+			if string(reply.Value) != tt.want {
+				t.Errorf("回复 = %q, 期望 %q", reply.Value, tt.want)
+			}
+		})
+	}
+}
+
+// TestResponder_Handle 测试非请求消息和回复发送失败的处理
+func TestResponder_Handle(t *testing.T) {
+	request := &sarama.ConsumerMessage{
+		Topic: "requests",
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderCorrelationID), Value: []byte("id-1")},
+			{Key: []byte(HeaderReplyTo), Value: []byte(testReplyTopic)},
+		},
+	}
+	tests := []struct {
+		name    string
+		msg     *sarama.ConsumerMessage
+		sendErr error // 不为空时期望发送回复并失败
+		wantErr bool
+	}{
+		{name: "缺少reply-to时跳过", msg: &sarama.ConsumerMessage{Topic: "requests"}},
+		{name: "回复发送失败时返回错误", msg: request, sendErr: sarama.ErrMessageSizeTooLarge, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := mocks.NewSyncProducer(t, newTestSaramaConfig())
+			if tt.sendErr != nil {
+				replies.ExpectSendMessageAndFail(tt.sendErr)
+			}
+			sender, err := producer.NewSyncProducerService(producer.WithBrokers("broker-1:9092"),
+				producer.WithSyncProducerFactory(func([]string, *sarama.Config) (sarama.SyncProducer, error) {
+					return replies, nil
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = sender.Close() })
+
+			called := false
+			responder := NewResponder(sender, func(context.Context, *sarama.ConsumerMessage) ([]byte, error) {
+				called = true
+				return []byte("ok"), nil
+			})
+			err = responder.Handle(context.Background(), tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if called != (tt.sendErr != nil) {
+				t.Errorf("是否调用处理函数 = %v", called)
+			}
+		})
+	}
+}
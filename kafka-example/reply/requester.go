@@ -0,0 +1,328 @@
+package reply
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kafka-example/config"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 请求-回复消息头
+const (
+	HeaderCorrelationID = "correlation-id" // 关联ID，回复中原样带回，请求方据此找到等待中的请求
+	HeaderReplyTo       = "reply-to"       // 请求方实例的回复主题
+	HeaderError         = "reply-error"    // 回复方处理失败的错误信息，成功时不设置
+
+	logPrefix = "[Reply] "
+
+	replyTopicRetention = "3600000" // 回复主题的保留时间，1小时；回复只对等待中的请求有意义
+)
+
+var (
+	// ErrTimeout 超时前没有收到回复
+	ErrTimeout = errors.New("等待回复超时")
+	// ErrClosed 请求方已关闭
+	ErrClosed = errors.New("请求方已关闭")
+)
+
+// RemoteError 回复方处理请求失败，错误信息来自回复的 reply-error 消息头
+type RemoteError struct {
+	CorrelationID string // 请求的关联ID
+	Message       string // 回复方返回的错误信息
+}
+
+// Error 实现 error 接口
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("回复方处理失败: correlation_id=%s, error=%s", e.CorrelationID, e.Message)
+}
+
+// Requester 请求-回复的请求方
+// 请求写入请求主题，消息头中带有关联ID和当前实例的回复主题；请求方从最新位置读取自己的回复主题，
+// 按关联ID把回复交给等待中的请求。超时后才到达的回复会被丢弃
+type Requester struct {
+	producer     sarama.SyncProducer        // 发送请求的生产者
+	consumer     sarama.Consumer            // 读取回复主题的消费者
+	partitions   []sarama.PartitionConsumer // 回复主题各分区的消费者
+	requestTopic string                     // 消息未指定主题时使用的请求主题
+	replyTopic   string                     // 当前实例的回复主题
+	timeout      time.Duration              // 上下文没有截止时间时的默认超时
+
+	mu      sync.Mutex                              // 保护pending
+	pending map[string]chan *sarama.ConsumerMessage // 等待回复的请求，键为关联ID
+	done    chan struct{}                           // 关闭时关闭，唤醒所有等待中的请求
+	wg      sync.WaitGroup                          // 等待分发协程退出
+
+	closeOnce sync.Once // 确保只关闭一次
+	closeErr  error     // Close的结果
+}
+
+// NewRequester 创建请求方
+// 回复主题不存在时自动创建，单分区并设置较短的保留时间
+// 参数:
+//   - cfg: Kafka配置，使用其中的 Reply 配置
+//
+// 返回:
+//   - *Requester: 请求方实例
+//   - error: 创建失败时返回错误
+func NewRequester(cfg *config.Config) (*Requester, error) {
+	replyTopic := cfg.Reply.ReplyTopic()
+	log.Printf("%s正在创建请求方: request_topic=%s, reply_topic=%s", logPrefix, cfg.Reply.RequestTopic, replyTopic)
+
+	saramaConfig, err := cfg.ReplySaramaConfig()
+	if err != nil {
+		return nil, fmt.Errorf("请求-回复配置不合法: %w", err)
+	}
+	if err := ensureReplyTopic(cfg.Brokers, saramaConfig, replyTopic, cfg.Reply.ReplicationFactor); err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建生产者失败: %v", logPrefix, err)
+		return nil, fmt.Errorf("创建生产者失败: %w", err)
+	}
+	consumer, err := sarama.NewConsumer(cfg.Brokers, saramaConfig)
+	if err != nil {
+		log.Printf("%s创建消费者失败: %v", logPrefix, err)
+		_ = producer.Close()
+		return nil, fmt.Errorf("创建消费者失败: %w", err)
+	}
+
+	r, err := newRequester(producer, consumer, cfg.Reply)
+	if err != nil {
+		_ = consumer.Close()
+		_ = producer.Close()
+		return nil, err
+	}
+	log.Printf("%s请求方创建成功", logPrefix)
+	return r, nil
+}
+
+// ensureReplyTopic 创建回复主题，主题已存在时直接返回
+func ensureReplyTopic(brokers []string, saramaConfig *sarama.Config, topic string, replicationFactor int16) error {
+	admin, err := sarama.NewClusterAdmin(brokers, saramaConfig)
+	if err != nil {
+		return fmt.Errorf("创建集群管理客户端失败: %w", err)
+	}
+	defer admin.Close()
+
+	retention := replyTopicRetention
+	err = admin.CreateTopic(topic, &sarama.TopicDetail{
+		NumPartitions:     1,
+		ReplicationFactor: replicationFactor,
+		ConfigEntries:     map[string]*string{"retention.ms": &retention},
+	}, false)
+	if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return fmt.Errorf("创建回复主题 %s 失败: %w", topic, err)
+	}
+	return nil
+}
+
+// newRequester 使用已创建的生产者和消费者组装请求方，并从最新位置开始读取回复主题的所有分区
+// 返回前已确定各分区的起始偏移量，之后发出的请求的回复都能读到
+func newRequester(producer sarama.SyncProducer, consumer sarama.Consumer, cfg config.ReplyConfig) (*Requester, error) {
+	replyTopic := cfg.ReplyTopic()
+	partitions, err := consumer.Partitions(replyTopic)
+	if err != nil {
+		return nil, fmt.Errorf("获取回复主题 %s 的分区失败: %w", replyTopic, err)
+	}
+
+	r := &Requester{
+		producer:     producer,
+		consumer:     consumer,
+		requestTopic: cfg.RequestTopic,
+		replyTopic:   replyTopic,
+		timeout:      cfg.Timeout,
+		pending:      make(map[string]chan *sarama.ConsumerMessage),
+		done:         make(chan struct{}),
+	}
+	for _, partition := range partitions {
+		pc, err := consumer.ConsumePartition(replyTopic, partition, sarama.OffsetNewest)
+		if err != nil {
+			for _, started := range r.partitions {
+				_ = started.Close()
+			}
+			r.wg.Wait()
+			return nil, fmt.Errorf("消费回复主题分区 %s/%d 失败: %w", replyTopic, partition, err)
+		}
+		r.partitions = append(r.partitions, pc)
+		r.wg.Add(1)
+		go r.dispatchLoop(pc)
+	}
+	return r, nil
+}
+
+// ReplyTopic 返回当前实例的回复主题
+func (r *Requester) ReplyTopic() string {
+	return r.replyTopic
+}
+
+// Request 发送请求并等待回复
+// 消息头中的 correlation-id 和 reply-to 会被覆盖；上下文没有截止时间时使用配置的默认超时
+// 参数:
+//   - ctx: 用于控制等待时间的上下文
+//   - msg: 请求消息，Topic 为空时发送到配置的请求主题
+//
+// 返回:
+//   - *sarama.ConsumerMessage: 回复消息
+//   - error: 发送失败、超时（ErrTimeout）、回复方处理失败（*RemoteError）或请求方已关闭（ErrClosed）时返回错误
+func (r *Requester) Request(ctx context.Context, msg *sarama.ProducerMessage) (*sarama.ConsumerMessage, error) {
+	if msg.Topic == "" {
+		msg.Topic = r.requestTopic
+	}
+	id, err := newCorrelationID()
+	if err != nil {
+		return nil, err
+	}
+	setHeader(msg, HeaderCorrelationID, id)
+	setHeader(msg, HeaderReplyTo, r.replyTopic)
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	// 先登记再发送，避免回复早于登记到达
+	ch := make(chan *sarama.ConsumerMessage, 1)
+	r.mu.Lock()
+	select {
+	case <-r.done:
+		r.mu.Unlock()
+		return nil, ErrClosed
+	default:
+	}
+	r.pending[id] = ch
+	r.mu.Unlock()
+	defer r.forget(id)
+
+	partition, offset, err := r.producer.SendMessage(msg)
+	if err != nil {
+		log.Printf("%s发送请求失败: topic=%s, correlation_id=%s, error=%v", logPrefix, msg.Topic, id, err)
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	log.Printf("%s请求已发送，等待回复: %s/%d/%d, correlation_id=%s", logPrefix, msg.Topic, partition, offset, id)
+
+	select {
+	case reply := <-ch:
+		if e := header(reply.Headers, HeaderError); e != "" {
+			return nil, &RemoteError{CorrelationID: id, Message: e}
+		}
+		return reply, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("%s等待回复超时: correlation_id=%s", logPrefix, id)
+			return nil, fmt.Errorf("%w: correlation_id=%s", ErrTimeout, id)
+		}
+		return nil, ctx.Err()
+	case <-r.done:
+		return nil, ErrClosed
+	}
+}
+
+// forget 移除等待中的请求
+func (r *Requester) forget(id string) {
+	r.mu.Lock()
+	delete(r.pending, id)
+	r.mu.Unlock()
+}
+
+// dispatchLoop 读取回复主题分区中的回复并交给等待中的请求，直到分区消费者关闭
+func (r *Requester) dispatchLoop(pc sarama.PartitionConsumer) {
+	defer r.wg.Done()
+	for msg := range pc.Messages() {
+		r.dispatch(msg)
+	}
+}
+
+// dispatch 按关联ID把回复交给等待中的请求
+// 找不到对应请求时（已超时、重复回复或其他实例的历史消息）丢弃
+func (r *Requester) dispatch(msg *sarama.ConsumerMessage) {
+	id := header(msg.Headers, HeaderCorrelationID)
+	r.mu.Lock()
+	ch, ok := r.pending[id]
+	delete(r.pending, id)
+	r.mu.Unlock()
+	if !ok {
+		log.Printf("%s没有等待中的请求，丢弃回复: %s/%d/%d, correlation_id=%s",
+			logPrefix, msg.Topic, msg.Partition, msg.Offset, id)
+		return
+	}
+	// 通道有一个缓冲且每个关联ID只投递一次，不会阻塞
+	ch <- msg
+}
+
+// Close 关闭请求方
+// 等待中的请求立即返回 ErrClosed，随后关闭消费者和生产者
+func (r *Requester) Close() error {
+	r.closeOnce.Do(func() {
+		log.Printf("%s正在关闭请求方...", logPrefix)
+		r.mu.Lock()
+		close(r.done)
+		r.mu.Unlock()
+
+		var errs []error
+		for _, pc := range r.partitions {
+			if err := pc.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("关闭分区消费者失败: %w", err))
+			}
+		}
+		r.wg.Wait()
+		if err := r.consumer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("关闭消费者失败: %w", err))
+		}
+		if err := r.producer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("关闭生产者失败: %w", err))
+		}
+		r.closeErr = errors.Join(errs...)
+
+		if r.closeErr != nil {
+			log.Printf("%s关闭请求方失败: %v", logPrefix, r.closeErr)
+		} else {
+			log.Printf("%s请求方已关闭", logPrefix)
+		}
+	})
+	return r.closeErr
+}
+
+// CorrelationID 返回消息的关联ID，不是请求或回复时返回空字符串
+func CorrelationID(msg *sarama.ConsumerMessage) string {
+	return header(msg.Headers, HeaderCorrelationID)
+}
+
+// newCorrelationID 生成随机的关联ID
+func newCorrelationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成关联ID失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// setHeader 设置生产者消息的消息头，已存在时覆盖
+func setHeader(msg *sarama.ProducerMessage, key, value string) {
+	for i, h := range msg.Headers {
+		if string(h.Key) == key {
+			msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// header 返回消费者消息中指定消息头的值
+func header(headers []*sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package reply
+
+import (
+	"context"
+	"fmt"
+	"kafka-example/producer"
+	"kafka-example/tracing"
+	"log"
+
+	"github.com/IBM/sarama"
+)
+
+// HandlerFunc 处理请求并返回回复内容
+type HandlerFunc func(ctx context.Context, msg *sarama.ConsumerMessage) ([]byte, error)
+
+// Responder 请求-回复的回复方，实现 consumer.Handler 接口
+// 处理请求后把结果发送到请求的 reply-to 主题，并带回请求的 correlation-id。
+// 处理失败时把错误信息作为回复返回给请求方，不再重试：请求方正在等待，重试很可能超过它的超时时间；
+// 只有回复发送失败时才返回错误，由消费者的重试中间件重新处理
+type Responder struct {
+	sender producer.Sender
+	handle HandlerFunc
+}
+
+// NewResponder 创建回复方
+// 参数:
+//   - sender: 发送回复的生产者，如 *producer.SyncProducerService
+//   - handle: 请求处理函数
+//
+// 返回:
+//   - *Responder: 回复方，可通过 consumer.WithHandler 接入消费者服务
+func NewResponder(sender producer.Sender, handle HandlerFunc) *Responder {
+	return &Responder{sender: sender, handle: handle}
+}
+
+// Handle 处理一条请求并发送回复
+// 缺少 reply-to 或 correlation-id 的消息不是请求，记录日志后跳过
+func (r *Responder) Handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	replyTo := header(msg.Headers, HeaderReplyTo)
+	id := header(msg.Headers, HeaderCorrelationID)
+	if replyTo == "" || id == "" {
+		log.Printf("%s消息缺少 reply-to 或 correlation-id，跳过: %s/%d/%d", logPrefix, msg.Topic, msg.Partition, msg.Offset)
+		return nil
+	}
+
+	reply := &sarama.ProducerMessage{
+		Topic:   replyTo,
+		Headers: []sarama.RecordHeader{{Key: []byte(HeaderCorrelationID), Value: []byte(id)}},
+	}
+	value, err := r.handle(ctx, msg)
+	if err != nil {
+		// 消费者正在停止时不回复，消息重新投递后再处理
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("%s处理请求失败，回复错误: correlation_id=%s, error=%v", logPrefix, id, err)
+		message := err.Error()
+		if message == "" {
+			message = "未知错误"
+		}
+		reply.Headers = append(reply.Headers, sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(message)})
+	} else {
+		reply.Value = sarama.ByteEncoder(value)
+	}
+	tracing.Inject(ctx, reply)
+
+	result, err := r.sender.Send(reply).Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("等待回复发送结果失败: %w", err)
+	}
+	if result.Err != nil {
+		return fmt.Errorf("发送回复失败: correlation_id=%s: %w", id, result.Err)
+	}
+	log.Printf("%s回复已发送: %s/%d/%d, correlation_id=%s", logPrefix, result.Topic, result.Partition, result.Offset, id)
+	return nil
+}
@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+// 追踪信息使用的消息头，与HTTP请求头同名
+const (
+	HeaderTraceParent = "traceparent"  // W3C Trace Context 的 traceparent
+	HeaderTraceState  = "tracestate"   // W3C Trace Context 的 tracestate
+	HeaderRequestID   = "x-request-id" // 请求ID
+)
+
+// Context 跨越HTTP和Kafka边界传递的追踪信息
+type Context struct {
+	TraceParent string // 格式为 00-{trace-id}-{parent-id}-{flags}
+	TraceState  string // 厂商自定义的追踪状态，原样传递
+	RequestID   string // 请求ID
+}
+
+// contextKey 在 context.Context 中保存追踪信息的键
+type contextKey struct{}
+
+// New 创建新的追踪链路和请求ID
+func New() Context {
+	return Context{
+		TraceParent: fmt.Sprintf("00-%s-%s-01", randomHex(16), randomHex(8)),
+		RequestID:   randomHex(16),
+	}
+}
+
+// FromHTTP 从HTTP请求头中提取追踪信息
+// traceparent 合法时延续调用方的链路并生成新的span ID，否则创建新的链路；没有请求ID时生成一个
+func FromHTTP(header http.Header) Context {
+	tc := New()
+	if parent := header.Get(HeaderTraceParent); validTraceParent(parent) {
+		tc = Context{
+			TraceParent: parent,
+			TraceState:  header.Get(HeaderTraceState),
+			RequestID:   tc.RequestID,
+		}.Child()
+	}
+	if id := header.Get(HeaderRequestID); id != "" {
+		tc.RequestID = id
+	}
+	return tc
+}
+
+// Child 返回同一链路下的子span，traceparent 不合法时原样返回
+func (c Context) Child() Context {
+	if !validTraceParent(c.TraceParent) {
+		return c
+	}
+	parts := strings.Split(c.TraceParent, "-")
+	parts[2] = randomHex(8)
+	c.TraceParent = strings.Join(parts, "-")
+	return c
+}
+
+// TraceID 返回 traceparent 中的 trace-id，traceparent 不合法时返回空字符串
+func (c Context) TraceID() string {
+	if !validTraceParent(c.TraceParent) {
+		return ""
+	}
+	return strings.Split(c.TraceParent, "-")[1]
+}
+
+// IsZero 判断是否没有任何追踪信息
+func (c Context) IsZero() bool {
+	return c.TraceParent == "" && c.TraceState == "" && c.RequestID == ""
+}
+
+// String 返回用于日志的键值对
+func (c Context) String() string {
+	return fmt.Sprintf("request_id=%s trace_id=%s", c.RequestID, c.TraceID())
+}
+
+// NewContext 返回携带追踪信息的上下文
+func NewContext(ctx context.Context, tc Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, tc)
+}
+
+// FromContext 从上下文中取出追踪信息，没有时返回零值
+func FromContext(ctx context.Context) Context {
+	if ctx == nil {
+		return Context{}
+	}
+	tc, _ := ctx.Value(contextKey{}).(Context)
+	return tc
+}
+
+// Inject 将上下文中的追踪信息写入生产者消息头
+// 消息中已有的同名消息头保持不变，上下文中没有追踪信息时不做任何修改
+func Inject(ctx context.Context, msg *sarama.ProducerMessage) {
+	tc := FromContext(ctx)
+	for _, h := range [...]struct{ key, value string }{
+		{HeaderTraceParent, tc.TraceParent},
+		{HeaderTraceState, tc.TraceState},
+		{HeaderRequestID, tc.RequestID},
+	} {
+		if h.value == "" || hasHeader(msg.Headers, h.key) {
+			continue
+		}
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(h.key), Value: []byte(h.value)})
+	}
+}
+
+// Extract 从消费者消息头中提取追踪信息
+func Extract(headers []*sarama.RecordHeader) Context {
+	var tc Context
+	for _, h := range headers {
+		if h == nil {
+			continue
+		}
+		switch strings.ToLower(string(h.Key)) {
+		case HeaderTraceParent:
+			tc.TraceParent = string(h.Value)
+		case HeaderTraceState:
+			tc.TraceState = string(h.Value)
+		case HeaderRequestID:
+			tc.RequestID = string(h.Value)
+		}
+	}
+	return tc
+}
+
+// hasHeader 判断消息头中是否已有同名消息头，忽略大小写
+func hasHeader(headers []sarama.RecordHeader, key string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(string(h.Key), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// validTraceParent 校验 traceparent 格式：版本、trace-id、parent-id 和 flags 均为小写十六进制，
+// trace-id 和 parent-id 不能全为0，版本 ff 不合法
+func validTraceParent(s string) bool {
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 {
+		return false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return false
+	}
+	return isHex(traceID, 32) && traceID != strings.Repeat("0", 32) &&
+		isHex(parentID, 16) && parentID != strings.Repeat("0", 16) &&
+		isHex(flags, 2)
+}
+
+// isHex 判断字符串是否为指定长度的小写十六进制
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex 生成 n 字节的随机十六进制字符串
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// TestFromHTTP 测试延续调用方的链路，或在没有合法 traceparent 时创建新链路
+func TestFromHTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        map[string]string
+		wantTraceID   string // 为空时只检查生成了新的trace-id
+		wantState     string
+		wantRequestID string // 为空时只检查生成了请求ID
+	}{
+		{
+			name: "延续调用方的链路",
+			header: map[string]string{
+				"Traceparent":  testTraceParent,
+				"Tracestate":   "vendor=value",
+				"X-Request-Id": "req-1",
+			},
+			wantTraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantState:     "vendor=value",
+			wantRequestID: "req-1",
+		},
+		{
+			name: "traceparent不合法时创建新链路并丢弃tracestate",
+			header: map[string]string{
+				"Traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+				"Tracestate":  "vendor=value",
+			},
+		},
+		{
+			name:   "没有追踪信息",
+			header: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			tc := FromHTTP(header)
+
+			if !validTraceParent(tc.TraceParent) {
+				t.Fatalf("traceparent = %q 不合法", tc.TraceParent)
+			}
+			if tc.TraceParent == tt.header["Traceparent"] {
+				t.Errorf("traceparent 应生成新的span ID")
+			}
+			if tt.wantTraceID != "" && tc.TraceID() != tt.wantTraceID {
+				t.Errorf("TraceID() = %q, 期望 %q", tc.TraceID(), tt.wantTraceID)
+			}
+			if tc.TraceState != tt.wantState {
+				t.Errorf("TraceState = %q, 期望 %q", tc.TraceState, tt.wantState)
+			}
+			if tc.RequestID == "" || (tt.wantRequestID != "" && tc.RequestID != tt.wantRequestID) {
+				t.Errorf("RequestID = %q, 期望 %q", tc.RequestID, tt.wantRequestID)
+			}
+		})
+	}
+}
+
+// TestInjectExtract 测试追踪信息写入生产者消息头后可以从消费者消息头中还原
+func TestInjectExtract(t *testing.T) {
+	want := Context{TraceParent: testTraceParent, TraceState: "vendor=value", RequestID: "req-1"}
+	msg := &sarama.ProducerMessage{
+		Headers: []sarama.RecordHeader{{Key: []byte("X-Request-ID"), Value: []byte("explicit")}},
+	}
+	Inject(NewContext(context.Background(), want), msg)
+
+	// 已有的同名消息头保持不变
+	if len(msg.Headers) != 3 {
+		t.Fatalf("消息头数量 = %d, 期望 3", len(msg.Headers))
+	}
+	headers := make([]*sarama.RecordHeader, len(msg.Headers))
+	for i := range msg.Headers {
+		headers[i] = &msg.Headers[i]
+	}
+	got := Extract(headers)
+	if got.TraceParent != want.TraceParent || got.TraceState != want.TraceState || got.RequestID != "explicit" {
+		t.Errorf("Extract() = %+v, 期望 traceparent、tracestate 一致且请求ID为 explicit", got)
+	}
+
+	// 上下文中没有追踪信息时不修改消息
+	empty := &sarama.ProducerMessage{}
+	Inject(context.Background(), empty)
+	if len(empty.Headers) != 0 {
+		t.Errorf("没有追踪信息时不应写入消息头: %v", empty.Headers)
+	}
+}
+
+// TestValidTraceParent 测试 traceparent 格式校验
+func TestValidTraceParent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "合法", value: testTraceParent, want: true},
+		{name: "未来版本允许附加字段", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", want: true},
+		{name: "版本00不允许附加字段", value: testTraceParent + "-extra", want: false},
+		{name: "版本ff", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: false},
+		{name: "大写十六进制", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", want: false},
+		{name: "parent-id全为0", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", want: false},
+		{name: "空字符串", value: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validTraceParent(tt.value); got != tt.want {
+				t.Errorf("validTraceParent(%q) = %v, 期望 %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}